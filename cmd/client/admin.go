@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
+	kvpb "github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+func adminUsage() {
+	fmt.Println("Admin commands (need an admin token):")
+	fmt.Println("  kvstore admin info")
+	fmt.Println("  kvstore admin snapshot")
+	fmt.Println("  kvstore admin rewrite-aof")
+	fmt.Println("  kvstore admin flush <prefix>")
+	fmt.Println("  kvstore admin flush --all")
+	fmt.Println("  kvstore admin read-only on|off")
+	fmt.Println("  kvstore admin reload")
+	fmt.Println("  kvstore admin replication")
+	fmt.Println("  kvstore admin consistency [<host:port>...]")
+	fmt.Println("  kvstore admin repair [<site-id>]")
+	fmt.Println("  kvstore admin changefeed [<from-lsn>|now]")
+	fmt.Println("  kvstore admin cluster status")
+	fmt.Println("  kvstore admin cluster add <id> <host:port>")
+	fmt.Println("  kvstore admin cluster remove <id>")
+	fmt.Println("  kvstore admin topology [<key>]")
+	fmt.Println("  kvstore admin shard add <id> <host:port>")
+	fmt.Println("  kvstore admin shard migrate <target-id> [<token>...]")
+	fmt.Println("  kvstore admin shard status")
+	fmt.Println("  kvstore admin shard abort")
+}
+
+func runAdmin(ctx context.Context, conn *grpc.ClientConn, dial func(string) (*grpc.ClientConn, error), args []string) int {
+	if len(args) == 0 {
+		adminUsage()
+		return 1
+	}
+	client := kvpb.NewAdminClient(conn)
+
+	switch args[0] {
+	case "info":
+		resp, err := client.Info(ctx, &kvpb.InfoRequest{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "info error:", err)
+			return 1
+		}
+		fmt.Printf("uptime:            %s\n", time.Duration(resp.UptimeSeconds)*time.Second)
+		fmt.Printf("keys:              %d (%d with ttl)\n", resp.Keys, resp.KeysWithExpiry)
+		fmt.Printf("data size:         %d bytes\n", resp.DataBytes)
+		if resp.MaxMemoryBytes > 0 {
+			fmt.Printf("memory limit:      %d bytes\n", resp.MaxMemoryBytes)
+		}
+		fmt.Printf("expired keys:      %d\n", resp.ExpiredKeys)
+		fmt.Printf("evicted keys:      %d\n", resp.EvictedKeys)
+		fmt.Printf("memory:            %d bytes from OS, %d bytes heap\n", resp.MemorySysBytes, resp.MemoryHeapAllocBytes)
+		fmt.Printf("read-only:         %t\n", resp.ReadOnly)
+		fmt.Printf("aof:               %s (%d bytes)\n", resp.AofPath, resp.AofSizeBytes)
+		fmt.Printf("last aof rewrite:  %s\n", formatUnix(resp.LastAofRewriteUnix))
+		fmt.Printf("snapshot dir:      %s\n", resp.SnapshotDir)
+		fmt.Printf("last snapshot:     %s\n", formatUnix(resp.LastSnapshotUnix))
+		if resp.LastSnapshotError != "" {
+			fmt.Printf("snapshot error:    %s\n", resp.LastSnapshotError)
+		}
+
+	case "snapshot":
+		if _, err := client.Snapshot(ctx, &kvpb.SnapshotRequest{}); err != nil {
+			fmt.Fprintln(os.Stderr, "snapshot error:", err)
+			return 1
+		}
+		fmt.Println("OK")
+
+	case "rewrite-aof":
+		resp, err := client.RewriteAOF(ctx, &kvpb.RewriteAOFRequest{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rewrite-aof error:", err)
+			return 1
+		}
+		fmt.Printf("OK, %d records\n", resp.Records)
+
+	case "flush":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "flush requires <prefix> or --all")
+			adminUsage()
+			return 1
+		}
+		req := &kvpb.FlushRequest{Prefix: args[1]}
+		if args[1] == "--all" {
+			req = &kvpb.FlushRequest{All: true}
+		}
+		resp, err := client.Flush(ctx, req)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "flush error:", err)
+			return 1
+		}
+		fmt.Printf("OK, %d keys deleted\n", resp.Deleted)
+
+	case "read-only":
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			fmt.Fprintln(os.Stderr, "read-only requires on or off")
+			adminUsage()
+			return 1
+		}
+		if _, err := client.SetReadOnly(ctx, &kvpb.SetReadOnlyRequest{ReadOnly: args[1] == "on"}); err != nil {
+			fmt.Fprintln(os.Stderr, "read-only error:", err)
+			return 1
+		}
+		fmt.Println("OK")
+
+	case "reload":
+		resp, err := client.ReloadConfig(ctx, &kvpb.ReloadConfigRequest{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reload error:", err)
+			return 1
+		}
+		fmt.Println("OK")
+		if len(resp.Applied) > 0 {
+			fmt.Println("applied:", strings.Join(resp.Applied, ", "))
+		}
+		if len(resp.RestartRequired) > 0 {
+			fmt.Println("restart required:", strings.Join(resp.RestartRequired, ", "))
+		}
+
+	case "replication":
+		resp, err := kvpb.NewReplicationClient(conn).Status(ctx, &kvpb.ReplicationStatusRequest{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "replication error:", err)
+			return 1
+		}
+		fmt.Printf("role:              %s\n", resp.Role)
+		fmt.Printf("offset:            %d\n", resp.Offset)
+		if resp.Role == "replica" {
+			fmt.Printf("primary:           %s\n", resp.PrimaryAddr)
+			fmt.Printf("connected:         %t\n", resp.Connected)
+			fmt.Printf("lag:               %d writes, %.1fs\n", resp.LagEntries, resp.LagSeconds)
+			fmt.Printf("keys repaired:     %d\n", resp.KeysRepaired)
+		}
+		if resp.OriginId != "" {
+			fmt.Printf("site:              %s\n", resp.OriginId)
+		}
+		for _, p := range resp.Peers {
+			fmt.Printf("peer:              %s (%s) connected %t, %d writes received, %d applied, %d keys repaired, lag %.1fs\n",
+				p.Id, p.Addr, p.Connected, p.WritesReceived, p.WritesApplied, p.KeysRepaired, p.LagSeconds)
+		}
+		for _, r := range resp.Replicas {
+			fmt.Printf("replica:           %s (%s) at offset %d, connected since %s\n", r.Id, r.Addr, r.Offset, formatUnix(r.ConnectedSinceUnix))
+		}
+
+	case "consistency":
+		return runConsistency(ctx, conn, dial, args[1:])
+
+	case "repair":
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, "repair takes at most a <site-id>")
+			adminUsage()
+			return 1
+		}
+		req := &kvpb.RepairRequest{}
+		if len(args) == 2 {
+			req.SiteId = args[1]
+		}
+		resp, err := kvpb.NewReplicationClient(conn).Repair(ctx, req)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "repair error:", err)
+			return 1
+		}
+		failed := false
+		for _, r := range resp.Results {
+			if r.Error != "" {
+				fmt.Printf("%s: failed after %d keys fixed: %s\n", r.Source, r.KeysFixed, r.Error)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: %d ranges differed, %d keys fixed\n", r.Source, r.Ranges, r.KeysFixed)
+		}
+		if failed {
+			return 1
+		}
+
+	case "changefeed":
+		return runChangeFeed(ctx, kvpb.NewChangesClient(conn), args[1:])
+
+	case "cluster":
+		return runCluster(ctx, kvpb.NewRaftClient(conn), args[1:])
+
+	case "topology":
+		return runTopology(ctx, kvpb.NewShardingClient(conn), args[1:])
+
+	case "shard":
+		return runShard(ctx, kvpb.NewShardingClient(conn), args[1:])
+
+	default:
+		fmt.Fprintln(os.Stderr, "unknown admin command:", args[0])
+		adminUsage()
+		return 1
+	}
+	return 0
+}
+
+func runCluster(ctx context.Context, client kvpb.RaftClient, args []string) int {
+	var (
+		resp *kvpb.MembershipResponse
+		err  error
+	)
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		status, err := client.ClusterStatus(ctx, &kvpb.ClusterStatusRequest{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cluster error:", err)
+			return 1
+		}
+		fmt.Printf("id:                %s\n", status.Id)
+		fmt.Printf("state:             %s\n", status.State)
+		fmt.Printf("term:              %d\n", status.Term)
+		if status.LeaderId != "" {
+			fmt.Printf("leader:            %s (%s)\n", status.LeaderId, status.LeaderAddr)
+		} else {
+			fmt.Printf("leader:            unknown\n")
+		}
+		fmt.Printf("log:               last %d, committed %d, applied %d, snapshot %d\n",
+			status.LastIndex, status.CommitIndex, status.AppliedIndex, status.SnapshotIndex)
+		printMembers(status.Members)
+		return 0
+	case len(args) == 3 && args[0] == "add":
+		resp, err = client.AddMember(ctx, &kvpb.AddMemberRequest{Id: args[1], Addr: args[2]})
+	case len(args) == 2 && args[0] == "remove":
+		resp, err = client.RemoveMember(ctx, &kvpb.RemoveMemberRequest{Id: args[1]})
+	default:
+		fmt.Fprintln(os.Stderr, "cluster requires status, add <id> <host:port> or remove <id>")
+		adminUsage()
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cluster error:", err)
+		return 1
+	}
+	fmt.Println("OK")
+	printMembers(resp.Members)
+	return 0
+}
+
+func runTopology(ctx context.Context, client kvpb.ShardingClient, args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "topology takes at most one <key>")
+		adminUsage()
+		return 1
+	}
+	resp, err := client.Topology(ctx, &kvpb.TopologyRequest{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "topology error:", err)
+		return 1
+	}
+	ring, err := sharding.RingFromProto(resp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "topology error:", err)
+		return 1
+	}
+	if len(args) == 1 {
+		owner := ring.Owner(args[0])
+		fmt.Printf("%s (%s)\n", owner.ID, owner.Addr)
+		return 0
+	}
+
+	tokens := make(map[string]int)
+	for _, t := range ring.Tokens() {
+		tokens[t.NodeID]++
+	}
+	fmt.Printf("epoch:             %d\n", ring.Epoch())
+	fmt.Printf("self:              %s\n", resp.SelfId)
+	for _, n := range ring.Nodes() {
+		fmt.Printf("shard:             %s (%s), %d tokens\n", n.ID, n.Addr, tokens[n.ID])
+	}
+	return 0
+}
+
+// Migrations run on the node that owns the tokens, so these commands must
+// be sent to it.
+func runShard(ctx context.Context, client kvpb.ShardingClient, args []string) int {
+	var (
+		resp *kvpb.MigrationStatus
+		err  error
+	)
+	switch {
+	case len(args) == 3 && args[0] == "add":
+		changed, err := client.AddNode(ctx, &kvpb.AddShardNodeRequest{Id: args[1], Addr: args[2]})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "shard error:", err)
+			return 1
+		}
+		fmt.Printf("OK, epoch %d\n", changed.Topology.Epoch)
+		for _, id := range changed.Unreachable {
+			fmt.Printf("unreachable:       %s\n", id)
+		}
+		return 0
+	case len(args) >= 2 && args[0] == "migrate":
+		req := &kvpb.StartMigrationRequest{TargetId: args[1]}
+		for _, arg := range args[2:] {
+			token, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "invalid token:", arg)
+				return 1
+			}
+			req.Tokens = append(req.Tokens, token)
+		}
+		resp, err = client.StartMigration(ctx, req)
+	case len(args) == 1 && args[0] == "status":
+		resp, err = client.GetMigration(ctx, &kvpb.GetMigrationRequest{})
+	case len(args) == 1 && args[0] == "abort":
+		resp, err = client.AbortMigration(ctx, &kvpb.AbortMigrationRequest{})
+	default:
+		fmt.Fprintln(os.Stderr, "shard requires add <id> <host:port>, migrate <target-id> [<token>...], status or abort")
+		adminUsage()
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "shard error:", err)
+		return 1
+	}
+	printMigration(resp)
+	return 0
+}
+
+// Prints changes as they happen until interrupted, one per line: LSN,
+// time, op, key and the new value, or the old one for removals.
+func runChangeFeed(ctx context.Context, client kvpb.ChangesClient, args []string) int {
+	req := &kvpb.ChangeFeedRequest{}
+	switch {
+	case len(args) > 1:
+		fmt.Fprintln(os.Stderr, "changefeed takes at most a <from-lsn>")
+		adminUsage()
+		return 1
+	case len(args) == 1 && args[0] == "now":
+		req.FromNow = true
+	case len(args) == 1:
+		from, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid LSN:", args[0])
+			return 1
+		}
+		req.FromLsn = from
+	}
+
+	// The stream runs until interrupted, so it doesn't have the timeout of
+	// other commands
+	ctx = untimed(ctx)
+	stream, err := client.ChangeFeed(ctx, req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "changefeed error:", err)
+		return 1
+	}
+	for {
+		event, err := stream.Recv()
+		if ctx.Err() != nil {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "changefeed error:", err)
+			return 1
+		}
+		value := event.New
+		if value == nil {
+			value = event.Old
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\n", event.Lsn, time.Unix(0, event.TimestampUnixNano).Format(time.RFC3339Nano), event.Op, event.Key, value.GetValue())
+	}
+}
+
+func printMigration(m *kvpb.MigrationStatus) {
+	fmt.Printf("state:             %s\n", m.State)
+	if m.State == "idle" {
+		return
+	}
+	fmt.Printf("target:            %s\n", m.TargetId)
+	fmt.Printf("tokens:            %d\n", len(m.Tokens))
+	fmt.Printf("keys copied:       %d\n", m.KeysCopied)
+	fmt.Printf("writes forwarded:  %d\n", m.WritesForwarded)
+	fmt.Printf("started:           %s\n", formatUnix(m.StartedUnix))
+	if m.FinishedUnix != 0 {
+		fmt.Printf("finished:          %s\n", formatUnix(m.FinishedUnix))
+	}
+	if m.Epoch != 0 {
+		fmt.Printf("epoch:             %d\n", m.Epoch)
+	}
+	if m.Error != "" {
+		fmt.Printf("error:             %s\n", m.Error)
+	}
+}
+
+func printMembers(members []*kvpb.RaftMember) {
+	for _, m := range members {
+		fmt.Printf("member:            %s (%s)\n", m.Id, m.Addr)
+	}
+}
+
+func formatUnix(seconds int64) string {
+	if seconds == 0 {
+		return "never"
+	}
+	return time.Unix(seconds, 0).Format(time.RFC3339)
+}
+
+// Buckets listed key by key when sites disagree, more would make the
+// output too long to read
+const maxListedBuckets = 16
+
+// Compares the digest of the connected site with those of the given sites,
+// or of its peers when none are given. Writes still on their way to a site
+// show up as differences too, so a mismatch is worth checking again.
+func runConsistency(ctx context.Context, conn *grpc.ClientConn, dial func(string) (*grpc.ClientConn, error), addrs []string) int {
+	client := kvpb.NewReplicationClient(conn)
+	if len(addrs) == 0 {
+		status, err := client.Status(ctx, &kvpb.ReplicationStatusRequest{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "consistency error:", err)
+			return 1
+		}
+		for _, p := range status.Peers {
+			addrs = append(addrs, p.Addr)
+		}
+		if len(addrs) == 0 {
+			fmt.Fprintln(os.Stderr, "consistency requires <host:port>..., the server has no peers")
+			return 1
+		}
+	}
+
+	local, err := client.Digest(ctx, &kvpb.DigestRequest{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "consistency error:", err)
+		return 1
+	}
+	consistent := true
+	for _, addr := range addrs {
+		other, err := dial(addr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "dial error:", err)
+			return 1
+		}
+		otherClient := kvpb.NewReplicationClient(other)
+		remote, err := otherClient.Digest(ctx, &kvpb.DigestRequest{})
+		if err != nil {
+			other.Close()
+			fmt.Fprintf(os.Stderr, "consistency error from %s: %v\n", addr, err)
+			return 1
+		}
+
+		if len(remote.Buckets) != len(local.Buckets) {
+			other.Close()
+			fmt.Fprintf(os.Stderr, "consistency error: %s sent %d buckets, expected %d\n", addr, len(remote.Buckets), len(local.Buckets))
+			return 1
+		}
+		var differing []uint32
+		for i, b := range local.Buckets {
+			r := remote.Buckets[i]
+			if b.Keys != r.Keys || b.Hash != r.Hash {
+				differing = append(differing, uint32(i))
+			}
+		}
+		fmt.Printf("%s (%s): %d keys, %d tombstones\n", addr, siteName(remote.OriginId), remote.Keys, remote.Tombstones)
+		if len(differing) == 0 {
+			fmt.Println("  consistent")
+			other.Close()
+			continue
+		}
+		consistent = false
+		fmt.Printf("  %d of %d buckets differ\n", len(differing), len(local.Buckets))
+		if len(differing) > maxListedBuckets {
+			differing = differing[:maxListedBuckets]
+		}
+		req := &kvpb.DigestRequest{ListBuckets: differing}
+		localKeys, err := client.Digest(ctx, req)
+		if err == nil {
+			var remoteKeys *kvpb.DigestResponse
+			if remoteKeys, err = otherClient.Digest(ctx, req); err == nil {
+				printKeyDifferences(localKeys.Listed, remoteKeys.Listed)
+			}
+		}
+		other.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "consistency error:", err)
+			return 1
+		}
+	}
+	if !consistent {
+		return 1
+	}
+	return 0
+}
+
+func printKeyDifferences(local, remote []*kvpb.KeyDigest) {
+	remoteByKey := make(map[string]*kvpb.KeyDigest, len(remote))
+	for _, k := range remote {
+		remoteByKey[k.Key] = k
+	}
+	for _, l := range local {
+		r, ok := remoteByKey[l.Key]
+		delete(remoteByKey, l.Key)
+		switch {
+		case !ok:
+			fmt.Printf("  %s: only here, written %s by %s\n", l.Key, hlc.Timestamp(l.Timestamp), siteName(l.Origin))
+		case l.Hash != r.Hash:
+			fmt.Printf("  %s: differs, written %s by %s here, %s by %s there\n", l.Key,
+				hlc.Timestamp(l.Timestamp), siteName(l.Origin), hlc.Timestamp(r.Timestamp), siteName(r.Origin))
+		}
+	}
+	for _, r := range remote {
+		if _, ok := remoteByKey[r.Key]; ok {
+			fmt.Printf("  %s: only there, written %s by %s\n", r.Key, hlc.Timestamp(r.Timestamp), siteName(r.Origin))
+		}
+	}
+}
+
+func siteName(origin string) string {
+	if origin == "" {
+		return "no site"
+	}
+	return origin
+}
@@ -2,66 +2,188 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-
-	kvpb "github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/client"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tlsconfig"
 )
 
 const defaultAddr = "localhost:50051"
 
+// Set while the shell runs, where the flags no longer apply
+var inShell bool
+
 func usage() {
 	fmt.Println("Usage:")
-	fmt.Println("  kvstore set <key> <value> <ttl>")
+	fmt.Println("  kvstore [flags] <command> [args...]")
+	fmt.Println("  kvstore [flags] shell [<script>|-]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  kvstore set <key> <value> <ttl> [nx|xx]")
 	fmt.Println("  kvstore get <key>")
 	fmt.Println("  kvstore delete <key>")
+	fmt.Println("  kvstore mget <key> [<key>...]")
+	fmt.Println("  kvstore mset <key> <value> <ttl> [<key> <value> <ttl>...]")
+	fmt.Println("  kvstore mdelete <key> [<key>...]")
+	fmt.Println("  kvstore expire <key> <seconds>")
+	fmt.Println("  kvstore expireat <key> <unix-seconds>")
+	fmt.Println("  kvstore persist <key>")
+	fmt.Println("  kvstore ttl <key>")
+	fmt.Println("  kvstore admin <command> (see kvstore admin)")
+	fmt.Println()
+	fmt.Println("Without a command, or with shell, commands are read one per line from the")
+	fmt.Println("terminal, a script or stdin, over one connection (type help in the shell).")
+	if inShell {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Flags:")
+	flag.PrintDefaults()
+}
+
+// Flag defaults come from the environment, so a shell can be set up once
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// TLS is on when any of its flags is set
+func tlsConfig(useTLS bool, opts tlsconfig.ClientOptions) (*tls.Config, error) {
+	if !useTLS && opts.CAFile == "" && opts.CertFile == "" && opts.KeyFile == "" {
+		return nil, nil
+	}
+	return tlsconfig.Client(opts)
+}
+
+// Duration flag defaults come from the environment too
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return d
 }
 
 func main() {
-	args := os.Args[1:]
-	if len(args) == 0 {
-		usage()
+	addr := flag.String("addr", envOr("KVSTORE_ADDR", defaultAddr), "server address, or a comma-separated list to fail over between (env KVSTORE_ADDR)")
+	useTLS := flag.Bool("tls", envOr("KVSTORE_TLS", "") != "", "connect with TLS using the system roots (env KVSTORE_TLS)")
+	var tlsOpts tlsconfig.ClientOptions
+	flag.StringVar(&tlsOpts.CAFile, "ca", envOr("KVSTORE_TLS_CA", ""), "CA bundle for verifying the server, implies -tls (env KVSTORE_TLS_CA)")
+	flag.StringVar(&tlsOpts.CertFile, "cert", envOr("KVSTORE_TLS_CERT", ""), "client certificate for mutual TLS (env KVSTORE_TLS_CERT)")
+	flag.StringVar(&tlsOpts.KeyFile, "key", envOr("KVSTORE_TLS_KEY", ""), "client private key for mutual TLS (env KVSTORE_TLS_KEY)")
+	flag.StringVar(&tlsOpts.ServerName, "server-name", envOr("KVSTORE_TLS_SERVER_NAME", ""), "name to verify the server certificate against (env KVSTORE_TLS_SERVER_NAME)")
+	token := flag.String("token", envOr("KVSTORE_TOKEN", ""), "authentication token sent with every request (env KVSTORE_TOKEN)")
+	timeout := flag.Duration("timeout", envDuration("KVSTORE_TIMEOUT", client.DefaultTimeout), "time each command may take (env KVSTORE_TIMEOUT)")
+	history := flag.String("history", envOr("KVSTORE_HISTORY", defaultHistoryFile()), "file the shell keeps its command history in, empty for none (env KVSTORE_HISTORY)")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	shell := len(args) == 0 || args[0] == "shell"
+	if *timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "timeout must be positive")
 		os.Exit(1)
 	}
 
-	addr := os.Getenv("KVSTORE_ADDR")
-	if addr == "" {
-		addr = defaultAddr
+	tlsConf, err := tlsConfig(*useTLS, tlsOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tls error:", err)
+		os.Exit(1)
 	}
 
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// Against a sharded server, keys go straight to the node that owns them.
+	// The shell runs admin commands too, which go to the node connected to.
+	c, err := client.New(context.Background(), client.Options{
+		Endpoints: strings.Split(*addr, ","),
+		Token:     *token,
+		TLS:       tlsConf,
+		Timeout:   *timeout,
+		Sharding:  shell || args[0] != "admin",
+	})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "dial error:", err)
+		fmt.Fprintln(os.Stderr, "connect error:", err)
 		os.Exit(1)
 	}
-	defer conn.Close()
 
-	client := kvpb.NewKVStoreClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	var code int
+	if shell {
+		code = runShell(c, *timeout, *history, args[min(len(args), 1):])
+	} else {
+		code = runCommand(context.Background(), c, *timeout, args)
+	}
+	c.Close()
+	os.Exit(code)
+}
+
+// Key under which a command's context keeps the one it got before its
+// timeout
+type untimedKey struct{}
+
+// Returns the context of a command without its timeout, for streams that
+// run until interrupted.
+func untimed(ctx context.Context) context.Context {
+	if parent, ok := ctx.Value(untimedKey{}).(context.Context); ok {
+		return parent
+	}
+	return context.WithoutCancel(ctx)
+}
+
+// Runs a command and returns its exit code: 1 on errors, 2 when the key
+// wasn't found or set.
+func runCommand(ctx context.Context, c *client.Client, timeout time.Duration, args []string) int {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, untimedKey{}, ctx), timeout)
 	defer cancel()
 
 	switch args[0] {
+	case "admin":
+		return runAdmin(ctx, c.Conn(), c.Dial, args[1:])
+
 	case "set":
-		if len(args) != 4 {
-			fmt.Fprintln(os.Stderr, "set requires <key> <value> <ttl>")
+		if len(args) != 4 && len(args) != 5 {
+			fmt.Fprintln(os.Stderr, "set requires <key> <value> <ttl> [nx|xx]")
 			usage()
-			os.Exit(1)
+			return 1
 		}
 		key, value, ttl := args[1], args[2], args[3]
 		ttlInt, err := strconv.ParseInt(ttl, 10, 64)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "invalid ttl:", err)
-			os.Exit(1)
+			return 1
+		}
+		opts := []client.SetOption{client.WithTTL(time.Duration(ttlInt) * time.Second)}
+		if len(args) == 5 {
+			switch strings.ToLower(args[4]) {
+			case "nx":
+				opts = append(opts, client.IfAbsent())
+			case "xx":
+				opts = append(opts, client.IfPresent())
+			default:
+				fmt.Fprintln(os.Stderr, "invalid condition:", args[4])
+				return 1
+			}
+		}
+		err = c.Set(ctx, key, []byte(value), opts...)
+		if errors.Is(err, client.ErrNotSet) {
+			fmt.Println("(not set)")
+			return 2
 		}
-		_, err = client.Set(ctx, &kvpb.SetRequest{Key: key, Value: value, TtlSeconds: ttlInt})
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "set error:", err)
-			os.Exit(1)
+			return 1
 		}
 		fmt.Println("OK")
 
@@ -69,37 +191,185 @@ func main() {
 		if len(args) != 2 {
 			fmt.Fprintln(os.Stderr, "get requires <key>")
 			usage()
-			os.Exit(1)
+			return 1
 		}
 		key := args[1]
-		resp, err := client.Get(ctx, &kvpb.GetRequest{Key: key})
+		value, err := c.Get(ctx, key)
+		if errors.Is(err, client.ErrNotFound) {
+			fmt.Println("(not found)")
+			return 2
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "get error:", err)
-			os.Exit(1)
-		}
-		if !resp.Found {
-			fmt.Println("(not found)")
-			os.Exit(2)
+			return 1
 		}
-		fmt.Println(resp.Value)
+		fmt.Println(string(value))
 
 	case "delete":
 		if len(args) != 2 {
 			fmt.Fprintln(os.Stderr, "delete requires <key>")
 			usage()
-			os.Exit(1)
+			return 1
 		}
 		key := args[1]
-		_, err := client.Delete(ctx, &kvpb.DeleteRequest{Key: key})
-		if err != nil {
+		if err := c.Delete(ctx, key); err != nil {
 			fmt.Fprintln(os.Stderr, "delete error:", err)
-			os.Exit(1)
+			return 1
 		}
 		fmt.Println("OK")
 
+	case "mget":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "mget requires at least one <key>")
+			usage()
+			return 1
+		}
+		values, err := c.MGet(ctx, args[1:]...)
+		keyErrs, err := batchErrors(err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "mget error:", err)
+			return 1
+		}
+		for _, key := range args[1:] {
+			value, found := values[key]
+			switch {
+			case keyErrs[key] != nil:
+				fmt.Printf("%s: (error: %v)\n", key, keyErrs[key])
+			case !found:
+				fmt.Printf("%s: (not found)\n", key)
+			default:
+				fmt.Printf("%s: %s\n", key, value)
+			}
+		}
+
+	case "mset":
+		if len(args) < 4 || (len(args)-1)%3 != 0 {
+			fmt.Fprintln(os.Stderr, "mset requires <key> <value> <ttl> triples")
+			usage()
+			return 1
+		}
+		var entries []client.Entry
+		for i := 1; i < len(args); i += 3 {
+			ttlInt, err := strconv.ParseInt(args[i+2], 10, 64)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "invalid ttl:", err)
+				return 1
+			}
+			entries = append(entries, client.Entry{Key: args[i], Value: []byte(args[i+1]), TTL: time.Duration(ttlInt) * time.Second})
+		}
+		keyErrs, err := batchErrors(c.MSet(ctx, entries...))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "mset error:", err)
+			return 1
+		}
+		for _, entry := range entries {
+			if keyErrs[entry.Key] != nil {
+				fmt.Printf("%s: (error: %v)\n", entry.Key, keyErrs[entry.Key])
+			} else {
+				fmt.Printf("%s: OK\n", entry.Key)
+			}
+		}
+
+	case "mdelete":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "mdelete requires at least one <key>")
+			usage()
+			return 1
+		}
+		deleted, err := c.MDelete(ctx, args[1:]...)
+		keyErrs, err := batchErrors(err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "mdelete error:", err)
+			return 1
+		}
+		for _, key := range args[1:] {
+			switch {
+			case keyErrs[key] != nil:
+				fmt.Printf("%s: (error: %v)\n", key, keyErrs[key])
+			case !deleted[key]:
+				fmt.Printf("%s: (not found)\n", key)
+			default:
+				fmt.Printf("%s: deleted\n", key)
+			}
+		}
+
+	case "expire", "expireat":
+		if len(args) != 3 {
+			fmt.Fprintf(os.Stderr, "%s requires <key> <seconds>\n", args[0])
+			usage()
+			return 1
+		}
+		seconds, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid seconds:", err)
+			return 1
+		}
+		if args[0] == "expire" {
+			err = c.Expire(ctx, args[1], time.Duration(seconds)*time.Second)
+		} else {
+			err = c.ExpireAt(ctx, args[1], time.Unix(seconds, 0))
+		}
+		if errors.Is(err, client.ErrNotFound) {
+			fmt.Println("(not found)")
+			return 2
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", args[0], err)
+			return 1
+		}
+		fmt.Println("OK")
+
+	case "persist":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "persist requires <key>")
+			usage()
+			return 1
+		}
+		updated, err := c.Persist(ctx, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "persist error:", err)
+			return 1
+		}
+		if !updated {
+			fmt.Println("(not found or no ttl)")
+			return 2
+		}
+		fmt.Println("OK")
+
+	case "ttl":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "ttl requires <key>")
+			usage()
+			return 1
+		}
+		ttl, err := c.TTL(ctx, args[1])
+		if errors.Is(err, client.ErrNotFound) {
+			fmt.Println("(not found)")
+			return 2
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ttl error:", err)
+			return 1
+		}
+		if ttl == client.NoExpiry {
+			fmt.Println("(no ttl)")
+		} else {
+			fmt.Println(int64(ttl / time.Second))
+		}
+
 	default:
 		fmt.Fprintln(os.Stderr, "unknown command:", args[0])
 		usage()
-		os.Exit(1)
+		return 1
+	}
+	return 0
+}
+
+// Splits the keys a batch call failed on from an error with the whole call.
+func batchErrors(err error) (map[string]error, error) {
+	var batchErr *client.BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Errors, nil
 	}
+	return nil, err
 }
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/client"
+)
+
+func shellUsage() {
+	usage()
+	fmt.Println()
+	fmt.Println("In the shell, commands are typed without kvstore, e.g. get <key> or admin info.")
+	fmt.Println("Values with spaces go in quotes: set greeting \"hello world\" 0")
+	fmt.Println()
+	fmt.Println("Shell commands:")
+	fmt.Println("  timing on|off            print how long each command took")
+	fmt.Println("  timeout [<duration>]     show or change the time each command may take")
+	fmt.Println("  help                     show this help")
+	fmt.Println("  exit                     leave the shell, as does Ctrl-D")
+}
+
+// Words tab completes, by the words before them
+var completions = map[string][]string{
+	"": {"set", "get", "delete", "mget", "mset", "mdelete", "expire", "expireat", "persist", "ttl",
+		"admin", "timing", "timeout", "help", "exit", "quit"},
+	"admin": {"info", "snapshot", "rewrite-aof", "flush", "read-only", "reload", "replication",
+		"consistency", "repair", "changefeed", "cluster", "topology", "shard"},
+	"admin flush":      {"--all"},
+	"admin read-only":  {"on", "off"},
+	"admin changefeed": {"now"},
+	"admin cluster":    {"status", "add", "remove"},
+	"admin shard":      {"add", "migrate", "status", "abort"},
+	"timing":           {"on", "off"},
+}
+
+// Lines of history kept across sessions
+const maxHistory = 1000
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kvstore_history")
+}
+
+// Runs commands on one connection, typed at a terminal or read from a
+// script.
+type shell struct {
+	c       *client.Client
+	timeout time.Duration
+	timing  bool
+	// Nil when running a script
+	term *term.Terminal
+	// A command failed
+	failed bool
+}
+
+// Reads commands from the terminal, or from a script file, or from stdin
+// when it isn't a terminal. Scripts go on after a command fails, and the
+// exit code is 1 if any did.
+func runShell(c *client.Client, timeout time.Duration, historyFile string, args []string) int {
+	s := &shell{c: c, timeout: timeout}
+	inShell = true
+	switch {
+	case len(args) > 1:
+		fmt.Fprintln(os.Stderr, "shell takes at most a <script>")
+		usage()
+		return 1
+	case len(args) == 1 && args[0] != "-":
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "script error:", err)
+			return 1
+		}
+		defer f.Close()
+		return s.runScript(f, args[0])
+	case len(args) == 0 && term.IsTerminal(int(os.Stdin.Fd())):
+		hist := loadHistory(historyFile)
+		defer hist.close()
+		return s.runInteractive(hist)
+	}
+	return s.runScript(os.Stdin, "stdin")
+}
+
+func (s *shell) runInteractive(hist *history) int {
+	fd := int(os.Stdin.Fd())
+	s.timing = true
+	s.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	s.term.History = hist
+	s.term.AutoCompleteCallback = s.complete
+	fmt.Printf("Connected to %s, type help for the commands.\n", s.c.Addr())
+
+	for {
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			s.term.SetSize(width, height)
+		}
+		// The prompt follows failovers
+		s.term.SetPrompt(s.c.Addr() + "> ")
+		// The terminal is only raw while a line is read, so commands print
+		// as usual
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "terminal error:", err)
+			return 1
+		}
+		line, err := s.term.ReadLine()
+		term.Restore(fd, state)
+		if err == io.EOF {
+			fmt.Println()
+			return 0
+		}
+		if err != nil && err != term.ErrPasteIndicator {
+			fmt.Fprintln(os.Stderr, "terminal error:", err)
+			return 1
+		}
+
+		words, err := splitWords(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "parse error:", err)
+			continue
+		}
+		if s.exec(words) {
+			return 0
+		}
+	}
+}
+
+func (s *shell) runScript(r io.Reader, name string) int {
+	reader := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			fmt.Fprintln(os.Stderr, "script error:", readErr)
+			return 1
+		}
+		words, err := splitWords(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: parse error: %v\n", name, n, err)
+			s.failed = true
+		} else if s.exec(words) {
+			break
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if s.failed {
+		return 1
+	}
+	return 0
+}
+
+// Runs a line's words and returns whether the shell should exit. Blank
+// lines and comments do nothing.
+func (s *shell) exec(words []string) (exit bool) {
+	if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+		return false
+	}
+	switch words[0] {
+	case "exit", "quit":
+		return true
+
+	case "help":
+		shellUsage()
+
+	case "timing":
+		if len(words) != 2 || (words[1] != "on" && words[1] != "off") {
+			fmt.Fprintln(os.Stderr, "timing requires on or off")
+			s.failed = true
+			return false
+		}
+		s.timing = words[1] == "on"
+
+	case "timeout":
+		switch len(words) {
+		case 1:
+			fmt.Println(s.timeout)
+		case 2:
+			timeout, err := time.ParseDuration(words[1])
+			if err != nil || timeout <= 0 {
+				fmt.Fprintln(os.Stderr, "invalid timeout:", words[1])
+				s.failed = true
+				return false
+			}
+			s.timeout = timeout
+		default:
+			fmt.Fprintln(os.Stderr, "timeout takes at most a <duration>")
+			s.failed = true
+		}
+
+	case "shell":
+		fmt.Fprintln(os.Stderr, "already in the shell")
+		s.failed = true
+
+	default:
+		// At a terminal Ctrl-C stops the command rather than the shell
+		ctx := context.Background()
+		if s.term != nil {
+			var stop context.CancelFunc
+			ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+			defer stop()
+		}
+		start := time.Now()
+		if runCommand(ctx, s.c, s.timeout, words) == 1 {
+			s.failed = true
+		}
+		if s.timing {
+			fmt.Printf("(%s)\n", time.Since(start).Round(time.Microsecond))
+		}
+	}
+	return false
+}
+
+// Completes the word before the cursor on tab. When several words match,
+// it completes as far as they agree, and lists them once it can't go on.
+func (s *shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	head := line[:pos]
+	start := strings.LastIndexFunc(head, unicode.IsSpace) + 1
+	prefix := head[start:]
+	var matches []string
+	for _, word := range completions[strings.Join(strings.Fields(head[:start]), " ")] {
+		if strings.HasPrefix(word, prefix) {
+			matches = append(matches, word)
+		}
+	}
+	if len(matches) == 0 {
+		return line, pos, true
+	}
+
+	word := matches[0]
+	if len(matches) == 1 {
+		word += " "
+	} else {
+		for _, match := range matches[1:] {
+			for !strings.HasPrefix(match, word) {
+				word = word[:len(word)-1]
+			}
+		}
+		if word == prefix {
+			fmt.Fprintln(s.term, strings.Join(matches, "  "))
+		}
+	}
+	return head[:start] + word + line[pos:], start + len(word), true
+}
+
+// Splits a line into words like a POSIX shell, without any expansion.
+// Quotes keep spaces in a word: single quotes keep everything as typed,
+// double quotes take \" and \\ as escapes, and outside quotes a backslash
+// escapes the character after it.
+func splitWords(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'' && r != '\'', quote == '"' && r != '"' && r != '\\':
+			word.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == quote:
+			quote = 0
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	switch {
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	case escaped:
+		return nil, errors.New("backslash at the end of the line")
+	case inWord:
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Command history of the shell, also appended to a file to be loaded by
+// the next session.
+type history struct {
+	// Oldest first
+	entries []string
+	file    *os.File
+}
+
+// Loads the history file, if any. Without one the history only lasts the
+// session.
+func loadHistory(path string) *history {
+	h := &history{}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, "history error:", err)
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	// The file only grows while in use, so it is trimmed when loaded
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		if err := os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600); err != nil {
+			fmt.Fprintln(os.Stderr, "history error:", err)
+		}
+	}
+	h.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "history error:", err)
+	}
+	return h
+}
+
+// Add skips blank lines and repeats of the last one.
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.file != nil {
+		fmt.Fprintln(h.file, entry)
+	}
+}
+
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+// At returns the idx-th most recent entry.
+func (h *history) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+func (h *history) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+func runStats(args []string) error {
+	var files fileFlags
+	fs := newFlagSet("stats", &files)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	snapshot, err := readSnapshotFile(files.snapshotPath)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	aof, err := readAOFFile(files.aofPath)
+	if err != nil {
+		return fmt.Errorf("reading AOF: %w", err)
+	}
+	now := time.Now()
+
+	fmt.Println("Snapshot:", snapshot.path)
+	if snapshot.missing {
+		fmt.Println("  (missing)")
+	} else {
+		expired := 0
+		for _, entry := range snapshot.entries {
+			if isExpired(entry.ExpiresAt, now) {
+				expired++
+			}
+		}
+		fmt.Printf("  size:     %d bytes\n", snapshot.size)
+		fmt.Printf("  entries:  %d (%d expired)\n", len(snapshot.entries), expired)
+	}
+
+	fmt.Println("AOF:", aof.path)
+	if aof.missing {
+		fmt.Println("  (missing)")
+	} else {
+		ops := make(map[string]int)
+		expired := 0
+		for _, entry := range aof.entries {
+			ops[entry.Op]++
+			if isExpired(entry.ExpiresAt, now) {
+				expired++
+			}
+		}
+		fmt.Printf("  size:     %d bytes\n", aof.size)
+		fmt.Printf("  records:  %d (%d expired)\n", len(aof.entries), expired)
+		for _, op := range sortedKeys(ops) {
+			fmt.Printf("    %-8s %d\n", op, ops[op])
+		}
+		if aof.corrupt != nil {
+			fmt.Printf("  status:   %v (%d trailing bytes unreadable)\n", aof.corrupt, aof.size-aof.valid)
+		} else {
+			fmt.Println("  status:   ok")
+		}
+	}
+
+	merged, tombstones := replay(snapshot, aof, now)
+	var keyBytes, valueBytes, withTTL int
+	for _, entry := range merged {
+		keyBytes += len(entry.Key)
+		valueBytes += len(entry.Value)
+		if !entry.ExpiresAt.IsZero() {
+			withTTL++
+		}
+	}
+	fmt.Println("Merged state:")
+	fmt.Printf("  live keys:   %d (%d with TTL)\n", len(merged), withTTL)
+	fmt.Printf("  key bytes:   %d\n", keyBytes)
+	fmt.Printf("  value bytes: %d\n", valueBytes)
+	if len(tombstones) > 0 {
+		fmt.Printf("  tombstones:  %d\n", len(tombstones))
+	}
+	return nil
+}
+
+func runDump(args []string) error {
+	var files fileFlags
+	fs := newFlagSet("dump", &files)
+	source := fs.String("source", "merged", "what to dump: merged, snapshot or aof")
+	asJSON := fs.Bool("json", false, "print one JSON object per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var records []any
+	switch *source {
+	case "snapshot":
+		snapshot, err := readSnapshotFile(files.snapshotPath)
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		for _, entry := range snapshot.entries {
+			records = append(records, entry)
+		}
+	case "aof":
+		aof, err := readAOFFile(files.aofPath)
+		if err != nil {
+			return fmt.Errorf("reading AOF: %w", err)
+		}
+		// Batch records are listed as the writes they contain
+		for _, entry := range persistance.FlattenAOF(aof.entries) {
+			records = append(records, entry)
+		}
+		if aof.corrupt != nil {
+			defer fmt.Fprintln(os.Stderr, "warning:", aof.corrupt)
+		}
+	case "merged":
+		snapshot, err := readSnapshotFile(files.snapshotPath)
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		aof, err := readAOFFile(files.aofPath)
+		if err != nil {
+			return fmt.Errorf("reading AOF: %w", err)
+		}
+		live, _ := replay(snapshot, aof, time.Now())
+		for _, entry := range live {
+			records = append(records, entry)
+		}
+		if aof.corrupt != nil {
+			defer fmt.Fprintln(os.Stderr, "warning:", aof.corrupt)
+		}
+	default:
+		return fmt.Errorf("unknown source %q", *source)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, record := range records {
+		switch r := record.(type) {
+		case persistance.SnapshotEntry:
+			fmt.Printf("%s %s %s\n", strconv.Quote(r.Key), strconv.Quote(r.Value), formatExpiry(r.ExpiresAt))
+		case persistance.AOFEntry:
+			fmt.Printf("%s %s %s %s\n", r.Op, strconv.Quote(r.Key), strconv.Quote(r.Value), formatExpiry(r.ExpiresAt))
+		}
+	}
+	return nil
+}
+
+func runVerify(args []string) error {
+	var files fileFlags
+	fs := newFlagSet("verify", &files)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	failed := false
+
+	snapshot, err := readSnapshotFile(files.snapshotPath)
+	switch {
+	case err != nil:
+		fmt.Printf("snapshot %s: %v\n", snapshotFilePath(files.snapshotPath), err)
+		failed = true
+	case snapshot.missing:
+		fmt.Printf("snapshot %s: missing\n", snapshot.path)
+	default:
+		problems := 0
+		seen := make(map[string]bool, len(snapshot.entries))
+		for i, entry := range snapshot.entries {
+			if entry.Key == "" {
+				fmt.Printf("snapshot %s: entry %d has an empty key\n", snapshot.path, i)
+				problems++
+			} else if seen[entry.Key] {
+				fmt.Printf("snapshot %s: duplicate key %q\n", snapshot.path, entry.Key)
+				problems++
+			}
+			seen[entry.Key] = true
+		}
+		if problems > 0 {
+			failed = true
+		} else {
+			fmt.Printf("snapshot %s: ok (%d entries)\n", snapshot.path, len(snapshot.entries))
+		}
+	}
+
+	aof, err := readAOFFile(files.aofPath)
+	switch {
+	case err != nil:
+		fmt.Printf("aof %s: %v\n", files.aofPath, err)
+		failed = true
+	case aof.missing:
+		fmt.Printf("aof %s: missing\n", aof.path)
+	default:
+		problems := 0
+		for i, record := range aof.entries {
+			entries := []persistance.AOFEntry{record}
+			if record.Op == "batch" {
+				entries = record.Entries
+				if len(entries) == 0 {
+					fmt.Printf("aof %s: record %d is an empty batch\n", aof.path, i+1)
+					problems++
+				}
+			}
+			for _, entry := range entries {
+				if entry.Op != "set" && entry.Op != "delete" {
+					fmt.Printf("aof %s: record %d has unknown op %q\n", aof.path, i+1, entry.Op)
+					problems++
+				}
+				if entry.Key == "" {
+					fmt.Printf("aof %s: record %d has an empty key\n", aof.path, i+1)
+					problems++
+				}
+			}
+		}
+		if aof.corrupt != nil {
+			fmt.Printf("aof %s: %v\n", aof.path, aof.corrupt)
+			fmt.Printf("  run `kvtool truncate -aof %s` to drop the last %d bytes\n", aof.path, aof.size-aof.valid)
+			problems++
+		}
+		if problems > 0 {
+			failed = true
+		} else {
+			fmt.Printf("aof %s: ok (%d records)\n", aof.path, len(aof.entries))
+		}
+	}
+
+	if failed {
+		return errors.New("verification failed")
+	}
+	return nil
+}
+
+func runTruncate(args []string) error {
+	var files fileFlags
+	fs := newFlagSet("truncate", &files)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	aof, err := readAOFFile(files.aofPath)
+	if err != nil {
+		return err
+	}
+	if aof.missing {
+		return fmt.Errorf("%s does not exist", aof.path)
+	}
+	if aof.corrupt == nil {
+		fmt.Println("AOF is intact, nothing to truncate")
+		return nil
+	}
+
+	dropped := aof.size - aof.valid
+	fmt.Println(aof.corrupt)
+	if *dryRun {
+		fmt.Printf("would keep %d records and drop %d bytes\n", len(aof.entries), dropped)
+		return nil
+	}
+
+	// Keep the removed bytes around in case someone wants to look at them
+	backupPath := aof.path + ".corrupt"
+	if err := saveTail(aof.path, aof.valid, backupPath); err != nil {
+		return fmt.Errorf("saving corrupt tail: %w", err)
+	}
+	if err := os.Truncate(aof.path, aof.valid); err != nil {
+		return err
+	}
+	fmt.Printf("kept %d records, dropped %d bytes (saved to %s)\n", len(aof.entries), dropped, backupPath)
+	return nil
+}
+
+func saveTail(path string, offset int64, dest string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func runCompact(args []string) error {
+	var files fileFlags
+	fs := newFlagSet("compact", &files)
+	out := fs.String("out", "", "directory to write the new snapshot to (defaults to the snapshot directory)")
+	keepAOF := fs.Bool("keep-aof", false, "don't clear the AOF after compacting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	snapshot, err := readSnapshotFile(files.snapshotPath)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	aof, err := readAOFFile(files.aofPath)
+	if err != nil {
+		return fmt.Errorf("reading AOF: %w", err)
+	}
+	if aof.corrupt != nil {
+		return fmt.Errorf("%v; run `kvtool truncate` first", aof.corrupt)
+	}
+
+	snapshotDir := filepath.Dir(snapshot.path)
+	outDir := *out
+	if outDir == "" {
+		outDir = snapshotDir
+	}
+
+	// Tombstones are kept, or an older write from another site could bring
+	// their keys back
+	live, tombstones := replay(snapshot, aof, time.Now())
+	entries := append(live, tombstones...)
+	if err := persistance.NewSnapshotPersistance().SaveSnapshot(outDir, entries); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d entries to %s\n", len(entries), filepath.Join(outDir, persistance.SnapshotFilename))
+
+	// The AOF only becomes redundant when the new snapshot replaces the old one
+	sameDir, err := samePath(outDir, snapshotDir)
+	if err != nil {
+		return err
+	}
+	if *keepAOF || !sameDir || aof.missing {
+		return nil
+	}
+	if err := os.Truncate(aof.path, 0); err != nil {
+		return err
+	}
+	fmt.Printf("cleared %s (%d records)\n", aof.path, len(aof.entries))
+	return nil
+}
+
+func samePath(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return absA == absB, nil
+}
+
+func runDiff(args []string) error {
+	fs := newFlagSet("diff", nil)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("diff requires <snapshot-a> <snapshot-b>")
+	}
+
+	a, err := readSnapshotFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(0), err)
+	}
+	b, err := readSnapshotFile(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(1), err)
+	}
+	for _, s := range []*snapshotFile{a, b} {
+		if s.missing {
+			return fmt.Errorf("%s does not exist", s.path)
+		}
+	}
+
+	before := make(map[string]persistance.SnapshotEntry, len(a.entries))
+	for _, entry := range a.entries {
+		if !entry.Deleted {
+			before[entry.Key] = entry
+		}
+	}
+	after := make(map[string]persistance.SnapshotEntry, len(b.entries))
+	for _, entry := range b.entries {
+		if !entry.Deleted {
+			after[entry.Key] = entry
+		}
+	}
+
+	keys := make(map[string]bool, len(before)+len(after))
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	var added, removed, changed int
+	for _, k := range sortedKeys(keys) {
+		old, inA := before[k]
+		cur, inB := after[k]
+		switch {
+		case !inA:
+			added++
+			fmt.Printf("+ %s %s %s\n", strconv.Quote(k), strconv.Quote(cur.Value), formatExpiry(cur.ExpiresAt))
+		case !inB:
+			removed++
+			fmt.Printf("- %s %s %s\n", strconv.Quote(k), strconv.Quote(old.Value), formatExpiry(old.ExpiresAt))
+		case old.Value != cur.Value || !old.ExpiresAt.Equal(cur.ExpiresAt):
+			changed++
+			fmt.Printf("~ %s %s %s -> %s %s\n", strconv.Quote(k),
+				strconv.Quote(old.Value), formatExpiry(old.ExpiresAt),
+				strconv.Quote(cur.Value), formatExpiry(cur.ExpiresAt))
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed\n", added, removed, changed)
+	return nil
+}
+
+func formatExpiry(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return "-"
+	}
+	return expiresAt.UTC().Format(time.RFC3339)
+}
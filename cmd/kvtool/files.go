@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+type aofFile struct {
+	path    string
+	size    int64
+	missing bool
+	entries []persistance.AOFEntry
+	// Number of bytes taken up by the records that decoded cleanly
+	valid   int64
+	corrupt *persistance.CorruptionError
+}
+
+type snapshotFile struct {
+	path    string
+	size    int64
+	missing bool
+	entries []persistance.SnapshotEntry
+}
+
+func readAOFFile(path string) (*aofFile, error) {
+	aof := &aofFile{path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			aof.missing = true
+			return aof, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	aof.size = info.Size()
+
+	aof.entries, aof.valid, err = persistance.ReadAOF(file)
+	if err != nil && !errors.As(err, &aof.corrupt) {
+		return nil, err
+	}
+	return aof, nil
+}
+
+// Accepts either a snapshot directory or the path of a snapshot file.
+func snapshotFilePath(path string) string {
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() {
+		return path
+	}
+	if err != nil && filepath.Ext(path) == ".gob" {
+		return path
+	}
+	return filepath.Join(path, persistance.SnapshotFilename)
+}
+
+func readSnapshotFile(path string) (*snapshotFile, error) {
+	snapshot := &snapshotFile{path: snapshotFilePath(path)}
+	info, err := os.Stat(snapshot.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			snapshot.missing = true
+			return snapshot, nil
+		}
+		return nil, err
+	}
+	snapshot.size = info.Size()
+
+	snapshot.entries, err = persistance.LoadSnapshotFile(snapshot.path)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func isExpired(expiresAt time.Time, now time.Time) bool {
+	return !expiresAt.IsZero() && expiresAt.Before(now)
+}
+
+// Rebuilds the state the server would have after loading both files,
+// with expired keys dropped. Tombstones of multi-master mode are returned
+// apart from the live keys, as Deleted entries. Both are sorted by key.
+func replay(snapshot *snapshotFile, aof *aofFile, now time.Time) (live, tombstones []persistance.SnapshotEntry) {
+	items := make(map[string]persistance.SnapshotEntry)
+	deleted := make(map[string]persistance.SnapshotEntry)
+	for _, entry := range snapshot.entries {
+		if entry.Deleted {
+			deleted[entry.Key] = entry
+			continue
+		}
+		items[entry.Key] = entry
+	}
+	for _, entry := range persistance.FlattenAOF(aof.entries) {
+		switch entry.Op {
+		case "set":
+			items[entry.Key] = persistance.SnapshotEntry{
+				Key:       entry.Key,
+				Value:     entry.Value,
+				ExpiresAt: entry.ExpiresAt,
+				Version:   entry.Version,
+				Flags:     entry.Flags,
+				Timestamp: entry.Timestamp,
+				Origin:    entry.Origin,
+			}
+			delete(deleted, entry.Key)
+		case "delete":
+			delete(items, entry.Key)
+			if entry.Timestamp != 0 {
+				deleted[entry.Key] = persistance.SnapshotEntry{
+					Key:       entry.Key,
+					Timestamp: entry.Timestamp,
+					Origin:    entry.Origin,
+					Deleted:   true,
+				}
+			}
+		}
+	}
+
+	live = make([]persistance.SnapshotEntry, 0, len(items))
+	for _, entry := range items {
+		if isExpired(entry.ExpiresAt, now) {
+			continue
+		}
+		live = append(live, entry)
+	}
+	tombstones = make([]persistance.SnapshotEntry, 0, len(deleted))
+	for _, entry := range deleted {
+		tombstones = append(tombstones, entry)
+	}
+	sortEntries(live)
+	sortEntries(tombstones)
+	return live, tombstones
+}
+
+func sortEntries(entries []persistance.SnapshotEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
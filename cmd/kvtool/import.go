@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/importer"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+func runImportRedis(args []string) error {
+	var files fileFlags
+	fs := newFlagSet("import-redis", &files)
+	format := fs.String("format", "auto", "input format: rdb, aof or auto (by file extension)")
+	db := fs.Int("db", 0, "Redis database to import")
+	allDBs := fs.Bool("all-dbs", false, "import every Redis database into the same keyspace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("import-redis requires at least one input file")
+	}
+
+	inputFormat := *format
+	if inputFormat == "auto" {
+		inputFormat = "aof"
+		if strings.EqualFold(filepath.Ext(fs.Arg(0)), ".rdb") {
+			inputFormat = "rdb"
+		}
+	}
+	if inputFormat == "rdb" && fs.NArg() != 1 {
+		return errors.New("only one RDB file can be imported at a time")
+	}
+	if inputFormat != "rdb" && inputFormat != "aof" {
+		return fmt.Errorf("unknown format %q", inputFormat)
+	}
+
+	// The parts of a Redis 7 multi-part AOF are read as one log, in the order given
+	readers := make([]io.Reader, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	st, err := store.New(files.aofPath, snapshotDirPath(files.snapshotPath))
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer st.Close()
+
+	opts := importer.RedisOptions{DB: *db, AllDatabases: *allDBs}
+	var stats *importer.RedisImportStats
+	if inputFormat == "rdb" {
+		stats, err = importer.ImportRedisRDB(readers[0], st, opts)
+	} else {
+		stats, err = importer.ImportRedisAOF(io.MultiReader(readers...), st, opts)
+	}
+	if stats != nil {
+		fmt.Printf("imported %d keys, deleted %d, skipped %d already expired\n", stats.Imported, stats.Deleted, stats.Expired)
+		for _, what := range sortedKeys(stats.Skipped) {
+			fmt.Printf("  skipped %d %s\n", stats.Skipped[what], what)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Fold everything into a snapshot so the server doesn't have to replay it
+	if err := st.SaveSnapshot(); err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	return nil
+}
+
+// Like snapshotFilePath, but for APIs that want the directory.
+func snapshotDirPath(path string) string {
+	return filepath.Dir(snapshotFilePath(path))
+}
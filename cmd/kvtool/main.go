@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const (
+	defaultAOFPath     = "aof/aof.log"
+	defaultSnapshotDir = "snapshots"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"stats", "[-aof file] [-snapshot path]", "print entry counts, op mix, expired entries and sizes", runStats},
+		{"dump", "[-aof file] [-snapshot path] [-source merged|snapshot|aof] [-json]", "print entries", runDump},
+		{"verify", "[-aof file] [-snapshot path]", "check that both files decode cleanly", runVerify},
+		{"truncate", "[-aof file] [-dry-run]", "cut a corrupt tail off the AOF", runTruncate},
+		{"compact", "[-aof file] [-snapshot path] [-out dir] [-keep-aof]", "fold the AOF into a fresh snapshot", runCompact},
+		{"diff", "<snapshot-a> <snapshot-b>", "compare two snapshots", runDiff},
+		{"import-redis", "[-aof file] [-snapshot path] [-format rdb|aof|auto] [-db n] [-all-dbs] <file>...", "load a Redis RDB or AOF into the store", runImportRedis},
+	}
+}
+
+func usage() {
+	fmt.Println("Usage:")
+	for _, c := range commands {
+		fmt.Printf("  kvtool %s %s\n", c.name, c.args)
+		fmt.Printf("      %s\n", c.summary)
+	}
+	fmt.Println()
+	fmt.Println("The server must not be running while truncate, compact or import-redis rewrite its files.")
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		if err := c.run(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "unknown command:", args[0])
+	usage()
+	os.Exit(1)
+}
+
+// Flags shared by every command that works on a data directory.
+type fileFlags struct {
+	aofPath      string
+	snapshotPath string
+}
+
+func newFlagSet(name string, files *fileFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if files != nil {
+		fs.StringVar(&files.aofPath, "aof", defaultAOFPath, "path to the AOF file")
+		fs.StringVar(&files.snapshotPath, "snapshot", defaultSnapshotDir, "snapshot directory or .gob file")
+	}
+	return fs
+}
@@ -1,40 +1,488 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/changefeed"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/config"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/logging"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/raft"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tlsconfig"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tracking"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
-	store_, err := store.New("../../aof/aof.log", "../../snapshots")
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
 	if err != nil {
-		fmt.Printf("Failed to initialize store: %v\n", err)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+
+	// Config validation already checked the level
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
+	logger, err := logging.NewWithLeveler(os.Stderr, logLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	if cfg.Path != "" {
+		slog.Info("loaded config", "path", cfg.Path)
+	}
+
+	store_, err := store.New(cfg.AOFPath(), cfg.SnapshotDir)
+	if err != nil {
+		slog.Error("failed to initialize store", "error", err)
 		os.Exit(1)
 	}
-	store_.InitBackgroundTasks()
+	store_.SetDefaultTTL(time.Duration(cfg.DefaultTTL) * time.Second)
+	store_.SetSnapshotInterval(cfg.SnapshotInterval)
+	store_.SetExpiryInterval(cfg.ExpiryInterval)
+	store_.SetMaxMemory(cfg.MaxMemory)
+	store_.SetTombstoneTTL(cfg.TombstoneTTL)
+	// The change feed records changes from here on, what the store loaded
+	// from disk is already in its history
+	var changeLog *changefeed.Log
+	if cfg.ChangeFeedDir != "" {
+		changeLog, err = changefeed.Open(cfg.ChangeFeedDir, changefeed.Options{
+			Retention: cfg.ChangeFeedRetention,
+			MaxBytes:  cfg.ChangeFeedMaxBytes,
+		})
+		if err != nil {
+			slog.Error("failed to open the change feed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("change feed enabled", "dir", cfg.ChangeFeedDir, "next_lsn", changeLog.Next())
+	}
+	// Clients that cache keys are told when they change, or when the data
+	// is replaced as a whole
+	var trackingTable *tracking.Table
+	if cfg.TrackingMaxKeys > 0 {
+		trackingTable = tracking.NewTable(cfg.TrackingMaxKeys)
+		store_.SetReplaceObserver(trackingTable.InvalidateAll)
+	}
+	if changeLog != nil || trackingTable != nil {
+		store_.SetChangeObserver(func(change store.Change) {
+			if changeLog != nil {
+				changeLog.Append(change)
+			}
+			if trackingTable != nil {
+				trackingTable.Observe(change)
+			}
+		})
+	}
+	tasksCtx, stopTasks := context.WithCancel(context.Background())
+	defer stopTasks()
+	store_.InitBackgroundTasks(tasksCtx)
 
-	grpcServer := api.NewGRPCServer(store_)
+	// A replica takes its writes from the primary, a primary logs its
+	// writes for replicas
+	var (
+		replicationLog *replication.Log
+		replica        *replication.Replica
+		replicaDone    = make(chan struct{})
+	)
+	if cfg.ReplicaOf != "" {
+		replica, err = newReplica(store_, cfg)
+		if err != nil {
+			slog.Error("failed to set up replication", "error", err)
+			os.Exit(1)
+		}
+		store_.SetPrimary(cfg.ReplicaOf)
+		go func() {
+			defer close(replicaDone)
+			replica.Run(tasksCtx)
+		}()
+		slog.Info("running as a replica", "primary", cfg.ReplicaOf)
+	} else {
+		close(replicaDone)
+		replicationLog = replication.NewLog(cfg.ReplicationBacklog)
+		store_.SetWriteObserver(replicationLog.Append)
+	}
+
+	// In multi-master mode every site also follows the others, merging
+	// their writes into its own
+	var (
+		peers     []*replication.Peer
+		peersDone sync.WaitGroup
+	)
+	if cfg.MultiMasterID != "" {
+		store_.EnableMultiMaster(cfg.MultiMasterID, hlc.NewClock(nil))
+		peers, err = newPeers(store_, cfg)
+		if err != nil {
+			slog.Error("failed to set up multi-master replication", "error", err)
+			os.Exit(1)
+		}
+		for _, p := range peers {
+			peersDone.Add(1)
+			go func() {
+				defer peersDone.Done()
+				p.Run(tasksCtx)
+			}()
+		}
+		slog.Info("running in multi-master mode", "id", cfg.MultiMasterID, "sites", len(peers)+1)
+	}
+
+	// In cluster mode writes go through the Raft log, which replaces what
+	// the store loaded with the latest Raft snapshot and replays the rest
+	var (
+		node      *raft.Node
+		transport *raft.GRPCTransport
+	)
+	if cfg.RaftID != "" {
+		node, transport, err = newClusterNode(store_, cfg)
+		if err != nil {
+			slog.Error("failed to set up the cluster node", "error", err)
+			os.Exit(1)
+		}
+	}
+	// Cluster mode and sharding only check requests on the gRPC API
+	grpcOnly := cfg.RaftID != "" || cfg.ShardID != ""
+	if grpcOnly && (cfg.RESPPort != 0 || cfg.HTTPPort != 0 || cfg.MemcachedPort != 0) {
+		slog.Warn("cluster mode and sharding only serve gRPC, the RESP, HTTP and memcached listeners are disabled")
+	}
+
+	// Keeps its own copy, so later reloads are compared with what is running
+	running := *cfg
+	configReloader := &reloader{
+		cfg:      &running,
+		store:    store_,
+		logLevel: logLevel,
+	}
+
+	registry := metrics.NewRegistry()
+	api.RegisterStoreMetrics(registry, store_)
+
+	// Metrics and logging come first so calls rejected by later interceptors
+	// are counted and logged
+	interceptors := []grpc.UnaryServerInterceptor{
+		api.RPCMetricsInterceptor(registry),
+		api.RPCLoggingInterceptor(logger),
+	}
+	var grpcOpts []grpc.ServerOption
+	if cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSClientCA != "" {
+		configReloader.tls, err = tlsconfig.NewReloader(tlsconfig.ServerOptions{
+			CertFile:     cfg.TLSCert,
+			KeyFile:      cfg.TLSKey,
+			ClientCAFile: cfg.TLSClientCA,
+		})
+		if err != nil {
+			slog.Error("failed to set up TLS", "error", err)
+			os.Exit(1)
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(configReloader.tls.Config())))
+	}
+	if cfg.ACLFile != "" {
+		acl, err := auth.LoadACLFile(cfg.ACLFile)
+		if err != nil {
+			slog.Error("failed to load ACL file", "error", err)
+			os.Exit(1)
+		}
+		configReloader.acl = auth.NewReloadableACL(acl)
+		interceptors = append(interceptors, api.AuthInterceptor(configReloader.acl))
+		grpcOpts = append(grpcOpts, grpc.ChainStreamInterceptor(api.AuthStreamInterceptor(configReloader.acl)))
+	}
+	grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(interceptors...))
+	grpcServer := api.NewGRPCServer(store_, grpcOpts...)
+	api.RegisterConnectionMetrics(registry, "grpc", grpcServer)
+	// Without ACLs there would be nothing keeping the Admin service to admins
+	if cfg.ACLFile != "" {
+		grpcServer.EnableAdmin(configReloader.reload)
+	} else {
+		slog.Info("admin service disabled, it needs -acl-file")
+	}
+	replicationServer := grpcServer.EnableReplication(replicationLog, replica)
+	replicationServer.SetPeers(peers)
+	api.RegisterReplicationMetrics(registry, replicationServer)
+	if changeLog != nil {
+		grpcServer.EnableChangeFeed(changeLog)
+		api.RegisterChangeFeedMetrics(registry, changeLog)
+	}
+	if trackingTable != nil {
+		grpcServer.EnableTracking(trackingTable)
+		api.RegisterTrackingMetrics(registry, trackingTable)
+	}
+	if node != nil {
+		grpcServer.EnableCluster(node)
+		node.Start()
+		slog.Info("running in cluster mode", "id", cfg.RaftID, "raft_dir", cfg.RaftDir)
+	}
+	if cfg.ShardID != "" {
+		shardingServer, err := enableSharding(grpcServer, cfg)
+		if err != nil {
+			slog.Error("failed to set up sharding", "error", err)
+			os.Exit(1)
+		}
+		// Migrations forward the writes to the keys they move
+		store_.SetWriteObserver(func(entry persistance.AOFEntry) {
+			replicationLog.Append(entry)
+			shardingServer.Observe(entry)
+		})
+		if ring := shardingServer.Ring(); ring != nil {
+			slog.Info("running as a shard", "id", cfg.ShardID, "shards", len(ring.Nodes()), "epoch", ring.Epoch())
+		} else {
+			slog.Info("running as a shard, waiting to be added", "id", cfg.ShardID)
+		}
+	}
 
 	go func() {
-		if err := grpcServer.Start(50051); err != nil {
-			fmt.Printf("Failed to start gRPC server: %v\n", err)
+		if err := grpcServer.Start(cfg.Port); err != nil {
+			slog.Error("failed to start gRPC server", "error", err)
 			os.Exit(1)
 		}
 	}()
 
-	fmt.Println("Key-Value Store gRPC server is running on port 50051")
-	fmt.Println("Press Ctrl+C to stop the server")
+	// Protocol servers by name, drained together on shutdown
+	servers := map[string]shutdowner{"grpc": grpcServer}
+
+	// The RESP listener shares the store with the gRPC server
+	if cfg.RESPPort != 0 && !grpcOnly {
+		respServer := api.NewRESPServer(store_)
+		if configReloader.acl != nil {
+			respServer.EnableAuth(configReloader.acl)
+		}
+		api.RegisterConnectionMetrics(registry, "resp", respServer)
+		servers["resp"] = respServer
+		go func() {
+			if err := respServer.Start(cfg.RESPPort); err != nil {
+				slog.Error("failed to start RESP server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	if cfg.HTTPPort != 0 && !grpcOnly {
+		httpServer := api.NewHTTPServer(store_)
+		if configReloader.acl != nil {
+			httpServer.EnableAuth(configReloader.acl)
+		}
+		api.RegisterConnectionMetrics(registry, "http", httpServer)
+		servers["http"] = httpServer
+		go func() {
+			if err := httpServer.Start(cfg.HTTPPort); err != nil {
+				slog.Error("failed to start HTTP server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
 
+	if cfg.MemcachedPort != 0 && !grpcOnly {
+		memcachedServer := api.NewMemcachedServer(store_)
+		api.RegisterConnectionMetrics(registry, "memcached", memcachedServer)
+		servers["memcached"] = memcachedServer
+		go func() {
+			if err := memcachedServer.Start(cfg.MemcachedPort); err != nil {
+				slog.Error("failed to start memcached server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	var metricsServer *api.MetricsServer
+	if cfg.MetricsPort != 0 {
+		metricsServer = api.NewMetricsServer(registry)
+		go func() {
+			if err := metricsServer.Start(cfg.MetricsPort); err != nil {
+				slog.Error("failed to start metrics server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	slog.Info("key-value store running", "grpc_port", cfg.Port)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+wait:
+	for {
+		select {
+		case <-reload:
+			// reload logs the outcome when it succeeds
+			if _, _, err := configReloader.reload(); err != nil {
+				slog.Error("config reload failed, keeping the current config", "error", err)
+			}
+		case <-quit:
+			break wait
+		}
+	}
+
+	// A second signal skips the rest of the shutdown
+	go func() {
+		<-quit
+		slog.Warn("forced exit")
+		os.Exit(1)
+	}()
+
+	// Settings applied by a reload count here too
+	current := configReloader.current()
+	slog.Info("shutting down", "timeout", current.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), current.ShutdownTimeout)
+	defer cancel()
+
+	// Drain every protocol first, so no writes arrive during the final
+	// snapshot
+	var wg sync.WaitGroup
+	for name, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				slog.Warn("requests still in flight at the shutdown deadline, closed their connections", "protocol", name, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if node != nil {
+		if err := node.Stop(); err != nil {
+			slog.Error("failed to stop the cluster node", "error", err)
+		}
+		transport.Close()
+	}
+
+	// Also stops the replica and the other sites' streams, whose writes have to be in before the snapshot
+	stopTasks()
+	<-replicaDone
+	if replica != nil {
+		replica.Close()
+	}
+	peersDone.Wait()
+	for _, p := range peers {
+		p.Close()
+	}
+	if current.ShutdownSnapshot {
+		// SaveSnapshot logs failures itself
+		if err := store_.SaveSnapshot(); err == nil {
+			slog.Info("final snapshot saved")
+		}
+	}
+	if err := store_.Close(); err != nil {
+		slog.Error("failed to close the AOF", "error", err)
+	}
+	if changeLog != nil {
+		if err := changeLog.Close(); err != nil {
+			slog.Error("failed to close the change feed", "error", err)
+		}
+	}
+
+	// Metrics stay up until the end, so the shutdown can be watched
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	slog.Info("server stopped")
+}
+
+func newReplica(st *store.Store, cfg *config.Config) (*replication.Replica, error) {
+	opts := replication.ReplicaOptions{Token: cfg.ReplicaToken, AntiEntropyInterval: cfg.AntiEntropyInterval}
+	if cfg.ReplicaTLSCA != "" {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.ClientOptions{CAFile: cfg.ReplicaTLSCA})
+		if err != nil {
+			return nil, err
+		}
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	}
+	return replication.NewReplica(st, cfg.ReplicaOf, opts)
+}
+
+func newPeers(st *store.Store, cfg *config.Config) ([]*replication.Peer, error) {
+	// Config validation already checked the sites
+	sites, _ := cfg.MultiMasterSites()
+	opts := replication.PeerOptions{
+		Origin:              cfg.MultiMasterID,
+		Token:               cfg.MultiMasterToken,
+		AntiEntropyInterval: cfg.AntiEntropyInterval,
+	}
+	if cfg.MultiMasterTLSCA != "" {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.ClientOptions{CAFile: cfg.MultiMasterTLSCA})
+		if err != nil {
+			return nil, err
+		}
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	}
+	var peers []*replication.Peer
+	for _, site := range sites {
+		p, err := replication.NewPeer(st, site.ID, site.Addr, opts)
+		if err != nil {
+			for _, p := range peers {
+				p.Close()
+			}
+			return nil, err
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+func newClusterNode(st *store.Store, cfg *config.Config) (*raft.Node, *raft.GRPCTransport, error) {
+	// Config validation already checked the peers
+	members, _ := cfg.RaftMembers()
+	opts := raft.GRPCTransportOptions{Token: cfg.RaftToken}
+	if cfg.RaftTLSCA != "" {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.ClientOptions{CAFile: cfg.RaftTLSCA})
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	}
+	transport := raft.NewGRPCTransport(opts)
+	node, err := raft.NewNode(raft.Config{
+		ID:                cfg.RaftID,
+		Dir:               cfg.RaftDir,
+		Bootstrap:         members,
+		ElectionTimeout:   cfg.RaftElectionTimeout,
+		HeartbeatInterval: cfg.RaftHeartbeatInterval,
+		SnapshotThreshold: cfg.RaftSnapshotThreshold,
+	}, raft.NewStoreFSM(st), transport)
+	if err != nil {
+		transport.Close()
+		return nil, nil, err
+	}
+	return node, transport, nil
+}
+
+func enableSharding(srv *api.GRPCServer, cfg *config.Config) (*api.ShardingServer, error) {
+	// Config validation already checked the nodes
+	ring, _ := cfg.ShardRing()
+	opts := api.ShardingOptions{
+		Path:         cfg.ShardTopologyFile,
+		VirtualNodes: cfg.ShardVirtualNodes,
+		Token:        cfg.ShardToken,
+	}
+	if cfg.ShardTLSCA != "" {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.ClientOptions{CAFile: cfg.ShardTLSCA})
+		if err != nil {
+			return nil, err
+		}
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	}
+	return srv.EnableSharding(cfg.ShardID, ring, opts)
+}
 
-	fmt.Println("Shutting down server...")
-	grpcServer.Stop()
-	fmt.Println("Server stopped")
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
 }
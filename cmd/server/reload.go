@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/config"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/logging"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tlsconfig"
+)
+
+// Holds everything a config reload can change on the running server.
+type reloader struct {
+	mu sync.Mutex
+	// The config in effect, keys that need a restart keep their startup value
+	cfg      *config.Config
+	store    *store.Store
+	logLevel *slog.LevelVar
+	// Nil when the feature is off
+	acl *auth.ReloadableACL
+	tls *tlsconfig.Reloader
+}
+
+// Returns the config in effect.
+func (r *reloader) current() config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.cfg
+}
+
+// Loads the configuration again from the same flags, environment and file
+// as at startup and applies what can be changed live. Nothing changes if
+// the new configuration is invalid or its ACL or certificates don't load.
+// The ACL file is read again even if its path didn't change, so edits to it
+// are picked up.
+func (r *reloader) reload() (applied, restartRequired []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	live, restart := config.Diff(r.cfg, cfg)
+
+	// Everything that can fail goes first
+	var acl *auth.ACL
+	if r.acl != nil {
+		if acl, err = auth.LoadACLFile(cfg.ACLFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	tlsChanged := slices.ContainsFunc(live, func(key string) bool {
+		return strings.HasPrefix(key, "TLS_")
+	})
+	if r.tls != nil && tlsChanged {
+		err := r.tls.Update(tlsconfig.ServerOptions{
+			CertFile:     cfg.TLSCert,
+			KeyFile:      cfg.TLSKey,
+			ClientCAFile: cfg.TLSClientCA,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if acl != nil {
+		r.acl.Swap(acl)
+		if !slices.Contains(live, "ACL_FILE") {
+			live = append(live, "ACL_FILE")
+		}
+	}
+	for _, key := range live {
+		switch key {
+		case "DEFAULT_TTL":
+			r.store.SetDefaultTTL(time.Duration(cfg.DefaultTTL) * time.Second)
+		case "SNAPSHOT_INTERVAL":
+			r.store.SetSnapshotInterval(cfg.SnapshotInterval)
+		case "EXPIRY_INTERVAL":
+			r.store.SetExpiryInterval(cfg.ExpiryInterval)
+		case "MAX_MEMORY":
+			r.store.SetMaxMemory(cfg.MaxMemory)
+		case "TOMBSTONE_TTL":
+			r.store.SetTombstoneTTL(cfg.TombstoneTTL)
+		case "LOG_LEVEL":
+			level, _ := logging.ParseLevel(cfg.LogLevel)
+			r.logLevel.Set(level)
+		}
+	}
+	r.cfg.Update(cfg, live)
+
+	slog.Info("config reloaded", "applied", live, "restart_required", restart)
+	if len(restart) > 0 {
+		slog.Warn("some config changes need a restart to take effect", "keys", restart)
+	}
+	return live, restart, nil
+}
@@ -3,8 +3,10 @@ module github.com/oskarsmoczynski/Go-Key-Value-Store
 go 1.24.5
 
 require (
+	golang.org/x/term v0.32.0
 	google.golang.org/grpc v1.74.2
 	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/raft"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdminServer implements the Admin service. It is registered on a
+// GRPCServer with EnableAdmin, and relies on AuthInterceptor to keep it
+// to admins.
+type AdminServer struct {
+	kvstore.UnimplementedAdminServer
+	store     *store.Store
+	reload    ReloadFunc
+	startedAt time.Time
+	// Set in cluster mode, flushes go through its log
+	raft *raft.Node
+}
+
+// ReloadFunc reloads the server configuration. It returns the config keys
+// that were applied and those that need a restart, or an error if the new
+// configuration was rejected and nothing changed.
+type ReloadFunc func() (applied, restartRequired []string, err error)
+
+// NewAdminServer returns an AdminServer. reload may be nil, in which case
+// ReloadConfig returns Unimplemented.
+func NewAdminServer(store *store.Store, reload ReloadFunc) *AdminServer {
+	return &AdminServer{
+		store:     store,
+		reload:    reload,
+		startedAt: time.Now(),
+	}
+}
+
+func (s *AdminServer) Snapshot(ctx context.Context, req *kvstore.SnapshotRequest) (*kvstore.SnapshotResponse, error) {
+	if err := s.store.SaveSnapshot(); err != nil {
+		return nil, status.Errorf(codes.Internal, "saving snapshot: %v", err)
+	}
+	return &kvstore.SnapshotResponse{}, nil
+}
+
+func (s *AdminServer) RewriteAOF(ctx context.Context, req *kvstore.RewriteAOFRequest) (*kvstore.RewriteAOFResponse, error) {
+	records, err := s.store.RewriteAOF()
+	if errors.Is(err, store.ErrRewriteUnsupported) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "rewriting AOF: %v", err)
+	}
+	return &kvstore.RewriteAOFResponse{Records: int64(records)}, nil
+}
+
+func (s *AdminServer) Flush(ctx context.Context, req *kvstore.FlushRequest) (*kvstore.FlushResponse, error) {
+	if req.Prefix == "" && !req.All {
+		return nil, status.Error(codes.InvalidArgument, "prefix cannot be empty, set all to flush every key")
+	}
+	if req.Prefix != "" && req.All {
+		return nil, status.Error(codes.InvalidArgument, "prefix and all are mutually exclusive")
+	}
+	// Read-only mode doesn't apply to admins, but a replica has to match
+	// its primary
+	if s.store.Primary() != "" {
+		return nil, writeRejection(s.store).Err()
+	}
+
+	result, err := applyWrite(ctx, s.store, s.raft, &kvstore.RaftCommand{Op: "flush", Prefix: req.Prefix})
+	if err != nil {
+		return nil, err
+	}
+	return &kvstore.FlushResponse{Deleted: int64(result.Count)}, nil
+}
+
+func (s *AdminServer) Info(ctx context.Context, req *kvstore.InfoRequest) (*kvstore.InfoResponse, error) {
+	info := s.store.Info()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	resp := &kvstore.InfoResponse{
+		UptimeSeconds:        int64(time.Since(s.startedAt) / time.Second),
+		Keys:                 int64(info.Keys),
+		KeysWithExpiry:       int64(info.KeysWithExpiry),
+		DataBytes:            info.DataBytes,
+		MaxMemoryBytes:       info.MaxMemory,
+		ExpiredKeys:          info.ExpiredKeys,
+		EvictedKeys:          info.EvictedKeys,
+		MemorySysBytes:       mem.Sys,
+		MemoryHeapAllocBytes: mem.HeapAlloc,
+		ReadOnly:             info.ReadOnly,
+		AofPath:              info.AOFPath,
+		AofSizeBytes:         info.AOFSize,
+		SnapshotDir:          info.SnapshotDir,
+	}
+	if !info.LastSnapshot.IsZero() {
+		resp.LastSnapshotUnix = info.LastSnapshot.Unix()
+	}
+	if info.LastSnapshotError != nil {
+		resp.LastSnapshotError = info.LastSnapshotError.Error()
+	}
+	if !info.LastAOFRewrite.IsZero() {
+		resp.LastAofRewriteUnix = info.LastAOFRewrite.Unix()
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) SetReadOnly(ctx context.Context, req *kvstore.SetReadOnlyRequest) (*kvstore.SetReadOnlyResponse, error) {
+	previous := s.store.SetReadOnly(req.ReadOnly)
+	return &kvstore.SetReadOnlyResponse{Previous: previous}, nil
+}
+
+func (s *AdminServer) ReloadConfig(ctx context.Context, req *kvstore.ReloadConfigRequest) (*kvstore.ReloadConfigResponse, error) {
+	if s.reload == nil {
+		return nil, status.Error(codes.Unimplemented, "config reload is not available")
+	}
+	applied, restartRequired, err := s.reload()
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "config not reloaded: %v", err)
+	}
+	return &kvstore.ReloadConfigResponse{Applied: applied, RestartRequired: restartRequired}, nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/changefeed"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Trailer that tells a consumer asking for a change that isn't retained
+// where the feed starts
+const oldestLSNTrailer = "kvstore-oldest-lsn"
+
+// ChangesServer implements the Changes service on top of a change feed
+// log. It is registered on a GRPCServer with EnableChangeFeed.
+type ChangesServer struct {
+	kvstore.UnimplementedChangesServer
+	log *changefeed.Log
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewChangesServer(log *changefeed.Log) *ChangesServer {
+	return &ChangesServer{log: log, done: make(chan struct{})}
+}
+
+// Ends the ChangeFeed streams, which would otherwise keep a graceful stop
+// waiting. The log itself stays open for the writes made during shutdown.
+func (s *ChangesServer) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+func (s *ChangesServer) ChangeFeed(req *kvstore.ChangeFeedRequest, stream kvstore.Changes_ChangeFeedServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	from := req.FromLsn
+	if req.FromNow {
+		from = s.log.Next()
+	}
+	err := s.log.Read(ctx, from, func(r changefeed.Record) error {
+		return stream.Send(changeToProto(r))
+	})
+
+	var rangeErr *changefeed.RangeError
+	switch {
+	case errors.As(err, &rangeErr):
+		stream.SetTrailer(metadata.Pairs(oldestLSNTrailer, strconv.FormatUint(rangeErr.First, 10)))
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, changefeed.ErrClosed):
+		return status.Error(codes.Unavailable, "server is shutting down")
+	case err != nil && stream.Context().Err() != nil:
+		return status.FromContextError(stream.Context().Err()).Err()
+	case err != nil && ctx.Err() != nil:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	return err
+}
+
+func changeToProto(r changefeed.Record) *kvstore.ChangeEvent {
+	return &kvstore.ChangeEvent{
+		Lsn:               r.LSN,
+		TimestampUnixNano: r.Time.UnixNano(),
+		Op:                r.Op,
+		Key:               r.Key,
+		Old:               changeValueToProto(r.Old),
+		New:               changeValueToProto(r.New),
+	}
+}
+
+func changeValueToProto(v *changefeed.Value) *kvstore.ChangeValue {
+	if v == nil {
+		return nil
+	}
+	value := &kvstore.ChangeValue{Value: v.Value, Version: v.Version, Flags: v.Flags}
+	if !v.ExpiresAt.IsZero() {
+		value.ExpiresAtUnixNano = v.ExpiresAt.UnixNano()
+	}
+	return value
+}
+
+func RegisterChangeFeedMetrics(reg *metrics.Registry, log *changefeed.Log) {
+	reg.NewGaugeFunc("kvstore_changefeed_last_lsn", "LSN of the last change written to the change feed.", func() float64 {
+		return float64(log.Stats().Last)
+	})
+	reg.NewGaugeFunc("kvstore_changefeed_first_lsn", "LSN of the oldest change the feed retains.", func() float64 {
+		return float64(log.Stats().First)
+	})
+	reg.NewGaugeFunc("kvstore_changefeed_bytes", "Bytes taken up on disk by the change feed's segments.", func() float64 {
+		return float64(log.Stats().Bytes)
+	})
+	reg.NewGaugeFunc("kvstore_changefeed_consumers", "Consumers currently reading the change feed.", func() float64 {
+		return float64(log.Stats().Readers)
+	})
+	reg.NewCounterFunc("kvstore_changefeed_write_errors_total", "Changes dropped because the change feed couldn't be written.", func() float64 {
+		return float64(log.Stats().WriteErrors)
+	})
+}
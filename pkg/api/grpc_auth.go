@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"strings"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Permission needed for each method. Methods not listed need admin.
+var methodPermissions = map[string]auth.Permission{
+	kvstore.KVStore_Get_FullMethodName:       auth.Read,
+	kvstore.KVStore_MGet_FullMethodName:      auth.Read,
+	kvstore.KVStore_Set_FullMethodName:       auth.Write,
+	kvstore.KVStore_MSet_FullMethodName:      auth.Write,
+	kvstore.KVStore_Delete_FullMethodName:    auth.Write,
+	kvstore.KVStore_MDelete_FullMethodName:   auth.Write,
+	kvstore.KVStore_Expire_FullMethodName:    auth.Write,
+	kvstore.KVStore_ExpireAt_FullMethodName:  auth.Write,
+	kvstore.KVStore_Persist_FullMethodName:   auth.Write,
+	kvstore.KVStore_TTL_FullMethodName:       auth.Read,
+	kvstore.Sharding_Topology_FullMethodName: auth.Read,
+}
+
+// AuthInterceptor checks the bearer token in the "authorization" metadata
+// and that its user may access every key in the request. A batch is
+// rejected as a whole if any of its keys is off limits. Pass an
+// *auth.ReloadableACL to be able to change the ACL later.
+func AuthInterceptor(acl auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		user, err := acl.Authenticate(bearerToken(ctx))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		perm, ok := methodPermissions[info.FullMethod]
+		if !ok {
+			perm = auth.Admin
+		}
+		keys, ok := requestKeys(req)
+		if !ok {
+			// Requests without keys are checked against the whole keyspace
+			keys = []string{""}
+		}
+		for _, key := range keys {
+			if !user.Allowed(perm, key) {
+				return nil, status.Errorf(codes.PermissionDenied, "user %s has no %s access to key %q", user.Name, perm, key)
+			}
+		}
+
+		return handler(auth.NewContext(ctx, user), req)
+	}
+}
+
+// Streams any authenticated user may open, they don't send key contents
+var userStreams = map[string]bool{
+	kvstore.Tracking_Invalidations_FullMethodName: true,
+}
+
+// AuthStreamInterceptor checks the bearer token of streaming calls, which
+// need admin permission unless listed in userStreams.
+func AuthStreamInterceptor(acl auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		user, err := acl.Authenticate(bearerToken(ss.Context()))
+		if err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		if !userStreams[info.FullMethod] && !user.Allowed(auth.Admin, "") {
+			return status.Errorf(codes.PermissionDenied, "user %s has no %s access to key %q", user.Name, auth.Admin, "")
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: auth.NewContext(ss.Context(), user)})
+	}
+}
+
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func requestKeys(req any) ([]string, bool) {
+	switch r := req.(type) {
+	case *kvstore.TopologyRequest:
+		// Any user may see the topology
+		return nil, true
+	case *kvstore.FlushRequest:
+		if r.All {
+			return []string{""}, true
+		}
+		return []string{r.Prefix}, true
+	case interface{ GetKey() string }:
+		return []string{r.GetKey()}, true
+	case interface{ GetKeys() []string }:
+		return r.GetKeys(), true
+	case *kvstore.MSetRequest:
+		keys := make([]string, len(r.Entries))
+		for i, entry := range r.Entries {
+			keys[i] = entry.Key
+		}
+		return keys, true
+	}
+	return nil, false
+}
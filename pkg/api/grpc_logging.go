@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const requestIDHeader = "x-request-id"
+
+// RPCLoggingInterceptor logs every gRPC call with a request ID. The ID is
+// taken from the caller's x-request-id metadata if set, generated otherwise,
+// and sent back in the response header. Handlers get a logger carrying it
+// through logging.FromContext.
+//
+// Successful calls are logged at debug level, client errors at info and
+// server errors at error.
+func RPCLoggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		id := incomingRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+
+		reqLogger := logger.With("request_id", id)
+		resp, err := handler(logging.NewContext(ctx, reqLogger), req)
+
+		code := status.Code(err)
+		attrs := []any{
+			"method", info.FullMethod,
+			"code", code.String(),
+			"duration", time.Since(start),
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			attrs = append(attrs, "peer", p.Addr.String())
+		}
+		if err != nil {
+			attrs = append(attrs, "error", status.Convert(err).Message())
+		}
+		reqLogger.Log(ctx, rpcLogLevel(code), "rpc", attrs...)
+		return resp, err
+	}
+}
+
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		// Cap the length so callers can't stuff the logs
+		if values := md.Get(requestIDHeader); len(values) > 0 && values[0] != "" && len(values[0]) <= 64 {
+			return values[0]
+		}
+	}
+	return logging.NewRequestID()
+}
+
+func rpcLogLevel(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelDebug
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
@@ -3,47 +3,268 @@ package api
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
+	"time"
 
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/changefeed"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/raft"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tracking"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type GRPCServer struct {
 	kvstore.UnimplementedKVStoreServer
-	store  *store.Store
-	server *grpc.Server
+	store       *store.Store
+	server      *grpc.Server
+	conns       connCounter
+	replication *ReplicationServer
+	admin       *AdminServer
+	raft        *raft.Node
+	sharding    *ShardingServer
+	changes     *ChangesServer
+	tracking    *TrackingServer
 }
 
-func NewGRPCServer(store *store.Store) *GRPCServer {
-	return &GRPCServer{
-		store:  store,
-		server: grpc.NewServer(),
+// The options are passed on to grpc.NewServer, e.g. grpc.Creds for TLS.
+func NewGRPCServer(store *store.Store, opts ...grpc.ServerOption) *GRPCServer {
+	s := &GRPCServer{
+		store: store,
 	}
+	// Chained interceptors run after the one set with grpc.UnaryInterceptor,
+	// so requests are authenticated before the read-only check
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.checkReadOnly, s.checkShard),
+		grpc.StatsHandler(&s.conns),
+	)
+	s.server = grpc.NewServer(opts...)
+	kvstore.RegisterKVStoreServer(s.server, s)
+	return s
 }
 
-func (s *GRPCServer) Start(port int) error {
-	kvstore.RegisterKVStoreServer(s.server, s)
+// ActiveConnections returns the number of open client connections.
+func (s *GRPCServer) ActiveConnections() int {
+	return int(s.conns.active.Load())
+}
+
+// EnableAdmin registers the Admin service, with reload backing its
+// ReloadConfig method. It must be called before the server starts.
+func (s *GRPCServer) EnableAdmin(reload ReloadFunc) {
+	s.admin = NewAdminServer(s.store, reload)
+	s.admin.raft = s.raft
+	kvstore.RegisterAdminServer(s.server, s.admin)
+}
+
+// EnableCluster registers the Raft service and sends writes through node's
+// log. Reads are served by the leader only, after a read barrier, so they
+// are linearizable. It must be called before the server starts.
+func (s *GRPCServer) EnableCluster(node *raft.Node) {
+	s.raft = node
+	if s.admin != nil {
+		s.admin.raft = node
+	}
+	kvstore.RegisterRaftServer(s.server, NewRaftServer(node))
+}
+
+// EnableReplication registers the Replication service, see
+// NewReplicationServer. It must be called before the server starts.
+func (s *GRPCServer) EnableReplication(log *replication.Log, replica *replication.Replica) *ReplicationServer {
+	s.replication = NewReplicationServer(s.store, log, replica)
+	kvstore.RegisterReplicationServer(s.server, s.replication)
+	return s.replication
+}
+
+// EnableChangeFeed registers the Changes service, which streams the
+// changes in log. It must be called before the server starts.
+func (s *GRPCServer) EnableChangeFeed(log *changefeed.Log) {
+	s.changes = NewChangesServer(log)
+	kvstore.RegisterChangesServer(s.server, s.changes)
+}
+
+// EnableTracking registers the Tracking service, which tells clients that
+// cache keys when they change. The table has to be told about changes, e.g.
+// as the store's change observer. It must be called before the server
+// starts.
+func (s *GRPCServer) EnableTracking(table *tracking.Table) {
+	s.tracking = NewTrackingServer(table)
+	kvstore.RegisterTrackingServer(s.server, s.tracking)
+}
+
+// EnableSharding registers the Sharding service and rejects keys that
+// other nodes own, pointing clients to the owner. See NewShardingServer for
+// the arguments. It must be called before the server starts.
+func (s *GRPCServer) EnableSharding(self string, ring *sharding.Ring, opts ShardingOptions) (*ShardingServer, error) {
+	srv, err := NewShardingServer(s.store, self, ring, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.sharding = srv
+	kvstore.RegisterShardingServer(s.server, s.sharding)
+	return s.sharding, nil
+}
+
+const readOnlyMessage = "server is in read-only mode"
+
+// Trailer and HTTP header that tell clients of a replica where to send
+// writes
+const (
+	primaryTrailer = "kvstore-primary"
+	primaryHeader  = "X-KVStore-Primary"
+)
+
+// Returns why st doesn't take writes, or nil if it does. Both are
+// FailedPrecondition, which clients don't retry: replicas give the
+// primary's address, so clients can redirect, and read-only mode lasts
+// until an admin turns it off.
+func writeRejection(st *store.Store) *status.Status {
+	if primary := st.Primary(); primary != "" {
+		return status.Newf(codes.FailedPrecondition, "replica is read-only, send writes to the primary at %s", primary)
+	}
+	if st.ReadOnly() {
+		return status.New(codes.FailedPrecondition, readOnlyMessage)
+	}
+	return nil
+}
+
+func (s *GRPCServer) checkReadOnly(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if methodPermissions[info.FullMethod] != auth.Write {
+		return handler(ctx, req)
+	}
+	if rejection := writeRejection(s.store); rejection != nil {
+		if primary := s.store.Primary(); primary != "" {
+			grpc.SetTrailer(ctx, metadata.Pairs(primaryTrailer, primary))
+		}
+		return nil, rejection.Err()
+	}
+	return handler(ctx, req)
+}
+
+// Runs a write through the cluster's log, or straight against the store
+// outside of a cluster.
+func applyWrite(ctx context.Context, st *store.Store, node *raft.Node, cmd *kvstore.RaftCommand) (raft.Result, error) {
+	if node == nil {
+		return raft.ApplyCommand(st, cmd), nil
+	}
+	data, err := proto.Marshal(cmd)
+	if err != nil {
+		return raft.Result{}, status.Errorf(codes.Internal, "encoding command: %v", err)
+	}
+	result, err := node.Apply(ctx, data)
+	if err != nil {
+		return raft.Result{}, raftError(ctx, err)
+	}
+	return result.(raft.Result), nil
+}
+
+func (s *GRPCServer) write(ctx context.Context, cmd *kvstore.RaftCommand) (raft.Result, error) {
+	return applyWrite(ctx, s.store, s.raft, cmd)
+}
+
+// Waits until reads reflect every committed write when in a cluster.
+func (s *GRPCServer) readBarrier(ctx context.Context) error {
+	if s.raft == nil {
+		return nil
+	}
+	if err := s.raft.ReadBarrier(ctx); err != nil {
+		return raftError(ctx, err)
+	}
+	return nil
+}
+
+func (s *GRPCServer) checkShard(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.sharding == nil {
+		return handler(ctx, req)
+	}
+	if _, ok := methodPermissions[info.FullMethod]; !ok {
+		return handler(ctx, req)
+	}
+	keys, ok := requestKeys(req)
+	if !ok || len(keys) == 0 {
+		return handler(ctx, req)
+	}
+	// A migration can't hand keys over while a request is using them
+	s.sharding.flip.RLock()
+	defer s.sharding.flip.RUnlock()
+	if err := s.sharding.checkKeys(ctx, keys); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
 
+func (s *GRPCServer) Start(port int) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	fmt.Printf("gRPC server starting on port %d...\n", port)
+	slog.Info("server starting", "protocol", "grpc", "port", port)
 
+	return s.Serve(lis)
+}
+
+// Serve accepts connections on lis until Stop is called.
+func (s *GRPCServer) Serve(lis net.Listener) error {
 	return s.server.Serve(lis)
 }
 
 func (s *GRPCServer) Stop() {
+	if s.replication != nil {
+		s.replication.stop()
+	}
+	if s.changes != nil {
+		s.changes.stop()
+	}
+	if s.tracking != nil {
+		s.tracking.stop()
+	}
+	if s.sharding != nil {
+		s.sharding.Close()
+	}
 	if s.server != nil {
 		s.server.GracefulStop()
 	}
 }
 
+// Shutdown stops accepting connections and waits for in-flight RPCs to
+// finish. When ctx is done first, the remaining RPCs are cancelled and
+// their connections closed.
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	if s.replication != nil {
+		s.replication.stop()
+	}
+	if s.changes != nil {
+		s.changes.stop()
+	}
+	if s.tracking != nil {
+		s.tracking.stop()
+	}
+	if s.sharding != nil {
+		s.sharding.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
 func (s *GRPCServer) Set(ctx context.Context, req *kvstore.SetRequest) (*kvstore.SetResponse, error) {
 	if req.Key == "" {
 		return &kvstore.SetResponse{
@@ -52,19 +273,46 @@ func (s *GRPCServer) Set(ctx context.Context, req *kvstore.SetRequest) (*kvstore
 		}, status.Error(codes.InvalidArgument, "key cannot be empty")
 	}
 
-	var ttlSeconds uint64
-	if req.TtlSeconds > 0 {
-		ttlSeconds = uint64(req.TtlSeconds)
+	if _, ok := setConditions[req.Condition]; !ok {
+		return &kvstore.SetResponse{
+			Success: false,
+			Error:   "unknown set condition",
+		}, status.Error(codes.InvalidArgument, "unknown set condition")
 	}
 
-	s.store.Set(req.Key, req.Value, ttlSeconds, true)
+	result, err := s.write(ctx, &kvstore.RaftCommand{
+		Op:                "set",
+		Key:               req.Key,
+		Value:             req.Value,
+		ExpiresAtUnixNano: raft.UnixNano(s.ttlExpiry(req.TtlSeconds, time.Now())),
+		Condition:         req.Condition,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &kvstore.SetResponse{
-		Success: true,
+		Success: result.OK,
 		Error:   "",
 	}, nil
 }
 
+var setConditions = map[kvstore.SetCondition]store.SetCondition{
+	kvstore.SetCondition_SET_CONDITION_ALWAYS:     store.SetAlways,
+	kvstore.SetCondition_SET_CONDITION_IF_ABSENT:  store.SetIfAbsent,
+	kvstore.SetCondition_SET_CONDITION_IF_PRESENT: store.SetIfPresent,
+}
+
+// A TTL of zero or less gets the default TTL. It is resolved here rather
+// than when the command is applied, so that every node of a cluster stores
+// the same expiry.
+func (s *GRPCServer) ttlExpiry(ttlSeconds int64, now time.Time) time.Time {
+	if ttlSeconds <= 0 {
+		return s.store.DefaultExpiry(now)
+	}
+	return now.Add(time.Duration(ttlSeconds) * time.Second)
+}
+
 func (s *GRPCServer) Get(ctx context.Context, req *kvstore.GetRequest) (*kvstore.GetResponse, error) {
 	if req.Key == "" {
 		return &kvstore.GetResponse{
@@ -74,11 +322,16 @@ func (s *GRPCServer) Get(ctx context.Context, req *kvstore.GetRequest) (*kvstore
 		}, status.Error(codes.InvalidArgument, "key cannot be empty")
 	}
 
-	value, found := s.store.Get(req.Key)
+	if err := s.readBarrier(ctx); err != nil {
+		return nil, err
+	}
+	tracker := s.startTracking(ctx, req.Key)
+	item, found := s.store.GetItem(req.Key)
+	tracker.finish([]store.Item{item})
 
 	return &kvstore.GetResponse{
 		Found: found,
-		Value: value,
+		Value: item.Value,
 		Error: "",
 	}, nil
 }
@@ -91,10 +344,176 @@ func (s *GRPCServer) Delete(ctx context.Context, req *kvstore.DeleteRequest) (*k
 		}, status.Error(codes.InvalidArgument, "key cannot be empty")
 	}
 
-	s.store.Delete(req.Key)
+	if _, err := s.write(ctx, &kvstore.RaftCommand{Op: "delete", Key: req.Key}); err != nil {
+		return nil, err
+	}
 
 	return &kvstore.DeleteResponse{
 		Success: true,
 		Error:   "",
 	}, nil
 }
+
+// The batch RPCs report problems with single keys in their results, so one
+// bad key doesn't fail the whole batch. Results are in request order.
+
+func (s *GRPCServer) MGet(ctx context.Context, req *kvstore.MGetRequest) (*kvstore.MGetResponse, error) {
+	if err := s.readBarrier(ctx); err != nil {
+		return nil, err
+	}
+	tracker := s.startTracking(ctx, req.Keys...)
+	items, found := s.store.MGet(req.Keys)
+	tracker.finish(items)
+
+	results := make([]*kvstore.MGetResult, len(req.Keys))
+	for i, key := range req.Keys {
+		if key == "" {
+			results[i] = &kvstore.MGetResult{Key: key, Error: "key cannot be empty"}
+			continue
+		}
+		results[i] = &kvstore.MGetResult{
+			Key:   key,
+			Found: found[i],
+			Value: items[i].Value,
+		}
+	}
+
+	return &kvstore.MGetResponse{Results: results}, nil
+}
+
+func (s *GRPCServer) MSet(ctx context.Context, req *kvstore.MSetRequest) (*kvstore.MSetResponse, error) {
+	now := time.Now()
+	results := make([]*kvstore.MSetResult, len(req.Entries))
+	cmd := &kvstore.RaftCommand{Op: "mset"}
+	for i, entry := range req.Entries {
+		if entry.Key == "" {
+			results[i] = &kvstore.MSetResult{Key: entry.Key, Error: "key cannot be empty"}
+			continue
+		}
+		if entry.Condition != kvstore.SetCondition_SET_CONDITION_ALWAYS {
+			results[i] = &kvstore.MSetResult{Key: entry.Key, Error: "conditions are not supported in MSet"}
+			continue
+		}
+		cmd.Entries = append(cmd.Entries, &kvstore.RaftCommand{
+			Key:               entry.Key,
+			Value:             entry.Value,
+			ExpiresAtUnixNano: raft.UnixNano(s.ttlExpiry(entry.TtlSeconds, now)),
+		})
+		results[i] = &kvstore.MSetResult{Key: entry.Key, Success: true}
+	}
+
+	if _, err := s.write(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	return &kvstore.MSetResponse{Results: results}, nil
+}
+
+func (s *GRPCServer) MDelete(ctx context.Context, req *kvstore.MDeleteRequest) (*kvstore.MDeleteResponse, error) {
+	result, err := s.write(ctx, &kvstore.RaftCommand{Op: "mdelete", Keys: req.Keys})
+	if err != nil {
+		return nil, err
+	}
+	deleted := result.Deleted
+
+	results := make([]*kvstore.MDeleteResult, len(req.Keys))
+	for i, key := range req.Keys {
+		if key == "" {
+			results[i] = &kvstore.MDeleteResult{Key: key, Error: "key cannot be empty"}
+			continue
+		}
+		results[i] = &kvstore.MDeleteResult{Key: key, Deleted: deleted[i]}
+	}
+
+	return &kvstore.MDeleteResponse{Results: results}, nil
+}
+
+func (s *GRPCServer) Expire(ctx context.Context, req *kvstore.ExpireRequest) (*kvstore.ExpireResponse, error) {
+	if req.Key == "" {
+		return &kvstore.ExpireResponse{
+			Error: "key cannot be empty",
+		}, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+
+	// Unlike in Set, a TTL that isn't positive expires the key right away
+	expiresAt := time.Now().Add(time.Duration(req.TtlSeconds) * time.Second)
+	if req.TtlSeconds <= 0 {
+		expiresAt = time.Now().Add(-time.Second)
+	}
+
+	return s.expire(ctx, req.Key, expiresAt)
+}
+
+func (s *GRPCServer) ExpireAt(ctx context.Context, req *kvstore.ExpireAtRequest) (*kvstore.ExpireResponse, error) {
+	if req.Key == "" {
+		return &kvstore.ExpireResponse{
+			Error: "key cannot be empty",
+		}, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+
+	// Timestamps at or before the epoch are in the past, not "no expiry"
+	expiresAt := time.Unix(req.UnixSeconds, 0)
+	if req.UnixSeconds <= 0 {
+		expiresAt = time.Unix(0, 1)
+	}
+
+	return s.expire(ctx, req.Key, expiresAt)
+}
+
+func (s *GRPCServer) expire(ctx context.Context, key string, expiresAt time.Time) (*kvstore.ExpireResponse, error) {
+	result, err := s.write(ctx, &kvstore.RaftCommand{
+		Op:                "expire",
+		Key:               key,
+		ExpiresAtUnixNano: raft.UnixNano(expiresAt),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kvstore.ExpireResponse{
+		Updated: result.OK,
+	}, nil
+}
+
+func (s *GRPCServer) Persist(ctx context.Context, req *kvstore.PersistRequest) (*kvstore.PersistResponse, error) {
+	if req.Key == "" {
+		return &kvstore.PersistResponse{
+			Error: "key cannot be empty",
+		}, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+
+	result, err := s.write(ctx, &kvstore.RaftCommand{Op: "persist", Key: req.Key})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kvstore.PersistResponse{
+		Updated: result.OK,
+	}, nil
+}
+
+func (s *GRPCServer) TTL(ctx context.Context, req *kvstore.TTLRequest) (*kvstore.TTLResponse, error) {
+	if req.Key == "" {
+		return &kvstore.TTLResponse{
+			Error: "key cannot be empty",
+		}, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+
+	if err := s.readBarrier(ctx); err != nil {
+		return nil, err
+	}
+	item, found := s.store.GetItem(req.Key)
+	if !found {
+		return &kvstore.TTLResponse{Found: false}, nil
+	}
+	if item.ExpiresAt.IsZero() {
+		return &kvstore.TTLResponse{Found: true, TtlSeconds: -1}, nil
+	}
+
+	// Round up, so a key that is still there never reports a TTL of 0
+	remaining := time.Until(item.ExpiresAt)
+	return &kvstore.TTLResponse{
+		Found:      true,
+		TtlSeconds: int64((remaining + time.Second - 1) / time.Second),
+	}, nil
+}
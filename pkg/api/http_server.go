@@ -0,0 +1,449 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	maxHTTPValueSize = 64 << 20
+	defaultPageSize  = 100
+	maxPageSize      = 1000
+)
+
+// HTTPServer is a JSON gateway to the store for curl and browser tools.
+type HTTPServer struct {
+	store  *store.Store
+	server *http.Server
+	conns  atomic.Int64
+	// Nil unless EnableAuth was called
+	acl auth.Authenticator
+}
+
+type httpItem struct {
+	Key        string     `json:"key"`
+	Value      string     `json:"value"`
+	Version    uint64     `json:"version"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty"`
+}
+
+type httpKeyList struct {
+	Keys       []httpItem `json:"keys"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// Error bodies follow the Google API style: the HTTP status, the name of the
+// matching gRPC code and a message.
+type httpError struct {
+	Error httpErrorBody `json:"error"`
+}
+
+type httpErrorBody struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func NewHTTPServer(store *store.Store) *HTTPServer {
+	s := &HTTPServer{store: store}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/keys", s.listKeys)
+	mux.HandleFunc("GET /v1/keys/{key...}", s.getKey)
+	mux.HandleFunc("PUT /v1/keys/{key...}", s.putKey)
+	mux.HandleFunc("DELETE /v1/keys/{key...}", s.deleteKey)
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnState:         s.trackConn,
+	}
+	return s
+}
+
+// EnableAuth requires a bearer token from acl in the Authorization header,
+// and checks the user's access to the keys of each request like the gRPC
+// API does. Pass an *auth.ReloadableACL to be able to change the ACL later.
+func (s *HTTPServer) EnableAuth(acl auth.Authenticator) {
+	s.acl = acl
+}
+
+func (s *HTTPServer) trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.conns.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		s.conns.Add(-1)
+	}
+}
+
+// ActiveConnections returns the number of open client connections.
+func (s *HTTPServer) ActiveConnections() int {
+	return int(s.conns.Load())
+}
+
+func (s *HTTPServer) Handler() http.Handler {
+	return s.server.Handler
+}
+
+func (s *HTTPServer) Start(port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	slog.Info("server starting", "protocol", "http", "port", port)
+
+	return s.Serve(lis)
+}
+
+func (s *HTTPServer) Serve(lis net.Listener) error {
+	if err := s.server.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *HTTPServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to
+// finish, closing the connections left when ctx is done.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *HTTPServer) getKey(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeHTTPError(w, codes.InvalidArgument, "key cannot be empty")
+		return
+	}
+	if !s.authorize(w, r, auth.Read, key) {
+		return
+	}
+
+	item, found := s.store.GetItem(key)
+	if !found {
+		writeHTTPError(w, codes.NotFound, "key not found")
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(item.Version))
+	if etagMatches(r.Header.Get("If-None-Match"), item.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, newHTTPItem(key, item))
+}
+
+func (s *HTTPServer) putKey(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.Write, r.PathValue("key")) || s.rejectWrite(w) {
+		return
+	}
+	key := r.PathValue("key")
+	if key == "" {
+		writeHTTPError(w, codes.InvalidArgument, "key cannot be empty")
+		return
+	}
+
+	ttl, err := requestTTL(r)
+	if err != nil {
+		writeHTTPError(w, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPValueSize))
+	if err != nil {
+		writeHTTPError(w, codes.InvalidArgument, "reading body: "+err.Error())
+		return
+	}
+
+	opts := store.SetOptions{ExpiresAt: s.store.DefaultExpiry(time.Now())}
+	if ttl > 0 {
+		opts.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	if r.Header.Get("If-None-Match") == "*" {
+		opts.Condition = store.SetIfAbsent
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, ok := s.matchingVersion(key, ifMatch)
+		if !ok {
+			writeHTTPError(w, codes.FailedPrecondition, "version does not match")
+			return
+		}
+		opts.IfVersion = version
+	}
+
+	item, ok := s.store.SetWithOptions(key, string(body), opts)
+	if !ok {
+		if opts.Condition == store.SetIfAbsent {
+			writeHTTPError(w, codes.FailedPrecondition, "key already exists")
+		} else {
+			writeHTTPError(w, codes.FailedPrecondition, "version does not match")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(item.Version))
+	writeJSON(w, http.StatusOK, newHTTPItem(key, item))
+}
+
+func (s *HTTPServer) deleteKey(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.Write, r.PathValue("key")) || s.rejectWrite(w) {
+		return
+	}
+	key := r.PathValue("key")
+	if key == "" {
+		writeHTTPError(w, codes.InvalidArgument, "key cannot be empty")
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, ok := s.matchingVersion(key, ifMatch)
+		if !ok {
+			writeHTTPError(w, codes.FailedPrecondition, "version does not match")
+			return
+		}
+		if _, ok := s.store.DeleteIfVersion(key, version); !ok {
+			writeHTTPError(w, codes.FailedPrecondition, "version does not match")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !s.store.Delete(key) {
+		writeHTTPError(w, codes.NotFound, "key not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists keys in key order. The cursor is opaque to clients: pass the
+// next_cursor of one page to get the next one.
+func (s *HTTPServer) listKeys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !s.authorize(w, r, auth.Read, query.Get("prefix")) {
+		return
+	}
+
+	limit := defaultPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxPageSize {
+			writeHTTPError(w, codes.InvalidArgument, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = n
+	}
+
+	var after string
+	if cursor := query.Get("cursor"); cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			writeHTTPError(w, codes.InvalidArgument, "invalid cursor")
+			return
+		}
+		after = string(decoded)
+	}
+
+	entries, more := s.store.Scan(query.Get("prefix"), after, limit)
+	list := httpKeyList{Keys: make([]httpItem, 0, len(entries))}
+	for _, entry := range entries {
+		list.Keys = append(list.Keys, newHTTPItem(entry.Key, entry.Item))
+	}
+	if more {
+		list.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(entries[len(entries)-1].Key))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Checks the bearer token and that its user has perm on key, or on every
+// key starting with it for listings. Answers with an error otherwise.
+func (s *HTTPServer) authorize(w http.ResponseWriter, r *http.Request, perm auth.Permission, key string) bool {
+	if s.acl == nil {
+		return true
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = ""
+	}
+	user, err := s.acl.Authenticate(strings.TrimSpace(token))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeHTTPError(w, codes.Unauthenticated, err.Error())
+		return false
+	}
+	if !user.Allowed(perm, key) {
+		writeHTTPError(w, codes.PermissionDenied, fmt.Sprintf("user %s has no %s access to key %q", user.Name, perm, key))
+		return false
+	}
+	return true
+}
+
+// Resolves an If-Match header against the current item. Returns the version
+// to use for the conditional write, or false if the precondition fails.
+func (s *HTTPServer) matchingVersion(key string, ifMatch string) (uint64, bool) {
+	item, found := s.store.GetItem(key)
+	if !found || !etagMatches(ifMatch, item.Version) {
+		return 0, false
+	}
+	return item.Version, true
+}
+
+// TTL in seconds from the ttl query parameter or the X-TTL header.
+func requestTTL(r *http.Request) (int64, error) {
+	value := r.URL.Query().Get("ttl")
+	if value == "" {
+		value = r.Header.Get("X-TTL")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	ttl, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid ttl %q", value)
+	}
+	return ttl, nil
+}
+
+func formatETag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// Checks an If-Match/If-None-Match header, a list of ETags or "*".
+func etagMatches(header string, version uint64) bool {
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == formatETag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+func newHTTPItem(key string, item store.Item) httpItem {
+	result := httpItem{
+		Key:     key,
+		Value:   item.Value,
+		Version: item.Version,
+	}
+	if !item.ExpiresAt.IsZero() {
+		expiresAt := item.ExpiresAt.UTC()
+		result.ExpiresAt = &expiresAt
+		result.TTLSeconds = int64(time.Until(item.ExpiresAt).Round(time.Second) / time.Second)
+	}
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Answers with an error when the store is read-only or a replica. Replicas
+// answer 421 with the primary's address in a header, read-only mode 409,
+// like FailedPrecondition on gRPC it isn't worth retrying elsewhere. 412 is
+// kept for failed conditional requests.
+func (s *HTTPServer) rejectWrite(w http.ResponseWriter) bool {
+	rejection := writeRejection(s.store)
+	if rejection == nil {
+		return false
+	}
+	httpStatus := http.StatusConflict
+	if primary := s.store.Primary(); primary != "" {
+		w.Header().Set(primaryHeader, primary)
+		httpStatus = http.StatusMisdirectedRequest
+	}
+	writeJSON(w, httpStatus, httpError{Error: httpErrorBody{
+		Code:    httpStatus,
+		Status:  codeName(rejection.Code()),
+		Message: rejection.Message(),
+	}})
+	return true
+}
+
+func writeHTTPError(w http.ResponseWriter, code codes.Code, message string) {
+	status := httpStatusFromCode(code)
+	writeJSON(w, status, httpError{Error: httpErrorBody{
+		Code:    status,
+		Status:  codeName(code),
+		Message: message,
+	}})
+}
+
+// Same mapping as grpc-gateway, except for FailedPrecondition which maps to
+// 412 because it's only used for failed conditional requests here.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// Turns "InvalidArgument" into "INVALID_ARGUMENT".
+func codeName(code codes.Code) string {
+	var sb strings.Builder
+	prev := rune(0)
+	for _, r := range code.String() {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return sb.String()
+}
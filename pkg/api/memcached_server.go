@@ -0,0 +1,431 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+const (
+	memcachedMaxKeyLength = 250
+	memcachedMaxValueSize = 1 << 20
+	// Expiry times up to 30 days are relative, anything larger is a unix timestamp
+	memcachedMaxRelativeExptime = 60 * 60 * 24 * 30
+)
+
+// MemcachedServer speaks the memcached ASCII protocol for legacy clients.
+// The memcached CAS value is the item version.
+type MemcachedServer struct {
+	store *store.Store
+	tcp   tcpListener
+}
+
+type memcachedConn struct {
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	noreply bool
+	quit    bool
+}
+
+// Errors that are sent back to the client instead of closing the connection
+type memcachedClientError string
+
+func (e memcachedClientError) Error() string {
+	return string(e)
+}
+
+var errMemcachedBadFormat = memcachedClientError("bad command line format")
+
+func NewMemcachedServer(store *store.Store) *MemcachedServer {
+	return &MemcachedServer{
+		store: store,
+	}
+}
+
+func (s *MemcachedServer) Start(port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	slog.Info("server starting", "protocol", "memcached", "port", port)
+
+	return s.Serve(lis)
+}
+
+// Serve accepts connections on lis until Stop is called.
+func (s *MemcachedServer) Serve(lis net.Listener) error {
+	return s.tcp.serve(lis, s.handleConn)
+}
+
+// ActiveConnections returns the number of open client connections.
+func (s *MemcachedServer) ActiveConnections() int {
+	return s.tcp.activeConns()
+}
+
+func (s *MemcachedServer) Stop() {
+	s.tcp.stop()
+}
+
+// Shutdown stops accepting connections and waits for the open ones to
+// finish their current command, closing those left when ctx is done.
+func (s *MemcachedServer) Shutdown(ctx context.Context) error {
+	return s.tcp.shutdown(ctx)
+}
+
+func (s *MemcachedServer) handleConn(conn net.Conn) {
+	c := &memcachedConn{
+		reader: bufio.NewReaderSize(conn, 4096),
+		writer: bufio.NewWriter(conn),
+	}
+
+	for !c.quit {
+		line, err := c.reader.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				c.writer.WriteString("CLIENT_ERROR line too long\r\n")
+			}
+			// Replies to earlier commands of a pipeline may still be buffered
+			c.writer.Flush()
+			return
+		}
+
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			c.reply("ERROR")
+		} else if err := s.dispatch(c, fields); err != nil {
+			var clientErr memcachedClientError
+			if !errors.As(err, &clientErr) {
+				return
+			}
+			c.noreply = false
+			c.reply("CLIENT_ERROR " + clientErr.Error())
+		}
+
+		// Only flush once a pipeline of commands has been handled
+		if c.reader.Buffered() == 0 {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.writer.Flush()
+}
+
+func (c *memcachedConn) reply(line string) {
+	if c.noreply {
+		return
+	}
+	c.writer.WriteString(line)
+	c.writer.WriteString("\r\n")
+}
+
+func (s *MemcachedServer) dispatch(c *memcachedConn, fields []string) error {
+	c.noreply = false
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "get", "gets":
+		return s.get(c, args, name == "gets")
+	case "set", "add", "replace", "cas":
+		return s.storeValue(c, name, args)
+	case "delete":
+		return s.delete(c, args)
+	case "incr", "decr":
+		return s.incr(c, args, name == "decr")
+	case "touch":
+		return s.touch(c, args)
+	case "version":
+		c.reply("VERSION kvstore")
+	case "quit":
+		c.quit = true
+	default:
+		c.reply("ERROR")
+	}
+	return nil
+}
+
+// Strips a trailing "noreply" and checks the argument count.
+func (c *memcachedConn) parseArgs(args []string, min, max int) ([]string, error) {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+		args = args[:len(args)-1]
+	}
+	if len(args) < min || len(args) > max {
+		return nil, errMemcachedBadFormat
+	}
+	if err := checkMemcachedKey(args[0]); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func checkMemcachedKey(key string) error {
+	if len(key) > memcachedMaxKeyLength {
+		return errMemcachedBadFormat
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7F {
+			return errMemcachedBadFormat
+		}
+	}
+	return nil
+}
+
+// Converts a memcached exptime to an expiry time. Zero means no expiry, even
+// with a DEFAULT_TTL, negative values and timestamps in the past mean
+// already expired.
+func memcachedExpiry(exptime string) (time.Time, error) {
+	n, err := strconv.ParseInt(exptime, 10, 64)
+	if err != nil {
+		return time.Time{}, errMemcachedBadFormat
+	}
+
+	switch {
+	case n == 0:
+		return time.Time{}, nil
+	case n < 0:
+		return time.Now().Add(-time.Second), nil
+	case n <= memcachedMaxRelativeExptime:
+		return time.Now().Add(time.Duration(n) * time.Second), nil
+	}
+	return time.Unix(n, 0), nil
+}
+
+// Answers with an error when the store is read-only or a replica. Storage
+// commands call it after reading their data block, so the connection stays
+// usable.
+func (s *MemcachedServer) rejectReadOnly(c *memcachedConn) bool {
+	rejection := writeRejection(s.store)
+	if rejection == nil {
+		return false
+	}
+	c.noreply = false
+	c.reply("SERVER_ERROR " + rejection.Message())
+	return true
+}
+
+func isPast(t time.Time) bool {
+	return !t.IsZero() && !t.After(time.Now())
+}
+
+func (s *MemcachedServer) get(c *memcachedConn, keys []string, withCAS bool) error {
+	if len(keys) == 0 {
+		return errMemcachedBadFormat
+	}
+	for _, key := range keys {
+		if err := checkMemcachedKey(key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		item, found := s.store.GetItem(key)
+		if !found {
+			continue
+		}
+		if withCAS {
+			fmt.Fprintf(c.writer, "VALUE %s %d %d %d\r\n", key, item.Flags, len(item.Value), item.Version)
+		} else {
+			fmt.Fprintf(c.writer, "VALUE %s %d %d\r\n", key, item.Flags, len(item.Value))
+		}
+		c.writer.WriteString(item.Value)
+		c.writer.WriteString("\r\n")
+	}
+	c.reply("END")
+	return nil
+}
+
+// Handles set, add, replace and cas, which all take a data block.
+func (s *MemcachedServer) storeValue(c *memcachedConn, name string, args []string) error {
+	want := 4
+	if name == "cas" {
+		want = 5
+	}
+	args, err := c.parseArgs(args, want, want)
+	if err != nil {
+		return err
+	}
+
+	key := args[0]
+	flags, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return errMemcachedBadFormat
+	}
+	expiresAt, err := memcachedExpiry(args[2])
+	if err != nil {
+		return err
+	}
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		return errMemcachedBadFormat
+	}
+	var casUnique uint64
+	if name == "cas" {
+		if casUnique, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return errMemcachedBadFormat
+		}
+	}
+
+	// The data block has to be consumed even if the value is rejected
+	if size > memcachedMaxValueSize {
+		if _, err := c.reader.Discard(size + 2); err != nil {
+			return err
+		}
+		c.noreply = false
+		c.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		return memcachedClientError("bad data chunk")
+	}
+	value := string(data[:size])
+	if s.rejectReadOnly(c) {
+		return nil
+	}
+
+	opts := store.SetOptions{
+		ExpiresAt: expiresAt,
+		Flags:     uint32(flags),
+	}
+	switch name {
+	case "add":
+		opts.Condition = store.SetIfAbsent
+	case "replace":
+		opts.Condition = store.SetIfPresent
+	case "cas":
+		opts.Condition = store.SetIfPresent
+		opts.IfVersion = casUnique
+		if casUnique == 0 {
+			// Versions start at 1, so nothing can match
+			if _, found := s.store.GetItem(key); found {
+				c.reply("EXISTS")
+			} else {
+				c.reply("NOT_FOUND")
+			}
+			return nil
+		}
+	}
+
+	current, ok := s.store.SetWithOptions(key, value, opts)
+	switch {
+	case ok:
+		// Items stored with an expiry in the past vanish straight away
+		if isPast(expiresAt) {
+			s.store.Delete(key)
+		}
+		c.reply("STORED")
+	case name != "cas":
+		c.reply("NOT_STORED")
+	case current.Version == 0:
+		c.reply("NOT_FOUND")
+	default:
+		c.reply("EXISTS")
+	}
+	return nil
+}
+
+func (s *MemcachedServer) delete(c *memcachedConn, args []string) error {
+	// Old clients may still send a hold time of 0
+	args, err := c.parseArgs(args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 && args[1] != "0" {
+		return memcachedClientError("bad command line format.  Usage: delete <key> [noreply]")
+	}
+	if s.rejectReadOnly(c) {
+		return nil
+	}
+
+	if s.store.Delete(args[0]) {
+		c.reply("DELETED")
+	} else {
+		c.reply("NOT_FOUND")
+	}
+	return nil
+}
+
+// Values are unsigned 64-bit integers: incr wraps around, decr stops at 0.
+func (s *MemcachedServer) incr(c *memcachedConn, args []string, decr bool) error {
+	args, err := c.parseArgs(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return memcachedClientError("invalid numeric delta argument")
+	}
+	if s.rejectReadOnly(c) {
+		return nil
+	}
+
+	key := args[0]
+	for {
+		item, found := s.store.GetItem(key)
+		if !found {
+			c.reply("NOT_FOUND")
+			return nil
+		}
+		current, err := strconv.ParseUint(item.Value, 10, 64)
+		if err != nil {
+			c.noreply = false
+			c.reply("CLIENT_ERROR cannot increment or decrement non-numeric value")
+			return nil
+		}
+
+		next := current + delta
+		if decr {
+			next = 0
+			if current > delta {
+				next = current - delta
+			}
+		}
+
+		// Retry if someone else changed the key in the meantime
+		value := strconv.FormatUint(next, 10)
+		_, ok := s.store.SetWithOptions(key, value, store.SetOptions{
+			KeepTTL:   true,
+			IfVersion: item.Version,
+			Flags:     item.Flags,
+		})
+		if ok {
+			c.reply(value)
+			return nil
+		}
+	}
+}
+
+func (s *MemcachedServer) touch(c *memcachedConn, args []string) error {
+	args, err := c.parseArgs(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	expiresAt, err := memcachedExpiry(args[1])
+	if err != nil {
+		return err
+	}
+	if s.rejectReadOnly(c) {
+		return nil
+	}
+
+	if s.store.Expire(args[0], expiresAt) {
+		c.reply("TOUCHED")
+	} else {
+		c.reply("NOT_FOUND")
+	}
+	return nil
+}
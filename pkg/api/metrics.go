@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsServer serves the registry on /metrics in the Prometheus format.
+type MetricsServer struct {
+	server *http.Server
+}
+
+func NewMetricsServer(reg *metrics.Registry) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", reg.Handler())
+	return &MetricsServer{
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (s *MetricsServer) Start(port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	slog.Info("server starting", "protocol", "metrics", "port", port)
+
+	return s.Serve(lis)
+}
+
+func (s *MetricsServer) Serve(lis net.Listener) error {
+	if err := s.server.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *MetricsServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to
+// finish, closing the connections left when ctx is done.
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+		return err
+	}
+	return nil
+}
+
+// RPCMetricsInterceptor counts gRPC calls by method and status code, and
+// records their latency. It should run before the auth interceptor so
+// rejected calls are counted too.
+func RPCMetricsInterceptor(reg *metrics.Registry) grpc.UnaryServerInterceptor {
+	requests := reg.NewCounter("kvstore_grpc_requests_total",
+		"gRPC requests handled, by method and status code.", "method", "code")
+	latency := reg.NewHistogram("kvstore_grpc_request_duration_seconds",
+		"Time taken to handle gRPC requests, by method.", metrics.DefaultBuckets, "method")
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		latency.With(info.FullMethod).Observe(time.Since(start).Seconds())
+		requests.With(info.FullMethod, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// RegisterStoreMetrics exports the store's key counts and persistence status.
+func RegisterStoreMetrics(reg *metrics.Registry, st *store.Store) {
+	// Info walks every key, so scrapes share one result per second
+	var cache struct {
+		sync.Mutex
+		at   time.Time
+		info store.Info
+	}
+	info := func() store.Info {
+		cache.Lock()
+		defer cache.Unlock()
+		if time.Since(cache.at) > time.Second {
+			cache.info = st.Info()
+			cache.at = time.Now()
+		}
+		return cache.info
+	}
+
+	reg.NewGaugeFunc("kvstore_keys", "Keys currently stored.", func() float64 {
+		return float64(info().Keys)
+	})
+	reg.NewGaugeFunc("kvstore_keys_with_expiry", "Keys that have a TTL.", func() float64 {
+		return float64(info().KeysWithExpiry)
+	})
+	reg.NewGaugeFunc("kvstore_data_bytes", "Bytes taken up by keys and values.", func() float64 {
+		return float64(info().DataBytes)
+	})
+	reg.NewCounterFunc("kvstore_expired_keys_total", "Keys removed because their TTL ran out.", func() float64 {
+		return float64(info().ExpiredKeys)
+	})
+	reg.NewCounterFunc("kvstore_evicted_keys_total", "Keys evicted to stay under the memory limit.", func() float64 {
+		return float64(info().EvictedKeys)
+	})
+	reg.NewGaugeFunc("kvstore_read_only", "1 if the store is in read-only mode.", func() float64 {
+		if st.ReadOnly() {
+			return 1
+		}
+		return 0
+	})
+	reg.NewGaugeFunc("kvstore_aof_size_bytes", "Size of the append-only file.", func() float64 {
+		return float64(info().AOFSize)
+	})
+	reg.NewCounterFunc("kvstore_aof_write_errors_total", "AOF records that couldn't be written after retrying.", func() float64 {
+		return float64(info().AOFWriteErrors)
+	})
+	reg.NewGaugeFunc("kvstore_snapshot_duration_seconds", "Time taken by the last snapshot.", func() float64 {
+		return info().LastSnapshotDuration.Seconds()
+	})
+	reg.NewGaugeFunc("kvstore_snapshot_age_seconds", "Time since the last snapshot, NaN before the first one.", func() float64 {
+		last := info().LastSnapshot
+		if last.IsZero() {
+			return math.NaN()
+		}
+		return time.Since(last).Seconds()
+	})
+	reg.NewGaugeFunc("kvstore_snapshot_failed", "1 if the last snapshot failed.", func() float64 {
+		if info().LastSnapshotError != nil {
+			return 1
+		}
+		return 0
+	})
+}
+
+// RegisterConnectionMetrics exports the open connections of a server under
+// the given protocol label.
+func RegisterConnectionMetrics(reg *metrics.Registry, protocol string, server interface{ ActiveConnections() int }) {
+	reg.NewGaugeFunc("kvstore_active_connections", "Open client connections, by protocol.", func() float64 {
+		return float64(server.ActiveConnections())
+	}, metrics.Label{Name: "protocol", Value: protocol})
+}
+
+// Counts open connections for the gRPC server.
+type connCounter struct {
+	active atomic.Int64
+}
+
+func (c *connCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		c.active.Add(1)
+	case *stats.ConnEnd:
+		c.active.Add(-1)
+	}
+}
+
+func (c *connCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleRPC(context.Context, stats.RPCStats) {}
@@ -0,0 +1,491 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Entries per ImportKeys message
+const importChunkSize = 500
+
+// Migration states
+const (
+	migrationIdle       = "idle"
+	migrationCopying    = "copying"
+	migrationForwarding = "forwarding"
+	migrationDone       = "done"
+	migrationFailed     = "failed"
+	migrationAborted    = "aborted"
+)
+
+// A migration hands some of this node's tokens to another node. It copies
+// the keys in their ranges, then forwards the writes to them that happened
+// since, and finally blocks keyed requests for as long as it takes to send
+// the last writes and switch to a topology in which the target owns the
+// tokens.
+type migration struct {
+	target sharding.Node
+	tokens []uint64
+	ranges []sharding.Range
+	// Writes to the ranges, fed by ShardingServer.Observe
+	log    *replication.Log
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status *kvstore.MigrationStatus
+}
+
+func (m *migration) owns(key string) bool {
+	hash := sharding.Hash(key)
+	for _, r := range m.ranges {
+		if r.Contains(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *migration) observe(entry persistance.AOFEntry) {
+	if entry, ok := m.filter(entry); ok {
+		m.log.Append(entry)
+	}
+}
+
+// Keeps the parts of a write that touch the migrated ranges.
+func (m *migration) filter(entry persistance.AOFEntry) (persistance.AOFEntry, bool) {
+	if entry.Op != "batch" {
+		return entry, m.owns(entry.Key)
+	}
+	var kept []persistance.AOFEntry
+	for _, e := range entry.Entries {
+		if e, ok := m.filter(e); ok {
+			kept = append(kept, e)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return persistance.AOFEntry{}, false
+	case 1:
+		return kept[0], true
+	}
+	entry.Entries = kept
+	return entry, true
+}
+
+func (m *migration) update(fn func(st *kvstore.MigrationStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(m.status)
+}
+
+func (m *migration) Status() *kvstore.MigrationStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &kvstore.MigrationStatus{
+		State:           m.status.State,
+		TargetId:        m.status.TargetId,
+		Tokens:          slices.Clone(m.status.Tokens),
+		KeysCopied:      m.status.KeysCopied,
+		WritesForwarded: m.status.WritesForwarded,
+		Error:           m.status.Error,
+		StartedUnix:     m.status.StartedUnix,
+		FinishedUnix:    m.status.FinishedUnix,
+		Epoch:           m.status.Epoch,
+	}
+}
+
+func (m *migration) finished() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ShardingServer) StartMigration(ctx context.Context, req *kvstore.StartMigrationRequest) (*kvstore.MigrationStatus, error) {
+	ring := s.Ring()
+	if ring == nil {
+		return nil, status.Error(codes.FailedPrecondition, noTopologyMessage)
+	}
+	target, ok := ring.Node(req.TargetId)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "node %q is not in the topology, add it first", req.TargetId)
+	}
+	if target.ID == s.self {
+		return nil, status.Error(codes.InvalidArgument, "cannot migrate to this node")
+	}
+
+	tokens := req.Tokens
+	if len(tokens) == 0 {
+		for _, hash := range sharding.VirtualTokens(target.ID, s.opts.VirtualNodes) {
+			if ring.OwnerOfHash(hash).ID == s.self {
+				tokens = append(tokens, hash)
+			}
+		}
+		if len(tokens) == 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "none of the default tokens of %s fall in this node's ranges", target.ID)
+		}
+	}
+	ranges := make([]sharding.Range, len(tokens))
+	for i, hash := range tokens {
+		if owner := ring.OwnerOfHash(hash); owner.ID != s.self {
+			return nil, status.Errorf(codes.InvalidArgument, "token %d is in a range of %s, not of this node", hash, owner.ID)
+		}
+		ranges[i] = ring.RangeOf(hash)
+	}
+
+	if err := s.checkPeers(ctx, ring, target); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.migration != nil && !s.migration.finished() {
+		return nil, status.Error(codes.FailedPrecondition, "a migration is already running")
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	m := &migration{
+		target: target,
+		tokens: tokens,
+		ranges: ranges,
+		log:    replication.NewLog(replication.DefaultBacklog),
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: &kvstore.MigrationStatus{
+			State:       migrationCopying,
+			TargetId:    target.ID,
+			Tokens:      tokens,
+			StartedUnix: time.Now().Unix(),
+		},
+	}
+	s.migration = m
+	go s.runMigration(runCtx, m)
+	return m.Status(), nil
+}
+
+// Makes sure the target knows the current topology, and that no other node
+// is migrating: two migrations would both make a topology with the next
+// epoch, and only one of them could win.
+func (s *ShardingServer) checkPeers(ctx context.Context, ring *sharding.Ring, target sharding.Node) error {
+	ctx, cancel := context.WithTimeout(s.outgoing(ctx), shardCallTimeout)
+	defer cancel()
+	for _, n := range ring.Nodes() {
+		if n.ID == s.self {
+			continue
+		}
+		client, err := s.client(n.Addr)
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "node %s: %v", n.ID, err)
+		}
+		if n.ID == target.ID {
+			resp, err := client.UpdateTopology(ctx, ring.ToProto(s.self))
+			if err != nil {
+				return status.Errorf(codes.Unavailable, "sending the topology to %s: %v", n.ID, err)
+			}
+			if resp.Epoch != ring.Epoch() {
+				return status.Errorf(codes.FailedPrecondition, "%s has topology epoch %d, this node %d", n.ID, resp.Epoch, ring.Epoch())
+			}
+		}
+		st, err := client.GetMigration(ctx, &kvstore.GetMigrationRequest{})
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "node %s: %v", n.ID, err)
+		}
+		if st.State == migrationCopying || st.State == migrationForwarding {
+			return status.Errorf(codes.FailedPrecondition, "node %s is migrating to %s", n.ID, st.TargetId)
+		}
+	}
+	return nil
+}
+
+func (s *ShardingServer) runMigration(ctx context.Context, m *migration) {
+	defer close(m.done)
+	defer m.cancel()
+
+	start := time.Now()
+	slog.Info("shard migration started", "target", m.target.ID, "tokens", len(m.tokens))
+	epoch, err := s.migrate(ctx, m)
+	s.active.Store(nil)
+
+	m.update(func(st *kvstore.MigrationStatus) {
+		st.FinishedUnix = time.Now().Unix()
+		switch {
+		case err == nil:
+			st.State = migrationDone
+			st.Epoch = epoch
+		case ctx.Err() != nil:
+			st.State = migrationAborted
+			st.Error = err.Error()
+		default:
+			st.State = migrationFailed
+			st.Error = err.Error()
+		}
+	})
+	if err != nil {
+		slog.Warn("shard migration stopped", "target", m.target.ID, "error", err)
+		return
+	}
+	slog.Info("shard migration finished", "target", m.target.ID, "epoch", epoch, "duration", time.Since(start))
+}
+
+// Returns the epoch of the topology in which the target owns the tokens.
+func (s *ShardingServer) migrate(ctx context.Context, m *migration) (uint64, error) {
+	client, err := s.client(m.target.Addr)
+	if err != nil {
+		return 0, err
+	}
+	// Keyed requests wait while the last writes are sent, so that part is
+	// cut short when the target is slow
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+	stream, err := client.ImportKeys(s.outgoing(streamCtx))
+	if err != nil {
+		return 0, fmt.Errorf("opening the import stream: %w", err)
+	}
+	header := &kvstore.ImportKeysRequest{SourceId: s.self}
+	for _, r := range m.ranges {
+		header.Ranges = append(header.Ranges, &kvstore.ShardRange{Start: r.Start, End: r.End})
+	}
+	if err := stream.Send(header); err != nil {
+		return 0, importError(stream, err)
+	}
+
+	// Writes from the moment of the copy on are captured, so the target
+	// ends up with every write the copy misses
+	var sub *replication.Subscription
+	items := s.store.Export(func() {
+		sub = m.log.Subscribe()
+		s.active.Store(m)
+	})
+	defer m.log.Unsubscribe(sub)
+
+	chunk := &kvstore.ImportKeysRequest{}
+	flush := func() error {
+		if len(chunk.Entries) == 0 {
+			return nil
+		}
+		err := stream.Send(chunk)
+		chunk = &kvstore.ImportKeysRequest{}
+		return err
+	}
+	for _, item := range items {
+		if !m.owns(item.Key) {
+			continue
+		}
+		chunk.Entries = append(chunk.Entries, replication.ItemToProto(item))
+		if len(chunk.Entries) == importChunkSize {
+			if err := flush(); err != nil {
+				return 0, importError(stream, err)
+			}
+		}
+		m.update(func(st *kvstore.MigrationStatus) { st.KeysCopied++ })
+	}
+	if err := flush(); err != nil {
+		return 0, importError(stream, err)
+	}
+
+	// Forwards writes until the target has caught up, the ones that are
+	// left are sent with keyed requests blocked
+	m.update(func(st *kvstore.MigrationStatus) { st.State = migrationForwarding })
+	last := sub.Offset
+	forward := func(until uint64) error {
+		for until == 0 || last < until {
+			var record replication.Record
+			var ok bool
+			if until == 0 {
+				select {
+				case record, ok = <-sub.Records():
+				default:
+					return flush()
+				}
+			} else {
+				record, ok = <-sub.Records()
+			}
+			if !ok {
+				return sub.Err()
+			}
+			last = record.Offset
+			chunk.Entries = append(chunk.Entries, replication.EntryToProto(record.Entry))
+			m.update(func(st *kvstore.MigrationStatus) { st.WritesForwarded++ })
+			if len(chunk.Entries) == importChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return flush()
+	}
+	if err := forward(0); err != nil {
+		return 0, importError(stream, err)
+	}
+
+	ring, err := func() (*sharding.Ring, error) {
+		s.flip.Lock()
+		defer s.flip.Unlock()
+		timer := time.AfterFunc(shardCallTimeout, cancelStream)
+		defer timer.Stop()
+		timedOut := func(err error) error {
+			if streamCtx.Err() != nil && ctx.Err() == nil {
+				return fmt.Errorf("target took longer than %s to take the last writes", shardCallTimeout)
+			}
+			return err
+		}
+		if err := forward(m.log.Offset()); err != nil {
+			return nil, timedOut(importError(stream, err))
+		}
+		s.active.Store(nil)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := stream.CloseAndRecv(); err != nil {
+			return nil, timedOut(fmt.Errorf("finishing the import: %w", err))
+		}
+		timer.Stop()
+
+		// From here on the migration can't be aborted. The target keeps the
+		// keys if the flip fails, but doesn't serve them.
+		ring, err := s.Ring().WithTokens(m.tokens, m.target.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.sendTopology(client, ring); err != nil {
+			return nil, fmt.Errorf("sending the new topology to %s: %w", m.target.ID, err)
+		}
+		if _, err := s.setRing(ring); err != nil {
+			return nil, err
+		}
+		return ring, nil
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	var moved []string
+	for _, item := range s.store.Export(nil) {
+		if m.owns(item.Key) {
+			moved = append(moved, item.Key)
+		}
+	}
+	s.store.MDelete(moved)
+	s.broadcast(ring, m.target.ID)
+	return ring.Epoch(), nil
+}
+
+// Sends the topology to the target. If the answer is lost, the target is
+// asked which topology it has, as it may have taken it.
+func (s *ShardingServer) sendTopology(client kvstore.ShardingClient, ring *sharding.Ring) error {
+	ctx, cancel := context.WithTimeout(s.outgoing(context.Background()), shardCallTimeout)
+	defer cancel()
+	_, err := client.UpdateTopology(ctx, ring.ToProto(s.self))
+	if err == nil {
+		return nil
+	}
+	resp, topologyErr := client.Topology(ctx, &kvstore.TopologyRequest{})
+	if topologyErr == nil && resp.Epoch >= ring.Epoch() {
+		return nil
+	}
+	return err
+}
+
+// Send only returns io.EOF when the server ended the stream, the reason is
+// then in the status.
+func importError(stream kvstore.Sharding_ImportKeysClient, err error) error {
+	if errors.Is(err, io.EOF) {
+		_, err = stream.CloseAndRecv()
+	}
+	return fmt.Errorf("importing keys: %w", err)
+}
+
+func (s *ShardingServer) GetMigration(ctx context.Context, req *kvstore.GetMigrationRequest) (*kvstore.MigrationStatus, error) {
+	s.mu.Lock()
+	m := s.migration
+	s.mu.Unlock()
+	if m == nil {
+		return &kvstore.MigrationStatus{State: migrationIdle}, nil
+	}
+	return m.Status(), nil
+}
+
+// AbortMigration stops the running migration and waits for it. The target
+// drops the keys it got. A migration that already handed its tokens over
+// finishes instead.
+func (s *ShardingServer) AbortMigration(ctx context.Context, req *kvstore.AbortMigrationRequest) (*kvstore.MigrationStatus, error) {
+	s.mu.Lock()
+	m := s.migration
+	s.mu.Unlock()
+	if m == nil || m.finished() {
+		return nil, status.Error(codes.FailedPrecondition, "no migration is running")
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return m.Status(), nil
+}
+
+func (s *ShardingServer) ImportKeys(stream kvstore.Sharding_ImportKeysServer) error {
+	header, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if len(header.Ranges) == 0 {
+		return status.Error(codes.InvalidArgument, "the first message must name the ranges")
+	}
+	m := &migration{}
+	for _, r := range header.Ranges {
+		m.ranges = append(m.ranges, sharding.Range{Start: r.Start, End: r.End})
+	}
+	slog.Info("importing keys", "source", header.SourceId, "ranges", len(m.ranges))
+
+	// Leftovers of an earlier, failed import would shadow deletes
+	s.dropRanges(m)
+	var applied uint64
+	for _, entry := range header.Entries {
+		s.store.ApplyReplicated(replication.EntryFromProto(entry))
+		applied++
+	}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			slog.Info("imported keys", "source", header.SourceId, "entries", applied)
+			return stream.SendAndClose(&kvstore.ImportKeysResponse{Entries: applied})
+		}
+		if err != nil {
+			slog.Warn("import failed, dropping its keys", "source", header.SourceId, "error", err)
+			s.dropRanges(m)
+			return err
+		}
+		for _, entry := range req.Entries {
+			s.store.ApplyReplicated(replication.EntryFromProto(entry))
+			applied++
+		}
+	}
+}
+
+// Deletes the keys in m's ranges, unless this node owns them.
+func (s *ShardingServer) dropRanges(m *migration) {
+	ring := s.Ring()
+	var keys []string
+	for _, item := range s.store.Export(nil) {
+		if m.owns(item.Key) && (ring == nil || ring.Owner(item.Key).ID != s.self) {
+			keys = append(keys, item.Key)
+		}
+	}
+	s.store.MDelete(keys)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/raft"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Trailer that tells clients of a follower where the leader is
+const leaderTrailer = "kvstore-leader"
+
+// RaftServer implements the Raft service, which carries the messages
+// between the nodes of a cluster as well as membership changes. It is
+// registered on a GRPCServer with EnableCluster.
+type RaftServer struct {
+	kvstore.UnimplementedRaftServer
+	node *raft.Node
+}
+
+func NewRaftServer(node *raft.Node) *RaftServer {
+	return &RaftServer{node: node}
+}
+
+func (s *RaftServer) RequestVote(ctx context.Context, req *kvstore.VoteRequest) (*kvstore.VoteResponse, error) {
+	resp, err := s.node.HandleRequestVote(req)
+	if err != nil {
+		return nil, raftError(ctx, err)
+	}
+	return resp, nil
+}
+
+func (s *RaftServer) AppendEntries(ctx context.Context, req *kvstore.AppendEntriesRequest) (*kvstore.AppendEntriesResponse, error) {
+	resp, err := s.node.HandleAppendEntries(req)
+	if err != nil {
+		return nil, raftError(ctx, err)
+	}
+	return resp, nil
+}
+
+// InstallSnapshot puts the snapshot back together from its chunks, the
+// first of which carries the rest of the request.
+func (s *RaftServer) InstallSnapshot(stream grpc.ClientStreamingServer[kvstore.InstallSnapshotRequest, kvstore.InstallSnapshotResponse]) error {
+	var req *kvstore.InstallSnapshotRequest
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if req == nil {
+			req = chunk
+			continue
+		}
+		req.Data = append(req.Data, chunk.Data...)
+	}
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "empty snapshot stream")
+	}
+
+	resp, err := s.node.HandleInstallSnapshot(req)
+	if err != nil {
+		return raftError(stream.Context(), err)
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *RaftServer) AddMember(ctx context.Context, req *kvstore.AddMemberRequest) (*kvstore.MembershipResponse, error) {
+	if req.Id == "" || req.Addr == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and addr cannot be empty")
+	}
+	members, err := s.node.AddMember(ctx, raft.Member{ID: req.Id, Addr: req.Addr})
+	if err != nil {
+		return nil, raftError(ctx, err)
+	}
+	return &kvstore.MembershipResponse{Members: membersToProto(members)}, nil
+}
+
+func (s *RaftServer) RemoveMember(ctx context.Context, req *kvstore.RemoveMemberRequest) (*kvstore.MembershipResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id cannot be empty")
+	}
+	members, err := s.node.RemoveMember(ctx, req.Id)
+	if err != nil {
+		return nil, raftError(ctx, err)
+	}
+	return &kvstore.MembershipResponse{Members: membersToProto(members)}, nil
+}
+
+func (s *RaftServer) ClusterStatus(ctx context.Context, req *kvstore.ClusterStatusRequest) (*kvstore.ClusterStatusResponse, error) {
+	st := s.node.Status()
+	return &kvstore.ClusterStatusResponse{
+		Id:            st.ID,
+		State:         st.State.String(),
+		Term:          st.Term,
+		LeaderId:      st.LeaderID,
+		LeaderAddr:    st.LeaderAddr,
+		CommitIndex:   st.CommitIndex,
+		AppliedIndex:  st.AppliedIndex,
+		LastIndex:     st.LastIndex,
+		SnapshotIndex: st.SnapshotIndex,
+		Members:       membersToProto(st.Members),
+	}, nil
+}
+
+// Maps the errors of a raft.Node to gRPC statuses. Followers answer with
+// FailedPrecondition and the leader's address in a trailer, so clients can
+// redirect like they do for replicas.
+func raftError(ctx context.Context, err error) error {
+	var notLeader *raft.NotLeaderError
+	switch {
+	case errors.As(err, &notLeader):
+		if notLeader.LeaderAddr != "" {
+			grpc.SetTrailer(ctx, metadata.Pairs(leaderTrailer, notLeader.LeaderAddr))
+		}
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, raft.ErrMembershipPending):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, raft.ErrLeadershipLost), errors.Is(err, raft.ErrStopped):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func membersToProto(members []raft.Member) []*kvstore.RaftMember {
+	out := make([]*kvstore.RaftMember, len(members))
+	for i, m := range members {
+		out[i] = &kvstore.RaftMember{Id: m.ID, Addr: m.Addr}
+	}
+	return out
+}
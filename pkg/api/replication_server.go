@@ -0,0 +1,418 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Limits on a single full sync message
+	fullSyncChunkItems = 1000
+	fullSyncChunkBytes = 1 << 20
+
+	replicationHeartbeat = time.Second
+)
+
+// ReplicationServer implements the Replication service. On a primary it
+// streams the store and the writes in log to replicas and other sites, on
+// a replica it only reports the replica's status.
+type ReplicationServer struct {
+	kvstore.UnimplementedReplicationServer
+	store   *store.Store
+	log     *replication.Log
+	replica *replication.Replica
+	// The other sites this one follows in multi-master mode
+	peers []*replication.Peer
+
+	mu       sync.Mutex
+	replicas map[*replicaStream]struct{}
+	// Closed to end the Sync streams on shutdown
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// A replica connected to this primary
+type replicaStream struct {
+	id     string
+	addr   string
+	since  time.Time
+	offset atomic.Uint64
+}
+
+// NewReplicationServer returns a server for a primary when log is set, or
+// for a replica when replica is set.
+func NewReplicationServer(store *store.Store, log *replication.Log, replica *replication.Replica) *ReplicationServer {
+	return &ReplicationServer{
+		store:    store,
+		log:      log,
+		replica:  replica,
+		replicas: make(map[*replicaStream]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// SetPeers reports the other sites of a multi-master deployment in the
+// status. It must be called before the server starts.
+func (s *ReplicationServer) SetPeers(peers []*replication.Peer) {
+	s.peers = peers
+}
+
+// Ends the Sync streams, which would otherwise keep a graceful stop waiting.
+func (s *ReplicationServer) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+func (s *ReplicationServer) Sync(req *kvstore.SyncRequest, stream grpc.ServerStreamingServer[kvstore.SyncResponse]) error {
+	if s.log == nil {
+		return status.Error(codes.FailedPrecondition, "this server is a replica, sync from its primary")
+	}
+
+	// Subscribing while the store is locked lines the log up with the copy
+	var sub *replication.Subscription
+	items := s.store.Export(func() { sub = s.log.Subscribe() })
+	defer s.log.Unsubscribe(sub)
+
+	r := &replicaStream{id: req.ReplicaId, since: time.Now()}
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		r.addr = p.Addr.String()
+	}
+	r.offset.Store(sub.Offset)
+	s.mu.Lock()
+	s.replicas[r] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.replicas, r)
+		s.mu.Unlock()
+	}()
+
+	// Another site also needs the deletes, and not the writes it made
+	var tombstones []store.Tombstone
+	if req.OriginId != "" {
+		tombstones = s.store.Tombstones()
+	}
+	if err := s.sendFullSync(stream, items, tombstones, sub.Offset); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(replicationHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case record, ok := <-sub.Records():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+			entry := record.Entry
+			if req.OriginId != "" {
+				if entry, ok = replication.ForSite(entry, req.OriginId); !ok {
+					r.offset.Store(record.Offset)
+					continue
+				}
+			}
+			err := stream.Send(&kvstore.SyncResponse{
+				Offset:            record.Offset,
+				TimestampUnixNano: record.Time.UnixNano(),
+				Message:           &kvstore.SyncResponse_Write{Write: replication.EntryToProto(entry)},
+			})
+			if err != nil {
+				return err
+			}
+			r.offset.Store(record.Offset)
+		case <-heartbeat.C:
+			hb := &kvstore.Heartbeat{}
+			if req.OriginId != "" {
+				hb.Passed = r.offset.Load()
+			}
+			err := stream.Send(&kvstore.SyncResponse{
+				Offset:            s.log.Offset(),
+				TimestampUnixNano: time.Now().UnixNano(),
+				Message:           &kvstore.SyncResponse_Heartbeat{Heartbeat: hb},
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.done:
+			return status.Error(codes.Unavailable, "primary is shutting down")
+		}
+	}
+}
+
+// Sends items and tombstones in chunks, the last one marked done even if it
+// is empty.
+func (s *ReplicationServer) sendFullSync(stream grpc.ServerStreamingServer[kvstore.SyncResponse], items []store.Entry, tombstones []store.Tombstone, offset uint64) error {
+	chunk := &kvstore.FullSync{}
+	size := 0
+	send := func() error {
+		return stream.Send(&kvstore.SyncResponse{
+			Offset:            offset,
+			TimestampUnixNano: time.Now().UnixNano(),
+			Message:           &kvstore.SyncResponse_FullSync{FullSync: chunk},
+		})
+	}
+
+	for _, item := range items {
+		chunk.Items = append(chunk.Items, replication.ItemToProto(item))
+		size += len(item.Key) + len(item.Value)
+		if len(chunk.Items) >= fullSyncChunkItems || size >= fullSyncChunkBytes {
+			if err := send(); err != nil {
+				return err
+			}
+			chunk = &kvstore.FullSync{}
+			size = 0
+		}
+	}
+	for _, t := range tombstones {
+		chunk.Tombstones = append(chunk.Tombstones, replication.TombstoneToProto(t))
+		if len(chunk.Items)+len(chunk.Tombstones) >= fullSyncChunkItems {
+			if err := send(); err != nil {
+				return err
+			}
+			chunk = &kvstore.FullSync{}
+			size = 0
+		}
+	}
+	chunk.Done = true
+	return send()
+}
+
+func (s *ReplicationServer) Status(ctx context.Context, req *kvstore.ReplicationStatusRequest) (*kvstore.ReplicationStatusResponse, error) {
+	if s.replica != nil {
+		st := s.replica.Status()
+		return &kvstore.ReplicationStatusResponse{
+			Role:         "replica",
+			Offset:       st.Offset,
+			PrimaryAddr:  st.Primary,
+			Connected:    st.Connected,
+			LagEntries:   st.LagEntries,
+			LagSeconds:   st.Lag.Seconds(),
+			KeysRepaired: st.KeysRepaired,
+		}, nil
+	}
+
+	resp := &kvstore.ReplicationStatusResponse{Role: "primary"}
+	if s.log != nil {
+		resp.Offset = s.log.Offset()
+	}
+	if origin := s.store.Origin(); origin != "" {
+		resp.Role = "multi-master"
+		resp.OriginId = origin
+	}
+	for _, p := range s.peers {
+		st := p.Status()
+		resp.Peers = append(resp.Peers, &kvstore.PeerStatus{
+			Id:             st.ID,
+			Addr:           st.Addr,
+			Connected:      st.Connected,
+			Offset:         st.Offset,
+			WritesReceived: st.WritesReceived,
+			WritesApplied:  st.WritesApplied,
+			LagSeconds:     st.Lag.Seconds(),
+			KeysRepaired:   st.KeysRepaired,
+		})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for r := range s.replicas {
+		resp.Replicas = append(resp.Replicas, &kvstore.ReplicaInfo{
+			Id:                 r.id,
+			Addr:               r.addr,
+			Offset:             r.offset.Load(),
+			ConnectedSinceUnix: r.since.Unix(),
+		})
+	}
+	return resp, nil
+}
+
+const defaultDigestBuckets = 256
+
+func (s *ReplicationServer) Digest(ctx context.Context, req *kvstore.DigestRequest) (*kvstore.DigestResponse, error) {
+	n := int(req.Buckets)
+	if n == 0 {
+		n = defaultDigestBuckets
+	}
+	if n > 1<<16 {
+		return nil, status.Error(codes.InvalidArgument, "at most 65536 buckets")
+	}
+
+	resp := &kvstore.DigestResponse{
+		OriginId:   s.store.Origin(),
+		Tombstones: uint64(s.store.Info().Tombstones),
+	}
+	for _, b := range s.store.Digest(n) {
+		resp.Keys += uint64(b.Keys)
+		resp.Buckets = append(resp.Buckets, &kvstore.BucketDigest{Keys: uint64(b.Keys), Hash: b.Hash})
+	}
+	for _, bucket := range req.ListBuckets {
+		if int(bucket) >= n {
+			return nil, status.Errorf(codes.InvalidArgument, "bucket %d out of range", bucket)
+		}
+		for _, e := range s.store.BucketItems(int(bucket), n) {
+			resp.Listed = append(resp.Listed, &kvstore.KeyDigest{
+				Key:       e.Key,
+				Bucket:    bucket,
+				Hash:      store.ItemHash(e.Key, e.Item),
+				Timestamp: uint64(e.Timestamp),
+				Origin:    e.Origin,
+			})
+		}
+	}
+	return resp, nil
+}
+
+func (s *ReplicationServer) MerkleNodes(ctx context.Context, req *kvstore.MerkleNodesRequest) (*kvstore.MerkleNodesResponse, error) {
+	if req.Depth > store.MaxMerkleDepth {
+		return nil, status.Errorf(codes.InvalidArgument, "depth is at most %d", store.MaxMerkleDepth)
+	}
+	tree := s.store.MerkleTree(int(req.Depth))
+	resp := &kvstore.MerkleNodesResponse{Hashes: make([]uint64, len(req.Nodes))}
+	for i, n := range req.Nodes {
+		hash, ok := tree.Node(int(n))
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "no node %d in a tree of depth %d", n, req.Depth)
+		}
+		resp.Hashes[i] = hash
+	}
+	return resp, nil
+}
+
+func (s *ReplicationServer) RangeItems(ctx context.Context, req *kvstore.RangeItemsRequest) (*kvstore.RangeItemsResponse, error) {
+	if req.Depth > store.MaxMerkleDepth {
+		return nil, status.Errorf(codes.InvalidArgument, "depth is at most %d", store.MaxMerkleDepth)
+	}
+	ranges := make([]int, len(req.Ranges))
+	for i, r := range req.Ranges {
+		if r >= 1<<req.Depth {
+			return nil, status.Errorf(codes.InvalidArgument, "no range %d in a tree of depth %d", r, req.Depth)
+		}
+		ranges[i] = int(r)
+	}
+
+	items, tombstones, version := s.store.RangeItems(int(req.Depth), ranges)
+	resp := &kvstore.RangeItemsResponse{Version: version}
+	for _, e := range items {
+		resp.Items = append(resp.Items, replication.ItemToProto(e))
+	}
+	for _, t := range tombstones {
+		resp.Tombstones = append(resp.Tombstones, replication.TombstoneToProto(t))
+	}
+	return resp, nil
+}
+
+func (s *ReplicationServer) Repair(ctx context.Context, req *kvstore.RepairRequest) (*kvstore.RepairResponse, error) {
+	type source struct {
+		name   string
+		repair func(context.Context) (replication.RepairResult, error)
+	}
+	var sources []source
+	switch {
+	case s.replica != nil:
+		if req.SiteId != "" {
+			return nil, status.Error(codes.InvalidArgument, "a replica only repairs from its primary")
+		}
+		sources = append(sources, source{s.replica.Status().Primary, s.replica.Repair})
+	case s.store.Origin() != "":
+		for _, p := range s.peers {
+			if req.SiteId == "" || p.ID() == req.SiteId {
+				sources = append(sources, source{p.ID(), p.Repair})
+			}
+		}
+		if len(sources) == 0 {
+			return nil, status.Errorf(codes.NotFound, "no site %q", req.SiteId)
+		}
+	default:
+		return nil, status.Error(codes.FailedPrecondition, "only replicas and multi-master sites repair, this server is a primary")
+	}
+
+	resp := &kvstore.RepairResponse{}
+	for _, src := range sources {
+		result, err := src.repair(ctx)
+		r := &kvstore.RepairResult{
+			Source:    src.name,
+			Ranges:    uint32(result.Ranges),
+			KeysFixed: uint64(result.KeysFixed),
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		resp.Results = append(resp.Results, r)
+	}
+	return resp, nil
+}
+
+// RegisterReplicationMetrics exports the replication offset and, on a
+// replica, how far behind the primary it is.
+func RegisterReplicationMetrics(reg *metrics.Registry, srv *ReplicationServer) {
+	reg.NewGaugeFunc("kvstore_replication_offset", "Newest write in the log on a primary, last write applied on a replica.", func() float64 {
+		if srv.replica != nil {
+			return float64(srv.replica.Status().Offset)
+		}
+		if srv.log != nil {
+			return float64(srv.log.Offset())
+		}
+		return 0
+	})
+
+	if srv.replica != nil {
+		reg.NewGaugeFunc("kvstore_replication_lag_entries", "Writes the replica has yet to apply.", func() float64 {
+			return float64(srv.replica.Status().LagEntries)
+		})
+		reg.NewGaugeFunc("kvstore_replication_lag_seconds", "Time since the replica last had every write of the primary.", func() float64 {
+			return srv.replica.Status().Lag.Seconds()
+		})
+		reg.NewGaugeFunc("kvstore_replication_connected", "1 if the replica is connected to its primary.", func() float64 {
+			if srv.replica.Status().Connected {
+				return 1
+			}
+			return 0
+		})
+		reg.NewCounterFunc("kvstore_anti_entropy_keys_repaired_total", "Keys fixed by anti-entropy repairs.", func() float64 {
+			return float64(srv.replica.Status().KeysRepaired)
+		})
+		return
+	}
+
+	reg.NewGaugeFunc("kvstore_replication_replicas", "Replicas connected to this primary.", func() float64 {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return float64(len(srv.replicas))
+	})
+
+	if srv.store.Origin() == "" {
+		return
+	}
+	reg.NewGaugeFunc("kvstore_tombstones", "Deleted keys remembered for multi-master replication.", func() float64 {
+		return float64(srv.store.Info().Tombstones)
+	})
+	for _, p := range srv.peers {
+		site := metrics.Label{Name: "site", Value: p.Status().ID}
+		reg.NewGaugeFunc("kvstore_multi_master_lag_seconds", "Time since this site last had every write of another.", func() float64 {
+			return p.Status().Lag.Seconds()
+		}, site)
+		reg.NewGaugeFunc("kvstore_multi_master_connected", "1 if this site is connected to another.", func() float64 {
+			if p.Status().Connected {
+				return 1
+			}
+			return 0
+		}, site)
+		reg.NewCounterFunc("kvstore_multi_master_writes_applied_total", "Writes from another site that won over the local ones.", func() float64 {
+			return float64(p.Status().WritesApplied)
+		}, site)
+		reg.NewCounterFunc("kvstore_anti_entropy_keys_repaired_total", "Keys fixed by anti-entropy repairs.", func() float64 {
+			return float64(p.Status().KeysRepaired)
+		}, site)
+	}
+}
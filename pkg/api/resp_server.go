@@ -0,0 +1,432 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/resp"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+// RESPServer speaks the Redis protocol (RESP2, and RESP3 after HELLO 3) so that
+// redis-cli and Redis client libraries can use the store.
+type RESPServer struct {
+	store *store.Store
+	tcp   tcpListener
+	// Nil unless EnableAuth was called
+	acl auth.Authenticator
+}
+
+type respConn struct {
+	conn   net.Conn
+	reader *resp.Reader
+	writer *resp.Writer
+	quit   bool
+	// Given with AUTH. It is checked again for every command, so a
+	// reloaded ACL applies to open connections too.
+	token string
+}
+
+type respCommand struct {
+	// Number of arguments including the command name, negative means at least -arity
+	arity   int
+	handler func(s *RESPServer, c *respConn, args []string) error
+}
+
+var respCommands map[string]respCommand
+
+// Commands rejected while the store is read-only
+var respWriteCommands = map[string]bool{
+	"SET":     true,
+	"DEL":     true,
+	"EXPIRE":  true,
+	"PEXPIRE": true,
+	"PERSIST": true,
+}
+
+// Permission each command needs on its keys when ACLs are on. The other
+// commands don't touch keys.
+var respCommandPermissions = map[string]auth.Permission{
+	"GET":     auth.Read,
+	"EXISTS":  auth.Read,
+	"TTL":     auth.Read,
+	"PTTL":    auth.Read,
+	"SET":     auth.Write,
+	"DEL":     auth.Write,
+	"EXPIRE":  auth.Write,
+	"PEXPIRE": auth.Write,
+	"PERSIST": auth.Write,
+}
+
+// Commands allowed before AUTH, like in Redis
+var respNoAuthCommands = map[string]bool{
+	"AUTH":  true,
+	"HELLO": true,
+	"QUIT":  true,
+}
+
+func init() {
+	respCommands = map[string]respCommand{
+		"PING":    {-1, (*RESPServer).ping},
+		"ECHO":    {2, (*RESPServer).echo},
+		"AUTH":    {-2, (*RESPServer).auth},
+		"HELLO":   {-1, (*RESPServer).hello},
+		"QUIT":    {1, (*RESPServer).quit},
+		"SELECT":  {2, (*RESPServer).selectDB},
+		"COMMAND": {-1, (*RESPServer).command},
+		"CLIENT":  {-2, (*RESPServer).client},
+		"GET":     {2, (*RESPServer).get},
+		"SET":     {-3, (*RESPServer).set},
+		"DEL":     {-2, (*RESPServer).del},
+		"EXISTS":  {-2, (*RESPServer).exists},
+		"EXPIRE":  {3, (*RESPServer).expire},
+		"PEXPIRE": {3, (*RESPServer).expire},
+		"PERSIST": {2, (*RESPServer).persist},
+		"TTL":     {2, (*RESPServer).ttl},
+		"PTTL":    {2, (*RESPServer).ttl},
+	}
+}
+
+func NewRESPServer(store *store.Store) *RESPServer {
+	return &RESPServer{
+		store: store,
+	}
+}
+
+// EnableAuth makes clients AUTH with a token from acl before anything else,
+// and checks the user's access to the keys of each command like the gRPC
+// API does. Pass an *auth.ReloadableACL to be able to change the ACL later.
+func (s *RESPServer) EnableAuth(acl auth.Authenticator) {
+	s.acl = acl
+}
+
+func (s *RESPServer) Start(port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	slog.Info("server starting", "protocol", "resp", "port", port)
+
+	return s.Serve(lis)
+}
+
+// Serve accepts connections on lis until Stop is called.
+func (s *RESPServer) Serve(lis net.Listener) error {
+	return s.tcp.serve(lis, s.handleConn)
+}
+
+// ActiveConnections returns the number of open client connections.
+func (s *RESPServer) ActiveConnections() int {
+	return s.tcp.activeConns()
+}
+
+func (s *RESPServer) Stop() {
+	s.tcp.stop()
+}
+
+// Shutdown stops accepting connections and waits for the open ones to
+// finish their current command, closing those left when ctx is done.
+func (s *RESPServer) Shutdown(ctx context.Context) error {
+	return s.tcp.shutdown(ctx)
+}
+
+func (s *RESPServer) handleConn(conn net.Conn) {
+	c := &respConn{
+		conn:   conn,
+		reader: resp.NewReader(conn),
+		writer: resp.NewWriter(conn),
+	}
+
+	for !c.quit {
+		args, err := c.reader.ReadCommand()
+		if err != nil {
+			if errors.Is(err, resp.ErrProtocol) {
+				c.writer.WriteError("ERR Protocol error: " + err.Error())
+			}
+			// Replies to earlier commands of a pipeline may still be buffered
+			c.writer.Flush()
+			return
+		}
+
+		if err := s.dispatch(c, args); err != nil {
+			return
+		}
+
+		// Only flush once a pipeline of commands has been handled
+		if c.reader.Buffered() == 0 {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.writer.Flush()
+}
+
+func (s *RESPServer) dispatch(c *respConn, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name := strings.ToUpper(args[0])
+	cmd, ok := respCommands[name]
+	if !ok {
+		return c.writer.WriteError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		return c.writer.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	}
+	if s.acl != nil && !respNoAuthCommands[name] {
+		if rejection := s.authorize(c, name, args); rejection != "" {
+			return c.writer.WriteError(rejection)
+		}
+	}
+	if respWriteCommands[name] {
+		if rejection := writeRejection(s.store); rejection != nil {
+			return c.writer.WriteError("READONLY " + rejection.Message())
+		}
+	}
+	return cmd.handler(s, c, args)
+}
+
+// Returns the error to answer with if the connection's user may not run
+// the command.
+func (s *RESPServer) authorize(c *respConn, name string, args []string) string {
+	user, err := s.acl.Authenticate(c.token)
+	if err != nil {
+		return "NOAUTH Authentication required."
+	}
+	perm, ok := respCommandPermissions[name]
+	if !ok {
+		return ""
+	}
+	keys := args[1:2]
+	if name == "DEL" || name == "EXISTS" {
+		keys = args[1:]
+	}
+	for _, key := range keys {
+		if !user.Allowed(perm, key) {
+			return fmt.Sprintf("NOPERM User %s has no permissions to access the '%s' key", user.Name, key)
+		}
+	}
+	return ""
+}
+
+// Takes AUTH <token>, or AUTH <username> <token> as sent by Redis 6
+// clients, in which case the username must be the token's user.
+func (s *RESPServer) auth(c *respConn, args []string) error {
+	if s.acl == nil {
+		return c.writer.WriteError("ERR AUTH called without any ACL configured")
+	}
+	if len(args) > 3 {
+		return c.writer.WriteError("ERR syntax error")
+	}
+	token := args[len(args)-1]
+	user, err := s.acl.Authenticate(token)
+	if err != nil || (len(args) == 3 && args[1] != user.Name) {
+		return c.writer.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.token = token
+	return c.writer.WriteSimpleString("OK")
+}
+
+func (s *RESPServer) ping(c *respConn, args []string) error {
+	switch len(args) {
+	case 1:
+		return c.writer.WriteSimpleString("PONG")
+	case 2:
+		return c.writer.WriteBulkString(args[1])
+	}
+	return c.writer.WriteError("ERR wrong number of arguments for 'ping' command")
+}
+
+func (s *RESPServer) echo(c *respConn, args []string) error {
+	return c.writer.WriteBulkString(args[1])
+}
+
+func (s *RESPServer) hello(c *respConn, args []string) error {
+	if len(args) > 1 {
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return c.writer.WriteError("ERR Protocol version is not an integer or out of range")
+		}
+		if version != 2 && version != 3 {
+			return c.writer.WriteError("NOPROTO unsupported protocol version")
+		}
+		c.writer.Version = version
+	}
+
+	c.writer.WriteMapHeader(3)
+	c.writer.WriteBulkString("server")
+	c.writer.WriteBulkString("kvstore")
+	c.writer.WriteBulkString("proto")
+	c.writer.WriteInteger(int64(c.writer.Version))
+	c.writer.WriteBulkString("mode")
+	return c.writer.WriteBulkString("standalone")
+}
+
+func (s *RESPServer) quit(c *respConn, args []string) error {
+	c.quit = true
+	return c.writer.WriteSimpleString("OK")
+}
+
+// There's a single keyspace, which clients see as database 0.
+func (s *RESPServer) selectDB(c *respConn, args []string) error {
+	if args[1] != "0" {
+		return c.writer.WriteError("ERR DB index is out of range")
+	}
+	return c.writer.WriteSimpleString("OK")
+}
+
+// redis-cli asks for command docs on startup, an empty reply is enough for it.
+func (s *RESPServer) command(c *respConn, args []string) error {
+	return c.writer.WriteArrayHeader(0)
+}
+
+// Accepts the CLIENT SETNAME/SETINFO calls client libraries make on connect.
+func (s *RESPServer) client(c *respConn, args []string) error {
+	switch strings.ToUpper(args[1]) {
+	case "SETNAME", "SETINFO":
+		return c.writer.WriteSimpleString("OK")
+	}
+	return c.writer.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+}
+
+func (s *RESPServer) get(c *respConn, args []string) error {
+	if args[1] == "" {
+		return c.writer.WriteError("ERR key cannot be empty")
+	}
+	value, found := s.store.Get(args[1])
+	if !found {
+		return c.writer.WriteNull()
+	}
+	return c.writer.WriteBulkString(value)
+}
+
+func (s *RESPServer) set(c *respConn, args []string) error {
+	key, value := args[1], args[2]
+	if key == "" {
+		return c.writer.WriteError("ERR key cannot be empty")
+	}
+
+	// As in Redis, a key set without an expiry never expires, DEFAULT_TTL
+	// doesn't apply
+	var opts store.SetOptions
+	hasExpiry := false
+	for i := 3; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "NX", "XX":
+			if opts.Condition != store.SetAlways {
+				return c.writer.WriteError("ERR syntax error")
+			}
+			opts.Condition = store.SetIfAbsent
+			if option == "XX" {
+				opts.Condition = store.SetIfPresent
+			}
+		case "KEEPTTL":
+			if hasExpiry {
+				return c.writer.WriteError("ERR syntax error")
+			}
+			opts.KeepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpiry || opts.KeepTTL || i+1 >= len(args) {
+				return c.writer.WriteError("ERR syntax error")
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return c.writer.WriteError("ERR value is not an integer or out of range")
+			}
+			if n <= 0 {
+				return c.writer.WriteError("ERR invalid expire time in 'set' command")
+			}
+			switch option {
+			case "EX":
+				opts.ExpiresAt = time.Now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				opts.ExpiresAt = time.Now().Add(time.Duration(n) * time.Millisecond)
+			case "EXAT":
+				opts.ExpiresAt = time.Unix(n, 0)
+			case "PXAT":
+				opts.ExpiresAt = time.UnixMilli(n)
+			}
+			hasExpiry = true
+		default:
+			return c.writer.WriteError("ERR syntax error")
+		}
+	}
+
+	if _, ok := s.store.SetWithOptions(key, value, opts); !ok {
+		return c.writer.WriteNull()
+	}
+	return c.writer.WriteSimpleString("OK")
+}
+
+func (s *RESPServer) del(c *respConn, args []string) error {
+	var deleted int64
+	for _, key := range args[1:] {
+		if s.store.Delete(key) {
+			deleted++
+		}
+	}
+	return c.writer.WriteInteger(deleted)
+}
+
+func (s *RESPServer) exists(c *respConn, args []string) error {
+	var found int64
+	for _, key := range args[1:] {
+		if _, ok := s.store.Get(key); ok {
+			found++
+		}
+	}
+	return c.writer.WriteInteger(found)
+}
+
+func (s *RESPServer) expire(c *respConn, args []string) error {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return c.writer.WriteError("ERR value is not an integer or out of range")
+	}
+	unit := time.Second
+	if strings.EqualFold(args[0], "PEXPIRE") {
+		unit = time.Millisecond
+	}
+
+	// Zero or negative times delete the key, like in Redis
+	expiresAt := time.Now().Add(time.Duration(n) * unit)
+	if s.store.Expire(args[1], expiresAt) {
+		return c.writer.WriteInteger(1)
+	}
+	return c.writer.WriteInteger(0)
+}
+
+func (s *RESPServer) persist(c *respConn, args []string) error {
+	if s.store.Persist(args[1]) {
+		return c.writer.WriteInteger(1)
+	}
+	return c.writer.WriteInteger(0)
+}
+
+// Replies -2 for missing keys and -1 for keys without an expiry.
+func (s *RESPServer) ttl(c *respConn, args []string) error {
+	item, found := s.store.GetItem(args[1])
+	if !found {
+		return c.writer.WriteInteger(-2)
+	}
+	if item.ExpiresAt.IsZero() {
+		return c.writer.WriteInteger(-1)
+	}
+
+	remaining := time.Until(item.ExpiresAt)
+	if strings.EqualFold(args[0], "PTTL") {
+		return c.writer.WriteInteger(remaining.Milliseconds())
+	}
+	return c.writer.WriteInteger(int64((remaining + 500*time.Millisecond) / time.Second))
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Time allowed for calls to other nodes about the topology
+const shardCallTimeout = 5 * time.Second
+
+type ShardingOptions struct {
+	// File the topology is saved to whenever it changes, and loaded from on
+	// startup when it is newer than the one given. Empty to not save it.
+	Path string
+	// Tokens a migration gives its target when none are named
+	VirtualNodes int
+	// Admin token for the other nodes, when they have ACLs
+	Token string
+	// Defaults to an insecure connection
+	DialOptions []grpc.DialOption
+}
+
+// ShardingServer implements the Sharding service, and holds the topology
+// the gRPC server checks keys against. It is registered on a GRPCServer
+// with EnableSharding.
+type ShardingServer struct {
+	kvstore.UnimplementedShardingServer
+	store *store.Store
+	self  string
+	opts  ShardingOptions
+	ring  atomic.Pointer[sharding.Ring]
+
+	// Held for reading while a keyed request is served, and for writing
+	// while a migration hands its tokens over
+	flip sync.RWMutex
+
+	mu        sync.Mutex
+	conns     map[string]*grpc.ClientConn
+	migration *migration
+	// The running migration, which sees every write
+	active atomic.Pointer[migration]
+}
+
+// NewShardingServer returns a server for the node self. ring may be nil
+// for a node that waits to be added to an existing deployment.
+func NewShardingServer(st *store.Store, self string, ring *sharding.Ring, opts ShardingOptions) (*ShardingServer, error) {
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = sharding.DefaultVirtualNodes
+	}
+	if len(opts.DialOptions) == 0 {
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	s := &ShardingServer{
+		store: st,
+		self:  self,
+		opts:  opts,
+		conns: make(map[string]*grpc.ClientConn),
+	}
+
+	if opts.Path != "" {
+		saved, err := sharding.LoadRing(opts.Path)
+		if err != nil {
+			return nil, fmt.Errorf("loading topology: %w", err)
+		}
+		if saved != nil && (ring == nil || saved.Epoch() >= ring.Epoch()) {
+			ring = saved
+		}
+	}
+	if ring != nil {
+		s.ring.Store(ring)
+	}
+	return s, nil
+}
+
+// Ring returns the current topology, nil if this node has none yet.
+func (s *ShardingServer) Ring() *sharding.Ring {
+	return s.ring.Load()
+}
+
+// Observe is meant to be part of the store's write observer. It forwards
+// writes to the target of a running migration.
+func (s *ShardingServer) Observe(entry persistance.AOFEntry) {
+	if m := s.active.Load(); m != nil {
+		m.observe(entry)
+	}
+}
+
+// Close stops a running migration and closes the connections to the other
+// nodes.
+func (s *ShardingServer) Close() error {
+	s.mu.Lock()
+	m := s.migration
+	s.mu.Unlock()
+	if m != nil {
+		m.cancel()
+		<-m.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for addr, conn := range s.conns {
+		errs = append(errs, conn.Close())
+		delete(s.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+// Replaces the topology if ring is newer, and saves it.
+func (s *ShardingServer) setRing(ring *sharding.Ring) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current := s.Ring(); current != nil && ring.Epoch() <= current.Epoch() {
+		return false, nil
+	}
+	if s.opts.Path != "" {
+		if err := sharding.SaveRing(s.opts.Path, ring); err != nil {
+			return false, fmt.Errorf("saving topology: %w", err)
+		}
+	}
+	s.ring.Store(ring)
+	slog.Info("shard topology changed", "epoch", ring.Epoch(), "nodes", len(ring.Nodes()))
+	return true, nil
+}
+
+func (s *ShardingServer) client(addr string) (kvstore.ShardingClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn, ok := s.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = grpc.NewClient(addr, s.opts.DialOptions...); err != nil {
+			return nil, err
+		}
+		s.conns[addr] = conn
+	}
+	return kvstore.NewShardingClient(conn), nil
+}
+
+func (s *ShardingServer) outgoing(ctx context.Context) context.Context {
+	if s.opts.Token != "" {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.opts.Token)
+	}
+	return ctx
+}
+
+// Sends ring to every other node in it, returning those that couldn't be
+// reached.
+func (s *ShardingServer) broadcast(ring *sharding.Ring, skip ...string) []string {
+	var unreachable []string
+	msg := ring.ToProto(s.self)
+	for _, n := range ring.Nodes() {
+		if n.ID == s.self || containsString(skip, n.ID) {
+			continue
+		}
+		err := func() error {
+			client, err := s.client(n.Addr)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(s.outgoing(context.Background()), shardCallTimeout)
+			defer cancel()
+			_, err = client.UpdateTopology(ctx, msg)
+			return err
+		}()
+		if err != nil {
+			slog.Warn("failed to send the shard topology", "node", n.ID, "error", err)
+			unreachable = append(unreachable, n.ID)
+		}
+	}
+	return unreachable
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+const noTopologyMessage = "this node has no shard topology yet, add it with admin shard add"
+
+func (s *ShardingServer) Topology(ctx context.Context, req *kvstore.TopologyRequest) (*kvstore.TopologyResponse, error) {
+	ring := s.Ring()
+	if ring == nil {
+		return nil, status.Error(codes.Unavailable, noTopologyMessage)
+	}
+	return ring.ToProto(s.self), nil
+}
+
+func (s *ShardingServer) AddNode(ctx context.Context, req *kvstore.AddShardNodeRequest) (*kvstore.TopologyChangeResponse, error) {
+	if req.Id == "" || req.Addr == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and addr cannot be empty")
+	}
+	ring := s.Ring()
+	if ring == nil {
+		return nil, status.Error(codes.FailedPrecondition, noTopologyMessage)
+	}
+	next, err := ring.WithNode(sharding.Node{ID: req.Id, Addr: req.Addr})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := s.setRing(next); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &kvstore.TopologyChangeResponse{
+		Topology:    next.ToProto(s.self),
+		Unreachable: s.broadcast(next),
+	}, nil
+}
+
+func (s *ShardingServer) UpdateTopology(ctx context.Context, req *kvstore.TopologyResponse) (*kvstore.TopologyResponse, error) {
+	ring, err := sharding.RingFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := s.setRing(ring); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return s.Ring().ToProto(s.self), nil
+}
+
+// Returns an error redirecting to the owner for the first key this node
+// doesn't own, or nil if it owns them all. Batches are rejected as a
+// whole, so they are never half applied.
+func (s *ShardingServer) checkKeys(ctx context.Context, keys []string) error {
+	ring := s.Ring()
+	if ring == nil {
+		return status.Error(codes.Unavailable, noTopologyMessage)
+	}
+	for _, key := range keys {
+		owner := ring.Owner(key)
+		if owner.ID == s.self {
+			continue
+		}
+		grpc.SetTrailer(ctx, metadata.Pairs(sharding.MovedTrailer, owner.Addr))
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("key %q belongs to shard %s at %s", key, owner.ID, owner.Addr))
+	}
+	return nil
+}
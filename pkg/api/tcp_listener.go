@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Connection bookkeeping shared by the servers that speak plain TCP
+// protocols, so that stopping one closes every open connection.
+type tcpListener struct {
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	stopped  bool
+}
+
+// Accepts connections on lis and runs handle for each one in its own
+// goroutine, until stop is called.
+func (l *tcpListener) serve(lis net.Listener, handle func(conn net.Conn)) error {
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		lis.Close()
+		return nil
+	}
+	l.listener = lis
+	if l.conns == nil {
+		l.conns = make(map[net.Conn]struct{})
+	}
+	l.mu.Unlock()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		l.mu.Lock()
+		if l.stopped {
+			l.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+
+		go func() {
+			defer func() {
+				conn.Close()
+				l.mu.Lock()
+				delete(l.conns, conn)
+				l.mu.Unlock()
+				l.wg.Done()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+func (l *tcpListener) activeConns() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+// Stops accepting connections and lets the open ones finish the command
+// they are handling. Reads from the clients are cut short, so connections
+// waiting for a command close right away and a command that has only
+// partly arrived is dropped. Connections still open when ctx is done are
+// closed.
+func (l *tcpListener) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.stopped = true
+	if l.listener != nil {
+		l.listener.Close()
+	}
+	for conn := range l.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		l.stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (l *tcpListener) stop() {
+	l.mu.Lock()
+	l.stopped = true
+	if l.listener != nil {
+		l.listener.Close()
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tracking"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata a client sends its tracking ID in, and header the expiry of the
+// keys it read comes back in
+const (
+	trackingIDMetadata = "kvstore-tracking-id"
+	expiresAtHeader    = "kvstore-expires-at"
+)
+
+// Keys sent in one Invalidation at most
+const maxInvalidationKeys = 1000
+
+// TrackingServer implements the Tracking service on top of a tracking
+// table. It is registered on a GRPCServer with EnableTracking.
+type TrackingServer struct {
+	kvstore.UnimplementedTrackingServer
+	table *tracking.Table
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewTrackingServer(table *tracking.Table) *TrackingServer {
+	return &TrackingServer{table: table, done: make(chan struct{})}
+}
+
+// Ends the Invalidations streams, which would otherwise keep a graceful
+// stop waiting.
+func (s *TrackingServer) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+func (s *TrackingServer) Invalidations(req *kvstore.InvalidationsRequest, stream kvstore.Tracking_InvalidationsServer) error {
+	sub := s.table.Subscribe()
+	defer s.table.Unsubscribe(sub)
+	if err := stream.Send(&kvstore.Invalidation{ClientId: sub.ID}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+			// Whatever else is waiting goes out with it
+			batch := &kvstore.Invalidation{}
+			for ok {
+				if msg.All {
+					batch.All = true
+				} else {
+					batch.Keys = append(batch.Keys, msg.Key)
+				}
+				if len(batch.Keys) >= maxInvalidationKeys {
+					break
+				}
+				select {
+				case msg, ok = <-sub.Messages():
+				default:
+					ok = false
+				}
+			}
+			if err := stream.Send(batch); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// Tracks keys for the client whose ID came with the request, if any, and
+// sends their expiry back once they have been read. Keys are tracked before
+// they are read, so no change after the read goes unreported.
+type tracker struct {
+	ctx   context.Context
+	track bool
+}
+
+func (s *GRPCServer) startTracking(ctx context.Context, keys ...string) tracker {
+	if s.tracking == nil {
+		return tracker{}
+	}
+	values := metadata.ValueFromIncomingContext(ctx, trackingIDMetadata)
+	if len(values) == 0 {
+		return tracker{}
+	}
+	id, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		return tracker{}
+	}
+	for _, key := range keys {
+		if key != "" && !s.tracking.table.Track(id, key) {
+			return tracker{}
+		}
+	}
+	return tracker{ctx: ctx, track: true}
+}
+
+// Sends the expiry of each item read, in the order of the keys, 0 for
+// items that are missing or don't expire. Without the header the client
+// mustn't cache the values.
+func (t tracker) finish(items []store.Item) {
+	if !t.track {
+		return
+	}
+	md := metadata.MD{}
+	for _, item := range items {
+		var expiresAt int64
+		if !item.ExpiresAt.IsZero() {
+			expiresAt = item.ExpiresAt.UnixNano()
+		}
+		md.Append(expiresAtHeader, strconv.FormatInt(expiresAt, 10))
+	}
+	grpc.SetHeader(t.ctx, md)
+}
+
+func RegisterTrackingMetrics(reg *metrics.Registry, table *tracking.Table) {
+	reg.NewGaugeFunc("kvstore_tracking_clients", "Clients subscribed to invalidations of the keys they cache.", func() float64 {
+		return float64(table.Stats().Subscriptions)
+	})
+	reg.NewGaugeFunc("kvstore_tracking_keys", "Keys tracked for clients that cache them.", func() float64 {
+		return float64(table.Stats().Keys)
+	})
+	reg.NewCounterFunc("kvstore_tracking_invalidations_total", "Invalidations sent to clients that cache keys.", func() float64 {
+		return float64(table.Stats().Invalidations)
+	})
+	reg.NewCounterFunc("kvstore_tracking_dropped_total", "Clients dropped for falling behind on invalidations.", func() float64 {
+		return float64(table.Stats().Dropped)
+	})
+}
@@ -0,0 +1,228 @@
+// Package auth implements token authentication and per-prefix access
+// control lists for the gRPC, RESP and HTTP APIs.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Permission uint8
+
+const (
+	Read Permission = 1 << iota
+	Write
+	// Admin covers server management and implies Read and Write
+	Admin
+)
+
+func (p Permission) String() string {
+	var names []string
+	for _, perm := range []Permission{Read, Write, Admin} {
+		if p&perm != 0 {
+			names = append(names, permissionNames[perm])
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+var permissionNames = map[Permission]string{
+	Read:  "read",
+	Write: "write",
+	Admin: "admin",
+}
+
+func parsePermission(name string) (Permission, error) {
+	for perm, n := range permissionNames {
+		if n == name {
+			return perm, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown permission %q", name)
+}
+
+var ErrUnauthenticated = errors.New("missing or invalid token")
+
+type User struct {
+	Name   string
+	grants []grant
+}
+
+// Permissions on every key starting with prefix. An empty prefix covers all keys.
+type grant struct {
+	prefix      string
+	permissions Permission
+}
+
+// Allowed reports whether the user has perm on key.
+func (u *User) Allowed(perm Permission, key string) bool {
+	for _, g := range u.grants {
+		if !strings.HasPrefix(key, g.prefix) {
+			continue
+		}
+		granted := g.permissions
+		if granted&Admin != 0 {
+			granted |= Read | Write
+		}
+		if granted&perm == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ACL maps tokens to users. It is safe for concurrent use since it never
+// changes after being loaded.
+type ACL struct {
+	// Keyed by the hex SHA-256 of the token, so plain tokens aren't kept around
+	users map[string]*User
+}
+
+// The file format, for example:
+//
+//	users:
+//	  - name: app
+//	    token_sha256: 9f86d081884c7d65...
+//	    permissions:
+//	      - prefix: "app/"
+//	        access: [read, write]
+//	  - name: ops
+//	    token: s3cret
+//	    permissions:
+//	      - access: [admin]
+type aclFile struct {
+	Users []struct {
+		Name        string `yaml:"name"`
+		Token       string `yaml:"token"`
+		TokenSHA256 string `yaml:"token_sha256"`
+		Permissions []struct {
+			Prefix string   `yaml:"prefix"`
+			Access []string `yaml:"access"`
+		} `yaml:"permissions"`
+	} `yaml:"users"`
+}
+
+func LoadACLFile(path string) (*ACL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := ParseACL(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return acl, nil
+}
+
+func ParseACL(data []byte) (*ACL, error) {
+	var file aclFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	acl := &ACL{users: make(map[string]*User)}
+	for i, u := range file.Users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("user %d has no name", i+1)
+		}
+
+		var hash string
+		switch {
+		case u.Token != "" && u.TokenSHA256 != "":
+			return nil, fmt.Errorf("user %s: set either token or token_sha256, not both", u.Name)
+		case u.Token != "":
+			hash = hashToken(u.Token)
+		case u.TokenSHA256 != "":
+			hash = strings.ToLower(u.TokenSHA256)
+			if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("user %s: token_sha256 is not a hex SHA-256 digest", u.Name)
+			}
+		default:
+			return nil, fmt.Errorf("user %s has no token", u.Name)
+		}
+		if _, ok := acl.users[hash]; ok {
+			return nil, fmt.Errorf("user %s: token is already used by another user", u.Name)
+		}
+
+		user := &User{Name: u.Name}
+		for _, p := range u.Permissions {
+			var perms Permission
+			for _, name := range p.Access {
+				perm, err := parsePermission(name)
+				if err != nil {
+					return nil, fmt.Errorf("user %s: %w", u.Name, err)
+				}
+				perms |= perm
+			}
+			user.grants = append(user.grants, grant{prefix: p.Prefix, permissions: perms})
+		}
+		acl.users[hash] = user
+	}
+	return acl, nil
+}
+
+// Authenticate returns the user the token belongs to.
+func (a *ACL) Authenticate(token string) (*User, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	// Looking up the hash keeps the comparison independent of the token bytes
+	user, ok := a.users[hashToken(token)]
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return user, nil
+}
+
+// Authenticator is implemented by ACL and ReloadableACL.
+type Authenticator interface {
+	Authenticate(token string) (*User, error)
+}
+
+// ReloadableACL authenticates against an ACL that can be replaced while
+// requests are being served.
+type ReloadableACL struct {
+	acl atomic.Pointer[ACL]
+}
+
+func NewReloadableACL(acl *ACL) *ReloadableACL {
+	r := &ReloadableACL{}
+	r.acl.Store(acl)
+	return r
+}
+
+// Swap makes later requests use acl. Requests already authenticated keep
+// the user they got.
+func (r *ReloadableACL) Swap(acl *ACL) {
+	r.acl.Store(acl)
+}
+
+func (r *ReloadableACL) Authenticate(token string) (*User, error) {
+	return r.acl.Load().Authenticate(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type userKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated user.
+func NewContext(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// FromContext returns the user stored by NewContext, if any.
+func FromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userKey{}).(*User)
+	return user, ok
+}
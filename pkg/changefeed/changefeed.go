@@ -0,0 +1,477 @@
+// Package changefeed keeps a numbered history of every change to the
+// store's keys on disk, for change data capture. Consumers read it from
+// any position that is still retained and then follow new changes, so one
+// that stores the last position it processed can resume after a
+// disconnect or restart.
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+const (
+	DefaultSegmentBytes = 16 << 20
+	DefaultRetention    = 24 * time.Hour
+	DefaultMaxBytes     = 1 << 30
+)
+
+const segmentSuffix = ".log"
+
+var ErrClosed = errors.New("change feed closed")
+
+// RangeError is returned when reading from a position the log doesn't
+// have: one whose segment was compacted away, or one past the next change.
+type RangeError struct {
+	LSN uint64
+	// Oldest retained change and the next one to be written
+	First uint64
+	Next  uint64
+}
+
+func (e *RangeError) Error() string {
+	if e.Compacted() {
+		return fmt.Sprintf("change %d was compacted away, the oldest retained change is %d", e.LSN, e.First)
+	}
+	return fmt.Sprintf("change %d is past the end of the feed, the last change is %d", e.LSN, e.Next-1)
+}
+
+// Compacted reports whether the change is too old rather than too new.
+func (e *RangeError) Compacted() bool {
+	return e.LSN < e.First
+}
+
+type Value struct {
+	Value     string
+	ExpiresAt time.Time
+	Version   uint64 `json:",omitempty"`
+	Flags     uint32 `json:",omitempty"`
+}
+
+type Record struct {
+	// Log sequence number, starting at 1
+	LSN  uint64
+	Time time.Time
+	// One of the store.Change ops
+	Op  string
+	Key string
+	// Nil when the key didn't exist, or was removed
+	Old *Value `json:",omitempty"`
+	New *Value `json:",omitempty"`
+}
+
+type Options struct {
+	// Size at which a segment is closed and a new one started, defaults to
+	// DefaultSegmentBytes
+	SegmentBytes int64
+	// Closed segments whose last change is older are deleted, 0 keeps them
+	// regardless of age
+	Retention time.Duration
+	// Closed segments are deleted, oldest first, while all of them take up
+	// more, 0 means no limit
+	MaxBytes int64
+}
+
+// The log is split into segment files named after their first LSN. Only
+// the last one is written to, and retention deletes whole segments.
+type segment struct {
+	first uint64
+	path  string
+	// Bytes of complete records
+	size int64
+	// Time of the last change in it
+	last time.Time
+}
+
+// Log numbers changes and appends them to the segment files in a directory.
+type Log struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	segments []*segment
+	file     *os.File
+	next     uint64
+	// Closed and replaced on every append, which wakes up readers
+	changed     chan struct{}
+	readers     int
+	writeErrors uint64
+	closed      bool
+}
+
+// Open opens the log in dir, creating it if needed, and continues numbering
+// after the last change in it. A record cut short by a crash is dropped.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = DefaultSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, opts: opts, segments: segments, next: 1, changed: make(chan struct{})}
+	if len(segments) == 0 {
+		if err := l.startSegment(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	active := segments[len(segments)-1]
+	if l.next, err = recoverSegment(active); err != nil {
+		return nil, err
+	}
+	if l.file, err = os.OpenFile(active.path, os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	l.compact()
+	return l, nil
+}
+
+func listSegments(dir string) ([]*segment, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*segment
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), segmentSuffix)
+		if !ok || f.IsDir() {
+			continue
+		}
+		first, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, &segment{
+			first: first,
+			path:  filepath.Join(dir, f.Name()),
+			size:  info.Size(),
+			last:  info.ModTime(),
+		})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].first < segments[j].first
+	})
+	return segments, nil
+}
+
+// Reads the last segment to find the next LSN, and truncates it after the
+// last record that decodes.
+func recoverSegment(seg *segment) (uint64, error) {
+	file, err := os.OpenFile(seg.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	next := seg.first
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var r Record
+		if json.Unmarshal(line, &r) != nil || r.LSN != next {
+			break
+		}
+		next++
+		size += int64(len(line))
+	}
+	if size != seg.size {
+		slog.Warn("dropping an incomplete change feed record", "segment", seg.path, "offset", size)
+		if err := file.Truncate(size); err != nil {
+			return 0, err
+		}
+		seg.size = size
+	}
+	return next, nil
+}
+
+// Closes the current segment, if any, and starts one at the next LSN.
+// Must be called with the lock held.
+func (l *Log) startSegment() error {
+	path := filepath.Join(l.dir, fmt.Sprintf("%020d%s", l.next, segmentSuffix))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.segments = append(l.segments, &segment{first: l.next, path: path, last: time.Now()})
+	return nil
+}
+
+// Append adds a change to the log. It is meant to be the store's change
+// observer, so it doesn't return errors: a change that can't be written is
+// logged and counted, and not numbered.
+func (l *Log) Append(change store.Change) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+
+	record := Record{
+		LSN:  l.next,
+		Time: time.Now(),
+		Op:   change.Op,
+		Key:  change.Key,
+		Old:  value(change.Old),
+		New:  value(change.New),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		l.writeFailed(record, err)
+		return
+	}
+	data = append(data, '\n')
+
+	active := l.segments[len(l.segments)-1]
+	if _, err := l.file.Write(data); err != nil {
+		// Readers only go up to the last complete record, so a partial
+		// write just has to be cut off before the next one
+		l.file.Truncate(active.size)
+		l.writeFailed(record, err)
+		return
+	}
+	active.size += int64(len(data))
+	active.last = record.Time
+	l.next++
+	close(l.changed)
+	l.changed = make(chan struct{})
+
+	if active.size >= l.opts.SegmentBytes {
+		if err := l.startSegment(); err != nil {
+			// Keeps appending to the full segment, and tries again with
+			// the next change
+			slog.Error("failed to start a change feed segment", "dir", l.dir, "error", err)
+		}
+	}
+	l.compact()
+}
+
+func value(item *store.Item) *Value {
+	if item == nil {
+		return nil
+	}
+	return &Value{Value: item.Value, ExpiresAt: item.ExpiresAt, Version: item.Version, Flags: item.Flags}
+}
+
+// Must be called with the lock held.
+func (l *Log) writeFailed(record Record, err error) {
+	l.writeErrors++
+	slog.Error("change feed write failed, dropping the change", "op", record.Op, "key", record.Key, "error", err)
+}
+
+// Deletes the oldest closed segments that are past the retention limits.
+// Must be called with the lock held.
+func (l *Log) compact() {
+	var total int64
+	for _, seg := range l.segments {
+		total += seg.size
+	}
+	for len(l.segments) > 1 {
+		oldest := l.segments[0]
+		tooBig := l.opts.MaxBytes > 0 && total > l.opts.MaxBytes
+		tooOld := l.opts.Retention > 0 && time.Since(oldest.last) > l.opts.Retention
+		if !tooBig && !tooOld {
+			return
+		}
+		// Readers of the segment keep it open, so they can finish it
+		if err := os.Remove(oldest.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to delete a change feed segment", "segment", oldest.path, "error", err)
+			return
+		}
+		slog.Debug("deleted a change feed segment", "segment", oldest.path, "bytes", oldest.size)
+		total -= oldest.size
+		l.segments = l.segments[1:]
+	}
+}
+
+// Read calls fn with every change from LSN from on, in order: first the
+// retained ones and then new ones as they are appended. It returns when ctx
+// is done, fn returns an error or the log is closed. from 0 starts at the
+// oldest retained change, and a from that isn't retained or is past the
+// next change returns a *RangeError.
+func (l *Log) Read(ctx context.Context, from uint64, fn func(Record) error) error {
+	l.mu.Lock()
+	if from == 0 {
+		from = l.segments[0].first
+	}
+	l.readers++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.readers--
+		l.mu.Unlock()
+	}()
+
+	var (
+		seg    *segment
+		file   *os.File
+		reader *bufio.Reader
+		offset int64
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return ErrClosed
+		}
+		if seg == nil {
+			if seg = l.find(from); seg == nil {
+				err := l.rangeError(from)
+				l.mu.Unlock()
+				return err
+			}
+		}
+		limit := seg.size
+		active := seg == l.segments[len(l.segments)-1]
+		changed := l.changed
+		l.mu.Unlock()
+
+		if file == nil {
+			var err error
+			if file, err = os.Open(seg.path); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					// Compacted in the meantime
+					l.mu.Lock()
+					defer l.mu.Unlock()
+					return l.rangeError(from)
+				}
+				return err
+			}
+			reader = bufio.NewReader(file)
+			offset = 0
+		}
+
+		// Only complete records are counted in the size, so reading stops
+		// at a record boundary
+		for offset < limit {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", seg.path, err)
+			}
+			offset += int64(len(line))
+			var r Record
+			if err := json.Unmarshal(line, &r); err != nil {
+				return fmt.Errorf("decoding a record in %s: %w", seg.path, err)
+			}
+			if r.LSN < from {
+				continue
+			}
+			if err := fn(r); err != nil {
+				return err
+			}
+			from = r.LSN + 1
+		}
+
+		if !active {
+			// Done with the segment, the next one starts at from
+			file.Close()
+			file, seg = nil, nil
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Returns the segment holding the change from, or the active segment if
+// from is the next change. Must be called with the lock held.
+func (l *Log) find(from uint64) *segment {
+	if from < l.segments[0].first || from > l.next {
+		return nil
+	}
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].first > from
+	})
+	return l.segments[i-1]
+}
+
+// Must be called with the lock held.
+func (l *Log) rangeError(from uint64) error {
+	return &RangeError{LSN: from, First: l.segments[0].first, Next: l.next}
+}
+
+// Next returns the LSN the next change will get, so reading from it only
+// sends new changes.
+func (l *Log) Next() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next
+}
+
+type Stats struct {
+	// Oldest retained change and the last one written, Last is below First
+	// while no change is retained
+	First uint64
+	Last  uint64
+	// Segments and their size on disk
+	Segments    int
+	Bytes       int64
+	Readers     int
+	WriteErrors uint64
+}
+
+func (l *Log) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st := Stats{
+		First:       l.segments[0].first,
+		Last:        l.next - 1,
+		Segments:    len(l.segments),
+		Readers:     l.readers,
+		WriteErrors: l.writeErrors,
+	}
+	for _, seg := range l.segments {
+		st.Bytes += seg.size
+	}
+	return st
+}
+
+// Close stops appending and ends every Read with ErrClosed.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.changed)
+	return errors.Join(l.file.Sync(), l.file.Close())
+}
@@ -0,0 +1,323 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata the tracking ID is sent in with reads, and header the server
+// answers tracked reads with
+const (
+	trackingIDMetadata = "kvstore-tracking-id"
+	expiresAtHeader    = "kvstore-expires-at"
+)
+
+// CacheStats counts what happened in the client-side cache since the
+// client was created.
+type CacheStats struct {
+	// Keys read from the cache, and keys the server had to be asked for
+	Hits   uint64
+	Misses uint64
+	// Keys dropped because they changed
+	Invalidations uint64
+	// Keys dropped to stay within CacheSize
+	Evictions uint64
+	Entries   int
+}
+
+// HitRate returns the share of keys read from the cache, 0 before any
+// reads.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+	found bool
+	// Zero when the key doesn't expire
+	expiresAt time.Time
+}
+
+// Keys being read from the server. A key invalidated while being read may
+// have been read before the change, so it isn't cached.
+type pendingRead struct {
+	reads int
+	stale bool
+}
+
+// An LRU of keys the server tracks for this client. Nothing is cached
+// without a tracking ID, as nobody would say when the keys change.
+type cache struct {
+	size int
+
+	mu      sync.Mutex
+	id      uint64
+	gen     uint64
+	entries map[string]*list.Element
+	lru     *list.List
+	pending map[string]*pendingRead
+	stats   CacheStats
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		pending: make(map[string]*pendingRead),
+	}
+}
+
+// Returns the cached value of key, ok is false on a miss. Safe to call on
+// a nil cache.
+func (c *cache) get(key string) (value []byte, found bool, ok bool) {
+	if c == nil {
+		return nil, false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			return entry.value, entry.found, true
+		}
+		c.remove(elem)
+	}
+	c.stats.Misses++
+	return nil, false, false
+}
+
+// Must be called with the lock held.
+func (c *cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// Drops keys that changed. Safe to call on a nil cache.
+func (c *cache) invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if pending, ok := c.pending[key]; ok {
+			pending.stale = true
+		}
+		if elem, ok := c.entries[key]; ok {
+			c.remove(elem)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// Drops every key and starts caching under a new tracking ID, 0 to stop
+// caching. Reads started before aren't cached.
+func (c *cache) reset(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Invalidations += uint64(len(c.entries))
+	clear(c.entries)
+	c.lru.Init()
+	c.id = id
+	c.gen++
+}
+
+func (c *cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// A read of keys from the server whose results may be cached.
+type cacheRead struct {
+	c    *cache
+	keys []string
+	id   uint64
+	gen  uint64
+}
+
+// Safe to call on a nil cache, returning a nil read.
+func (c *cache) startRead(keys ...string) *cacheRead {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		pending := c.pending[key]
+		if pending == nil {
+			pending = &pendingRead{}
+			c.pending[key] = pending
+		}
+		pending.reads++
+	}
+	return &cacheRead{c: c, keys: keys, id: c.id, gen: c.gen}
+}
+
+// Asks the server to track the keys for this client.
+func (r *cacheRead) context(ctx context.Context) context.Context {
+	if r == nil || r.id == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, trackingIDMetadata, strconv.FormatUint(r.id, 10))
+}
+
+type readResult struct {
+	value []byte
+	found bool
+	// The key couldn't be read
+	failed bool
+}
+
+// Caches the results, one per key, if the server tracks them, as the
+// expiry header tells. Safe to call on a nil read.
+func (r *cacheRead) fill(header metadata.MD, results []readResult) {
+	if r == nil || r.id == 0 {
+		return
+	}
+	expiries := header.Get(expiresAtHeader)
+	if len(expiries) != len(r.keys) || len(results) != len(r.keys) {
+		return
+	}
+
+	c := r.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != r.gen {
+		return
+	}
+	for i, key := range r.keys {
+		if results[i].failed || c.pending[key].stale {
+			continue
+		}
+		nanos, err := strconv.ParseInt(expiries[i], 10, 64)
+		if err != nil {
+			continue
+		}
+		entry := &cacheEntry{key: key, value: results[i].value, found: results[i].found}
+		if nanos != 0 {
+			entry.expiresAt = time.Unix(0, nanos)
+		}
+		if elem, ok := c.entries[key]; ok {
+			elem.Value = entry
+			c.lru.MoveToFront(elem)
+			continue
+		}
+		c.entries[key] = c.lru.PushFront(entry)
+		for c.lru.Len() > c.size {
+			c.remove(c.lru.Back())
+			c.stats.Evictions++
+		}
+	}
+}
+
+// Must be called once the read is over, whether it succeeded or not. Safe
+// to call on a nil read.
+func (r *cacheRead) end() {
+	if r == nil {
+		return
+	}
+	c := r.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range r.keys {
+		pending := c.pending[key]
+		if pending.reads--; pending.reads == 0 {
+			delete(c.pending, key)
+		}
+	}
+}
+
+// Follows the server's invalidations for as long as the client is open,
+// resubscribing when the stream breaks. The cache is emptied whenever the
+// stream isn't up, since changes would go unnoticed.
+func (c *Client) trackInvalidations(ctx context.Context) {
+	defer close(c.trackingDone)
+	backoff := c.opts.Retry.InitialBackoff
+	for {
+		subscribed := c.followInvalidations(ctx)
+		c.cache.reset(0)
+		if subscribed {
+			backoff = c.opts.Retry.InitialBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.opts.Retry.MaxBackoff)
+	}
+}
+
+// Returns whether the stream got as far as a tracking ID.
+func (c *Client) followInvalidations(ctx context.Context) bool {
+	stream, err := kvstore.NewTrackingClient(c.Conn()).Invalidations(ctx, &kvstore.InvalidationsRequest{})
+	if err != nil {
+		return false
+	}
+	msg, err := stream.Recv()
+	if err != nil || msg.ClientId == 0 {
+		return false
+	}
+	id := msg.ClientId
+	c.cache.reset(id)
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return true
+		}
+		if msg.All {
+			c.cache.reset(id)
+		}
+		c.cache.invalidate(msg.Keys...)
+	}
+}
+
+// CacheStats returns the client-side cache's counters, all zero when
+// caching is off.
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.Stats()
+}
+
+// RegisterCacheMetrics adds the client-side cache's counters to reg.
+func (c *Client) RegisterCacheMetrics(reg *metrics.Registry) {
+	reg.NewCounterFunc("kvstore_client_cache_hits_total", "Keys read from the client-side cache.", func() float64 {
+		return float64(c.CacheStats().Hits)
+	})
+	reg.NewCounterFunc("kvstore_client_cache_misses_total", "Keys read from the server because they weren't cached.", func() float64 {
+		return float64(c.CacheStats().Misses)
+	})
+	reg.NewGaugeFunc("kvstore_client_cache_hit_ratio", "Share of keys read from the client-side cache.", func() float64 {
+		return c.CacheStats().HitRate()
+	})
+	reg.NewCounterFunc("kvstore_client_cache_invalidations_total", "Cached keys dropped because they changed.", func() float64 {
+		return float64(c.CacheStats().Invalidations)
+	})
+	reg.NewCounterFunc("kvstore_client_cache_evictions_total", "Cached keys dropped to stay within the cache size.", func() float64 {
+		return float64(c.CacheStats().Evictions)
+	})
+	reg.NewGaugeFunc("kvstore_client_cache_entries", "Keys in the client-side cache.", func() float64 {
+		return float64(c.CacheStats().Entries)
+	})
+}
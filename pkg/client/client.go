@@ -0,0 +1,339 @@
+// Package client is the Go client for the key-value store's gRPC API. It
+// keeps connections to one or more servers, sends the token with every
+// call, retries idempotent calls with backoff, fails over between servers
+// and follows replicas and Raft followers to the server that takes writes:
+//
+//	c, err := client.New(ctx, client.Options{Endpoints: []string{"localhost:50051"}})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	value, err := c.Get(ctx, "key")
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultTimeout        = 5 * time.Second
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 50 * time.Millisecond
+	DefaultMaxBackoff     = time.Second
+)
+
+// Trailers the server sends with writes it doesn't take: a replica names
+// its primary and a Raft follower its leader
+const (
+	primaryTrailer = "kvstore-primary"
+	leaderTrailer  = "kvstore-leader"
+)
+
+// Redirects followed per call, so servers pointing at each other can't
+// keep a call going forever
+const maxRedirects = 3
+
+type Options struct {
+	// Server addresses as host:port. Calls go to the first one until it
+	// can't be reached, then to the next.
+	Endpoints []string
+	// Sent as a bearer token with every call, including those made on Conn
+	Token string
+	// Connects with TLS when set
+	TLS *tls.Config
+	// Added to every connection's options
+	DialOptions []grpc.DialOption
+	// Limit on a call and its retries when the context has no deadline,
+	// defaults to DefaultTimeout. Negative disables it.
+	Timeout time.Duration
+	Retry   RetryPolicy
+	// Sends every key to the shard that owns it when the servers are
+	// sharded, which New finds out with a Topology call
+	Sharding bool
+	// Keys kept in a local cache of the values read, 0 turns caching off.
+	// The server tells the client when cached keys change, so reads never
+	// see a value older than that notice. Not supported with sharding.
+	CacheSize int
+}
+
+// RetryPolicy applies to calls that can safely be sent twice, when the
+// server is unavailable.
+type RetryPolicy struct {
+	// Attempts per call including the first, defaults to
+	// DefaultMaxAttempts. 1 disables retries.
+	MaxAttempts int
+	// Wait before the first retry, doubled for every retry up to
+	// MaxBackoff, with up to half of it added at random
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type endpoint struct {
+	addr string
+	conn *grpc.ClientConn
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	opts   Options
+	router *sharding.Router
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	// Endpoint calls go to
+	current int
+
+	// Set when caching is on
+	cache        *cache
+	stopTracking context.CancelFunc
+	trackingDone chan struct{}
+}
+
+// New connects to the endpoints. Connections are made lazily, so it only
+// talks to a server when sharding is on.
+func New(ctx context.Context, opts Options) (*Client, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, errors.New("no endpoints")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Retry.InitialBackoff <= 0 {
+		opts.Retry.InitialBackoff = DefaultInitialBackoff
+	}
+	if opts.Retry.MaxBackoff <= 0 {
+		opts.Retry.MaxBackoff = DefaultMaxBackoff
+	}
+
+	c := &Client{opts: opts}
+	for _, addr := range opts.Endpoints {
+		if _, err := c.endpoint(addr); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if opts.Sharding {
+		if err := c.startRouter(ctx); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("fetching the topology: %w", err)
+		}
+	}
+
+	if opts.CacheSize > 0 {
+		if c.router != nil {
+			c.Close()
+			return nil, errors.New("client-side caching isn't supported with sharded servers")
+		}
+		c.cache = newCache(opts.CacheSize)
+		ctx, cancel := context.WithCancel(context.Background())
+		c.stopTracking = cancel
+		c.trackingDone = make(chan struct{})
+		go c.trackInvalidations(ctx)
+	}
+	return c, nil
+}
+
+// Fetches the topology from the first endpoint that is available.
+func (c *Client) startRouter(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var err error
+	for i, ep := range c.endpoints {
+		var router *sharding.Router
+		router, err = sharding.NewRouter(ctx, ep.conn, c.Dial)
+		switch {
+		case err == nil:
+			c.router = router
+			c.current = i
+			return nil
+		case errors.Is(err, sharding.ErrNotSharded):
+			c.current = i
+			return nil
+		case status.Code(err) != codes.Unavailable:
+			return err
+		}
+	}
+	return err
+}
+
+// Dial opens a connection to addr with the client's credentials and token.
+// The caller closes it.
+func (c *Client) Dial(addr string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if c.opts.TLS != nil {
+		creds = credentials.NewTLS(c.opts.TLS)
+	}
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if c.opts.Token != "" {
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(c.addTokenUnary),
+			grpc.WithChainStreamInterceptor(c.addTokenStream),
+		)
+	}
+	return grpc.NewClient(addr, append(dialOpts, c.opts.DialOptions...)...)
+}
+
+func (c *Client) withToken(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.opts.Token)
+}
+
+func (c *Client) addTokenUnary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(c.withToken(ctx), method, req, reply, cc, opts...)
+}
+
+func (c *Client) addTokenStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(c.withToken(ctx), desc, cc, method, opts...)
+}
+
+// Returns the endpoint for addr, connecting to it if it is new.
+func (c *Client) endpoint(addr string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, ep := range c.endpoints {
+		if ep.addr == addr {
+			return i, nil
+		}
+	}
+	conn, err := c.Dial(addr)
+	if err != nil {
+		return 0, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	c.endpoints = append(c.endpoints, &endpoint{addr: addr, conn: conn})
+	return len(c.endpoints) - 1, nil
+}
+
+// Conn returns the connection to the endpoint calls currently go to, for
+// the services this package doesn't wrap, like Admin.
+func (c *Client) Conn() *grpc.ClientConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints[c.current].conn
+}
+
+// Addr returns the address of the endpoint calls currently go to.
+func (c *Client) Addr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints[c.current].addr
+}
+
+// Moves on from the endpoint at i to the next one, unless another call
+// already has.
+func (c *Client) failover(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == i {
+		c.current = (i + 1) % len(c.endpoints)
+	}
+}
+
+func (c *Client) Close() error {
+	if c.stopTracking != nil {
+		c.stopTracking()
+		<-c.trackingDone
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	if c.router != nil {
+		errs = append(errs, c.router.Close())
+	}
+	for _, ep := range c.endpoints {
+		errs = append(errs, ep.conn.Close())
+	}
+	c.endpoints = nil
+	return errors.Join(errs...)
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.opts.Timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opts.Timeout)
+}
+
+// Sends a KVStore call. Unavailable servers are retried, on the next
+// endpoint, only for idempotent calls, since the first attempt may have
+// been applied. A write rejected by a replica or a follower wasn't, so it
+// goes to the server named in the trailer whatever the call.
+func (c *Client) invoke(ctx context.Context, method string, req, reply any, idempotent bool, opts ...grpc.CallOption) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	backoff := c.opts.Retry.InitialBackoff
+	redirects := 0
+	for attempt := 1; ; attempt++ {
+		c.mu.Lock()
+		i := c.current
+		var cc grpc.ClientConnInterface = c.endpoints[i].conn
+		c.mu.Unlock()
+		if c.router != nil {
+			cc = c.router
+		}
+
+		var trailer metadata.MD
+		err := cc.Invoke(ctx, method, req, reply, append(opts, grpc.Trailer(&trailer))...)
+		if err == nil {
+			return nil
+		}
+
+		if addr := redirect(err, trailer); addr != "" && c.router == nil && redirects < maxRedirects {
+			redirects++
+			next, dialErr := c.endpoint(addr)
+			if dialErr != nil {
+				return errors.Join(err, dialErr)
+			}
+			c.mu.Lock()
+			c.current = next
+			c.mu.Unlock()
+			attempt--
+			continue
+		}
+
+		if status.Code(err) != codes.Unavailable || !idempotent || attempt >= c.opts.Retry.MaxAttempts {
+			return err
+		}
+		c.failover(i)
+		wait := backoff + rand.N(backoff/2+1)
+		backoff = min(2*backoff, c.opts.Retry.MaxBackoff)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Returns the server a rejected write should go to instead, if any.
+func redirect(err error, trailer metadata.MD) string {
+	if status.Code(err) != codes.FailedPrecondition {
+		return ""
+	}
+	for _, key := range []string{primaryTrailer, leaderTrailer} {
+		if values := trailer.Get(key); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	ErrNotFound = errors.New("key not found")
+	// A Set with IfAbsent or IfPresent whose condition didn't hold
+	ErrNotSet = errors.New("key not set")
+)
+
+// Returned by TTL for a key that doesn't expire
+const NoExpiry time.Duration = -1
+
+// BatchError holds the keys of a batch call that failed, by key. The other
+// keys' results are still returned.
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s: %v", key, e.Errors[key])
+	}
+	return fmt.Sprintf("%d keys failed: %s", len(keys), strings.Join(parts, "; "))
+}
+
+func (e *BatchError) add(key, msg string) *BatchError {
+	if e == nil {
+		e = &BatchError{Errors: make(map[string]error)}
+	}
+	e.Errors[key] = errors.New(msg)
+	return e
+}
+
+// Keeps a nil *BatchError from becoming a non-nil error.
+func (e *BatchError) err() error {
+	if e == nil {
+		return nil
+	}
+	return e
+}
+
+type SetOption func(*kvstore.SetRequest)
+
+// WithTTL expires the key after ttl, rounded up to whole seconds.
+func WithTTL(ttl time.Duration) SetOption {
+	return func(req *kvstore.SetRequest) { req.TtlSeconds = seconds(ttl) }
+}
+
+// IfAbsent only sets the key if it doesn't exist (NX).
+func IfAbsent() SetOption {
+	return func(req *kvstore.SetRequest) { req.Condition = kvstore.SetCondition_SET_CONDITION_IF_ABSENT }
+}
+
+// IfPresent only sets the key if it already exists (XX).
+func IfPresent() SetOption {
+	return func(req *kvstore.SetRequest) { req.Condition = kvstore.SetCondition_SET_CONDITION_IF_PRESENT }
+}
+
+// Entry is a key to set with MSet. A TTL of 0 means no expiry.
+type Entry struct {
+	Key   string
+	Value []byte
+	TTL   time.Duration
+}
+
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// Get returns ErrNotFound if the key doesn't exist.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, found, ok := c.cache.get(key); ok {
+		if !found {
+			return nil, ErrNotFound
+		}
+		return bytes.Clone(value), nil
+	}
+
+	read := c.cache.startRead(key)
+	defer read.end()
+	var resp kvstore.GetResponse
+	var header metadata.MD
+	if err := c.invoke(read.context(ctx), kvstore.KVStore_Get_FullMethodName, &kvstore.GetRequest{Key: key}, &resp, true, grpc.Header(&header)); err != nil {
+		return nil, err
+	}
+	value := []byte(resp.Value)
+	read.fill(header, []readResult{{value: value, found: resp.Found}})
+	if !resp.Found {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(value), nil
+}
+
+// Set returns ErrNotSet if a condition prevented the write. Only
+// unconditional sets are retried.
+func (c *Client) Set(ctx context.Context, key string, value []byte, opts ...SetOption) error {
+	req := &kvstore.SetRequest{Key: key, Value: string(value)}
+	for _, opt := range opts {
+		opt(req)
+	}
+	defer c.cache.invalidate(key)
+	var resp kvstore.SetResponse
+	idempotent := req.Condition == kvstore.SetCondition_SET_CONDITION_ALWAYS
+	if err := c.invoke(ctx, kvstore.KVStore_Set_FullMethodName, req, &resp, idempotent); err != nil {
+		return err
+	}
+	if !resp.Success {
+		return ErrNotSet
+	}
+	return nil
+}
+
+// Delete succeeds whether or not the key existed.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	defer c.cache.invalidate(key)
+	var resp kvstore.DeleteResponse
+	return c.invoke(ctx, kvstore.KVStore_Delete_FullMethodName, &kvstore.DeleteRequest{Key: key}, &resp, true)
+}
+
+// MGet returns the keys that exist. Keys that couldn't be read are in a
+// *BatchError.
+func (c *Client) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	missing := keys
+	if c.cache != nil {
+		missing = nil
+		for _, key := range keys {
+			value, found, ok := c.cache.get(key)
+			switch {
+			case !ok:
+				missing = append(missing, key)
+			case found:
+				values[key] = bytes.Clone(value)
+			}
+		}
+		if len(missing) == 0 {
+			return values, nil
+		}
+	}
+
+	read := c.cache.startRead(missing...)
+	defer read.end()
+	var resp kvstore.MGetResponse
+	var header metadata.MD
+	if err := c.invoke(read.context(ctx), kvstore.KVStore_MGet_FullMethodName, &kvstore.MGetRequest{Keys: missing}, &resp, true, grpc.Header(&header)); err != nil {
+		return nil, err
+	}
+	results := make([]readResult, len(resp.Results))
+	var batchErr *BatchError
+	for i, result := range resp.Results {
+		value := []byte(result.Value)
+		results[i] = readResult{value: value, found: result.Found, failed: result.Error != ""}
+		switch {
+		case result.Error != "":
+			batchErr = batchErr.add(result.Key, result.Error)
+		case result.Found:
+			values[result.Key] = bytes.Clone(value)
+		}
+	}
+	read.fill(header, results)
+	return values, batchErr.err()
+}
+
+// MSet sets the entries, which aren't written atomically. Keys that
+// couldn't be set are in a *BatchError.
+func (c *Client) MSet(ctx context.Context, entries ...Entry) error {
+	req := &kvstore.MSetRequest{Entries: make([]*kvstore.SetRequest, len(entries))}
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		req.Entries[i] = &kvstore.SetRequest{Key: entry.Key, Value: string(entry.Value), TtlSeconds: seconds(entry.TTL)}
+		keys[i] = entry.Key
+	}
+	defer c.cache.invalidate(keys...)
+	var resp kvstore.MSetResponse
+	if err := c.invoke(ctx, kvstore.KVStore_MSet_FullMethodName, req, &resp, true); err != nil {
+		return err
+	}
+	var batchErr *BatchError
+	for _, result := range resp.Results {
+		if result.Error != "" {
+			batchErr = batchErr.add(result.Key, result.Error)
+		}
+	}
+	return batchErr.err()
+}
+
+// MDelete returns whether each key existed. Keys that couldn't be deleted
+// are in a *BatchError. It isn't retried, as a second attempt would report
+// the keys as missing.
+func (c *Client) MDelete(ctx context.Context, keys ...string) (map[string]bool, error) {
+	defer c.cache.invalidate(keys...)
+	var resp kvstore.MDeleteResponse
+	if err := c.invoke(ctx, kvstore.KVStore_MDelete_FullMethodName, &kvstore.MDeleteRequest{Keys: keys}, &resp, false); err != nil {
+		return nil, err
+	}
+	deleted := make(map[string]bool, len(resp.Results))
+	var batchErr *BatchError
+	for _, result := range resp.Results {
+		if result.Error != "" {
+			batchErr = batchErr.add(result.Key, result.Error)
+			continue
+		}
+		deleted[result.Key] = result.Deleted
+	}
+	return deleted, batchErr.err()
+}
+
+// Expire expires the key after ttl, rounded up to whole seconds, or right
+// away if it isn't positive. It returns ErrNotFound if the key doesn't
+// exist.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	defer c.cache.invalidate(key)
+	var resp kvstore.ExpireResponse
+	if err := c.invoke(ctx, kvstore.KVStore_Expire_FullMethodName, &kvstore.ExpireRequest{Key: key, TtlSeconds: seconds(ttl)}, &resp, false); err != nil {
+		return err
+	}
+	if !resp.Updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ExpireAt expires the key at t, truncated to the second, or right away if
+// t has passed. It returns ErrNotFound if the key doesn't exist.
+func (c *Client) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	defer c.cache.invalidate(key)
+	var resp kvstore.ExpireResponse
+	if err := c.invoke(ctx, kvstore.KVStore_ExpireAt_FullMethodName, &kvstore.ExpireAtRequest{Key: key, UnixSeconds: t.Unix()}, &resp, true); err != nil {
+		return err
+	}
+	if !resp.Updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Persist removes the key's expiry. It returns false if the key doesn't
+// exist or doesn't expire.
+func (c *Client) Persist(ctx context.Context, key string) (bool, error) {
+	defer c.cache.invalidate(key)
+	var resp kvstore.PersistResponse
+	if err := c.invoke(ctx, kvstore.KVStore_Persist_FullMethodName, &kvstore.PersistRequest{Key: key}, &resp, false); err != nil {
+		return false, err
+	}
+	return resp.Updated, nil
+}
+
+// TTL returns the time left until the key expires, to the second, or
+// NoExpiry. It returns ErrNotFound if the key doesn't exist.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var resp kvstore.TTLResponse
+	if err := c.invoke(ctx, kvstore.KVStore_TTL_FullMethodName, &kvstore.TTLRequest{Key: key}, &resp, true); err != nil {
+		return 0, err
+	}
+	switch {
+	case !resp.Found:
+		return 0, ErrNotFound
+	case resp.TtlSeconds < 0:
+		return NoExpiry, nil
+	}
+	return time.Duration(resp.TtlSeconds) * time.Second, nil
+}
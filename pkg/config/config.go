@@ -0,0 +1,663 @@
+// Package config loads the server configuration. Values are layered, each
+// source overriding the previous one: built-in defaults, the YAML file,
+// KVSTORE_* environment variables and finally command-line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/changefeed"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/logging"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/raft"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tracking"
+)
+
+const (
+	DefaultPath = "configs/config.yml"
+	EnvPrefix   = "KVSTORE_"
+	aofFilename = "aof.log"
+)
+
+type Config struct {
+	// TTL in seconds for writes that don't set one, 0 means no expiry
+	DefaultTTL  int64  `yaml:"DEFAULT_TTL"`
+	SnapshotDir string `yaml:"SNAPSHOT_DIR"`
+	AOFDir      string `yaml:"AOF_DIR"`
+	// Durations such as "30s", a zero snapshot interval disables snapshots
+	SnapshotInterval time.Duration `yaml:"SNAPSHOT_INTERVAL"`
+	ExpiryInterval   time.Duration `yaml:"EXPIRY_INTERVAL"`
+	// Limit on the size of keys and values in bytes, 0 means no limit
+	MaxMemory int64 `yaml:"MAX_MEMORY"`
+	// How long shutdown waits for in-flight requests before closing
+	// connections, and whether it takes a final snapshot
+	ShutdownTimeout  time.Duration `yaml:"SHUTDOWN_TIMEOUT"`
+	ShutdownSnapshot bool          `yaml:"SHUTDOWN_SNAPSHOT"`
+	// gRPC port
+	Port int `yaml:"PORT"`
+	// Ports of the other listeners, 0 disables them
+	RESPPort      int `yaml:"RESP_PORT"`
+	HTTPPort      int `yaml:"HTTP_PORT"`
+	MemcachedPort int `yaml:"MEMCACHED_PORT"`
+	MetricsPort   int `yaml:"METRICS_PORT"`
+
+	TLSCert     string `yaml:"TLS_CERT"`
+	TLSKey      string `yaml:"TLS_KEY"`
+	TLSClientCA string `yaml:"TLS_CLIENT_CA"`
+	ACLFile     string `yaml:"ACL_FILE"`
+
+	// Address of the primary, which makes this server a read-only replica
+	ReplicaOf    string `yaml:"REPLICA_OF"`
+	ReplicaToken string `yaml:"REPLICA_TOKEN"`
+	// CA bundle for verifying the primary, enables TLS to it
+	ReplicaTLSCA string `yaml:"REPLICA_TLS_CA"`
+	// Writes a replica can fall behind by before it has to sync again
+	ReplicationBacklog int `yaml:"REPLICATION_BACKLOG"`
+	// Time between Merkle tree comparisons of a replica with its primary,
+	// or a site with the others, 0 disables them
+	AntiEntropyInterval time.Duration `yaml:"ANTI_ENTROPY_INTERVAL"`
+
+	// ID of this node, which turns on cluster mode
+	RaftID string `yaml:"RAFT_ID"`
+	// Initial members as "id=host:port,...", including this node. Leave it
+	// empty on a node that joins an existing cluster.
+	RaftPeers string `yaml:"RAFT_PEERS"`
+	RaftDir   string `yaml:"RAFT_DIR"`
+	// Admin token for the other nodes, when they have ACLs
+	RaftToken string `yaml:"RAFT_TOKEN"`
+	// CA bundle for verifying the other nodes, enables TLS to them
+	RaftTLSCA             string        `yaml:"RAFT_TLS_CA"`
+	RaftElectionTimeout   time.Duration `yaml:"RAFT_ELECTION_TIMEOUT"`
+	RaftHeartbeatInterval time.Duration `yaml:"RAFT_HEARTBEAT_INTERVAL"`
+	// Applied entries between snapshots of the raft log
+	RaftSnapshotThreshold int `yaml:"RAFT_SNAPSHOT_THRESHOLD"`
+
+	// ID of this node, which turns on sharding
+	ShardID string `yaml:"SHARD_ID"`
+	// Every shard as "id=host:port,...", including this node. Leave it
+	// empty on a node that is added to an existing deployment.
+	ShardNodes string `yaml:"SHARD_NODES"`
+	// Points on the hash ring per node
+	ShardVirtualNodes int `yaml:"SHARD_VIRTUAL_NODES"`
+	// Where the topology is kept once nodes are added or tokens migrated
+	ShardTopologyFile string `yaml:"SHARD_TOPOLOGY_FILE"`
+	// Admin token for the other nodes, when they have ACLs
+	ShardToken string `yaml:"SHARD_TOKEN"`
+	// CA bundle for verifying the other nodes, enables TLS to them
+	ShardTLSCA string `yaml:"SHARD_TLS_CA"`
+
+	// ID of this site, which turns on multi-master replication
+	MultiMasterID string `yaml:"MULTI_MASTER_ID"`
+	// Every site as "id=host:port,...", including this one
+	MultiMasterPeers string `yaml:"MULTI_MASTER_PEERS"`
+	// Admin token for the other sites, when they have ACLs
+	MultiMasterToken string `yaml:"MULTI_MASTER_TOKEN"`
+	// CA bundle for verifying the other sites, enables TLS to them
+	MultiMasterTLSCA string `yaml:"MULTI_MASTER_TLS_CA"`
+	// How long deleted keys are remembered, a site cut off for longer may
+	// bring them back
+	TombstoneTTL time.Duration `yaml:"TOMBSTONE_TTL"`
+
+	// Directory for the change feed's segments, which turns it on
+	ChangeFeedDir string `yaml:"CHANGEFEED_DIR"`
+	// Limits on the change feed's history, 0 means no limit
+	ChangeFeedRetention time.Duration `yaml:"CHANGEFEED_RETENTION"`
+	ChangeFeedMaxBytes  int64         `yaml:"CHANGEFEED_MAX_BYTES"`
+
+	// Keys tracked for clients that cache them, 0 turns tracking off
+	TrackingMaxKeys int `yaml:"TRACKING_MAX_KEYS"`
+
+	LogLevel  string `yaml:"LOG_LEVEL"`
+	LogFormat string `yaml:"LOG_FORMAT"`
+
+	// The file the config was loaded from, empty if none was found
+	Path string `yaml:"-"`
+}
+
+func Default() Config {
+	return Config{
+		SnapshotDir:           "snapshots",
+		AOFDir:                "aof",
+		SnapshotInterval:      store.DefaultSnapshotInterval,
+		ExpiryInterval:        store.DefaultExpiryInterval,
+		ShutdownTimeout:       10 * time.Second,
+		ShutdownSnapshot:      true,
+		Port:                  50051,
+		MetricsPort:           2112,
+		ReplicationBacklog:    replication.DefaultBacklog,
+		AntiEntropyInterval:   replication.DefaultAntiEntropyInterval,
+		RaftDir:               "raft",
+		RaftElectionTimeout:   raft.DefaultElectionTimeout,
+		RaftHeartbeatInterval: raft.DefaultHeartbeatInterval,
+		RaftSnapshotThreshold: raft.DefaultSnapshotThreshold,
+		ShardVirtualNodes:     sharding.DefaultVirtualNodes,
+		ShardTopologyFile:     "topology.json",
+		TombstoneTTL:          store.DefaultTombstoneTTL,
+		ChangeFeedRetention:   changefeed.DefaultRetention,
+		ChangeFeedMaxBytes:    changefeed.DefaultMaxBytes,
+		TrackingMaxKeys:       tracking.DefaultMaxKeys,
+		LogLevel:              "info",
+		LogFormat:             "text",
+	}
+}
+
+// AOFPath is the path of the append-only file inside AOFDir.
+func (c *Config) AOFPath() string {
+	return filepath.Join(c.AOFDir, aofFilename)
+}
+
+// A setting that can come from the file, the environment or a flag.
+type field struct {
+	// YAML key, also the environment variable after the prefix
+	key   string
+	flag  string
+	usage string
+	// *int, *int64, *time.Duration, *bool or *string inside the Config
+	ptr any
+	// Whether a running server needs a restart to apply a change
+	restart bool
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{"DEFAULT_TTL", "default-ttl", "TTL in seconds for gRPC and HTTP writes that don't set one, 0 means no expiry", &c.DefaultTTL, false},
+		{"SNAPSHOT_DIR", "snapshot-dir", "directory for snapshots", &c.SnapshotDir, true},
+		{"AOF_DIR", "aof-dir", "directory for the append-only file", &c.AOFDir, true},
+		{"SNAPSHOT_INTERVAL", "snapshot-interval", "time between snapshots, 0 disables them", &c.SnapshotInterval, false},
+		{"EXPIRY_INTERVAL", "expiry-interval", "time between removals of expired keys", &c.ExpiryInterval, false},
+		{"MAX_MEMORY", "max-memory", "limit on the size of keys and values in bytes, 0 means no limit", &c.MaxMemory, false},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time to wait for in-flight requests on shutdown", &c.ShutdownTimeout, false},
+		{"SHUTDOWN_SNAPSHOT", "shutdown-snapshot", "take a snapshot on shutdown", &c.ShutdownSnapshot, false},
+		{"PORT", "port", "port for the gRPC server", &c.Port, true},
+		{"RESP_PORT", "resp-port", "port for the Redis protocol (RESP) listener, e.g. 6379, off when 0", &c.RESPPort, true},
+		{"HTTP_PORT", "http-port", "port for the HTTP/JSON gateway, e.g. 8080, off when 0", &c.HTTPPort, true},
+		{"MEMCACHED_PORT", "memcached-port", "port for the memcached text protocol listener, e.g. 11211, off when 0", &c.MemcachedPort, true},
+		{"METRICS_PORT", "metrics-port", "port for the Prometheus /metrics endpoint, 0 disables it", &c.MetricsPort, true},
+		{"TLS_CERT", "tls-cert", "TLS certificate file for the gRPC server", &c.TLSCert, false},
+		{"TLS_KEY", "tls-key", "TLS private key file for the gRPC server", &c.TLSKey, false},
+		{"TLS_CLIENT_CA", "tls-client-ca", "CA bundle for verifying client certificates, enables mutual TLS", &c.TLSClientCA, false},
+		{"ACL_FILE", "acl-file", "YAML file with users, tokens and per-prefix permissions, enables authentication on the gRPC, RESP and HTTP APIs", &c.ACLFile, false},
+		{"REPLICA_OF", "replica-of", "host:port of a primary's gRPC server, makes this server a read-only replica of it", &c.ReplicaOf, true},
+		{"REPLICA_TOKEN", "replica-token", "admin token for the primary, when it has ACLs", &c.ReplicaToken, true},
+		{"REPLICA_TLS_CA", "replica-tls-ca", "CA bundle for verifying the primary, enables TLS to it", &c.ReplicaTLSCA, true},
+		{"REPLICATION_BACKLOG", "replication-backlog", "writes a replica can fall behind by before it has to sync again", &c.ReplicationBacklog, true},
+		{"ANTI_ENTROPY_INTERVAL", "anti-entropy-interval", "time between anti-entropy repairs of a replica or multi-master site, 0 disables them", &c.AntiEntropyInterval, true},
+		{"RAFT_ID", "raft-id", "ID of this node in a Raft cluster, enables cluster mode", &c.RaftID, true},
+		{"RAFT_PEERS", "raft-peers", "initial cluster members as id=host:port,... including this node, empty to join an existing cluster", &c.RaftPeers, true},
+		{"RAFT_DIR", "raft-dir", "directory for the Raft log and snapshots", &c.RaftDir, true},
+		{"RAFT_TOKEN", "raft-token", "admin token for the other nodes, when they have ACLs", &c.RaftToken, true},
+		{"RAFT_TLS_CA", "raft-tls-ca", "CA bundle for verifying the other nodes, enables TLS to them", &c.RaftTLSCA, true},
+		{"RAFT_ELECTION_TIMEOUT", "raft-election-timeout", "time without a leader before a node starts an election", &c.RaftElectionTimeout, true},
+		{"RAFT_HEARTBEAT_INTERVAL", "raft-heartbeat-interval", "time between heartbeats from the leader", &c.RaftHeartbeatInterval, true},
+		{"RAFT_SNAPSHOT_THRESHOLD", "raft-snapshot-threshold", "applied entries between snapshots of the Raft log", &c.RaftSnapshotThreshold, true},
+		{"SHARD_ID", "shard-id", "ID of this node among the shards, enables sharding", &c.ShardID, true},
+		{"SHARD_NODES", "shard-nodes", "every shard as id=host:port,... including this node, empty to be added to an existing deployment", &c.ShardNodes, true},
+		{"SHARD_VIRTUAL_NODES", "shard-virtual-nodes", "points on the hash ring per shard, the same on every node", &c.ShardVirtualNodes, true},
+		{"SHARD_TOPOLOGY_FILE", "shard-topology-file", "file the topology is saved to after nodes are added or tokens migrated", &c.ShardTopologyFile, true},
+		{"SHARD_TOKEN", "shard-token", "admin token for the other shards, when they have ACLs", &c.ShardToken, true},
+		{"SHARD_TLS_CA", "shard-tls-ca", "CA bundle for verifying the other shards, enables TLS to them", &c.ShardTLSCA, true},
+		{"MULTI_MASTER_ID", "multi-master-id", "ID of this site, enables multi-master replication", &c.MultiMasterID, true},
+		{"MULTI_MASTER_PEERS", "multi-master-peers", "every site as id=host:port,... including this one", &c.MultiMasterPeers, true},
+		{"MULTI_MASTER_TOKEN", "multi-master-token", "admin token for the other sites, when they have ACLs", &c.MultiMasterToken, true},
+		{"MULTI_MASTER_TLS_CA", "multi-master-tls-ca", "CA bundle for verifying the other sites, enables TLS to them", &c.MultiMasterTLSCA, true},
+		{"TOMBSTONE_TTL", "tombstone-ttl", "how long deleted keys are remembered in multi-master mode", &c.TombstoneTTL, false},
+		{"CHANGEFEED_DIR", "changefeed-dir", "directory for the change feed's history, enables the change feed", &c.ChangeFeedDir, true},
+		{"CHANGEFEED_RETENTION", "changefeed-retention", "how long the change feed keeps changes, 0 means no limit", &c.ChangeFeedRetention, true},
+		{"CHANGEFEED_MAX_BYTES", "changefeed-max-bytes", "limit on the size of the change feed's history in bytes, 0 means no limit", &c.ChangeFeedMaxBytes, true},
+		{"TRACKING_MAX_KEYS", "tracking-max-keys", "keys tracked for clients that cache them, 0 disables client-side caching", &c.TrackingMaxKeys, true},
+		{"LOG_LEVEL", "log-level", "minimum log level: debug, info, warn or error", &c.LogLevel, false},
+		{"LOG_FORMAT", "log-format", "log output format: text or json", &c.LogFormat, true},
+	}
+}
+
+func setField(f field, value string) error {
+	switch ptr := f.ptr.(type) {
+	case *string:
+		*ptr = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.key, value)
+		}
+		*ptr = n
+	case *int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.key, value)
+		}
+		*ptr = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration", f.key, value)
+		}
+		*ptr = d
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", f.key, value)
+		}
+		*ptr = b
+	}
+	return nil
+}
+
+func (f field) value() any {
+	switch ptr := f.ptr.(type) {
+	case *string:
+		return *ptr
+	case *int:
+		return *ptr
+	case *int64:
+		return *ptr
+	case *time.Duration:
+		return *ptr
+	case *bool:
+		return *ptr
+	}
+	return nil
+}
+
+// Records the raw value of a flag, so flags can be applied after the file
+// and the environment even though they are parsed first.
+type flagValue struct {
+	field field
+	set   map[string]string
+}
+
+func (v flagValue) String() string {
+	return ""
+}
+
+// Lets boolean flags be given without a value, like -shutdown-snapshot.
+func (v flagValue) IsBoolFlag() bool {
+	_, ok := v.field.ptr.(*bool)
+	return ok
+}
+
+func (v flagValue) Set(value string) error {
+	// Check numbers now so flag reports errors against the right flag
+	switch v.field.ptr.(type) {
+	case *int, *int64:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return errors.New("not a number")
+		}
+	case *time.Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return errors.New("not a duration")
+		}
+	case *bool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("not a boolean")
+		}
+	}
+	v.set[v.field.key] = value
+	return nil
+}
+
+// Load parses args (without the program name) and builds the configuration.
+// The file is taken from -config, then KVSTORE_CONFIG, then DefaultPath; a
+// missing DefaultPath is not an error. lookupEnv is usually os.LookupEnv.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configPath := fs.String("config", "", fmt.Sprintf("YAML config file (env %sCONFIG, default %s)", EnvPrefix, DefaultPath))
+	flagValues := make(map[string]string)
+	for _, f := range cfg.fields() {
+		fs.Var(flagValue{field: f, set: flagValues}, f.flag, fmt.Sprintf("%s (env %s%s)", f.usage, EnvPrefix, f.key))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	path, required := *configPath, true
+	if path == "" {
+		path, required = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path == "" {
+		path, required = DefaultPath, false
+	}
+	if err := cfg.loadFile(path, required); err != nil {
+		return nil, err
+	}
+
+	for _, f := range cfg.fields() {
+		if value, ok := lookupEnv(EnvPrefix + f.key); ok {
+			if err := setField(f, value); err != nil {
+				return nil, fmt.Errorf("%s%s: %w", EnvPrefix, f.key, err)
+			}
+		}
+	}
+	for _, f := range cfg.fields() {
+		if value, ok := flagValues[f.key]; ok {
+			setField(f, value)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil
+		}
+		return err
+	}
+
+	// Unknown keys are most likely typos, so they are rejected
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.Path = path
+	return nil
+}
+
+// Validate checks that the values make sense together.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DefaultTTL < 0 {
+		errs = append(errs, errors.New("DEFAULT_TTL cannot be negative"))
+	}
+	if c.SnapshotDir == "" {
+		errs = append(errs, errors.New("SNAPSHOT_DIR cannot be empty"))
+	}
+	if c.AOFDir == "" {
+		errs = append(errs, errors.New("AOF_DIR cannot be empty"))
+	}
+	if c.SnapshotInterval < 0 {
+		errs = append(errs, errors.New("SNAPSHOT_INTERVAL cannot be negative"))
+	}
+	if c.ExpiryInterval <= 0 {
+		errs = append(errs, errors.New("EXPIRY_INTERVAL must be positive"))
+	}
+	if c.MaxMemory < 0 {
+		errs = append(errs, errors.New("MAX_MEMORY cannot be negative"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	used := map[int]string{c.Port: "PORT"}
+	for _, p := range []struct {
+		key  string
+		port int
+	}{
+		{"RESP_PORT", c.RESPPort},
+		{"HTTP_PORT", c.HTTPPort},
+		{"MEMCACHED_PORT", c.MemcachedPort},
+		{"METRICS_PORT", c.MetricsPort},
+	} {
+		if p.port == 0 {
+			continue
+		}
+		if p.port < 0 || p.port > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be between 0 and 65535, got %d", p.key, p.port))
+			continue
+		}
+		if other, ok := used[p.port]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s both use port %d", other, p.key, p.port))
+		}
+		used[p.port] = p.key
+	}
+
+	// Unlike RESP and HTTP, the memcached text protocol has no way to send
+	// a token
+	if c.ACLFile != "" && c.MemcachedPort != 0 {
+		errs = append(errs, errors.New("MEMCACHED_PORT must be 0 when ACL_FILE is set, the memcached protocol has no authentication"))
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("TLS_CERT and TLS_KEY must be set together"))
+	}
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		errs = append(errs, errors.New("TLS_CLIENT_CA needs TLS_CERT and TLS_KEY"))
+	}
+
+	if c.ReplicationBacklog <= 0 {
+		errs = append(errs, errors.New("REPLICATION_BACKLOG must be positive"))
+	}
+	if c.AntiEntropyInterval < 0 {
+		errs = append(errs, errors.New("ANTI_ENTROPY_INTERVAL cannot be negative"))
+	}
+	if c.ReplicaTLSCA != "" && c.ReplicaOf == "" {
+		errs = append(errs, errors.New("REPLICA_TLS_CA needs REPLICA_OF"))
+	}
+
+	if c.RaftID != "" {
+		if c.ReplicaOf != "" {
+			errs = append(errs, errors.New("RAFT_ID and REPLICA_OF are mutually exclusive"))
+		}
+		// Eviction picks keys at random, which nodes would do differently
+		if c.MaxMemory != 0 {
+			errs = append(errs, errors.New("MAX_MEMORY must be 0 in cluster mode"))
+		}
+		if c.RaftDir == "" {
+			errs = append(errs, errors.New("RAFT_DIR cannot be empty"))
+		}
+		if c.RaftElectionTimeout <= 0 || c.RaftHeartbeatInterval <= 0 {
+			errs = append(errs, errors.New("RAFT_ELECTION_TIMEOUT and RAFT_HEARTBEAT_INTERVAL must be positive"))
+		} else if c.RaftHeartbeatInterval >= c.RaftElectionTimeout {
+			errs = append(errs, errors.New("RAFT_HEARTBEAT_INTERVAL must be shorter than RAFT_ELECTION_TIMEOUT"))
+		}
+		if c.RaftSnapshotThreshold <= 0 {
+			errs = append(errs, errors.New("RAFT_SNAPSHOT_THRESHOLD must be positive"))
+		}
+		if _, err := c.RaftMembers(); err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.RaftPeers != "" {
+		errs = append(errs, errors.New("RAFT_PEERS needs RAFT_ID"))
+	}
+
+	if c.ShardID != "" {
+		if c.RaftID != "" || c.ReplicaOf != "" {
+			errs = append(errs, errors.New("SHARD_ID can't be combined with RAFT_ID or REPLICA_OF"))
+		}
+		if c.ShardVirtualNodes <= 0 {
+			errs = append(errs, errors.New("SHARD_VIRTUAL_NODES must be positive"))
+		} else if _, err := c.ShardRing(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.ShardTopologyFile == "" {
+			errs = append(errs, errors.New("SHARD_TOPOLOGY_FILE cannot be empty"))
+		}
+	} else if c.ShardNodes != "" {
+		errs = append(errs, errors.New("SHARD_NODES needs SHARD_ID"))
+	}
+
+	if c.TombstoneTTL <= 0 {
+		errs = append(errs, errors.New("TOMBSTONE_TTL must be positive"))
+	}
+	if c.MultiMasterID != "" {
+		if c.ReplicaOf != "" || c.RaftID != "" || c.ShardID != "" {
+			errs = append(errs, errors.New("MULTI_MASTER_ID can't be combined with REPLICA_OF, RAFT_ID or SHARD_ID"))
+		}
+		// Sites would evict different keys
+		if c.MaxMemory != 0 {
+			errs = append(errs, errors.New("MAX_MEMORY must be 0 in multi-master mode"))
+		}
+		if _, err := c.MultiMasterSites(); err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.MultiMasterPeers != "" {
+		errs = append(errs, errors.New("MULTI_MASTER_PEERS needs MULTI_MASTER_ID"))
+	}
+
+	if c.ChangeFeedRetention < 0 {
+		errs = append(errs, errors.New("CHANGEFEED_RETENTION cannot be negative"))
+	}
+	if c.ChangeFeedMaxBytes < 0 {
+		errs = append(errs, errors.New("CHANGEFEED_MAX_BYTES cannot be negative"))
+	}
+	if c.TrackingMaxKeys < 0 {
+		errs = append(errs, errors.New("TRACKING_MAX_KEYS cannot be negative"))
+	}
+
+	if _, err := logging.New(io.Discard, c.LogLevel, c.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// RaftMembers parses RAFT_PEERS, which must include RAFT_ID unless it is
+// empty.
+func (c *Config) RaftMembers() ([]raft.Member, error) {
+	if c.RaftPeers == "" {
+		return nil, nil
+	}
+	peers, err := parseNodeList("RAFT_PEERS", c.RaftPeers, "RAFT_ID", c.RaftID)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]raft.Member, len(peers))
+	for i, p := range peers {
+		members[i] = raft.Member{ID: p.id, Addr: p.addr}
+	}
+	return members, nil
+}
+
+// ShardRing builds the hash ring from SHARD_NODES, which must include
+// SHARD_ID unless it is empty. An empty list gives a nil ring.
+func (c *Config) ShardRing() (*sharding.Ring, error) {
+	if c.ShardNodes == "" {
+		return nil, nil
+	}
+	list, err := parseNodeList("SHARD_NODES", c.ShardNodes, "SHARD_ID", c.ShardID)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]sharding.Node, len(list))
+	for i, n := range list {
+		nodes[i] = sharding.Node{ID: n.id, Addr: n.addr}
+	}
+	return sharding.NewRing(nodes, c.ShardVirtualNodes)
+}
+
+// Site is another site of a multi-master deployment.
+type Site struct {
+	ID   string
+	Addr string
+}
+
+// MultiMasterSites parses MULTI_MASTER_PEERS, which must include
+// MULTI_MASTER_ID unless it is empty, and returns the other sites.
+func (c *Config) MultiMasterSites() ([]Site, error) {
+	if c.MultiMasterPeers == "" {
+		return nil, nil
+	}
+	list, err := parseNodeList("MULTI_MASTER_PEERS", c.MultiMasterPeers, "MULTI_MASTER_ID", c.MultiMasterID)
+	if err != nil {
+		return nil, err
+	}
+	var sites []Site
+	for _, n := range list {
+		if n.id != c.MultiMasterID {
+			sites = append(sites, Site{ID: n.id, Addr: n.addr})
+		}
+	}
+	return sites, nil
+}
+
+type nodeAddr struct {
+	id, addr string
+}
+
+// Parses "id=host:port,..." lists, which must include the ID in selfKey.
+func parseNodeList(key, value, selfKey, self string) ([]nodeAddr, error) {
+	var nodes []nodeAddr
+	found := false
+	for _, entry := range strings.Split(value, ",") {
+		id, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("%s: %q is not id=host:port", key, entry)
+		}
+		if slices.ContainsFunc(nodes, func(n nodeAddr) bool { return n.id == id }) {
+			return nil, fmt.Errorf("%s: duplicate id %q", key, id)
+		}
+		nodes = append(nodes, nodeAddr{id: id, addr: addr})
+		found = found || id == self
+	}
+	if !found {
+		return nil, fmt.Errorf("%s must include %s %q", key, selfKey, self)
+	}
+	return nodes, nil
+}
+
+// Diff returns the keys whose values differ between old and next, split
+// into those a running server can apply and those that need a restart.
+// Turning TLS or ACLs on or off always needs a restart.
+func Diff(old, next *Config) (live, restart []string) {
+	oldFields, nextFields := old.fields(), next.fields()
+	for i, f := range oldFields {
+		if f.value() == nextFields[i].value() {
+			continue
+		}
+		if f.restart || old.toggles(next, f.key) {
+			restart = append(restart, f.key)
+		} else {
+			live = append(live, f.key)
+		}
+	}
+	return live, restart
+}
+
+// Whether changing key from c to next switches a feature on or off.
+func (c *Config) toggles(next *Config, key string) bool {
+	switch key {
+	case "TLS_CERT", "TLS_KEY", "TLS_CLIENT_CA":
+		return (c.TLSCert == "") != (next.TLSCert == "")
+	case "ACL_FILE":
+		return (c.ACLFile == "") != (next.ACLFile == "")
+	}
+	return false
+}
+
+// Update copies the values of the given keys from other.
+func (c *Config) Update(other *Config, keys []string) {
+	otherFields := other.fields()
+	for i, f := range c.fields() {
+		if !slices.Contains(keys, f.key) {
+			continue
+		}
+		switch ptr := f.ptr.(type) {
+		case *string:
+			*ptr = *otherFields[i].ptr.(*string)
+		case *int:
+			*ptr = *otherFields[i].ptr.(*int)
+		case *int64:
+			*ptr = *otherFields[i].ptr.(*int64)
+		case *time.Duration:
+			*ptr = *otherFields[i].ptr.(*time.Duration)
+		case *bool:
+			*ptr = *otherFields[i].ptr.(*bool)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package hlc implements hybrid logical clocks. A timestamp follows the
+// wall clock, but never goes backwards and always moves past the
+// timestamps a node has seen from others, so a write that causally follows
+// another gets a higher timestamp even when the clocks of the two nodes
+// disagree.
+package hlc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Timestamp packs the wall time in milliseconds into the upper 48 bits and
+// a logical counter into the lower 16, so timestamps compare as integers.
+// The counter overflowing into the wall time keeps them ordered.
+type Timestamp uint64
+
+const logicalBits = 16
+
+func FromTime(t time.Time) Timestamp {
+	return Timestamp(uint64(t.UnixMilli()) << logicalBits)
+}
+
+// Time returns the wall time part of the timestamp.
+func (t Timestamp) Time() time.Time {
+	return time.UnixMilli(int64(t >> logicalBits))
+}
+
+func (t Timestamp) Logical() uint16 {
+	return uint16(t)
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%s+%d", t.Time().UTC().Format(time.RFC3339Nano), t.Logical())
+}
+
+type Clock struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	last Timestamp
+}
+
+// NewClock returns a clock that follows now, time.Now when nil.
+func NewClock(now func() time.Time) *Clock {
+	if now == nil {
+		now = time.Now
+	}
+	return &Clock{now: now}
+}
+
+// Now returns a timestamp above every one the clock returned or saw.
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = max(FromTime(c.now()), c.last+1)
+	return c.last
+}
+
+// Update moves the clock past a timestamp from another node.
+func (c *Clock) Update(remote Timestamp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = max(c.last, remote)
+}
+
+// Last returns the newest timestamp the clock returned or saw.
+func (c *Clock) Last() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
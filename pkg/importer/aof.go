@@ -0,0 +1,302 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/resp"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+var errSyntax = errors.New("syntax error")
+
+// ImportRedisAOF replays a Redis AOF (a log of RESP commands) into the store.
+// Files that start with an RDB preamble, like the base file of a Redis 7
+// multi-part AOF, are handled too. Relative expiries (EX, EXPIRE...) are taken
+// relative to the time of the import; Redis 7 logs them as absolute times.
+func ImportRedisAOF(r io.Reader, st *store.Store, opts RedisOptions) (*RedisImportStats, error) {
+	ri := newRedisImport(st, opts)
+	br := bufio.NewReader(r)
+
+	if prefix, err := br.Peek(5); err == nil && string(prefix) == "REDIS" {
+		if err := ri.readRDB(br); err != nil {
+			return ri.stats, fmt.Errorf("reading RDB preamble: %w", err)
+		}
+	}
+
+	reader := resp.NewReader(br)
+	for n := 1; ; n++ {
+		args, err := reader.ReadCommand()
+		if err == io.EOF {
+			return ri.stats, nil
+		}
+		if err != nil {
+			return ri.stats, fmt.Errorf("command %d: %w", n, err)
+		}
+		if err := ri.apply(args); err != nil {
+			return ri.stats, fmt.Errorf("command %d (%s): %w", n, args[0], err)
+		}
+	}
+}
+
+func (ri *redisImport) apply(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	switch name {
+	case "SELECT":
+		if len(args) != 1 {
+			return errSyntax
+		}
+		db, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		ri.db = db
+		return nil
+	case "MULTI", "EXEC":
+		return nil
+	case "FLUSHALL":
+		ri.flush(true)
+		return nil
+	}
+
+	if !ri.selected() {
+		return nil
+	}
+
+	switch name {
+	case "SET":
+		return ri.applySet(args)
+	case "SETNX":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		if _, _, exists := ri.get(args[0]); !exists {
+			ri.set(args[0], args[1], time.Time{})
+		}
+	case "SETEX", "PSETEX":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		unit := time.Second
+		if name == "PSETEX" {
+			unit = time.Millisecond
+		}
+		expiresAt, err := ri.expiryFrom(args[1], unit, false)
+		if err != nil {
+			return err
+		}
+		ri.set(args[0], args[2], expiresAt)
+	case "GETSET":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		ri.set(args[0], args[1], time.Time{})
+	case "MSET", "MSETNX":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return errSyntax
+		}
+		if name == "MSETNX" {
+			for i := 0; i < len(args); i += 2 {
+				if _, _, exists := ri.get(args[i]); exists {
+					return nil
+				}
+			}
+		}
+		for i := 0; i < len(args); i += 2 {
+			ri.set(args[i], args[i+1], time.Time{})
+		}
+	case "DEL", "UNLINK", "GETDEL":
+		for _, key := range args {
+			ri.delete(key)
+		}
+	case "FLUSHDB":
+		ri.flush(false)
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		return ri.applyExpire(name, args)
+	case "PERSIST":
+		if len(args) != 1 {
+			return errSyntax
+		}
+		if value, _, exists := ri.get(args[0]); exists {
+			ri.set(args[0], value, time.Time{})
+		}
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		return ri.applyIncr(name, args)
+	case "APPEND":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		value, expiresAt, _ := ri.get(args[0])
+		ri.set(args[0], value+args[1], expiresAt)
+	case "RENAME", "RENAMENX":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		value, expiresAt, exists := ri.get(args[0])
+		if !exists {
+			return nil
+		}
+		if name == "RENAMENX" {
+			if _, _, taken := ri.get(args[1]); taken {
+				return nil
+			}
+		}
+		ri.delete(args[0])
+		ri.set(args[1], value, expiresAt)
+	default:
+		ri.skip(name)
+	}
+	return nil
+}
+
+func (ri *redisImport) applySet(args []string) error {
+	if len(args) < 2 {
+		return errSyntax
+	}
+	key, value := args[0], args[1]
+
+	var expiresAt time.Time
+	var nx, xx, keepTTL bool
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "GET":
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			i++
+			var err error
+			switch option {
+			case "EX":
+				expiresAt, err = ri.expiryFrom(args[i], time.Second, false)
+			case "PX":
+				expiresAt, err = ri.expiryFrom(args[i], time.Millisecond, false)
+			case "EXAT":
+				expiresAt, err = ri.expiryFrom(args[i], time.Second, true)
+			case "PXAT":
+				expiresAt, err = ri.expiryFrom(args[i], time.Millisecond, true)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	_, currentExpiry, exists := ri.get(key)
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	if keepTTL && exists {
+		expiresAt = currentExpiry
+	}
+	ri.set(key, value, expiresAt)
+	return nil
+}
+
+func (ri *redisImport) applyExpire(name string, args []string) error {
+	if len(args) < 2 {
+		return errSyntax
+	}
+	unit := time.Second
+	if strings.HasPrefix(name, "P") {
+		unit = time.Millisecond
+	}
+	expiresAt, err := ri.expiryFrom(args[1], unit, strings.HasSuffix(name, "AT"))
+	if err != nil {
+		return err
+	}
+
+	value, currentExpiry, exists := ri.get(args[0])
+	if !exists {
+		return nil
+	}
+
+	// NX/XX/GT/LT conditions, a missing TTL counts as infinite for GT/LT
+	for _, option := range args[2:] {
+		var ok bool
+		switch strings.ToUpper(option) {
+		case "NX":
+			ok = currentExpiry.IsZero()
+		case "XX":
+			ok = !currentExpiry.IsZero()
+		case "GT":
+			ok = !currentExpiry.IsZero() && expiresAt.After(currentExpiry)
+		case "LT":
+			ok = currentExpiry.IsZero() || expiresAt.Before(currentExpiry)
+		default:
+			return errSyntax
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	ri.set(args[0], value, expiresAt)
+	return nil
+}
+
+func (ri *redisImport) applyIncr(name string, args []string) error {
+	delta := int64(1)
+	switch name {
+	case "INCR", "DECR":
+		if len(args) != 1 {
+			return errSyntax
+		}
+	default:
+		if len(args) != 2 {
+			return errSyntax
+		}
+		var err error
+		if delta, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return err
+		}
+	}
+	if strings.HasPrefix(name, "DECR") {
+		delta = -delta
+	}
+
+	value, expiresAt, exists := ri.get(args[0])
+	current := int64(0)
+	if exists {
+		var err error
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("value of %q is not an integer", args[0])
+		}
+	}
+	ri.set(args[0], strconv.FormatInt(current+delta, 10), expiresAt)
+	return nil
+}
+
+// Turns a relative or absolute (unix) time argument into an expiry time.
+func (ri *redisImport) expiryFrom(arg string, unit time.Duration, absolute bool) (time.Time, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expire time %q", arg)
+	}
+	if absolute {
+		if unit == time.Second {
+			return time.Unix(n, 0), nil
+		}
+		return time.UnixMilli(n), nil
+	}
+	return ri.opts.Now().Add(time.Duration(n) * unit), nil
+}
@@ -0,0 +1,640 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+// RDB opcodes and value types, see rdb.h in the Redis sources
+const (
+	rdbOpSlotInfo     = 0xF4
+	rdbOpFunction2    = 0xF5
+	rdbOpFunctionOld  = 0xF6
+	rdbOpModuleAux    = 0xF7
+	rdbOpIdle         = 0xF8
+	rdbOpFreq         = 0xF9
+	rdbOpAux          = 0xFA
+	rdbOpResizeDB     = 0xFB
+	rdbOpExpireTimeMS = 0xFC
+	rdbOpExpireTime   = 0xFD
+	rdbOpSelectDB     = 0xFE
+	rdbOpEOF          = 0xFF
+
+	rdbTypeString           = 0
+	rdbTypeList             = 1
+	rdbTypeSet              = 2
+	rdbTypeZSet             = 3
+	rdbTypeHash             = 4
+	rdbTypeZSet2            = 5
+	rdbTypeModule           = 6
+	rdbTypeModule2          = 7
+	rdbTypeHashZipmap       = 9
+	rdbTypeListZiplist      = 10
+	rdbTypeSetIntset        = 11
+	rdbTypeZSetZiplist      = 12
+	rdbTypeHashZiplist      = 13
+	rdbTypeListQuicklist    = 14
+	rdbTypeStreamListpacks  = 15
+	rdbTypeHashListpack     = 16
+	rdbTypeZSetListpack     = 17
+	rdbTypeListQuicklist2   = 18
+	rdbTypeStreamListpacks2 = 19
+	rdbTypeSetListpack      = 20
+	rdbTypeStreamListpacks3 = 21
+	rdbTypeHashMetadata     = 24
+	rdbTypeHashListpackEx   = 25
+
+	rdbModuleOpEOF    = 0
+	rdbModuleOpSInt   = 1
+	rdbModuleOpUInt   = 2
+	rdbModuleOpFloat  = 3
+	rdbModuleOpDouble = 4
+	rdbModuleOpString = 5
+)
+
+var rdbTypeNames = map[byte]string{
+	rdbTypeList:             "list",
+	rdbTypeSet:              "set",
+	rdbTypeZSet:             "zset",
+	rdbTypeHash:             "hash",
+	rdbTypeZSet2:            "zset",
+	rdbTypeModule2:          "module",
+	rdbTypeHashZipmap:       "hash",
+	rdbTypeListZiplist:      "list",
+	rdbTypeSetIntset:        "set",
+	rdbTypeZSetZiplist:      "zset",
+	rdbTypeHashZiplist:      "hash",
+	rdbTypeListQuicklist:    "list",
+	rdbTypeStreamListpacks:  "stream",
+	rdbTypeHashListpack:     "hash",
+	rdbTypeZSetListpack:     "zset",
+	rdbTypeListQuicklist2:   "list",
+	rdbTypeStreamListpacks2: "stream",
+	rdbTypeSetListpack:      "set",
+	rdbTypeStreamListpacks3: "stream",
+	rdbTypeHashMetadata:     "hash",
+	rdbTypeHashListpackEx:   "hash",
+}
+
+var ErrNotRDB = errors.New("not a Redis RDB file")
+
+// Redis refuses strings longer than 512 MB (proto-max-bulk-len), so a longer
+// length means the file is corrupt
+const maxRDBLength = 512 << 20
+
+// Strings up to this length are allocated up front. Longer ones grow as they
+// are read, so a corrupt length fails at the end of the file without a huge
+// allocation first.
+const rdbPreallocLimit = 1 << 20
+
+// ImportRedisRDB loads the string keys of a Redis RDB snapshot into the store,
+// keeping their expiry. Keys of other types are parsed and counted in Skipped.
+func ImportRedisRDB(r io.Reader, st *store.Store, opts RedisOptions) (*RedisImportStats, error) {
+	ri := newRedisImport(st, opts)
+	if err := ri.readRDB(bufio.NewReader(r)); err != nil {
+		return ri.stats, err
+	}
+	return ri.stats, nil
+}
+
+type rdbReader struct {
+	r       *bufio.Reader
+	version int
+}
+
+func (ri *redisImport) readRDB(r *bufio.Reader) error {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("reading RDB header: %w", err)
+	}
+	if string(header[:5]) != "REDIS" {
+		return ErrNotRDB
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return ErrNotRDB
+	}
+	rdb := &rdbReader{r: r, version: version}
+
+	var expiresAt time.Time
+	for {
+		opcode, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("reading RDB: %w", err)
+		}
+
+		switch opcode {
+		case rdbOpEOF:
+			// Versions 5 and up end with a CRC64 checksum
+			if version >= 5 {
+				if _, err := rdb.readRaw(8); err != nil {
+					return fmt.Errorf("reading RDB checksum: %w", err)
+				}
+			}
+			return nil
+		case rdbOpSelectDB:
+			db, err := rdb.readLength()
+			if err != nil {
+				return err
+			}
+			ri.db = int(db)
+			continue
+		case rdbOpResizeDB:
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpAux:
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpSlotInfo:
+			for range 3 {
+				if _, err := rdb.readLength(); err != nil {
+					return err
+				}
+			}
+			continue
+		case rdbOpFunction2:
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpFunctionOld:
+			return errors.New("RDB contains pre-release function data, which isn't supported")
+		case rdbOpModuleAux:
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			if err := rdb.skipModuleValue(); err != nil {
+				return err
+			}
+			continue
+		case rdbOpExpireTime:
+			data, err := rdb.readRaw(4)
+			if err != nil {
+				return err
+			}
+			expiresAt = time.Unix(int64(binary.LittleEndian.Uint32(data)), 0)
+			continue
+		case rdbOpExpireTimeMS:
+			data, err := rdb.readRaw(8)
+			if err != nil {
+				return err
+			}
+			expiresAt = time.UnixMilli(int64(binary.LittleEndian.Uint64(data)))
+			continue
+		case rdbOpFreq:
+			if _, err := rdb.readRaw(1); err != nil {
+				return err
+			}
+			continue
+		case rdbOpIdle:
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Anything else is the type of a key-value pair
+		key, err := rdb.readString()
+		if err != nil {
+			return err
+		}
+		if opcode == rdbTypeString {
+			value, err := rdb.readString()
+			if err != nil {
+				return err
+			}
+			if ri.selected() {
+				ri.set(key, value, expiresAt)
+			}
+		} else {
+			if err := rdb.skipValue(opcode); err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+			if ri.selected() {
+				ri.skip(rdbTypeNames[opcode])
+			}
+		}
+		expiresAt = time.Time{}
+	}
+}
+
+func (rdb *rdbReader) readRaw(n uint64) ([]byte, error) {
+	if n > maxRDBLength {
+		return nil, fmt.Errorf("length %d is too long, the file may be corrupt", n)
+	}
+	if n <= rdbPreallocLimit {
+		data := make([]byte, n)
+		if _, err := io.ReadFull(rdb.r, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(rdb.r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// Reads a length-encoded integer. When encoded is true the value is the
+// special string encoding stored in the low bits instead of a length.
+func (rdb *rdbReader) readLengthOrEncoding() (length uint64, encoded bool, err error) {
+	first, err := rdb.r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch first >> 6 {
+	case 0:
+		return uint64(first & 0x3F), false, nil
+	case 1:
+		next, err := rdb.r.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3F)<<8 | uint64(next), false, nil
+	case 2:
+		switch first {
+		case 0x80:
+			data, err := rdb.readRaw(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(data)), false, nil
+		case 0x81:
+			data, err := rdb.readRaw(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(data), false, nil
+		}
+		return 0, false, fmt.Errorf("unknown length encoding 0x%02x", first)
+	default:
+		return uint64(first & 0x3F), true, nil
+	}
+}
+
+func (rdb *rdbReader) readLength() (uint64, error) {
+	length, encoded, err := rdb.readLengthOrEncoding()
+	if err != nil {
+		return 0, err
+	}
+	if encoded {
+		return 0, errors.New("expected a length, found an encoded string")
+	}
+	return length, nil
+}
+
+func (rdb *rdbReader) readString() (string, error) {
+	length, encoded, err := rdb.readLengthOrEncoding()
+	if err != nil {
+		return "", err
+	}
+
+	if !encoded {
+		data, err := rdb.readRaw(length)
+		return string(data), err
+	}
+
+	switch length {
+	case 0:
+		data, err := rdb.readRaw(1)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int8(data[0]))), nil
+	case 1:
+		data, err := rdb.readRaw(2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(data)))), nil
+	case 2:
+		data, err := rdb.readRaw(4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(data)))), nil
+	case 3:
+		compressedLen, err := rdb.readLength()
+		if err != nil {
+			return "", err
+		}
+		uncompressedLen, err := rdb.readLength()
+		if err != nil {
+			return "", err
+		}
+		if uncompressedLen > maxRDBLength {
+			return "", fmt.Errorf("length %d is too long, the file may be corrupt", uncompressedLen)
+		}
+		compressed, err := rdb.readRaw(compressedLen)
+		if err != nil {
+			return "", err
+		}
+		data, err := lzfDecompress(compressed, int(uncompressedLen))
+		return string(data), err
+	}
+	return "", fmt.Errorf("unknown string encoding %d", length)
+}
+
+// Reads past a value whose type we don't import.
+func (rdb *rdbReader) skipValue(valueType byte) error {
+	switch valueType {
+	case rdbTypeList, rdbTypeSet, rdbTypeListQuicklist:
+		return rdb.skipStrings(1)
+	case rdbTypeHash:
+		return rdb.skipStrings(2)
+	case rdbTypeZSet:
+		n, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+			// Old-style scores are a length byte followed by the text,
+			// with 253-255 standing for NaN and the infinities
+			size, err := rdb.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if size < 253 {
+				if _, err := rdb.readRaw(uint64(size)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case rdbTypeZSet2:
+		n, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+			if _, err := rdb.readRaw(8); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeSetIntset, rdbTypeZSetZiplist,
+		rdbTypeHashZiplist, rdbTypeHashListpack, rdbTypeZSetListpack, rdbTypeSetListpack:
+		_, err := rdb.readString()
+		return err
+	case rdbTypeListQuicklist2:
+		n, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			// Container type, then the node itself
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rdbTypeHashMetadata:
+		// Minimum expiry of the hash, then TTL, field and value for each entry
+		if _, err := rdb.readRaw(8); err != nil {
+			return err
+		}
+		n, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+			if err := rdb.skipStrings(2); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rdbTypeHashListpackEx:
+		if _, err := rdb.readRaw(8); err != nil {
+			return err
+		}
+		_, err := rdb.readString()
+		return err
+	case rdbTypeModule2:
+		if _, err := rdb.readLength(); err != nil {
+			return err
+		}
+		return rdb.skipModuleValue()
+	case rdbTypeStreamListpacks, rdbTypeStreamListpacks2, rdbTypeStreamListpacks3:
+		return rdb.skipStream(valueType)
+	}
+	return fmt.Errorf("unsupported RDB value type %d", valueType)
+}
+
+// Skips n-tuples of strings, prefixed by the number of tuples.
+func (rdb *rdbReader) skipStrings(perEntry int) error {
+	n, err := rdb.readLength()
+	if err != nil {
+		return err
+	}
+	for range n * uint64(perEntry) {
+		if _, err := rdb.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rdb *rdbReader) skipLengths(n int) error {
+	for range n {
+		if _, err := rdb.readLength(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rdb *rdbReader) skipStream(valueType byte) error {
+	// Listpacks holding the entries, keyed by their master ID
+	if err := rdb.skipStrings(2); err != nil {
+		return err
+	}
+
+	// Length and last ID
+	if err := rdb.skipLengths(3); err != nil {
+		return err
+	}
+	if valueType >= rdbTypeStreamListpacks2 {
+		// First ID, max deleted ID and entries added
+		if err := rdb.skipLengths(5); err != nil {
+			return err
+		}
+	}
+
+	groups, err := rdb.readLength()
+	if err != nil {
+		return err
+	}
+	for range groups {
+		if _, err := rdb.readString(); err != nil {
+			return err
+		}
+		if err := rdb.skipLengths(2); err != nil {
+			return err
+		}
+		if valueType >= rdbTypeStreamListpacks2 {
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+		}
+
+		// Pending entries: raw 128-bit ID, delivery time and delivery count
+		pending, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		for range pending {
+			if _, err := rdb.readRaw(16 + 8); err != nil {
+				return err
+			}
+			if _, err := rdb.readLength(); err != nil {
+				return err
+			}
+		}
+
+		consumers, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		for range consumers {
+			if _, err := rdb.readString(); err != nil {
+				return err
+			}
+			// Seen time, plus active time from version 3
+			times := 8
+			if valueType >= rdbTypeStreamListpacks3 {
+				times = 16
+			}
+			if _, err := rdb.readRaw(uint64(times)); err != nil {
+				return err
+			}
+			owned, err := rdb.readLength()
+			if err != nil {
+				return err
+			}
+			for range owned {
+				if _, err := rdb.readRaw(16); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Module values are a sequence of typed fields terminated by an EOF opcode.
+func (rdb *rdbReader) skipModuleValue() error {
+	for {
+		opcode, err := rdb.readLength()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case rdbModuleOpEOF:
+			return nil
+		case rdbModuleOpSInt, rdbModuleOpUInt:
+			_, err = rdb.readLength()
+		case rdbModuleOpFloat:
+			_, err = rdb.readRaw(4)
+		case rdbModuleOpDouble:
+			_, err = rdb.readRaw(8)
+		case rdbModuleOpString:
+			_, err = rdb.readString()
+		default:
+			return fmt.Errorf("unknown module opcode %d", opcode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// The output grows as it is written rather than taking outLen on trust, and
+// may not get longer than outLen.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, min(outLen, rdbPreallocLimit))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// Literal run of ctrl+1 bytes
+		if ctrl < 32 {
+			end := i + ctrl + 1
+			if end > len(in) {
+				return nil, errors.New("lzf: literal run past end of input")
+			}
+			if len(out)+ctrl+1 > outLen {
+				return nil, fmt.Errorf("lzf: output longer than %d bytes", outLen)
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+
+		// Back reference
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errors.New("lzf: truncated back reference")
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("lzf: truncated back reference")
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("lzf: back reference before start of output")
+		}
+		if len(out)+length+2 > outLen {
+			return nil, fmt.Errorf("lzf: output longer than %d bytes", outLen)
+		}
+		// Copy byte by byte, the source and destination may overlap
+		for j := range length + 2 {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if len(out) != outLen {
+		return nil, fmt.Errorf("lzf: expected %d bytes, got %d", outLen, len(out))
+	}
+	return out, nil
+}
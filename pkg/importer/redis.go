@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+type RedisOptions struct {
+	// Redis database to import. Redis clients use 0 unless told otherwise.
+	DB int
+	// Import every database into the same keyspace, ignoring DB
+	AllDatabases bool
+	// Used to work out remaining TTLs, defaults to time.Now
+	Now func() time.Time
+}
+
+type RedisImportStats struct {
+	// Keys written to the store
+	Imported int
+	Deleted  int
+	// Keys that had already expired when the import ran
+	Expired int
+	// Keys of unsupported types, or commands that were ignored, by name
+	Skipped map[string]int
+}
+
+// Tracks what the import has written so that commands like EXPIRE, RENAME and
+// FLUSHDB can be replayed against a store that only knows Set/Get/Delete.
+type redisImport struct {
+	store *store.Store
+	opts  RedisOptions
+	stats *RedisImportStats
+	db    int
+	// Database each imported key was last written from
+	keys map[string]int
+	// Absolute expiry of imported keys, zero for keys without a TTL
+	expiry map[string]time.Time
+}
+
+func newRedisImport(st *store.Store, opts RedisOptions) *redisImport {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &redisImport{
+		store:  st,
+		opts:   opts,
+		stats:  &RedisImportStats{Skipped: make(map[string]int)},
+		keys:   make(map[string]int),
+		expiry: make(map[string]time.Time),
+	}
+}
+
+func (ri *redisImport) selected() bool {
+	return ri.opts.AllDatabases || ri.db == ri.opts.DB
+}
+
+func (ri *redisImport) skip(what string) {
+	ri.stats.Skipped[what]++
+}
+
+func (ri *redisImport) set(key string, value string, expiresAt time.Time) {
+	ttlSeconds, expired := ri.ttlSeconds(expiresAt)
+	if expired {
+		ri.stats.Expired++
+		ri.delete(key)
+		return
+	}
+
+	ri.store.Set(key, value, ttlSeconds, true)
+	ri.keys[key] = ri.db
+	ri.expiry[key] = expiresAt
+	ri.stats.Imported++
+}
+
+func (ri *redisImport) delete(key string) {
+	if _, ok := ri.keys[key]; !ok {
+		if _, exists := ri.store.Get(key); !exists {
+			return
+		}
+	}
+	ri.store.Delete(key)
+	delete(ri.keys, key)
+	delete(ri.expiry, key)
+	ri.stats.Deleted++
+}
+
+func (ri *redisImport) get(key string) (string, time.Time, bool) {
+	value, ok := ri.store.Get(key)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	return value, ri.expiry[key], true
+}
+
+func (ri *redisImport) flush(all bool) {
+	for key, db := range ri.keys {
+		if all || db == ri.db {
+			ri.delete(key)
+		}
+	}
+}
+
+// The store works in whole seconds, so remaining TTLs are rounded up.
+func (ri *redisImport) ttlSeconds(expiresAt time.Time) (uint64, bool) {
+	if expiresAt.IsZero() {
+		return 0, false
+	}
+	remaining := expiresAt.Sub(ri.opts.Now())
+	if remaining <= 0 {
+		return 0, true
+	}
+	return uint64((remaining + time.Second - 1) / time.Second), false
+}
@@ -0,0 +1,67 @@
+// Package logging sets up the server's slog logger and carries
+// request-scoped loggers through contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New returns a logger writing to w. The level is one of debug, info, warn
+// and error, the format either text or json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithLeveler(w, lvl, format)
+}
+
+// NewWithLeveler is like New, but takes the level as a slog.Leveler. Passing
+// a *slog.LevelVar lets the level be changed while the logger is in use.
+func NewWithLeveler(w io.Writer, level slog.Leveler, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(format) {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected text or json", format)
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+	}
+	return lvl, nil
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored by NewContext, or slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// NewRequestID returns a random 16 character hex ID.
+func NewRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
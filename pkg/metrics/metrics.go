@@ -0,0 +1,322 @@
+// Package metrics is a small Prometheus client that writes the text
+// exposition format, so the server doesn't need the official client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Buckets suited to request latencies, in seconds
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Registry holds metric families and writes them in registration order.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	collect []func(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+// Adds a collector to the family with the given name, creating it if needed.
+// Funcs registered under the same name share one HELP and TYPE line.
+func (r *Registry) register(name, help, typ string, collect func(w io.Writer)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.byName[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		r.byName[name] = f
+		r.families = append(r.families, f)
+	} else if f.typ != typ {
+		panic(fmt.Sprintf("metrics: %s registered as both %s and %s", name, f.typ, typ))
+	}
+	f.collect = append(f.collect, collect)
+}
+
+// Write writes every metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+		for _, collect := range f.collect {
+			collect(w)
+		}
+	}
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// NewGaugeFunc exports the result of fn, read on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64, labels ...Label) {
+	r.register(name, help, "gauge", func(w io.Writer) {
+		writeSample(w, name, labels, fn())
+	})
+}
+
+// NewCounterFunc exports the result of fn, which must never go down.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64, labels ...Label) {
+	r.register(name, help, "counter", func(w io.Writer) {
+		writeSample(w, name, labels, fn())
+	})
+}
+
+// Series of one metric keyed by their label values.
+type vec[T any] struct {
+	labelNames []string
+	newSeries  func() *T
+
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newVec[T any](labelNames []string, newSeries func() *T) *vec[T] {
+	return &vec[T]{
+		labelNames: labelNames,
+		newSeries:  newSeries,
+		series:     make(map[string]*T),
+		values:     make(map[string][]string),
+	}
+}
+
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %v", len(labelValues), v.labelNames))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = v.newSeries()
+	v.series[key] = s
+	v.values[key] = append([]string(nil), labelValues...)
+	return s
+}
+
+// Calls fn for every series, sorted by label values so output is stable.
+func (v *vec[T]) each(fn func(labels []Label, s *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mu.RLock()
+		s, values := v.series[key], v.values[key]
+		v.mu.RUnlock()
+
+		labels := make([]Label, len(values))
+		for i, value := range values {
+			labels[i] = Label{Name: v.labelNames[i], Value: value}
+		}
+		fn(labels, s)
+	}
+}
+
+// A float64 that can be updated atomically.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+type Counter struct {
+	vec *vec[atomicFloat]
+}
+
+// NewCounter registers a counter with the given label names. Use With to
+// pick a series, or Inc and Add directly when there are no labels.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{vec: newVec(labelNames, func() *atomicFloat { return &atomicFloat{} })}
+	r.register(name, help, "counter", func(w io.Writer) {
+		c.vec.each(func(labels []Label, value *atomicFloat) {
+			writeSample(w, name, labels, value.load())
+		})
+	})
+	return c
+}
+
+func (c *Counter) With(labelValues ...string) *CounterSeries {
+	return (*CounterSeries)(c.vec.with(labelValues))
+}
+
+func (c *Counter) Inc() {
+	c.With().Inc()
+}
+
+func (c *Counter) Add(delta float64) {
+	c.With().Add(delta)
+}
+
+type CounterSeries atomicFloat
+
+func (s *CounterSeries) Inc() {
+	s.Add(1)
+}
+
+// Add panics on negative deltas, counters only go up.
+func (s *CounterSeries) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters can't decrease")
+	}
+	(*atomicFloat)(s).add(delta)
+}
+
+type Histogram struct {
+	buckets []float64
+	vec     *vec[histogramSeries]
+}
+
+type histogramSeries struct {
+	// Not cumulative, summed up when written
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomicFloat
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted. The +Inf bucket is added automatically.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		buckets: buckets,
+		vec: newVec(labelNames, func() *histogramSeries {
+			return &histogramSeries{counts: make([]atomic.Uint64, len(buckets))}
+		}),
+	}
+	r.register(name, help, "histogram", func(w io.Writer) {
+		h.vec.each(func(labels []Label, s *histogramSeries) {
+			var cumulative uint64
+			for i, bound := range h.buckets {
+				cumulative += s.counts[i].Load()
+				le := append(labels[:len(labels):len(labels)], Label{Name: "le", Value: formatFloat(bound)})
+				writeSample(w, name+"_bucket", le, float64(cumulative))
+			}
+			count := s.count.Load()
+			inf := append(labels[:len(labels):len(labels)], Label{Name: "le", Value: "+Inf"})
+			writeSample(w, name+"_bucket", inf, float64(count))
+			writeSample(w, name+"_sum", labels, s.sum.load())
+			writeSample(w, name+"_count", labels, float64(count))
+		})
+	})
+	return h
+}
+
+func (h *Histogram) With(labelValues ...string) *HistogramSeries {
+	return &HistogramSeries{buckets: h.buckets, series: h.vec.with(labelValues)}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.With().Observe(value)
+}
+
+type HistogramSeries struct {
+	buckets []float64
+	series  *histogramSeries
+}
+
+func (s *HistogramSeries) Observe(value float64) {
+	i := sort.SearchFloat64s(s.buckets, value)
+	if i < len(s.buckets) {
+		s.series.counts[i].Add(1)
+	}
+	s.series.count.Add(1)
+	s.series.sum.add(value)
+}
+
+func writeSample(w io.Writer, name string, labels []Label, value float64) {
+	io.WriteString(w, name)
+	if len(labels) > 0 {
+		io.WriteString(w, "{")
+		for i, label := range labels {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label.Name, escapeLabel(label.Value))
+		}
+		io.WriteString(w, "}")
+	}
+	fmt.Fprintf(w, " %s\n", formatFloat(value))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
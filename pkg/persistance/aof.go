@@ -2,11 +2,15 @@ package persistance
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"time"
 
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/util"
 )
 
@@ -15,8 +19,34 @@ type AOFEntry struct {
 	Key       string
 	Value     string
 	ExpiresAt time.Time
+	Version   uint64 `json:",omitempty"`
+	Flags     uint32 `json:",omitempty"`
+	// Set for "batch" records, which group several writes into one line
+	Entries []AOFEntry `json:",omitempty"`
+	// When and where the write was made, in multi-master mode
+	Timestamp hlc.Timestamp `json:",omitempty"`
+	Origin    string        `json:",omitempty"`
 }
 
+// CorruptionError is returned when the AOF contains a record that can't be decoded.
+// Offset is the position of the first byte of the broken record, so everything
+// before it is safe to keep.
+type CorruptionError struct {
+	Offset int64
+	Line   int
+	Err    error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupt AOF record at line %d (offset %d): %v", e.Line, e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+var ErrIncompleteRecord = errors.New("incomplete record")
+
 type AOFPersistance struct{}
 
 func NewAOFPersistance() *AOFPersistance {
@@ -38,15 +68,18 @@ func (ap *AOFPersistance) LoadAOF(file *os.File) ([]AOFEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	scanner := bufio.NewScanner(file)
-	entries := make([]AOFEntry, 0)
-	for scanner.Scan() {
-		var entry AOFEntry
-		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-			return nil, err
-		}
-
+	all, _, err := ReadAOF(file)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AOFEntry, 0, len(all))
+	for _, entry := range FlattenAOF(all) {
+		// An expired set still replaces whatever the key held before,
+		// so it turns into a delete instead of being dropped
 		if !entry.ExpiresAt.IsZero() && entry.ExpiresAt.Before(time.Now()) {
+			if entry.Op == "set" {
+				entries = append(entries, AOFEntry{Op: "delete", Key: entry.Key})
+			}
 			continue
 		}
 		entries = append(entries, entry)
@@ -54,6 +87,51 @@ func (ap *AOFPersistance) LoadAOF(file *os.File) ([]AOFEntry, error) {
 	return entries, nil
 }
 
+// FlattenAOF replaces batch records with the writes they contain.
+func FlattenAOF(entries []AOFEntry) []AOFEntry {
+	flat := make([]AOFEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Op == "batch" {
+			flat = append(flat, FlattenAOF(entry.Entries)...)
+			continue
+		}
+		flat = append(flat, entry)
+	}
+	return flat
+}
+
+// ReadAOF decodes every record from r, including the expired ones.
+// It stops at the first broken record and returns the entries read so far,
+// the number of bytes they take up and a *CorruptionError.
+func ReadAOF(r io.Reader) ([]AOFEntry, int64, error) {
+	reader := bufio.NewReader(r)
+	entries := make([]AOFEntry, 0)
+	var offset int64
+	line := 0
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(data) == 0 && err == io.EOF {
+			return entries, offset, nil
+		}
+		if err != nil && err != io.EOF {
+			return entries, offset, err
+		}
+		line++
+
+		// A record without the trailing newline is a torn write
+		if err == io.EOF {
+			return entries, offset, &CorruptionError{Offset: offset, Line: line, Err: ErrIncompleteRecord}
+		}
+
+		var entry AOFEntry
+		if err := json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil {
+			return entries, offset, &CorruptionError{Offset: offset, Line: line, Err: err}
+		}
+		entries = append(entries, entry)
+		offset += int64(len(data))
+	}
+}
+
 func (ap *AOFPersistance) ClearAOF(file *os.File) error {
 	filePath := file.Name()
 	
@@ -73,3 +151,53 @@ func (ap *AOFPersistance) ClearAOF(file *os.File) error {
 
 	return nil
 }
+
+// RewriteAOF atomically replaces the AOF with the given entries. The new
+// log is written next to the old one and renamed over it, so a crash
+// leaves either the old or the new file in place.
+func (ap *AOFPersistance) RewriteAOF(file *os.File, entries []AOFEntry) error {
+	filePath := file.Name()
+	tmpPath := filePath + ".rewrite"
+
+	if err := writeAOFFile(tmpPath, entries); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	newFile, err := util.OpenOrCreate(filePath)
+	if err != nil {
+		return err
+	}
+
+	// Same trick as in ClearAOF, the store keeps its pointer to the file
+	file.Close()
+	*file = *newFile
+
+	return nil
+}
+
+func writeAOFFile(path string, entries []AOFEntry) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
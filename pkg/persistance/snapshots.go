@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/util"
 )
 
@@ -13,8 +14,18 @@ type SnapshotEntry struct {
 	Key       string
 	Value     string
 	ExpiresAt time.Time
+	Version   uint64
+	Flags     uint32
+	// When and where the key was last written, in multi-master mode
+	Timestamp hlc.Timestamp
+	Origin    string
+	// Marks the record of a deleted key, kept so that older writes from
+	// other sites can't bring it back
+	Deleted bool
 }
 
+const SnapshotFilename = "snapshot.gob"
+
 type SnapshotPersistance struct{}
 
 func NewSnapshotPersistance() *SnapshotPersistance {
@@ -23,7 +34,7 @@ func NewSnapshotPersistance() *SnapshotPersistance {
 
 func (sp *SnapshotPersistance) SaveSnapshot(dir string, entries []SnapshotEntry) error {
     tempFilename := "snapshot.tmp"
-    existingFilename := "snapshot.gob"
+    existingFilename := SnapshotFilename
     tempPath := filepath.Join(dir, tempFilename)
     existingPath := filepath.Join(dir, existingFilename)
     
@@ -46,16 +57,23 @@ func (sp *SnapshotPersistance) SaveSnapshot(dir string, entries []SnapshotEntry)
 }
 
 func (sp *SnapshotPersistance) LoadSnapshot(dir string) ([]SnapshotEntry, error) {
-    snapshotFilename := "snapshot.gob"
-    path := filepath.Join(dir, snapshotFilename)
-
-    file, err := os.Open(path)
+    entries, err := LoadSnapshotFile(filepath.Join(dir, SnapshotFilename))
     if err != nil {
         if os.IsNotExist(err) {
             return []SnapshotEntry{}, nil
         }
         return nil, err
     }
+
+    return entries, nil
+}
+
+// Decodes a single snapshot file. Unlike LoadSnapshot, a missing file is an error.
+func LoadSnapshotFile(path string) ([]SnapshotEntry, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
     defer file.Close()
 
     var entries []SnapshotEntry
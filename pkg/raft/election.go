@@ -0,0 +1,144 @@
+package raft
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+// Must be called with the lock held.
+func (n *Node) startElection() {
+	n.state = Candidate
+	n.term++
+	n.votedFor = n.cfg.ID
+	n.leaderID = ""
+	n.resetElectionTimer()
+	if err := n.saveState(); err != nil {
+		slog.Error("raft failed to save its vote", "error", err)
+		n.state = Follower
+		return
+	}
+	n.notifyProgress()
+	slog.Debug("raft election started", "term", n.term)
+
+	term := n.term
+	votes := 1
+	if votes >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+
+	req := &kvstore.VoteRequest{
+		Term:         term,
+		CandidateId:  n.cfg.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	for _, m := range n.members {
+		if m.ID == n.cfg.ID {
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+			defer cancel()
+			resp, err := n.transport.RequestVote(ctx, m.Addr, req)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if n.stopped() {
+				return
+			}
+			if resp.Term > n.term {
+				n.becomeFollower(resp.Term, "")
+				return
+			}
+			if n.state != Candidate || n.term != term || !resp.Granted {
+				return
+			}
+			votes++
+			if votes >= n.quorum() {
+				n.becomeLeader()
+			}
+		}()
+	}
+}
+
+// Must be called with the lock held.
+func (n *Node) becomeFollower(term uint64, leaderID string) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		if err := n.saveState(); err != nil {
+			slog.Error("raft failed to save its term", "error", err)
+		}
+	}
+	if n.state == Leader {
+		n.stopReplicators()
+		n.failPending(ErrLeadershipLost)
+	}
+	n.state = Follower
+	n.leaderID = leaderID
+	n.notifyProgress()
+}
+
+// Must be called with the lock held.
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leaderID = n.cfg.ID
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = make(map[string]uint64)
+	n.lastAck = make(map[string]time.Time)
+	n.replicators = make(map[string]*replicator)
+	n.syncReplicators()
+	slog.Info("raft leader elected", "id", n.cfg.ID, "term", n.term)
+
+	// Committing an entry of the new term also commits everything before it
+	entry := &kvstore.RaftEntry{Index: n.lastIndex() + 1, Term: n.term, Type: kvstore.RaftEntryType_RAFT_ENTRY_NOOP}
+	if err := n.appendEntries([]*kvstore.RaftEntry{entry}); err != nil {
+		slog.Error("raft failed to append to its log", "error", err)
+		n.becomeFollower(n.term, "")
+		return
+	}
+	n.advanceCommit()
+	n.triggerReplicators()
+	n.notifyProgress()
+}
+
+// HandleRequestVote answers a candidate's vote request.
+func (n *Node) HandleRequestVote(req *kvstore.VoteRequest) (*kvstore.VoteResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return nil, ErrStopped
+	}
+
+	// While a leader is active, nodes that lost touch with it, such as
+	// removed members, must not be able to start a new term
+	if req.Term > n.term && (n.state == Leader || (n.leaderID != "" && time.Since(n.lastContact) < n.cfg.ElectionTimeout)) {
+		return &kvstore.VoteResponse{Term: n.term}, nil
+	}
+	if req.Term < n.term {
+		return &kvstore.VoteResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term {
+		n.becomeFollower(req.Term, "")
+	}
+
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+	if !upToDate || (n.votedFor != "" && n.votedFor != req.CandidateId) {
+		return &kvstore.VoteResponse{Term: n.term}, nil
+	}
+
+	n.votedFor = req.CandidateId
+	if err := n.saveState(); err != nil {
+		return nil, err
+	}
+	n.resetElectionTimer()
+	return &kvstore.VoteResponse{Term: n.term, Granted: true}, nil
+}
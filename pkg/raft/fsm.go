@@ -0,0 +1,172 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/protobuf/proto"
+)
+
+// StateMachine is what the log is applied to. Every node applies the same
+// commands in the same order, so Apply must be deterministic.
+type StateMachine interface {
+	Apply(command []byte) any
+	Snapshot() ([]byte, error)
+	// Replaces the state with a snapshot, empty data means the initial state
+	Restore(data []byte) error
+	// Reports whether the state is the initial one
+	Empty() bool
+}
+
+// StoreFSM applies RaftCommands to a store.
+type StoreFSM struct {
+	store *store.Store
+}
+
+func NewStoreFSM(st *store.Store) *StoreFSM {
+	return &StoreFSM{store: st}
+}
+
+// Result is what StoreFSM.Apply returns for a command.
+type Result struct {
+	// The stored or current item for a set
+	Item store.Item
+	// Whether a set, delete, expire or persist changed the key
+	OK bool
+	// Items stored by an mset
+	Items []store.Item
+	// Which keys of an mdelete existed
+	Deleted []bool
+	// Keys deleted by a flush
+	Count int
+}
+
+// Snapshots use the store's snapshot format, plus the version counter so
+// restored nodes hand out the same versions as the others
+type fsmSnapshot struct {
+	LastVersion uint64
+	Entries     []persistance.SnapshotEntry
+}
+
+func (f *StoreFSM) Apply(command []byte) any {
+	var cmd kvstore.RaftCommand
+	if err := proto.Unmarshal(command, &cmd); err != nil {
+		return Result{}
+	}
+	return ApplyCommand(f.store, &cmd)
+}
+
+// Snapshot also takes a snapshot of the store itself, which clears its AOF
+// now that the log has the writes.
+func (f *StoreFSM) Snapshot() ([]byte, error) {
+	items := f.store.Export(nil)
+	snap := fsmSnapshot{
+		LastVersion: f.store.LastVersion(),
+		Entries:     make([]persistance.SnapshotEntry, len(items)),
+	}
+	for i, item := range items {
+		snap.Entries[i] = persistance.SnapshotEntry{
+			Key:       item.Key,
+			Value:     item.Value,
+			ExpiresAt: item.ExpiresAt,
+			Version:   item.Version,
+			Flags:     item.Flags,
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+		return nil, err
+	}
+	// Failures are logged by the store, the raft snapshot doesn't need it
+	f.store.SaveSnapshot()
+	return buf.Bytes(), nil
+}
+
+func (f *StoreFSM) Empty() bool {
+	return f.store.Info().Keys == 0
+}
+
+func (f *StoreFSM) Restore(data []byte) error {
+	var snap fsmSnapshot
+	if len(data) > 0 {
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snap); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]store.Entry, len(snap.Entries))
+	for i, e := range snap.Entries {
+		entries[i] = store.Entry{Key: e.Key, Item: store.Item{
+			Value:     e.Value,
+			ExpiresAt: e.ExpiresAt,
+			Version:   e.Version,
+			Flags:     e.Flags,
+		}}
+	}
+	// ReplaceAll saves a store snapshot, failures are logged by the store
+	f.store.ReplaceAll(entries)
+	f.store.SetLastVersion(snap.LastVersion)
+	return nil
+}
+
+var setConditions = map[kvstore.SetCondition]store.SetCondition{
+	kvstore.SetCondition_SET_CONDITION_ALWAYS:     store.SetAlways,
+	kvstore.SetCondition_SET_CONDITION_IF_ABSENT:  store.SetIfAbsent,
+	kvstore.SetCondition_SET_CONDITION_IF_PRESENT: store.SetIfPresent,
+}
+
+// ApplyCommand runs a command against st. Servers that aren't part of a
+// cluster use it to share the code path with those that are.
+func ApplyCommand(st *store.Store, cmd *kvstore.RaftCommand) Result {
+	switch cmd.Op {
+	case "set":
+		item, ok := st.SetWithOptions(cmd.Key, cmd.Value, store.SetOptions{
+			ExpiresAt: fromUnixNano(cmd.ExpiresAtUnixNano),
+			KeepTTL:   cmd.KeepTtl,
+			Condition: setConditions[cmd.Condition],
+			IfVersion: cmd.IfVersion,
+			Flags:     cmd.Flags,
+		})
+		return Result{Item: item, OK: ok}
+	case "delete":
+		return Result{OK: st.Delete(cmd.Key)}
+	case "mset":
+		entries := make([]store.Entry, len(cmd.Entries))
+		for i, e := range cmd.Entries {
+			entries[i] = store.Entry{Key: e.Key, Item: store.Item{
+				Value:     e.Value,
+				ExpiresAt: fromUnixNano(e.ExpiresAtUnixNano),
+				Flags:     e.Flags,
+			}}
+		}
+		return Result{Items: st.MSet(entries)}
+	case "mdelete":
+		return Result{Deleted: st.MDelete(cmd.Keys)}
+	case "expire":
+		return Result{OK: st.Expire(cmd.Key, fromUnixNano(cmd.ExpiresAtUnixNano))}
+	case "persist":
+		return Result{OK: st.Persist(cmd.Key)}
+	case "flush":
+		return Result{Count: st.DeletePrefix(cmd.Prefix)}
+	}
+	return Result{}
+}
+
+func UnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,166 @@
+package raft
+
+import (
+	"slices"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/protobuf/proto"
+)
+
+// The helpers below index n.log, whose first element stands for the last
+// entry in the snapshot. They must be called with the lock held.
+
+func (n *Node) snapshotIndex() uint64 {
+	return n.log[0].Index
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *Node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+// Returns 0 for indexes outside the log.
+func (n *Node) termAt(index uint64) uint64 {
+	if index < n.snapshotIndex() || index > n.lastIndex() {
+		return 0
+	}
+	return n.log[index-n.snapshotIndex()].Term
+}
+
+func (n *Node) entryAt(index uint64) *kvstore.RaftEntry {
+	return n.log[index-n.snapshotIndex()]
+}
+
+// Returns up to limit entries starting at index.
+func (n *Node) entriesFrom(index uint64, limit int) []*kvstore.RaftEntry {
+	if index > n.lastIndex() {
+		return nil
+	}
+	entries := n.log[index-n.snapshotIndex():]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return slices.Clone(entries)
+}
+
+// Appends entries to the log on disk and in memory.
+func (n *Node) appendEntries(entries []*kvstore.RaftEntry) error {
+	if err := n.storage.appendLog(entries); err != nil {
+		return err
+	}
+	n.log = append(n.log, entries...)
+	for _, entry := range entries {
+		if entry.Type == kvstore.RaftEntryType_RAFT_ENTRY_MEMBERSHIP {
+			n.updateMembers()
+			break
+		}
+	}
+	return nil
+}
+
+// Drops the entries from index on, which conflict with the leader's log.
+func (n *Node) truncateFrom(index uint64) error {
+	kept := n.log[:index-n.snapshotIndex()]
+	if err := n.storage.rewriteLog(kept[1:]); err != nil {
+		return err
+	}
+	n.log = kept
+	n.updateMembers()
+	return nil
+}
+
+// Replaces the entries up to index with a snapshot of the state machine.
+func (n *Node) compact(index uint64, data []byte) error {
+	snap := &kvstore.RaftSnapshot{
+		LastIncludedIndex: index,
+		LastIncludedTerm:  n.termAt(index),
+		Members:           membersToProto(n.membersAt(index)),
+		Data:              data,
+	}
+	if err := n.storage.saveSnapshot(snap); err != nil {
+		return err
+	}
+
+	rest := slices.Clone(n.log[index-n.snapshotIndex()+1:])
+	if err := n.storage.rewriteLog(rest); err != nil {
+		return err
+	}
+	n.log = append([]*kvstore.RaftEntry{{Index: index, Term: snap.LastIncludedTerm}}, rest...)
+	n.snapshotMembers = membersFromProto(snap.Members)
+	return nil
+}
+
+// Members tracks the latest configuration in the log, committed or not, as
+// Raft changes membership one server at a time.
+func (n *Node) updateMembers() {
+	n.members = n.membersAt(n.lastIndex())
+	if n.state == Leader {
+		n.syncReplicators()
+	}
+}
+
+func (n *Node) membersAt(index uint64) []Member {
+	for i := index; i > n.snapshotIndex(); i-- {
+		entry := n.entryAt(i)
+		if entry.Type == kvstore.RaftEntryType_RAFT_ENTRY_MEMBERSHIP {
+			return decodeMembers(entry.Data)
+		}
+	}
+	return n.snapshotMembers
+}
+
+// Returns the index of the newest membership entry, 0 if the snapshot has
+// the latest configuration.
+func (n *Node) membershipIndex() uint64 {
+	for i := n.lastIndex(); i > n.snapshotIndex(); i-- {
+		if n.entryAt(i).Type == kvstore.RaftEntryType_RAFT_ENTRY_MEMBERSHIP {
+			return i
+		}
+	}
+	return 0
+}
+
+func (n *Node) member(id string) (Member, bool) {
+	for _, m := range n.members {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+func (n *Node) quorum() int {
+	return len(n.members)/2 + 1
+}
+
+func encodeMembers(members []Member) []byte {
+	data, _ := proto.Marshal(&kvstore.RaftMembers{Members: membersToProto(members)})
+	return data
+}
+
+func decodeMembers(data []byte) []Member {
+	var msg kvstore.RaftMembers
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return nil
+	}
+	return membersFromProto(msg.Members)
+}
+
+func membersToProto(members []Member) []*kvstore.RaftMember {
+	out := make([]*kvstore.RaftMember, len(members))
+	for i, m := range members {
+		out[i] = &kvstore.RaftMember{Id: m.ID, Addr: m.Addr}
+	}
+	return out
+}
+
+func membersFromProto(members []*kvstore.RaftMember) []Member {
+	out := make([]Member, len(members))
+	for i, m := range members {
+		out[i] = Member{ID: m.Id, Addr: m.Addr}
+	}
+	return out
+}
@@ -0,0 +1,598 @@
+// Package raft replicates a log of commands between the nodes of a cluster
+// with the Raft consensus algorithm, and applies the committed commands to
+// a state machine on every node. It covers leader election, log
+// replication, snapshots for compacting the log, single-server membership
+// changes and linearizable reads through ReadBarrier.
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+const (
+	DefaultElectionTimeout   = time.Second
+	DefaultHeartbeatInterval = 100 * time.Millisecond
+	DefaultSnapshotThreshold = 8192
+
+	// Entries sent in one AppendEntries call at most
+	maxAppendEntries = 512
+)
+
+var (
+	ErrStopped = errors.New("raft node stopped")
+	// The entry may still be committed by the next leader
+	ErrLeadershipLost    = errors.New("leadership lost before the entry was committed, it may or may not be applied")
+	ErrMembershipPending = errors.New("another membership change is still in progress")
+	// The state machine would be replaced by the cluster's, losing its data
+	ErrNotEmpty = errors.New("a node without Raft state must start with empty data, the other nodes don't have it")
+)
+
+// NotLeaderError is returned for requests that only the leader can handle.
+type NotLeaderError struct {
+	LeaderID   string
+	LeaderAddr string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.LeaderAddr == "" {
+		return "not the leader, and no leader is known"
+	}
+	return fmt.Sprintf("not the leader, the leader is %s at %s", e.LeaderID, e.LeaderAddr)
+}
+
+type Member struct {
+	ID string
+	// gRPC address, used by the other nodes and for redirecting clients
+	Addr string
+}
+
+type Config struct {
+	ID string
+	// Directory for the log, the vote and snapshots
+	Dir string
+	// Initial members, only used when Dir holds no state yet. Every node of
+	// a new cluster needs the same list. Leave it empty on a node that is
+	// going to be added to an existing cluster.
+	Bootstrap []Member
+	// Followers start an election after hearing nothing from the leader for
+	// between one and two election timeouts
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	// Applied entries that trigger a snapshot of the state machine
+	SnapshotThreshold int
+}
+
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (s State) String() string {
+	switch s {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+type Status struct {
+	ID            string
+	State         State
+	Term          uint64
+	LeaderID      string
+	LeaderAddr    string
+	CommitIndex   uint64
+	AppliedIndex  uint64
+	LastIndex     uint64
+	SnapshotIndex uint64
+	Members       []Member
+}
+
+type Node struct {
+	cfg       Config
+	fsm       StateMachine
+	transport Transport
+	storage   *storage
+
+	mu       sync.Mutex
+	state    State
+	term     uint64
+	votedFor string
+	leaderID string
+	// log[0] stands for the last entry in the snapshot
+	log             []*kvstore.RaftEntry
+	snapshotMembers []Member
+	members         []Member
+	commitIndex     uint64
+	lastApplied     uint64
+	// Last time a leader was heard from or a vote granted
+	lastContact     time.Time
+	electionTimeout time.Duration
+	// Closed and replaced whenever the commit index, the applied index or
+	// the state changes
+	progress chan struct{}
+
+	// Leader state
+	nextIndex   map[string]uint64
+	matchIndex  map[string]uint64
+	lastAck     map[string]time.Time
+	replicators map[string]*replicator
+	pending     map[uint64]*proposal
+
+	// Held while the state machine changes, so snapshots see it between
+	// entries
+	applyMu sync.Mutex
+	applyCh chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type proposal struct {
+	term uint64
+	done chan proposalResult
+}
+
+type proposalResult struct {
+	value any
+	err   error
+}
+
+// NewNode loads the node's state from cfg.Dir and resets the state machine
+// to the latest snapshot. Committed entries after it are applied again
+// once the node learns they are committed. Call Start to join the cluster.
+func NewNode(cfg Config, fsm StateMachine, transport Transport) (*Node, error) {
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = DefaultElectionTimeout
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.SnapshotThreshold <= 0 {
+		cfg.SnapshotThreshold = DefaultSnapshotThreshold
+	}
+
+	storage, err := openStorage(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("opening raft storage: %w", err)
+	}
+	n := &Node{
+		cfg:       cfg,
+		fsm:       fsm,
+		transport: transport,
+		storage:   storage,
+		progress:  make(chan struct{}),
+		pending:   make(map[uint64]*proposal),
+		applyCh:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	if err := n.load(); err != nil {
+		storage.close()
+		return nil, err
+	}
+	n.resetElectionTimer()
+	return n, nil
+}
+
+func (n *Node) load() error {
+	state, err := n.storage.loadState()
+	if err != nil {
+		return err
+	}
+	snap, err := n.storage.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	entries, err := n.storage.loadLog()
+	if err != nil {
+		return err
+	}
+
+	// A new node starts from the cluster's state, which would silently
+	// replace whatever the state machine already has
+	if snap == nil && len(entries) == 0 && !n.fsm.Empty() {
+		return ErrNotEmpty
+	}
+
+	n.term, n.votedFor = state.Term, state.VotedFor
+	if snap == nil {
+		snap = &kvstore.RaftSnapshot{}
+	}
+	n.log = []*kvstore.RaftEntry{{Index: snap.LastIncludedIndex, Term: snap.LastIncludedTerm}}
+	n.snapshotMembers = membersFromProto(snap.Members)
+	for _, entry := range entries {
+		// Left over if a crash hit between saving a snapshot and
+		// rewriting the log
+		if entry.Index > n.lastIndex() {
+			n.log = append(n.log, entry)
+		}
+	}
+
+	// Every node of a new cluster writes the same first entry
+	if n.lastIndex() == 0 && len(n.cfg.Bootstrap) > 0 {
+		n.term = max(n.term, 1)
+		if err := n.storage.saveState(hardState{Term: n.term, VotedFor: n.votedFor}); err != nil {
+			return err
+		}
+		err := n.appendEntries([]*kvstore.RaftEntry{{
+			Index: 1,
+			Term:  1,
+			Type:  kvstore.RaftEntryType_RAFT_ENTRY_MEMBERSHIP,
+			Data:  encodeMembers(n.cfg.Bootstrap),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	n.members = n.membersAt(n.lastIndex())
+
+	if err := n.fsm.Restore(snap.Data); err != nil {
+		return fmt.Errorf("restoring snapshot: %w", err)
+	}
+	n.commitIndex = snap.LastIncludedIndex
+	n.lastApplied = snap.LastIncludedIndex
+	return nil
+}
+
+func (n *Node) Start() {
+	n.wg.Add(2)
+	go n.ticker()
+	go n.applier()
+}
+
+// Stop leaves the cluster until the node is started again with a new Node.
+// Proposals that are still waiting fail with ErrStopped.
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	select {
+	case <-n.stop:
+		n.mu.Unlock()
+		return nil
+	default:
+	}
+	close(n.stop)
+	n.stopReplicators()
+	n.failPending(ErrStopped)
+	n.mu.Unlock()
+
+	n.wg.Wait()
+	return n.storage.close()
+}
+
+// Apply proposes a command and waits until it is committed and applied,
+// returning what the state machine returned for it.
+func (n *Node) Apply(ctx context.Context, command []byte) (any, error) {
+	n.mu.Lock()
+	index, p, err := n.propose(kvstore.RaftEntryType_RAFT_ENTRY_COMMAND, command)
+	n.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return n.wait(ctx, index, p)
+}
+
+// Appends an entry as the leader. Must be called with the lock held.
+func (n *Node) propose(typ kvstore.RaftEntryType, data []byte) (uint64, *proposal, error) {
+	if n.stopped() {
+		return 0, nil, ErrStopped
+	}
+	if n.state != Leader {
+		return 0, nil, n.notLeader()
+	}
+
+	entry := &kvstore.RaftEntry{Index: n.lastIndex() + 1, Term: n.term, Type: typ, Data: data}
+	if err := n.appendEntries([]*kvstore.RaftEntry{entry}); err != nil {
+		return 0, nil, err
+	}
+	p := &proposal{term: n.term, done: make(chan proposalResult, 1)}
+	n.pending[entry.Index] = p
+	n.advanceCommit()
+	n.triggerReplicators()
+	return entry.Index, p, nil
+}
+
+func (n *Node) wait(ctx context.Context, index uint64, p *proposal) (any, error) {
+	select {
+	case result := <-p.done:
+		return result.value, result.err
+	case <-ctx.Done():
+		n.mu.Lock()
+		delete(n.pending, index)
+		n.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// ReadBarrier returns once the state machine reflects every write that was
+// committed before the call, so reads after it are linearizable. Only the
+// leader can serve it.
+func (n *Node) ReadBarrier(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state != Leader {
+		return n.notLeader()
+	}
+	// A new leader only knows what is committed once an entry of its own
+	// term is
+	term := n.term
+	err := n.waitLocked(ctx, func() bool {
+		return n.state != Leader || n.term != term || n.termAt(n.commitIndex) == term
+	})
+	if err != nil {
+		return err
+	}
+	if n.state != Leader || n.term != term {
+		return n.notLeader()
+	}
+	readIndex := n.commitIndex
+
+	// Another leader may have been elected without this one noticing, a
+	// round of heartbeats acknowledged by a majority rules that out
+	start := time.Now()
+	n.triggerReplicators()
+	err = n.waitLocked(ctx, func() bool {
+		return n.state != Leader || n.term != term || n.ackedSince(start) >= n.quorum()
+	})
+	if err != nil {
+		return err
+	}
+	if n.state != Leader || n.term != term {
+		return n.notLeader()
+	}
+
+	return n.waitLocked(ctx, func() bool { return n.lastApplied >= readIndex })
+}
+
+// Waits for cond, which is checked with the lock held after every change
+// of progress. Must be called with the lock held.
+func (n *Node) waitLocked(ctx context.Context, cond func() bool) error {
+	for !cond() {
+		if n.stopped() {
+			return ErrStopped
+		}
+		progress := n.progress
+		n.mu.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+		case <-n.stop:
+		}
+		n.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Node) notifyProgress() {
+	close(n.progress)
+	n.progress = make(chan struct{})
+}
+
+// AddMember adds a node to the cluster, or changes the address of a
+// member. It returns once the change is committed.
+func (n *Node) AddMember(ctx context.Context, member Member) ([]Member, error) {
+	return n.changeMembers(ctx, func(members []Member) []Member {
+		members = slices.DeleteFunc(members, func(m Member) bool { return m.ID == member.ID })
+		return append(members, member)
+	})
+}
+
+// RemoveMember removes a node from the cluster. A leader that removes
+// itself steps down once the change is committed.
+func (n *Node) RemoveMember(ctx context.Context, id string) ([]Member, error) {
+	return n.changeMembers(ctx, func(members []Member) []Member {
+		return slices.DeleteFunc(members, func(m Member) bool { return m.ID == id })
+	})
+}
+
+func (n *Node) changeMembers(ctx context.Context, change func([]Member) []Member) ([]Member, error) {
+	n.mu.Lock()
+	if n.state == Leader && n.membershipIndex() > n.commitIndex {
+		n.mu.Unlock()
+		return nil, ErrMembershipPending
+	}
+	members := change(slices.Clone(n.members))
+	if len(members) == 0 {
+		n.mu.Unlock()
+		return nil, errors.New("cannot remove the last member")
+	}
+	index, p, err := n.propose(kvstore.RaftEntryType_RAFT_ENTRY_MEMBERSHIP, encodeMembers(members))
+	n.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := n.wait(ctx, index, p); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	st := Status{
+		ID:            n.cfg.ID,
+		State:         n.state,
+		Term:          n.term,
+		LeaderID:      n.leaderID,
+		CommitIndex:   n.commitIndex,
+		AppliedIndex:  n.lastApplied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshotIndex(),
+		Members:       slices.Clone(n.members),
+	}
+	if leader, ok := n.member(n.leaderID); ok {
+		st.LeaderAddr = leader.Addr
+	}
+	return st
+}
+
+// Must be called with the lock held.
+func (n *Node) notLeader() error {
+	err := &NotLeaderError{LeaderID: n.leaderID}
+	if leader, ok := n.member(n.leaderID); ok && n.leaderID != n.cfg.ID {
+		err.LeaderAddr = leader.Addr
+	}
+	return err
+}
+
+func (n *Node) stopped() bool {
+	select {
+	case <-n.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Must be called with the lock held.
+func (n *Node) saveState() error {
+	return n.storage.saveState(hardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+// Must be called with the lock held.
+func (n *Node) failPending(err error) {
+	for index, p := range n.pending {
+		p.done <- proposalResult{err: err}
+		delete(n.pending, index)
+	}
+}
+
+func (n *Node) signalApplier() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+// Applies committed entries in order, and takes a snapshot every
+// SnapshotThreshold entries.
+func (n *Node) applier() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-n.applyCh:
+		}
+
+		n.applyMu.Lock()
+		n.applyCommitted()
+		n.maybeSnapshot()
+		n.applyMu.Unlock()
+	}
+}
+
+// Must be called with applyMu held.
+func (n *Node) applyCommitted() {
+	n.mu.Lock()
+	first := n.lastApplied + 1
+	entries := n.entriesFrom(first, int(n.commitIndex-n.lastApplied))
+	n.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	results := make([]any, len(entries))
+	for i, entry := range entries {
+		if entry.Type == kvstore.RaftEntryType_RAFT_ENTRY_COMMAND {
+			results[i] = n.fsm.Apply(entry.Data)
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, entry := range entries {
+		p, ok := n.pending[entry.Index]
+		if !ok {
+			continue
+		}
+		if p.term == entry.Term {
+			p.done <- proposalResult{value: results[i]}
+		} else {
+			p.done <- proposalResult{err: ErrLeadershipLost}
+		}
+		delete(n.pending, entry.Index)
+	}
+	n.lastApplied = entries[len(entries)-1].Index
+	n.notifyProgress()
+	// More may have been committed in the meantime
+	if n.commitIndex > n.lastApplied {
+		n.signalApplier()
+	}
+}
+
+// Must be called with applyMu held.
+func (n *Node) maybeSnapshot() {
+	n.mu.Lock()
+	index := n.lastApplied
+	due := index-n.snapshotIndex() >= uint64(n.cfg.SnapshotThreshold)
+	n.mu.Unlock()
+	if !due {
+		return
+	}
+
+	data, err := n.fsm.Snapshot()
+	if err != nil {
+		slog.Error("raft snapshot failed", "error", err)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.compact(index, data); err != nil {
+		slog.Error("raft log compaction failed", "error", err)
+		return
+	}
+	slog.Debug("raft log compacted", "index", index)
+}
+
+func (n *Node) resetElectionTimer() {
+	n.lastContact = time.Now()
+	n.electionTimeout = n.cfg.ElectionTimeout + rand.N(n.cfg.ElectionTimeout)
+}
+
+// Starts elections when the leader goes quiet, and makes a leader that lost
+// touch with the majority step down.
+func (n *Node) ticker() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.Lock()
+		switch {
+		case n.state == Leader:
+			if n.ackedSince(time.Now().Add(-n.cfg.ElectionTimeout)) < n.quorum() {
+				slog.Warn("raft leader lost contact with the majority, stepping down", "term", n.term)
+				n.becomeFollower(n.term, "")
+			}
+		case time.Since(n.lastContact) >= n.electionTimeout:
+			if _, ok := n.member(n.cfg.ID); ok {
+				n.startElection()
+			}
+		}
+		n.mu.Unlock()
+	}
+}
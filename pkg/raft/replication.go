@@ -0,0 +1,369 @@
+package raft
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+// Sends the leader's log to one follower, on every heartbeat and whenever
+// it is triggered.
+type replicator struct {
+	id      string
+	trigger chan struct{}
+	stop    chan struct{}
+}
+
+// Starts replicators for new members and stops those of removed ones. Must
+// be called with the lock held, as the leader.
+func (n *Node) syncReplicators() {
+	current := make(map[string]bool)
+	for _, m := range n.members {
+		if m.ID == n.cfg.ID {
+			continue
+		}
+		current[m.ID] = true
+		if _, ok := n.replicators[m.ID]; ok {
+			continue
+		}
+
+		r := &replicator{id: m.ID, trigger: make(chan struct{}, 1), stop: make(chan struct{})}
+		n.replicators[m.ID] = r
+		n.nextIndex[m.ID] = n.lastIndex() + 1
+		n.matchIndex[m.ID] = 0
+		// New followers get an election timeout to answer before they
+		// count as lost
+		n.lastAck[m.ID] = time.Now()
+		n.wg.Add(1)
+		go n.replicate(r, n.term)
+	}
+
+	for id, r := range n.replicators {
+		if !current[id] {
+			close(r.stop)
+			delete(n.replicators, id)
+		}
+	}
+}
+
+// Must be called with the lock held.
+func (n *Node) stopReplicators() {
+	for id, r := range n.replicators {
+		close(r.stop)
+		delete(n.replicators, id)
+	}
+}
+
+// Must be called with the lock held.
+func (n *Node) triggerReplicators() {
+	for _, r := range n.replicators {
+		select {
+		case r.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Counts the members, including this node, that acknowledged a request
+// sent after t. Must be called with the lock held.
+func (n *Node) ackedSince(t time.Time) int {
+	acked := 0
+	for _, m := range n.members {
+		if m.ID == n.cfg.ID || !n.lastAck[m.ID].Before(t) {
+			acked++
+		}
+	}
+	return acked
+}
+
+func (n *Node) replicate(r *replicator, term uint64) {
+	defer n.wg.Done()
+	heartbeat := time.NewTicker(n.cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-n.stop:
+			return
+		case <-heartbeat.C:
+		case <-r.trigger:
+		}
+
+		// Keep going while the follower is behind
+		for n.replicateTo(r.id, term) {
+			select {
+			case <-r.stop:
+				return
+			case <-n.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// Sends one AppendEntries or InstallSnapshot call. Returns whether there is
+// more to send right away.
+func (n *Node) replicateTo(id string, term uint64) bool {
+	n.mu.Lock()
+	member, ok := n.member(id)
+	if n.state != Leader || n.term != term || !ok {
+		n.mu.Unlock()
+		return false
+	}
+	next := n.nextIndex[id]
+	if next <= n.snapshotIndex() {
+		n.mu.Unlock()
+		return n.sendSnapshot(member, term)
+	}
+
+	prev := next - 1
+	entries := n.entriesFrom(next, maxAppendEntries)
+	req := &kvstore.AppendEntriesRequest{
+		Term:         term,
+		LeaderId:     n.cfg.ID,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.termAt(prev),
+		Entries:      entries,
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	sent := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+	defer cancel()
+	resp, err := n.transport.AppendEntries(ctx, member.Addr, req)
+	if err != nil {
+		return false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.term {
+		n.becomeFollower(resp.Term, "")
+		return false
+	}
+	if n.state != Leader || n.term != term {
+		return false
+	}
+	n.lastAck[id] = sent
+	n.notifyProgress()
+
+	if !resp.Success {
+		// Back off to where the follower's log may match, but never past
+		// what it is known to have
+		next := max(min(resp.ConflictIndex, n.nextIndex[id]-1), n.matchIndex[id]+1, 1)
+		n.nextIndex[id] = next
+		return true
+	}
+	match := prev + uint64(len(entries))
+	if match > n.matchIndex[id] {
+		n.matchIndex[id] = match
+		n.advanceCommit()
+	}
+	n.nextIndex[id] = max(n.nextIndex[id], match+1)
+	return n.nextIndex[id] <= n.lastIndex()
+}
+
+func (n *Node) sendSnapshot(member Member, term uint64) bool {
+	snap, err := n.storage.loadSnapshot()
+	if err != nil || snap == nil {
+		slog.Error("raft failed to load the snapshot for a follower", "error", err)
+		return false
+	}
+	req := &kvstore.InstallSnapshotRequest{
+		Term:              term,
+		LeaderId:          n.cfg.ID,
+		LastIncludedIndex: snap.LastIncludedIndex,
+		LastIncludedTerm:  snap.LastIncludedTerm,
+		Members:           snap.Members,
+		Data:              snap.Data,
+	}
+
+	sent := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*n.cfg.ElectionTimeout)
+	defer cancel()
+	resp, err := n.transport.InstallSnapshot(ctx, member.Addr, req)
+	if err != nil {
+		slog.Warn("raft failed to send a snapshot", "member", member.ID, "error", err)
+		return false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.term {
+		n.becomeFollower(resp.Term, "")
+		return false
+	}
+	if n.state != Leader || n.term != term {
+		return false
+	}
+	n.lastAck[member.ID] = sent
+	if snap.LastIncludedIndex > n.matchIndex[member.ID] {
+		n.matchIndex[member.ID] = snap.LastIncludedIndex
+		n.advanceCommit()
+	}
+	n.nextIndex[member.ID] = max(n.nextIndex[member.ID], snap.LastIncludedIndex+1)
+	n.notifyProgress()
+	return true
+}
+
+// Commits the newest entry of the current term that a majority has. Must
+// be called with the lock held, as the leader.
+func (n *Node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		// Entries of earlier terms are only committed along with a newer one
+		if n.termAt(index) != n.term {
+			break
+		}
+		count := 0
+		for _, m := range n.members {
+			if m.ID == n.cfg.ID || n.matchIndex[m.ID] >= index {
+				count++
+			}
+		}
+		if count >= n.quorum() {
+			n.commitIndex = index
+			n.notifyProgress()
+			n.signalApplier()
+			break
+		}
+	}
+
+	// A leader that removed itself hands over once the change is committed
+	if _, ok := n.member(n.cfg.ID); !ok && n.membershipIndex() <= n.commitIndex {
+		slog.Info("raft leader removed from the cluster, stepping down")
+		n.becomeFollower(n.term, "")
+	}
+}
+
+// HandleAppendEntries adds the leader's entries to the log.
+func (n *Node) HandleAppendEntries(req *kvstore.AppendEntriesRequest) (*kvstore.AppendEntriesResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return nil, ErrStopped
+	}
+
+	if req.Term < n.term {
+		return &kvstore.AppendEntriesResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.becomeFollower(req.Term, req.LeaderId)
+	}
+	if n.leaderID != req.LeaderId {
+		n.leaderID = req.LeaderId
+		n.notifyProgress()
+	}
+	n.resetElectionTimer()
+
+	prev, entries := req.PrevLogIndex, req.Entries
+	if prev < n.snapshotIndex() {
+		// The snapshot already has the start of it
+		skip := n.snapshotIndex() - prev
+		if uint64(len(entries)) <= skip {
+			entries = nil
+		} else {
+			entries = entries[skip:]
+		}
+		prev = n.snapshotIndex()
+	} else {
+		if prev > n.lastIndex() {
+			return &kvstore.AppendEntriesResponse{Term: n.term, ConflictIndex: n.lastIndex() + 1}, nil
+		}
+		if term := n.termAt(prev); term != req.PrevLogTerm {
+			// Skip the whole conflicting term in one go
+			conflict := prev
+			for conflict > n.snapshotIndex()+1 && n.termAt(conflict-1) == term {
+				conflict--
+			}
+			return &kvstore.AppendEntriesResponse{Term: n.term, ConflictIndex: conflict}, nil
+		}
+	}
+
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if n.termAt(entry.Index) == entry.Term {
+				continue
+			}
+			if err := n.truncateFrom(entry.Index); err != nil {
+				return nil, err
+			}
+		}
+		if err := n.appendEntries(entries[i:]); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	lastNew := prev + uint64(len(entries))
+	if req.LeaderCommit > n.commitIndex {
+		n.commitIndex = max(n.commitIndex, min(req.LeaderCommit, lastNew))
+		n.notifyProgress()
+		n.signalApplier()
+	}
+	return &kvstore.AppendEntriesResponse{Term: n.term, Success: true}, nil
+}
+
+// HandleInstallSnapshot replaces the state machine and the log with the
+// leader's snapshot.
+func (n *Node) HandleInstallSnapshot(req *kvstore.InstallSnapshotRequest) (*kvstore.InstallSnapshotResponse, error) {
+	n.mu.Lock()
+	if n.stopped() {
+		defer n.mu.Unlock()
+		return nil, ErrStopped
+	}
+	if req.Term < n.term {
+		defer n.mu.Unlock()
+		return &kvstore.InstallSnapshotResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.becomeFollower(req.Term, req.LeaderId)
+	}
+	n.leaderID = req.LeaderId
+	n.resetElectionTimer()
+	n.mu.Unlock()
+
+	// The applier must not run while the state machine is replaced
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if req.LastIncludedIndex <= n.lastApplied {
+		return &kvstore.InstallSnapshotResponse{Term: n.term}, nil
+	}
+
+	snap := &kvstore.RaftSnapshot{
+		LastIncludedIndex: req.LastIncludedIndex,
+		LastIncludedTerm:  req.LastIncludedTerm,
+		Members:           req.Members,
+		Data:              req.Data,
+	}
+	if err := n.storage.saveSnapshot(snap); err != nil {
+		return nil, err
+	}
+
+	// Entries after the snapshot are kept if the log agrees with it
+	var rest []*kvstore.RaftEntry
+	if n.termAt(req.LastIncludedIndex) == req.LastIncludedTerm && req.LastIncludedIndex >= n.snapshotIndex() {
+		rest = n.entriesFrom(req.LastIncludedIndex+1, len(n.log))
+	}
+	if err := n.storage.rewriteLog(rest); err != nil {
+		return nil, err
+	}
+	n.log = append([]*kvstore.RaftEntry{{Index: req.LastIncludedIndex, Term: req.LastIncludedTerm}}, rest...)
+	n.snapshotMembers = membersFromProto(req.Members)
+	n.updateMembers()
+
+	if err := n.fsm.Restore(req.Data); err != nil {
+		return nil, err
+	}
+	n.lastApplied = req.LastIncludedIndex
+	n.commitIndex = max(n.commitIndex, req.LastIncludedIndex)
+	n.notifyProgress()
+	slog.Info("raft snapshot installed", "index", req.LastIncludedIndex)
+	return &kvstore.InstallSnapshotResponse{Term: n.term}, nil
+}
@@ -0,0 +1,219 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	stateFilename    = "state.json"
+	logFilename      = "log"
+	snapshotFilename = "snapshot"
+)
+
+// The term and vote, which have to survive a restart so a node never
+// votes twice in a term.
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for,omitempty"`
+}
+
+// Keeps a node's state in a directory. The log file holds the entries after
+// the snapshot, each as a length, a CRC-32 and the encoded entry. Every
+// write is synced before it returns.
+type storage struct {
+	dir     string
+	logFile *os.File
+}
+
+func openStorage(dir string) (*storage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, logFilename), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &storage{dir: dir, logFile: file}, nil
+}
+
+func (s *storage) close() error {
+	return s.logFile.Close()
+}
+
+func (s *storage) loadState() (hardState, error) {
+	var state hardState
+	data, err := os.ReadFile(filepath.Join(s.dir, stateFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("decoding %s: %w", stateFilename, err)
+	}
+	return state, nil
+}
+
+func (s *storage) saveState(state hardState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(stateFilename, data)
+}
+
+// Returns nil if there is no snapshot yet.
+func (s *storage) loadSnapshot() (*kvstore.RaftSnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap := &kvstore.RaftSnapshot{}
+	if err := proto.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+func (s *storage) saveSnapshot(snap *kvstore.RaftSnapshot) error {
+	data, err := proto.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(snapshotFilename, data)
+}
+
+// Reads the log. A record cut short by a crash is dropped, along with
+// anything after it.
+func (s *storage) loadLog() ([]*kvstore.RaftEntry, error) {
+	if _, err := s.logFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(s.logFile)
+
+	var entries []*kvstore.RaftEntry
+	var offset int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[:4]))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		entry := &kvstore.RaftEntry{}
+		if err := proto.Unmarshal(data, entry); err != nil {
+			break
+		}
+		entries = append(entries, entry)
+		offset += int64(len(header) + len(data))
+	}
+
+	if err := s.logFile.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err := s.logFile.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *storage) appendLog(entries []*kvstore.RaftEntry) error {
+	data, err := encodeEntries(entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.logFile.Write(data); err != nil {
+		return err
+	}
+	return s.logFile.Sync()
+}
+
+// Replaces the log with entries, after a conflict or a snapshot.
+func (s *storage) rewriteLog(entries []*kvstore.RaftEntry) error {
+	data, err := encodeEntries(entries)
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(logFilename, data); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, logFilename), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return err
+	}
+	s.logFile.Close()
+	s.logFile = file
+	return nil
+}
+
+func encodeEntries(entries []*kvstore.RaftEntry) ([]byte, error) {
+	var buf []byte
+	for _, entry := range entries {
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(data))
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+// Replaces a file through a synced temporary file, so a crash leaves
+// either the old or the new version.
+func (s *storage) writeFile(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
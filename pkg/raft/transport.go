@@ -0,0 +1,128 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Transport sends RPCs to the other nodes, by their gRPC address.
+type Transport interface {
+	RequestVote(ctx context.Context, addr string, req *kvstore.VoteRequest) (*kvstore.VoteResponse, error)
+	AppendEntries(ctx context.Context, addr string, req *kvstore.AppendEntriesRequest) (*kvstore.AppendEntriesResponse, error)
+	InstallSnapshot(ctx context.Context, addr string, req *kvstore.InstallSnapshotRequest) (*kvstore.InstallSnapshotResponse, error)
+}
+
+// Snapshot data sent in one InstallSnapshot message at most
+const snapshotChunkSize = 1 << 20
+
+type GRPCTransportOptions struct {
+	// Bearer token of an admin user, needed when the nodes have ACLs
+	Token string
+	// Defaults to an insecure connection
+	DialOptions []grpc.DialOption
+}
+
+// GRPCTransport talks to the Raft service of the other nodes, keeping one
+// connection per node.
+type GRPCTransport struct {
+	opts GRPCTransportOptions
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func NewGRPCTransport(opts GRPCTransportOptions) *GRPCTransport {
+	if len(opts.DialOptions) == 0 {
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &GRPCTransport{
+		opts:  opts,
+		conns: make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (t *GRPCTransport) client(ctx context.Context, addr string) (context.Context, kvstore.RaftClient, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, ok := t.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = grpc.NewClient(addr, t.opts.DialOptions...); err != nil {
+			return nil, nil, err
+		}
+		t.conns[addr] = conn
+	}
+	if t.opts.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+t.opts.Token)
+	}
+	return ctx, kvstore.NewRaftClient(conn), nil
+}
+
+func (t *GRPCTransport) RequestVote(ctx context.Context, addr string, req *kvstore.VoteRequest) (*kvstore.VoteResponse, error) {
+	ctx, client, err := t.client(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return client.RequestVote(ctx, req)
+}
+
+func (t *GRPCTransport) AppendEntries(ctx context.Context, addr string, req *kvstore.AppendEntriesRequest) (*kvstore.AppendEntriesResponse, error) {
+	ctx, client, err := t.client(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return client.AppendEntries(ctx, req)
+}
+
+// InstallSnapshot splits the data into chunks, the first of which also
+// carries the rest of the request.
+func (t *GRPCTransport) InstallSnapshot(ctx context.Context, addr string, req *kvstore.InstallSnapshotRequest) (*kvstore.InstallSnapshotResponse, error) {
+	ctx, client, err := t.client(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.InstallSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := req.Data
+	first := true
+	for first || len(data) > 0 {
+		chunk := data[:min(len(data), snapshotChunkSize)]
+		data = data[len(chunk):]
+		msg := &kvstore.InstallSnapshotRequest{Data: chunk}
+		if first {
+			msg = &kvstore.InstallSnapshotRequest{
+				Term:              req.Term,
+				LeaderId:          req.LeaderId,
+				LastIncludedIndex: req.LastIncludedIndex,
+				LastIncludedTerm:  req.LastIncludedTerm,
+				Members:           req.Members,
+				Data:              chunk,
+			}
+			first = false
+		}
+		if err := stream.Send(msg); err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func (t *GRPCTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for addr, conn := range t.conns {
+		errs = append(errs, conn.Close())
+		delete(t.conns, addr)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+// Replication is asynchronous, so a crash can lose writes a replica or
+// another site never got, or leave some it has that the primary lost.
+// Anti-entropy finds such differences by comparing Merkle trees, and fixes
+// them from the other server.
+
+const DefaultAntiEntropyInterval = 10 * time.Minute
+
+// Ranges fetched per RangeItems call, which keeps the messages small
+const repairRangesPerCall = 16
+
+type RepairResult struct {
+	// Ranges whose leaves differed
+	Ranges    int
+	KeysFixed int
+}
+
+// Walks down the Merkle trees of st and the server behind client and fixes
+// the ranges that differ. With merge, the server's items and tombstones are
+// merged as writes of another site, otherwise st is made to match it like a
+// replica.
+func repair(ctx context.Context, st *store.Store, client kvstore.ReplicationClient, merge bool) (RepairResult, error) {
+	depth := store.DefaultMerkleDepth
+	local := st.MerkleTree(depth)
+
+	var ranges []int
+	nodes := []uint32{0}
+	for len(nodes) > 0 {
+		resp, err := client.MerkleNodes(ctx, &kvstore.MerkleNodesRequest{Depth: uint32(depth), Nodes: nodes})
+		if err != nil {
+			return RepairResult{}, err
+		}
+		if len(resp.Hashes) != len(nodes) {
+			return RepairResult{}, fmt.Errorf("asked for %d tree nodes, got %d", len(nodes), len(resp.Hashes))
+		}
+		var next []uint32
+		for i, n := range nodes {
+			if hash, _ := local.Node(int(n)); hash == resp.Hashes[i] {
+				continue
+			}
+			if leaf, ok := local.Leaf(int(n)); ok {
+				ranges = append(ranges, leaf)
+				continue
+			}
+			left, right := local.Children(int(n))
+			next = append(next, uint32(left), uint32(right))
+		}
+		nodes = next
+	}
+
+	result := RepairResult{Ranges: len(ranges)}
+	for start := 0; start < len(ranges); start += repairRangesPerCall {
+		chunk := ranges[start:min(start+repairRangesPerCall, len(ranges))]
+		req := &kvstore.RangeItemsRequest{Depth: uint32(depth)}
+		for _, r := range chunk {
+			req.Ranges = append(req.Ranges, uint32(r))
+		}
+		resp, err := client.RangeItems(ctx, req)
+		if err != nil {
+			return result, err
+		}
+
+		if merge {
+			for _, item := range resp.Items {
+				result.KeysFixed += st.Merge(EntryFromProto(item))
+			}
+			for _, t := range resp.Tombstones {
+				result.KeysFixed += st.Merge(EntryFromProto(t))
+			}
+			continue
+		}
+		entries := make([]store.Entry, len(resp.Items))
+		for i, item := range resp.Items {
+			entries[i] = ItemFromProto(item)
+		}
+		result.KeysFixed += st.Repair(depth, chunk, entries, resp.Version)
+	}
+	return result, nil
+}
+
+// Calls repair every interval while ready says the stream is caught up, so
+// writes on their way aren't taken for differences, until ctx is done.
+func runAntiEntropy(ctx context.Context, interval time.Duration, ready func() bool, repair func(context.Context) (RepairResult, error), source string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !ready() {
+			continue
+		}
+		result, err := repair(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				slog.Warn("anti-entropy repair failed", "source", source, "error", err)
+			}
+		case result.KeysFixed > 0:
+			slog.Info("anti-entropy repair fixed keys", "source", source, "ranges", result.Ranges, "keys", result.KeysFixed)
+		default:
+			slog.Debug("anti-entropy repair found nothing to fix", "source", source, "ranges", result.Ranges)
+		}
+	}
+}
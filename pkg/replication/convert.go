@@ -0,0 +1,94 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+func EntryToProto(entry persistance.AOFEntry) *kvstore.ReplicationEntry {
+	msg := &kvstore.ReplicationEntry{
+		Op:                entry.Op,
+		Key:               entry.Key,
+		Value:             entry.Value,
+		ExpiresAtUnixNano: unixNano(entry.ExpiresAt),
+		Version:           entry.Version,
+		Flags:             entry.Flags,
+		Timestamp:         uint64(entry.Timestamp),
+		Origin:            entry.Origin,
+	}
+	for _, e := range entry.Entries {
+		msg.Entries = append(msg.Entries, EntryToProto(e))
+	}
+	return msg
+}
+
+func EntryFromProto(msg *kvstore.ReplicationEntry) persistance.AOFEntry {
+	entry := persistance.AOFEntry{
+		Op:        msg.Op,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		ExpiresAt: fromUnixNano(msg.ExpiresAtUnixNano),
+		Version:   msg.Version,
+		Flags:     msg.Flags,
+		Timestamp: hlc.Timestamp(msg.Timestamp),
+		Origin:    msg.Origin,
+	}
+	for _, e := range msg.Entries {
+		entry.Entries = append(entry.Entries, EntryFromProto(e))
+	}
+	return entry
+}
+
+// ItemToProto encodes a key for a full sync, as a set.
+func ItemToProto(entry store.Entry) *kvstore.ReplicationEntry {
+	return &kvstore.ReplicationEntry{
+		Op:                "set",
+		Key:               entry.Key,
+		Value:             entry.Value,
+		ExpiresAtUnixNano: unixNano(entry.ExpiresAt),
+		Version:           entry.Version,
+		Flags:             entry.Flags,
+		Timestamp:         uint64(entry.Timestamp),
+		Origin:            entry.Origin,
+	}
+}
+
+// TombstoneToProto encodes a deleted key for another site's full sync, as a
+// delete.
+func TombstoneToProto(t store.Tombstone) *kvstore.ReplicationEntry {
+	return &kvstore.ReplicationEntry{
+		Op:        "delete",
+		Key:       t.Key,
+		Timestamp: uint64(t.Timestamp),
+		Origin:    t.Origin,
+	}
+}
+
+func ItemFromProto(msg *kvstore.ReplicationEntry) store.Entry {
+	return store.Entry{Key: msg.Key, Item: store.Item{
+		Value:     msg.Value,
+		ExpiresAt: fromUnixNano(msg.ExpiresAtUnixNano),
+		Version:   msg.Version,
+		Flags:     msg.Flags,
+		Timestamp: hlc.Timestamp(msg.Timestamp),
+		Origin:    msg.Origin,
+	}}
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,122 @@
+// Package replication streams a primary's writes to its replicas. The
+// primary keeps a Log of recent writes that each replica follows after a
+// full sync, and a Replica applies that stream to its own store.
+package replication
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+const DefaultBacklog = 10000
+
+var ErrTooSlow = errors.New("replica fell too far behind the primary")
+
+type Record struct {
+	// Position in the log, starting at 1
+	Offset uint64
+	Entry  persistance.AOFEntry
+	Time   time.Time
+}
+
+// Log numbers the primary's writes and hands them to subscribers. It keeps
+// no history, a replica that falls behind by more than the backlog is
+// dropped and has to sync again.
+type Log struct {
+	backlog int
+
+	mu     sync.Mutex
+	offset uint64
+	subs   map[*Subscription]struct{}
+}
+
+// NewLog returns a log whose subscribers can fall behind by up to backlog
+// writes.
+func NewLog(backlog int) *Log {
+	if backlog <= 0 {
+		backlog = DefaultBacklog
+	}
+	return &Log{
+		backlog: backlog,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Append adds a write to the log. It is meant to be the store's write
+// observer and never blocks.
+func (l *Log) Append(entry persistance.AOFEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.offset++
+	record := Record{Offset: l.offset, Entry: entry, Time: time.Now()}
+	for sub := range l.subs {
+		select {
+		case sub.records <- record:
+		default:
+			sub.tooSlow.Store(true)
+			l.remove(sub)
+		}
+	}
+}
+
+// Offset returns the position of the newest write.
+func (l *Log) Offset() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.offset
+}
+
+// Subscribe starts following the log. To line the subscription up with a
+// copy of the data, call it while the store is locked, e.g. from Export.
+func (l *Log) Subscribe() *Subscription {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sub := &Subscription{
+		Offset:  l.offset,
+		records: make(chan Record, l.backlog),
+	}
+	l.subs[sub] = struct{}{}
+	return sub
+}
+
+func (l *Log) Unsubscribe(sub *Subscription) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remove(sub)
+}
+
+// Must be called with the lock held.
+func (l *Log) remove(sub *Subscription) {
+	if _, ok := l.subs[sub]; ok {
+		delete(l.subs, sub)
+		close(sub.records)
+	}
+}
+
+type Subscription struct {
+	// The log's offset when subscribing, the first record follows it
+	Offset uint64
+
+	records chan Record
+	tooSlow atomic.Bool
+}
+
+// Records returns the writes after Offset. The channel is closed when the
+// subscription ends, see Err.
+func (s *Subscription) Records() <-chan Record {
+	return s.records
+}
+
+// Err returns ErrTooSlow if the log dropped the subscription.
+func (s *Subscription) Err() error {
+	if s.tooSlow.Load() {
+		return ErrTooSlow
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+type PeerOptions struct {
+	// ID of this site, so the other one leaves out the writes made here
+	Origin string
+	// Bearer token of an admin user, needed when the other site has ACLs
+	Token string
+	// Defaults to an insecure connection
+	DialOptions []grpc.DialOption
+	// Wait between reconnects, defaults to DefaultRetryDelay
+	RetryDelay time.Duration
+	// Time between anti-entropy repairs from the site, 0 disables them
+	AntiEntropyInterval time.Duration
+}
+
+// Peer follows another site of a multi-master deployment. Unlike a Replica
+// it merges what it receives into the store, keeping the newest write to
+// every key, so both sites take writes. Every connection starts with the
+// other site's keys and tombstones, which brings back a site that was cut
+// off.
+type Peer struct {
+	store  *store.Store
+	id     string
+	addr   string
+	opts   PeerOptions
+	conn   *grpc.ClientConn
+	client kvstore.ReplicationClient
+
+	mu        sync.Mutex
+	connected bool
+	// Last write received and newest write the other site reported
+	offset     uint64
+	peerOffset uint64
+	received   uint64
+	applied    uint64
+	caughtUpAt time.Time
+	repaired   uint64
+}
+
+type PeerStatus struct {
+	ID        string
+	Addr      string
+	Connected bool
+	Offset    uint64
+	// Writes received, and those of them that were newer than what the
+	// store had
+	WritesReceived uint64
+	WritesApplied  uint64
+	// Zero while caught up, otherwise the time since the site last was
+	Lag time.Duration
+	// Keys fixed by anti-entropy repairs
+	KeysRepaired uint64
+}
+
+// NewPeer returns a follower of the site id at addr. It doesn't connect
+// until Run is called.
+func NewPeer(st *store.Store, id, addr string, opts PeerOptions) (*Peer, error) {
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+	dialOpts := opts.DialOptions
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to site %s at %s: %w", id, addr, err)
+	}
+	return &Peer{
+		store:      st,
+		id:         id,
+		addr:       addr,
+		opts:       opts,
+		conn:       conn,
+		client:     kvstore.NewReplicationClient(conn),
+		caughtUpAt: time.Now(),
+	}, nil
+}
+
+// Run follows the site until ctx is done, reconnecting whenever the stream
+// breaks, and repairs the store from it regularly if anti-entropy is on.
+func (p *Peer) Run(ctx context.Context) {
+	if p.opts.AntiEntropyInterval > 0 {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runAntiEntropy(ctx, p.opts.AntiEntropyInterval, p.caughtUp, p.Repair, p.id)
+		}()
+		defer func() { <-done }()
+	}
+	for {
+		err := p.sync(ctx)
+		p.mu.Lock()
+		p.connected = false
+		p.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("stream from site ended, reconnecting", "site", p.id, "addr", p.addr, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.opts.RetryDelay):
+		}
+	}
+}
+
+func (p *Peer) outgoing(ctx context.Context) context.Context {
+	if p.opts.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+p.opts.Token)
+	}
+	return ctx
+}
+
+func (p *Peer) sync(ctx context.Context) error {
+	ctx = p.outgoing(ctx)
+	stream, err := p.client.Sync(ctx, &kvstore.SyncRequest{ReplicaId: p.opts.Origin, OriginId: p.opts.Origin})
+	if err != nil {
+		return err
+	}
+
+	synced := 0
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		offset := msg.Offset
+		switch m := msg.Message.(type) {
+		case *kvstore.SyncResponse_FullSync:
+			// Merging is the same in any order, so chunks are applied as
+			// they come
+			for _, item := range m.FullSync.Items {
+				synced += p.merge(EntryFromProto(item), false)
+			}
+			for _, t := range m.FullSync.Tombstones {
+				synced += p.merge(EntryFromProto(t), false)
+			}
+			if !m.FullSync.Done {
+				continue
+			}
+			slog.Info("full sync from site done", "site", p.id, "applied", synced, "offset", offset)
+			p.mu.Lock()
+			p.connected = true
+			// The site may have restarted, which starts its log over
+			p.offset = offset
+			p.peerOffset = offset
+			p.mu.Unlock()
+		case *kvstore.SyncResponse_Write:
+			p.merge(EntryFromProto(m.Write), true)
+			p.mu.Lock()
+			p.offset = offset
+			p.mu.Unlock()
+		case *kvstore.SyncResponse_Heartbeat:
+			p.mu.Lock()
+			p.offset = max(p.offset, m.Heartbeat.Passed)
+			p.mu.Unlock()
+		}
+
+		p.mu.Lock()
+		p.peerOffset = max(p.peerOffset, offset)
+		if p.connected && p.offset >= p.peerOffset {
+			p.caughtUpAt = time.Now()
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *Peer) merge(entry persistance.AOFEntry, count bool) int {
+	applied := p.store.Merge(entry)
+	if count {
+		p.mu.Lock()
+		p.received += writes(entry)
+		p.applied += uint64(applied)
+		p.mu.Unlock()
+	}
+	return applied
+}
+
+// Repair compares the store with the site's and merges the keys and
+// tombstones of the ranges that differ. Only writes newer than what the
+// store has apply, so the site's own repair fixes keys this one has newer.
+func (p *Peer) Repair(ctx context.Context) (RepairResult, error) {
+	result, err := repair(p.outgoing(ctx), p.store, p.client, true)
+	p.mu.Lock()
+	p.repaired += uint64(result.KeysFixed)
+	p.mu.Unlock()
+	return result, err
+}
+
+func (p *Peer) caughtUp() bool {
+	st := p.Status()
+	return st.Connected && st.Lag == 0
+}
+
+// ID returns the ID of the site.
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// Counts the writes in entry, batches by their parts.
+func writes(entry persistance.AOFEntry) uint64 {
+	if entry.Op != "batch" {
+		return 1
+	}
+	var n uint64
+	for _, e := range entry.Entries {
+		n += writes(e)
+	}
+	return n
+}
+
+func (p *Peer) Status() PeerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := PeerStatus{
+		ID:             p.id,
+		Addr:           p.addr,
+		Connected:      p.connected,
+		Offset:         p.offset,
+		WritesReceived: p.received,
+		WritesApplied:  p.applied,
+		KeysRepaired:   p.repaired,
+	}
+	if !p.connected || p.peerOffset > p.offset {
+		st.Lag = time.Since(p.caughtUpAt)
+	}
+	return st
+}
+
+// Close closes the connection to the site. Run must have returned.
+func (p *Peer) Close() error {
+	return p.conn.Close()
+}
+
+// ForSite keeps the parts of a write another site needs: those that
+// weren't made there, and that carry a timestamp.
+func ForSite(entry persistance.AOFEntry, site string) (persistance.AOFEntry, bool) {
+	if entry.Op != "batch" {
+		return entry, entry.Timestamp != 0 && entry.Origin != site
+	}
+	var kept []persistance.AOFEntry
+	for _, e := range entry.Entries {
+		if e, ok := ForSite(e, site); ok {
+			kept = append(kept, e)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return persistance.AOFEntry{}, false
+	case 1:
+		return kept[0], true
+	}
+	entry.Entries = kept
+	return entry, true
+}
@@ -0,0 +1,214 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const DefaultRetryDelay = time.Second
+
+type ReplicaOptions struct {
+	// Name shown in the primary's status, defaults to the hostname
+	ID string
+	// Bearer token of an admin user, needed when the primary has ACLs
+	Token string
+	// Defaults to an insecure connection
+	DialOptions []grpc.DialOption
+	// Wait between reconnects, defaults to DefaultRetryDelay
+	RetryDelay time.Duration
+	// Time between anti-entropy repairs from the primary, 0 disables them
+	AntiEntropyInterval time.Duration
+}
+
+// Replica keeps a store in sync with a primary. Every connection starts
+// with a full copy of the primary's data, after which its writes are
+// applied as they happen.
+type Replica struct {
+	store   *store.Store
+	primary string
+	opts    ReplicaOptions
+	conn    *grpc.ClientConn
+	client  kvstore.ReplicationClient
+
+	mu        sync.Mutex
+	connected bool
+	// Last write applied and newest write the primary reported
+	offset        uint64
+	primaryOffset uint64
+	// When the replica last had every write it knew of
+	caughtUpAt time.Time
+	repaired   uint64
+}
+
+type Status struct {
+	Primary    string
+	Connected  bool
+	Offset     uint64
+	LagEntries uint64
+	// Zero while caught up, otherwise the time since the replica last was
+	Lag time.Duration
+	// Keys fixed by anti-entropy repairs
+	KeysRepaired uint64
+}
+
+// NewReplica returns a replica of the primary at addr. It doesn't connect
+// until Run is called.
+func NewReplica(st *store.Store, addr string, opts ReplicaOptions) (*Replica, error) {
+	if opts.ID == "" {
+		opts.ID, _ = os.Hostname()
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+	dialOpts := opts.DialOptions
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to primary %s: %w", addr, err)
+	}
+	return &Replica{
+		store:      st,
+		primary:    addr,
+		opts:       opts,
+		conn:       conn,
+		client:     kvstore.NewReplicationClient(conn),
+		caughtUpAt: time.Now(),
+	}, nil
+}
+
+// Run follows the primary until ctx is done, reconnecting whenever the
+// stream breaks, and repairs the store from it regularly if anti-entropy
+// is on.
+func (r *Replica) Run(ctx context.Context) {
+	if r.opts.AntiEntropyInterval > 0 {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runAntiEntropy(ctx, r.opts.AntiEntropyInterval, r.caughtUp, r.Repair, r.primary)
+		}()
+		defer func() { <-done }()
+	}
+	for {
+		err := r.sync(ctx)
+		r.mu.Lock()
+		r.connected = false
+		r.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("replication stream ended, reconnecting", "primary", r.primary, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.opts.RetryDelay):
+		}
+	}
+}
+
+func (r *Replica) outgoing(ctx context.Context) context.Context {
+	if r.opts.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+r.opts.Token)
+	}
+	return ctx
+}
+
+func (r *Replica) sync(ctx context.Context) error {
+	ctx = r.outgoing(ctx)
+	stream, err := r.client.Sync(ctx, &kvstore.SyncRequest{ReplicaId: r.opts.ID})
+	if err != nil {
+		return err
+	}
+
+	var items []store.Entry
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch m := msg.Message.(type) {
+		case *kvstore.SyncResponse_FullSync:
+			for _, item := range m.FullSync.Items {
+				items = append(items, ItemFromProto(item))
+			}
+			if !m.FullSync.Done {
+				continue
+			}
+			// A failed snapshot is logged by the store, the data is replaced
+			// either way
+			r.store.ReplaceAll(items)
+			slog.Info("full sync from primary done", "primary", r.primary, "keys", len(items), "offset", msg.Offset)
+			items = nil
+			r.mu.Lock()
+			r.connected = true
+			// The primary may have restarted, which starts its log over
+			r.offset = msg.Offset
+			r.primaryOffset = msg.Offset
+			r.mu.Unlock()
+		case *kvstore.SyncResponse_Write:
+			r.store.ApplyReplicated(EntryFromProto(m.Write))
+			r.mu.Lock()
+			r.offset = msg.Offset
+			r.mu.Unlock()
+		}
+
+		r.mu.Lock()
+		r.primaryOffset = max(r.primaryOffset, msg.Offset)
+		if r.connected && r.offset >= r.primaryOffset {
+			r.caughtUpAt = time.Now()
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Repair compares the store with the primary's and makes the key ranges
+// that differ match it.
+func (r *Replica) Repair(ctx context.Context) (RepairResult, error) {
+	result, err := repair(r.outgoing(ctx), r.store, r.client, false)
+	r.mu.Lock()
+	r.repaired += uint64(result.KeysFixed)
+	r.mu.Unlock()
+	return result, err
+}
+
+func (r *Replica) caughtUp() bool {
+	st := r.Status()
+	return st.Connected && st.LagEntries == 0
+}
+
+func (r *Replica) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := Status{
+		Primary:      r.primary,
+		Connected:    r.connected,
+		Offset:       r.offset,
+		KeysRepaired: r.repaired,
+	}
+	if r.primaryOffset > r.offset {
+		st.LagEntries = r.primaryOffset - r.offset
+	}
+	if !r.connected || st.LagEntries > 0 {
+		st.Lag = time.Since(r.caughtUpAt)
+	}
+	return st
+}
+
+// Close closes the connection to the primary. Run must have returned.
+func (r *Replica) Close() error {
+	return r.conn.Close()
+}
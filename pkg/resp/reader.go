@@ -0,0 +1,155 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Limits taken from Redis' defaults for client query buffers
+const (
+	maxArgs       = 1024 * 1024
+	maxBulkLength = 512 * 1024 * 1024
+	// Longest inline command or header line
+	maxLineLength = 64 * 1024
+)
+
+// Lengths come from the client, so buffers are only allocated up front to
+// this size and grow as the data arrives. A few bytes claiming a huge length
+// can't make the server allocate it.
+const (
+	argsPrealloc = 1024
+	bulkPrealloc = 64 * 1024
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &Reader{r: br}
+	}
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Buffered reports how many bytes can be read without blocking, which lets
+// servers flush replies only once a pipeline has been drained.
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// ReadCommand reads one command, either as an array of bulk strings or as an
+// inline command. Blank lines, including those with only whitespace, and
+// comment lines starting with '#', which Redis writes into its AOF as
+// annotations, are skipped.
+func (r *Reader) ReadCommand() ([]string, error) {
+	for {
+		prefix, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if prefix[0] != '*' {
+			line, err := r.readLine()
+			if err != nil {
+				return nil, err
+			}
+			args := strings.Fields(line)
+			if len(args) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			return args, nil
+		}
+
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > maxArgs {
+			return nil, fmt.Errorf("%w: invalid multibulk length", ErrProtocol)
+		}
+		if n <= 0 {
+			continue
+		}
+
+		args := make([]string, 0, min(n, argsPrealloc))
+		for range n {
+			arg, err := r.readBulkString()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	}
+}
+
+func (r *Reader) readBulkString() (string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return "", fmt.Errorf("%w: expected '$', got %q", ErrProtocol, line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxBulkLength {
+		return "", fmt.Errorf("%w: invalid bulk length", ErrProtocol)
+	}
+
+	var data []byte
+	if n <= bulkPrealloc {
+		data = make([]byte, n+2)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return "", unexpectedEOF(err)
+		}
+	} else {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r.r, int64(n+2)); err != nil {
+			return "", unexpectedEOF(err)
+		}
+		data = buf.Bytes()
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		return "", fmt.Errorf("%w: bulk string not terminated by CRLF", ErrProtocol)
+	}
+	return string(data[:n]), nil
+}
+
+// Reads a line terminated by "\r\n" (or a bare "\n") without the terminator.
+// Lines longer than maxLineLength are a protocol error.
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineLength+2 {
+			return "", fmt.Errorf("%w: line too long", ErrProtocol)
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if len(line) > 0 {
+				return "", unexpectedEOF(err)
+			}
+			return "", err
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
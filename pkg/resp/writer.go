@@ -0,0 +1,79 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// Writer encodes replies. Version selects between RESP2 and RESP3, which only
+// differ in how nulls and maps are written for the replies we use.
+type Writer struct {
+	w       *bufio.Writer
+	Version int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w), Version: 2}
+}
+
+func (w *Writer) WriteSimpleString(s string) error {
+	return w.writeLine('+', s)
+}
+
+// WriteError writes an error reply. By convention msg starts with an
+// upper-case error code such as ERR or WRONGTYPE.
+func (w *Writer) WriteError(msg string) error {
+	return w.writeLine('-', msg)
+}
+
+func (w *Writer) WriteInteger(n int64) error {
+	return w.writeLine(':', strconv.FormatInt(n, 10))
+}
+
+func (w *Writer) WriteBulkString(s string) error {
+	if err := w.writeLine('$', strconv.Itoa(len(s))); err != nil {
+		return err
+	}
+	if _, err := w.w.WriteString(s); err != nil {
+		return err
+	}
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
+
+func (w *Writer) WriteNull() error {
+	if w.Version >= 3 {
+		_, err := w.w.WriteString("_\r\n")
+		return err
+	}
+	return w.writeLine('$', "-1")
+}
+
+func (w *Writer) WriteArrayHeader(n int) error {
+	return w.writeLine('*', strconv.Itoa(n))
+}
+
+// WriteMapHeader starts a map of n key-value pairs. RESP2 has no maps, so
+// they're sent as flat arrays.
+func (w *Writer) WriteMapHeader(n int) error {
+	if w.Version >= 3 {
+		return w.writeLine('%', strconv.Itoa(n))
+	}
+	return w.WriteArrayHeader(2 * n)
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) writeLine(prefix byte, s string) error {
+	if err := w.w.WriteByte(prefix); err != nil {
+		return err
+	}
+	if _, err := w.w.WriteString(s); err != nil {
+		return err
+	}
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
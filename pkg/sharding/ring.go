@@ -0,0 +1,270 @@
+// Package sharding spreads keys over several servers with consistent
+// hashing. Every node owns a number of points, or tokens, on a ring of
+// 64-bit hashes, and a key belongs to the node with the first token at or
+// after the key's hash. Adding a node only moves the keys between its new
+// tokens and the ones before them.
+package sharding
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Tokens per node in a ring built by NewRing
+const DefaultVirtualNodes = 128
+
+type Node struct {
+	ID string
+	// gRPC address, used by clients and other nodes
+	Addr string
+}
+
+type Token struct {
+	Hash   uint64
+	NodeID string
+}
+
+// Ring is an immutable topology. Changes make a new Ring with a higher
+// epoch.
+type Ring struct {
+	epoch  uint64
+	nodes  []Node
+	tokens []Token
+}
+
+// Hash places a key or a token on the ring.
+func Hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV spreads short, similar strings like token names poorly, the
+	// splitmix64 finalizer mixes the bits
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// NewRing gives every node virtualNodes tokens, derived from its ID so
+// that every server and client builds the same ring.
+func NewRing(nodes []Node, virtualNodes int) (*Ring, error) {
+	if virtualNodes <= 0 {
+		return nil, errors.New("virtual nodes must be positive")
+	}
+	var tokens []Token
+	for _, n := range nodes {
+		for _, hash := range VirtualTokens(n.ID, virtualNodes) {
+			tokens = append(tokens, Token{Hash: hash, NodeID: n.ID})
+		}
+	}
+	return NewRingFromTokens(1, nodes, tokens)
+}
+
+// VirtualTokens returns the points NewRing gives a node.
+func VirtualTokens(id string, virtualNodes int) []uint64 {
+	hashes := make([]uint64, virtualNodes)
+	for i := range hashes {
+		hashes[i] = Hash(id + "#" + strconv.Itoa(i))
+	}
+	return hashes
+}
+
+// NewRingFromTokens builds a ring with the given tokens, which may come in
+// any order.
+func NewRingFromTokens(epoch uint64, nodes []Node, tokens []Token) (*Ring, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("a ring needs at least one node")
+	}
+	ids := make(map[string]bool)
+	for _, n := range nodes {
+		if n.ID == "" || n.Addr == "" {
+			return nil, fmt.Errorf("node %q needs an id and an address", n.ID)
+		}
+		if ids[n.ID] {
+			return nil, fmt.Errorf("duplicate node %q", n.ID)
+		}
+		ids[n.ID] = true
+	}
+
+	tokens = slices.Clone(tokens)
+	slices.SortFunc(tokens, func(a, b Token) int { return cmp.Compare(a.Hash, b.Hash) })
+	for i, t := range tokens {
+		if !ids[t.NodeID] {
+			return nil, fmt.Errorf("token %d belongs to unknown node %q", t.Hash, t.NodeID)
+		}
+		if i > 0 && tokens[i-1].Hash == t.Hash {
+			return nil, fmt.Errorf("duplicate token %d", t.Hash)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("a ring needs at least one token")
+	}
+	return &Ring{epoch: epoch, nodes: slices.Clone(nodes), tokens: tokens}, nil
+}
+
+func (r *Ring) Epoch() uint64 {
+	return r.epoch
+}
+
+func (r *Ring) Nodes() []Node {
+	return slices.Clone(r.nodes)
+}
+
+// Tokens returns the tokens in ring order.
+func (r *Ring) Tokens() []Token {
+	return slices.Clone(r.tokens)
+}
+
+func (r *Ring) Node(id string) (Node, bool) {
+	for _, n := range r.nodes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
+
+// Owner returns the node that owns key.
+func (r *Ring) Owner(key string) Node {
+	return r.OwnerOfHash(Hash(key))
+}
+
+// OwnerOfHash returns the node that owns a point on the ring.
+func (r *Ring) OwnerOfHash(hash uint64) Node {
+	node, _ := r.Node(r.tokens[r.tokenIndex(hash)].NodeID)
+	return node
+}
+
+// RangeOf returns the hashes a token at hash owns, or would own once added:
+// those after the token before it.
+func (r *Ring) RangeOf(hash uint64) Range {
+	i := r.tokenIndex(hash)
+	if r.tokens[i].Hash < hash {
+		// Wrapped around, every token is before hash
+		i = len(r.tokens)
+	}
+	prev := r.tokens[(i-1+len(r.tokens))%len(r.tokens)].Hash
+	return Range{Start: prev, End: hash}
+}
+
+// WithNode returns a copy of the ring with n added, without tokens.
+func (r *Ring) WithNode(n Node) (*Ring, error) {
+	if _, ok := r.Node(n.ID); ok {
+		return nil, fmt.Errorf("node %q is already in the ring", n.ID)
+	}
+	return NewRingFromTokens(r.epoch+1, append(r.Nodes(), n), r.tokens)
+}
+
+// WithTokens returns a copy of the ring in which nodeID owns the tokens at
+// the given hashes, adding the ones that don't exist yet.
+func (r *Ring) WithTokens(hashes []uint64, nodeID string) (*Ring, error) {
+	tokens := r.Tokens()
+	for _, hash := range hashes {
+		i, found := slices.BinarySearchFunc(tokens, hash, func(t Token, h uint64) int { return cmp.Compare(t.Hash, h) })
+		if found {
+			tokens[i].NodeID = nodeID
+		} else {
+			tokens = slices.Insert(tokens, i, Token{Hash: hash, NodeID: nodeID})
+		}
+	}
+	return NewRingFromTokens(r.epoch+1, r.nodes, tokens)
+}
+
+// Range is the part of the ring after Start, up to and including End. It
+// wraps around when End is before Start, and covers the whole ring when
+// they are equal.
+type Range struct {
+	Start, End uint64
+}
+
+func (r Range) Contains(hash uint64) bool {
+	if r.Start < r.End {
+		return hash > r.Start && hash <= r.End
+	}
+	return hash > r.Start || hash <= r.End
+}
+
+// Index of the first token at or after hash, wrapping around
+func (r *Ring) tokenIndex(hash uint64) int {
+	i, _ := slices.BinarySearchFunc(r.tokens, hash, func(t Token, h uint64) int { return cmp.Compare(t.Hash, h) })
+	if i == len(r.tokens) {
+		return 0
+	}
+	return i
+}
+
+// ToProto describes the ring as seen by the node self.
+func (r *Ring) ToProto(self string) *kvstore.TopologyResponse {
+	resp := &kvstore.TopologyResponse{Epoch: r.epoch, SelfId: self}
+	for _, n := range r.nodes {
+		resp.Nodes = append(resp.Nodes, &kvstore.ShardNode{Id: n.ID, Addr: n.Addr})
+	}
+	for _, t := range r.tokens {
+		resp.Tokens = append(resp.Tokens, &kvstore.ShardToken{Hash: t.Hash, NodeId: t.NodeID})
+	}
+	return resp
+}
+
+func RingFromProto(resp *kvstore.TopologyResponse) (*Ring, error) {
+	nodes := make([]Node, len(resp.Nodes))
+	for i, n := range resp.Nodes {
+		nodes[i] = Node{ID: n.Id, Addr: n.Addr}
+	}
+	tokens := make([]Token, len(resp.Tokens))
+	for i, t := range resp.Tokens {
+		tokens[i] = Token{Hash: t.Hash, NodeID: t.NodeId}
+	}
+	return NewRingFromTokens(resp.Epoch, nodes, tokens)
+}
+
+// LoadRing reads a ring saved with SaveRing, or returns nil if path doesn't
+// exist.
+func LoadRing(path string) (*Ring, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msg kvstore.TopologyResponse
+	if err := protojson.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return RingFromProto(&msg)
+}
+
+// SaveRing writes the ring to path as JSON, replacing the file atomically.
+func SaveRing(path string, r *Ring) error {
+	data, err := protojson.MarshalOptions{Multiline: true}.Marshal(r.ToProto(""))
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
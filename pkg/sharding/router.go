@@ -0,0 +1,263 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Trailer with the owner's address that servers send with keys they don't
+// own
+const MovedTrailer = "kvstore-moved"
+
+// ErrNotSharded is returned by NewRouter when the server isn't sharded.
+var ErrNotSharded = errors.New("server is not sharded")
+
+// Router sends every KVStore call to the node that owns its keys, so it can
+// stand in for a single connection:
+//
+//	client := kvstore.NewKVStoreClient(router)
+//
+// Batch calls are split by owner and their results put back in request
+// order. Calls without keys, and streams, go to the seed connection. When
+// a node answers that it doesn't own a key, the router fetches the topology
+// from the owner it names, which has it first after a migration, and
+// retries once.
+type Router struct {
+	seed grpc.ClientConnInterface
+	dial func(addr string) (*grpc.ClientConn, error)
+
+	mu    sync.Mutex
+	ring  *Ring
+	conns map[string]*grpc.ClientConn
+}
+
+// NewRouter fetches the topology through seed. dial opens connections to
+// the other nodes, with the same credentials as seed.
+func NewRouter(ctx context.Context, seed grpc.ClientConnInterface, dial func(addr string) (*grpc.ClientConn, error)) (*Router, error) {
+	r := &Router{
+		seed:  seed,
+		dial:  dial,
+		conns: make(map[string]*grpc.ClientConn),
+	}
+	if err := r.Refresh(ctx); err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, ErrNotSharded
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Refresh fetches the topology again, keeping the current one if it is
+// newer.
+func (r *Router) Refresh(ctx context.Context) error {
+	return r.fetch(ctx, r.seed)
+}
+
+// Fetches the topology from the node at addr, or from the seed if that
+// fails.
+func (r *Router) refreshFrom(ctx context.Context, addr string) error {
+	conn, err := r.conn(addr)
+	if err == nil {
+		err = r.fetch(ctx, conn)
+	}
+	if err != nil {
+		return r.Refresh(ctx)
+	}
+	return nil
+}
+
+func (r *Router) fetch(ctx context.Context, cc grpc.ClientConnInterface) error {
+	resp, err := kvstore.NewShardingClient(cc).Topology(ctx, &kvstore.TopologyRequest{})
+	if err != nil {
+		return err
+	}
+	ring, err := RingFromProto(resp)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ring == nil || ring.Epoch() > r.ring.Epoch() {
+		r.ring = ring
+	}
+	return nil
+}
+
+func (r *Router) Ring() *Ring {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ring
+}
+
+// Close closes the connections to the nodes, but not the seed.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for addr, conn := range r.conns {
+		errs = append(errs, conn.Close())
+		delete(r.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) conn(addr string) (*grpc.ClientConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if conn, ok := r.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := r.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	r.conns[addr] = conn
+	return conn, nil
+}
+
+func (r *Router) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return r.seed.NewStream(ctx, desc, method, opts...)
+}
+
+func (r *Router) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	err := r.invoke(ctx, method, args, reply, opts)
+	var moved *movedError
+	if !errors.As(err, &moved) {
+		return err
+	}
+	if err := r.refreshFrom(ctx, moved.addr); err != nil {
+		return err
+	}
+	return r.invoke(ctx, method, args, reply, opts)
+}
+
+func (r *Router) invoke(ctx context.Context, method string, args, reply any, opts []grpc.CallOption) error {
+	switch req := args.(type) {
+	case *kvstore.MGetRequest:
+		return r.invokeMGet(ctx, req, reply.(*kvstore.MGetResponse), opts)
+	case *kvstore.MSetRequest:
+		return r.invokeMSet(ctx, req, reply.(*kvstore.MSetResponse), opts)
+	case *kvstore.MDeleteRequest:
+		return r.invokeMDelete(ctx, req, reply.(*kvstore.MDeleteResponse), opts)
+	case interface{ GetKey() string }:
+		return r.invokeOn(ctx, r.Ring().Owner(req.GetKey()).Addr, method, args, reply, opts)
+	}
+	return r.seed.Invoke(ctx, method, args, reply, opts...)
+}
+
+// Moved errors carry the owner's address in a trailer, so the error is
+// recognised by that.
+func (r *Router) invokeOn(ctx context.Context, addr, method string, args, reply any, opts []grpc.CallOption) error {
+	conn, err := r.conn(addr)
+	if err != nil {
+		return err
+	}
+	var trailer metadata.MD
+	err = conn.Invoke(ctx, method, args, reply, append(opts, grpc.Trailer(&trailer))...)
+	if owner := trailer.Get(MovedTrailer); err != nil && len(owner) > 0 {
+		return &movedError{err: err, addr: owner[0]}
+	}
+	return err
+}
+
+type movedError struct {
+	err error
+	// The owner's address
+	addr string
+}
+
+func (e *movedError) Error() string { return e.err.Error() }
+
+// Keeps the status of the server's error
+func (e *movedError) GRPCStatus() *status.Status { return status.Convert(e.err) }
+
+func (e *movedError) Unwrap() error { return e.err }
+
+// Groups the indexes of keys by the address of their owner.
+func (r *Router) group(keys []string) map[string][]int {
+	ring := r.Ring()
+	groups := make(map[string][]int)
+	for i, key := range keys {
+		addr := ring.Owner(key).Addr
+		groups[addr] = append(groups[addr], i)
+	}
+	return groups
+}
+
+func (r *Router) invokeMGet(ctx context.Context, req *kvstore.MGetRequest, reply *kvstore.MGetResponse, opts []grpc.CallOption) error {
+	results := make([]*kvstore.MGetResult, len(req.Keys))
+	for addr, indexes := range r.group(req.Keys) {
+		sub := &kvstore.MGetRequest{Keys: make([]string, len(indexes))}
+		for j, i := range indexes {
+			sub.Keys[j] = req.Keys[i]
+		}
+		var resp kvstore.MGetResponse
+		if err := r.invokeOn(ctx, addr, kvstore.KVStore_MGet_FullMethodName, sub, &resp, opts); err != nil {
+			return err
+		}
+		for j, i := range indexes {
+			results[i] = resp.Results[j]
+		}
+	}
+	proto.Reset(reply)
+	reply.Results = results
+	return nil
+}
+
+// A batch that spans shards is one write per shard, an error can leave the
+// shards before it written.
+func (r *Router) invokeMSet(ctx context.Context, req *kvstore.MSetRequest, reply *kvstore.MSetResponse, opts []grpc.CallOption) error {
+	keys := make([]string, len(req.Entries))
+	for i, entry := range req.Entries {
+		keys[i] = entry.Key
+	}
+	results := make([]*kvstore.MSetResult, len(req.Entries))
+	for addr, indexes := range r.group(keys) {
+		sub := &kvstore.MSetRequest{Entries: make([]*kvstore.SetRequest, len(indexes))}
+		for j, i := range indexes {
+			sub.Entries[j] = req.Entries[i]
+		}
+		var resp kvstore.MSetResponse
+		if err := r.invokeOn(ctx, addr, kvstore.KVStore_MSet_FullMethodName, sub, &resp, opts); err != nil {
+			return err
+		}
+		for j, i := range indexes {
+			results[i] = resp.Results[j]
+		}
+	}
+	proto.Reset(reply)
+	reply.Results = results
+	return nil
+}
+
+func (r *Router) invokeMDelete(ctx context.Context, req *kvstore.MDeleteRequest, reply *kvstore.MDeleteResponse, opts []grpc.CallOption) error {
+	results := make([]*kvstore.MDeleteResult, len(req.Keys))
+	for addr, indexes := range r.group(req.Keys) {
+		sub := &kvstore.MDeleteRequest{Keys: make([]string, len(indexes))}
+		for j, i := range indexes {
+			sub.Keys[j] = req.Keys[i]
+		}
+		var resp kvstore.MDeleteResponse
+		if err := r.invokeOn(ctx, addr, kvstore.KVStore_MDelete_FullMethodName, sub, &resp, opts); err != nil {
+			return err
+		}
+		for j, i := range indexes {
+			results[i] = resp.Results[j]
+		}
+	}
+	proto.Reset(reply)
+	reply.Results = results
+	return nil
+}
+
+var _ grpc.ClientConnInterface = (*Router)(nil)
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+// Implemented by AOF persistence that can replace the log with a compacted one.
+type AOFRewriter interface {
+	RewriteAOF(file *os.File, entries []persistance.AOFEntry) error
+}
+
+var ErrRewriteUnsupported = errors.New("AOF persistence doesn't support rewriting")
+
+type Info struct {
+	Keys           int
+	KeysWithExpiry int
+	// Bytes taken up by keys and values, without any overhead
+	DataBytes int64
+	// Limit on DataBytes, 0 if there is none
+	MaxMemory int64
+	ReadOnly  bool
+	// Deleted keys remembered for multi-master replication
+	Tombstones int
+
+	// Totals since startup. Expired keys are counted when the background
+	// cleanup or eviction removes them.
+	ExpiredKeys    uint64
+	EvictedKeys    uint64
+	AOFWriteErrors uint64
+
+	AOFPath              string
+	AOFSize              int64
+	SnapshotDir          string
+	LastSnapshot         time.Time
+	LastSnapshotError    error
+	LastSnapshotDuration time.Duration
+	LastAOFRewrite       time.Time
+}
+
+func (s *Store) Info() Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := Info{
+		MaxMemory:            s.maxMemory.Load(),
+		ReadOnly:             s.readOnly.Load(),
+		ExpiredKeys:          s.expiredKeys.Load(),
+		EvictedKeys:          s.evictedKeys.Load(),
+		AOFWriteErrors:       s.aofWriteErrors.Load(),
+		SnapshotDir:          s.snapshotDir,
+		LastSnapshot:         s.lastSnapshot,
+		LastSnapshotError:    s.lastSnapshotError,
+		LastSnapshotDuration: s.lastSnapshotDuration,
+		LastAOFRewrite:       s.lastAOFRewrite,
+		Tombstones:           len(s.tombstones),
+	}
+	for key, item := range s.items {
+		if isExpired(item) {
+			continue
+		}
+		info.Keys++
+		if !item.ExpiresAt.IsZero() {
+			info.KeysWithExpiry++
+		}
+		info.DataBytes += itemSize(key, item)
+	}
+	if s.aofFile != nil {
+		info.AOFPath = s.aofFile.Name()
+		if stat, err := s.aofFile.Stat(); err == nil {
+			info.AOFSize = stat.Size()
+		}
+	}
+	return info
+}
+
+// In read-only mode the protocol servers reject writes. The store itself
+// doesn't enforce it, so admin operations keep working. Returns the
+// previous mode.
+func (s *Store) SetReadOnly(readOnly bool) bool {
+	return s.readOnly.Swap(readOnly)
+}
+
+func (s *Store) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// Deletes every key that starts with prefix, or all keys for an empty
+// prefix. Returns how many keys were deleted.
+func (s *Store) DeletePrefix(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	var entries []persistance.AOFEntry
+	for key, item := range s.items {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if !isExpired(item) {
+			deleted++
+		}
+		entries = append(entries, s.deleteItem(key))
+	}
+	s.appendBatch(entries)
+	return deleted
+}
+
+// Replaces the AOF with one set record per live key and one delete record
+// per tombstone, dropping overwritten and deleted history. The AOF is
+// replayed over the last snapshot, so keys in the snapshot that have since
+// been deleted get a delete record too. Returns the number of records
+// written.
+func (s *Store) RewriteAOF() (int, error) {
+	rewriter, ok := s.aofPersistance.(AOFRewriter)
+	if !ok {
+		return 0, ErrRewriteUnsupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Snapshots are only written with the lock held, so this is the one
+	// the AOF is replayed over
+	snapshot, err := s.snapshotPersistance.LoadSnapshot(s.snapshotDir)
+	if err != nil {
+		slog.Error("AOF rewrite failed", "error", err)
+		return 0, err
+	}
+
+	entries := make([]persistance.AOFEntry, 0, len(s.items))
+	live := make(map[string]bool, len(s.items))
+	for key, item := range s.items {
+		if isExpired(item) {
+			continue
+		}
+		live[key] = true
+		entries = append(entries, setEntry(key, item))
+	}
+	for key, t := range s.tombstones {
+		entries = append(entries, persistance.AOFEntry{Op: "delete", Key: key, Timestamp: t.Timestamp, Origin: t.Origin})
+	}
+	for _, entry := range snapshot {
+		if _, tombstone := s.tombstones[entry.Key]; !entry.Deleted && !live[entry.Key] && !tombstone {
+			entries = append(entries, persistance.AOFEntry{Op: "delete", Key: entry.Key})
+		}
+	}
+	if err := rewriter.RewriteAOF(s.aofFile, entries); err != nil {
+		slog.Error("AOF rewrite failed", "error", err)
+		return 0, err
+	}
+	slog.Info("AOF rewritten", "records", len(entries))
+	s.lastAOFRewrite = time.Now()
+	return len(entries), nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+// The batch methods take the lock once for all keys and log a single AOF
+// record, so a batch is applied and persisted as a whole.
+
+// Looks up every key. The results are in the same order as keys, with found
+// telling which keys exist.
+func (s *Store) MGet(keys []string) (items []Item, found []bool) {
+	items = make([]Item, len(keys))
+	found = make([]bool, len(keys))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, key := range keys {
+		items[i], found[i] = s.liveItem(key)
+	}
+	return items, found
+}
+
+// Writes every entry, using their Value, ExpiresAt and Flags. Other keys
+// may be evicted to make room for them. Returns the stored items with
+// their new versions, in the same order as entries.
+func (s *Store) MSet(entries []Entry) []Item {
+	items := make([]Item, len(entries))
+	aofEntries := make([]persistance.AOFEntry, len(entries))
+
+	keys := make([]string, len(entries))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, entry := range entries {
+		keys[i] = entry.Key
+		items[i], aofEntries[i] = s.setItem(entry.Key, Item{
+			Value:     entry.Value,
+			ExpiresAt: entry.ExpiresAt,
+			Flags:     entry.Flags,
+		})
+	}
+	s.appendBatch(append(aofEntries, s.evict(keys...)...))
+	return items
+}
+
+// Deletes every key and reports which of them existed.
+func (s *Store) MDelete(keys []string) []bool {
+	deleted := make([]bool, len(keys))
+	aofEntries := make([]persistance.AOFEntry, 0, len(keys))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, key := range keys {
+		item, ok := s.items[key]
+		if !ok {
+			continue
+		}
+		deleted[i] = !isExpired(item)
+		aofEntries = append(aofEntries, s.deleteItem(key))
+	}
+	s.appendBatch(aofEntries)
+	return deleted
+}
+
+// Must be called with the lock held.
+func (s *Store) appendBatch(entries []persistance.AOFEntry) {
+	switch len(entries) {
+	case 0:
+		return
+	case 1:
+		s.appendAOF(entries[0])
+	default:
+		s.appendAOF(persistance.AOFEntry{
+			Op:      "batch",
+			Entries: entries,
+		})
+	}
+}
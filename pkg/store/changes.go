@@ -0,0 +1,47 @@
+package store
+
+// Kinds of Change. Expire is a key removed because its TTL passed, evict
+// one removed to stay under the memory limit.
+const (
+	ChangeSet    = "set"
+	ChangeDelete = "delete"
+	ChangeExpire = "expire"
+	ChangeEvict  = "evict"
+)
+
+// Change describes a key changing in memory.
+type Change struct {
+	Op  string
+	Key string
+	// The key before and after the change, nil when it didn't exist or
+	// was removed
+	Old *Item
+	New *Item
+}
+
+// Sets a function that is told about every change to a key, in the order
+// they happen. Unlike the write observer, it also sees expired keys being
+// cleaned up and gets the value the key had before. Loading from disk and
+// full syncs from a primary aren't reported. It is called with the store
+// locked, so it must not block or call back into the store.
+func (s *Store) SetChangeObserver(fn func(change Change)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changeObserver = fn
+}
+
+// Must be called with the lock held.
+func (s *Store) notifyChange(op, key string, old *Item, new *Item) {
+	if s.changeObserver != nil {
+		s.changeObserver(Change{Op: op, Key: key, Old: old, New: new})
+	}
+}
+
+// Sets a function that is called when ReplaceAll swaps in a new set of
+// keys, which isn't reported as changes. Like the change observer, it is
+// called with the store locked.
+func (s *Store) SetReplaceObserver(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replaceObserver = fn
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+)
+
+// Digests let sites compare their data without sending it. Keys are spread
+// over buckets by hash, and a bucket's digest combines the hashes of its
+// live keys, so two sites agree on a bucket when they hold the same writes
+// to its keys. Versions are left out, they differ between sites.
+
+type BucketDigest struct {
+	Keys int
+	Hash uint64
+}
+
+// KeyBucket returns the bucket of key among n buckets.
+func KeyBucket(key string, n int) int {
+	return int(keyHash(key) % uint64(n))
+}
+
+func keyHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// ItemHash hashes a key with everything about its last write except the
+// version.
+func ItemHash(key string, item Item) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(s)))
+		h.Write(buf[:])
+		h.Write([]byte(s))
+	}
+	writeUint := func(n uint64) {
+		binary.LittleEndian.PutUint64(buf[:], n)
+		h.Write(buf[:])
+	}
+	writeString(key)
+	writeString(item.Value)
+	var expiresAt int64
+	if !item.ExpiresAt.IsZero() {
+		expiresAt = item.ExpiresAt.UnixNano()
+	}
+	writeUint(uint64(expiresAt))
+	writeUint(uint64(item.Flags))
+	writeUint(uint64(item.Timestamp))
+	writeString(item.Origin)
+	return h.Sum64()
+}
+
+// Digest returns the digest of each of n buckets.
+func (s *Store) Digest(n int) []BucketDigest {
+	buckets := make([]BucketDigest, n)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, item := range s.items {
+		if isExpired(item) {
+			continue
+		}
+		b := &buckets[KeyBucket(key, n)]
+		b.Keys++
+		b.Hash ^= ItemHash(key, item)
+	}
+	return buckets
+}
+
+// BucketItems returns the live keys in a bucket among n, in key order.
+func (s *Store) BucketItems(bucket, n int) []Entry {
+	var entries []Entry
+	s.mu.RLock()
+	for key, item := range s.items {
+		if !isExpired(item) && KeyBucket(key, n) == bucket {
+			entries = append(entries, Entry{Key: key, Item: item})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"log/slog"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+// Sets the limit on the size of all keys and values in bytes, zero means
+// no limit. Writes that go over the limit evict other keys, and lowering
+// it below the current size evicts keys right away.
+func (s *Store) SetMaxMemory(bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxMemory.Store(max(bytes, 0))
+	s.appendBatch(s.evict())
+}
+
+func (s *Store) MaxMemory() int64 {
+	return s.maxMemory.Load()
+}
+
+// Deletes keys until the data fits in the memory limit, expired keys first
+// and then arbitrary ones. The keys in keep are never evicted, so a write
+// bigger than the limit still goes through. Returns the AOF entries for the
+// deletes. Must be called with the lock held.
+func (s *Store) evict(keep ...string) []persistance.AOFEntry {
+	limit := s.maxMemory.Load()
+	if limit <= 0 || s.dataBytes <= limit {
+		return nil
+	}
+
+	kept := func(key string) bool {
+		for _, k := range keep {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	var entries []persistance.AOFEntry
+	for key, item := range s.items {
+		if s.dataBytes <= limit {
+			return entries
+		}
+		if isExpired(item) && !kept(key) {
+			entries = append(entries, s.deleteItem(key))
+			s.expiredKeys.Add(1)
+		}
+	}
+
+	// Map iteration order is random, which makes this random eviction
+	evicted := 0
+	for key := range s.items {
+		if s.dataBytes <= limit {
+			break
+		}
+		if kept(key) {
+			continue
+		}
+		// Reported as an eviction rather than a delete. MAX_MEMORY is off
+		// in multi-master mode, so no tombstone is needed.
+		s.removeItem(key, ChangeEvict)
+		entries = append(entries, persistance.AOFEntry{Op: "delete", Key: key})
+		evicted++
+	}
+	if evicted > 0 {
+		s.evictedKeys.Add(uint64(evicted))
+		slog.Debug("evicted keys over the memory limit", "keys", evicted, "limit", limit)
+	}
+	return entries
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+	"sort"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+// Anti-entropy compares two stores through Merkle trees. The space of key
+// hashes is split into 1<<depth equal ranges, the leaves, and a leaf's hash
+// combines the hashes of its live keys like a bucket digest. Every inner
+// node hashes its two children, so stores whose roots match hold the same
+// data, and walking down through the nodes that differ finds the ranges to
+// repair without comparing the others.
+
+const (
+	DefaultMerkleDepth = 10
+	MaxMerkleDepth     = 16
+)
+
+type MerkleTree struct {
+	depth int
+	// In heap order: node i has children 2i+1 and 2i+2, the leaves come
+	// last
+	nodes []uint64
+}
+
+// KeyRange returns the leaf key falls in among 1<<depth.
+func KeyRange(key string, depth int) int {
+	if depth == 0 {
+		return 0
+	}
+	return int(keyHash(key) >> (64 - depth))
+}
+
+// MerkleTree builds the tree of the live items with 1<<depth leaves.
+func (s *Store) MerkleTree(depth int) *MerkleTree {
+	leaves := 1 << depth
+	t := &MerkleTree{depth: depth, nodes: make([]uint64, 2*leaves-1)}
+	first := leaves - 1
+
+	s.mu.RLock()
+	for key, item := range s.items {
+		if !isExpired(item) {
+			t.nodes[first+KeyRange(key, depth)] ^= ItemHash(key, item)
+		}
+	}
+	s.mu.RUnlock()
+
+	for i := first - 1; i >= 0; i-- {
+		t.nodes[i] = hashChildren(t.nodes[2*i+1], t.nodes[2*i+2])
+	}
+	return t
+}
+
+// Empty subtrees hash to 0, like empty leaves.
+func hashChildren(left, right uint64) uint64 {
+	if left == 0 && right == 0 {
+		return 0
+	}
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], left)
+	binary.LittleEndian.PutUint64(buf[8:], right)
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return h.Sum64()
+}
+
+func (t *MerkleTree) Depth() int {
+	return t.depth
+}
+
+// Node returns the hash of node i, false if the tree has no such node.
+func (t *MerkleTree) Node(i int) (uint64, bool) {
+	if i < 0 || i >= len(t.nodes) {
+		return 0, false
+	}
+	return t.nodes[i], true
+}
+
+// Leaf returns the range node i covers, false for inner nodes.
+func (t *MerkleTree) Leaf(i int) (int, bool) {
+	first := len(t.nodes) / 2
+	if i < first || i >= len(t.nodes) {
+		return 0, false
+	}
+	return i - first, true
+}
+
+func (t *MerkleTree) Children(i int) (left, right int) {
+	return 2*i + 1, 2*i + 2
+}
+
+// RangeItems returns the live items and the tombstones in the given ranges
+// among 1<<depth, in key order, and the last version handed out when they
+// were read.
+func (s *Store) RangeItems(depth int, ranges []int) ([]Entry, []Tombstone, uint64) {
+	var (
+		entries    []Entry
+		tombstones []Tombstone
+	)
+	s.mu.RLock()
+	for key, item := range s.items {
+		if !isExpired(item) && slices.Contains(ranges, KeyRange(key, depth)) {
+			entries = append(entries, Entry{Key: key, Item: item})
+		}
+	}
+	for key, t := range s.tombstones {
+		if slices.Contains(ranges, KeyRange(key, depth)) {
+			tombstones = append(tombstones, Tombstone{Key: key, Timestamp: t.Timestamp, Origin: t.Origin})
+		}
+	}
+	version := s.version
+	s.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, tombstones, version
+}
+
+// Repair makes the given ranges match entries, the primary's items in them
+// as returned by RangeItems along with version. Keys this store has at a
+// higher version were written after the primary read its items and are
+// left alone. The changes are logged to the AOF. Returns how many keys
+// were changed.
+func (s *Store) Repair(depth int, ranges []int, entries []Entry, version uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var applied []persistance.AOFEntry
+	primary := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		primary[e.Key] = true
+		local, ok := s.items[e.Key]
+		if ok && !isExpired(local) {
+			if local.Version > e.Version {
+				continue
+			}
+			if local.Version == e.Version && ItemHash(e.Key, local) == ItemHash(e.Key, e.Item) {
+				continue
+			}
+		}
+		e.Version = s.loadVersion(e.Version)
+		s.storeItem(e.Key, e.Item)
+		applied = append(applied, setEntry(e.Key, e.Item))
+	}
+	for key, local := range s.items {
+		if primary[key] || isExpired(local) || local.Version > version || !slices.Contains(ranges, KeyRange(key, depth)) {
+			continue
+		}
+		s.dropItem(key)
+		applied = append(applied, persistance.AOFEntry{Op: "delete", Key: key})
+	}
+	s.appendBatch(applied)
+	return len(applied)
+}
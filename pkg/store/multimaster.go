@@ -0,0 +1,156 @@
+package store
+
+import (
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+// In multi-master mode every site takes writes and sends them to the
+// others, which keep whichever write to a key is the newest: the one with
+// the highest timestamp, or on a tie the highest origin. Deletes leave a
+// tombstone with their timestamp, so an older write that arrives late
+// can't bring the key back.
+
+// How long tombstones are kept by default. A site that is out of touch for
+// longer may bring deleted keys back.
+const DefaultTombstoneTTL = 24 * time.Hour
+
+type tombstone struct {
+	Timestamp hlc.Timestamp
+	Origin    string
+}
+
+// Tombstone is a deleted key, see Tombstones.
+type Tombstone struct {
+	Key       string
+	Timestamp hlc.Timestamp
+	Origin    string
+}
+
+// EnableMultiMaster makes every write carry a timestamp from clock and
+// origin, the ID of this site, and every delete leave a tombstone. The
+// clock is moved past the timestamps the store loaded. It must be called
+// before the store takes writes.
+func (s *Store) EnableMultiMaster(origin string, clock *hlc.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.items {
+		clock.Update(item.Timestamp)
+	}
+	for _, t := range s.tombstones {
+		clock.Update(t.Timestamp)
+	}
+	s.clock = clock
+	s.origin = origin
+}
+
+// Origin returns the ID of this site, "" outside of multi-master mode.
+func (s *Store) Origin() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.origin
+}
+
+// Sets how long tombstones are kept, non-positive values are ignored.
+func (s *Store) SetTombstoneTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	s.tombstoneTTL.Store(int64(ttl))
+}
+
+func (s *Store) TombstoneTTL() time.Duration {
+	return time.Duration(s.tombstoneTTL.Load())
+}
+
+func (s *Store) Tombstones() []Tombstone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tombstones := make([]Tombstone, 0, len(s.tombstones))
+	for key, t := range s.tombstones {
+		tombstones = append(tombstones, Tombstone{Key: key, Timestamp: t.Timestamp, Origin: t.Origin})
+	}
+	return tombstones
+}
+
+// Merge applies a write from another site where it is newer than what the
+// store has for the key, and logs the parts it applied to the AOF with
+// versions of this store. Writes without a timestamp, such as another
+// site's removal of an expired key, are ignored. Returns how many writes
+// were applied.
+func (s *Store) Merge(entry persistance.AOFEntry) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	applied := s.merge(entry, nil)
+	s.appendBatch(applied)
+	return len(applied)
+}
+
+// Must be called with the lock held.
+func (s *Store) merge(entry persistance.AOFEntry, applied []persistance.AOFEntry) []persistance.AOFEntry {
+	switch entry.Op {
+	case "batch":
+		for _, e := range entry.Entries {
+			applied = s.merge(e, applied)
+		}
+		return applied
+	case "set", "delete":
+	default:
+		return applied
+	}
+	if entry.Timestamp == 0 {
+		return applied
+	}
+	if s.clock != nil {
+		s.clock.Update(entry.Timestamp)
+	}
+	if !s.newer(entry.Key, entry.Timestamp, entry.Origin) {
+		return applied
+	}
+
+	if entry.Op == "delete" {
+		s.dropItem(entry.Key)
+		s.tombstones[entry.Key] = tombstone{Timestamp: entry.Timestamp, Origin: entry.Origin}
+		return append(applied, entry)
+	}
+	s.version++
+	item := Item{
+		Value:     entry.Value,
+		ExpiresAt: entry.ExpiresAt,
+		Version:   s.version,
+		Flags:     entry.Flags,
+		Timestamp: entry.Timestamp,
+		Origin:    entry.Origin,
+	}
+	s.storeItem(entry.Key, item)
+	return append(applied, setEntry(entry.Key, item))
+}
+
+// Whether a write with the given timestamp and origin wins over the last
+// write to key. Must be called with the lock held.
+func (s *Store) newer(key string, ts hlc.Timestamp, origin string) bool {
+	var current tombstone
+	if item, ok := s.items[key]; ok {
+		current = tombstone{Timestamp: item.Timestamp, Origin: item.Origin}
+	} else if t, ok := s.tombstones[key]; ok {
+		current = t
+	} else {
+		return true
+	}
+	if ts != current.Timestamp {
+		return ts > current.Timestamp
+	}
+	return origin > current.Origin
+}
+
+// Drops tombstones older than the TTL. Must be called with the lock held.
+func (s *Store) cleanTombstones() {
+	cutoff := time.Now().Add(-s.TombstoneTTL())
+	for key, t := range s.tombstones {
+		if t.Timestamp.Time().Before(cutoff) {
+			delete(s.tombstones, key)
+		}
+	}
+}
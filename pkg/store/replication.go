@@ -0,0 +1,97 @@
+package store
+
+import (
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+// Sets a function that is told about every write, as the AOF record for
+// it, in the order the writes are applied. It is called with the store
+// locked, so it must not block or call back into the store.
+func (s *Store) SetWriteObserver(fn func(entry persistance.AOFEntry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeObserver = fn
+}
+
+// Returns every live item. locked, if not nil, is called while no write
+// can happen, so a write observer can tell which writes the items already
+// include.
+func (s *Store) Export(locked func()) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(s.items))
+	for key, item := range s.items {
+		if !isExpired(item) {
+			entries = append(entries, Entry{Key: key, Item: item})
+		}
+	}
+	if locked != nil {
+		locked()
+	}
+	return entries
+}
+
+// Replaces every item with entries, keeping their versions, and takes a
+// snapshot of the result. Used by replicas for a full sync.
+func (s *Store) ReplaceAll(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A full sync replaces everything at once, it isn't reported key by key
+	observer := s.changeObserver
+	s.changeObserver = nil
+	defer func() { s.changeObserver = observer }()
+
+	s.items = make(map[string]Item, len(entries))
+	s.tombstones = make(map[string]tombstone)
+	s.dataBytes = 0
+	s.version = 0
+	for _, entry := range entries {
+		entry.Version = s.loadVersion(entry.Version)
+		s.storeItem(entry.Key, entry.Item)
+	}
+	if s.replaceObserver != nil {
+		s.replaceObserver()
+	}
+	return s.snapshot()
+}
+
+// Returns the last version handed out to an item.
+func (s *Store) LastVersion() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// Makes later writes get versions above version. After ReplaceAll, this
+// lets a copy hand out the same versions as the store it was taken from.
+func (s *Store) SetLastVersion(version uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = max(s.version, version)
+}
+
+// Applies a write received from the primary and logs it to the AOF. The
+// write keeps the primary's versions and isn't checked against the memory
+// limit, the primary replicates its evictions.
+func (s *Store) ApplyReplicated(entry persistance.AOFEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applyEntry(entry)
+	s.appendAOF(entry)
+}
+
+// Marks the store as a replica of the primary at addr, an empty addr makes
+// it a primary again. The protocol servers reject writes to a replica.
+func (s *Store) SetPrimary(addr string) {
+	s.primary.Store(&addr)
+}
+
+// Returns the address of the primary, or "" if this store is the primary.
+func (s *Store) Primary() string {
+	if addr := s.primary.Load(); addr != nil {
+		return *addr
+	}
+	return ""
+}
@@ -1,11 +1,17 @@
 package store
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
 	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/util"
 )
@@ -13,6 +19,14 @@ import (
 type Item struct {
 	Value     string
 	ExpiresAt time.Time
+	// Changes on every write to the key, used for compare-and-set
+	Version uint64
+	// Opaque to the store, memcached clients use them to tag value encodings
+	Flags uint32
+	// When and where the key was last written, in multi-master mode. Unlike
+	// versions, they are the same on every site.
+	Timestamp hlc.Timestamp
+	Origin    string
 }
 
 type Store struct {
@@ -22,6 +36,50 @@ type Store struct {
 	snapshotDir         string
 	aofPersistance      AOFPersistance
 	snapshotPersistance SnapshotPersistance
+
+	// Last version handed out to an item
+	version uint64
+	// Size of all keys and values in items, including expired ones that
+	// haven't been cleaned up yet
+	dataBytes int64
+
+	// Background task intervals, a send on the channel makes the task pick
+	// up a new interval right away
+	snapshotInterval        atomic.Int64
+	snapshotIntervalChanged chan struct{}
+	expiryInterval          atomic.Int64
+	expiryIntervalChanged   chan struct{}
+	maxMemory               atomic.Int64
+	// Told about every write, see SetWriteObserver
+	writeObserver func(entry persistance.AOFEntry)
+	// Told about every change to a key, see SetChangeObserver
+	changeObserver func(change Change)
+	// Told when ReplaceAll swaps in new data, see SetReplaceObserver
+	replaceObserver func()
+	// Address of the primary when this store is a replica
+	primary atomic.Pointer[string]
+
+	// Set by EnableMultiMaster
+	clock  *hlc.Clock
+	origin string
+	// Deleted keys, by when and where they were deleted
+	tombstones   map[string]tombstone
+	tombstoneTTL atomic.Int64
+
+	// Stops the tasks started by InitBackgroundTasks, nil before that
+	cancelTasks context.CancelFunc
+	tasks       sync.WaitGroup
+
+	readOnly             atomic.Bool
+	defaultTTL           atomic.Int64
+	lastSnapshot         time.Time
+	lastSnapshotError    error
+	lastSnapshotDuration time.Duration
+	lastAOFRewrite       time.Time
+
+	expiredKeys    atomic.Uint64
+	evictedKeys    atomic.Uint64
+	aofWriteErrors atomic.Uint64
 }
 
 type AOFPersistance interface {
@@ -48,12 +106,18 @@ func New(aofPath string, snapshotPath string) (*Store, error) {
 		return nil, err
 	}
 	store := Store{
-		items:               make(map[string]Item),
-		aofFile:             aofFile,
-		snapshotDir:         snapshotDir,
-		aofPersistance:      persistance.NewAOFPersistance(),
-		snapshotPersistance: persistance.NewSnapshotPersistance(),
+		items:                   make(map[string]Item),
+		tombstones:              make(map[string]tombstone),
+		aofFile:                 aofFile,
+		snapshotDir:             snapshotDir,
+		aofPersistance:          persistance.NewAOFPersistance(),
+		snapshotPersistance:     persistance.NewSnapshotPersistance(),
+		snapshotIntervalChanged: make(chan struct{}, 1),
+		expiryIntervalChanged:   make(chan struct{}, 1),
 	}
+	store.snapshotInterval.Store(int64(DefaultSnapshotInterval))
+	store.expiryInterval.Store(int64(DefaultExpiryInterval))
+	store.tombstoneTTL.Store(int64(DefaultTombstoneTTL))
 
 	// Load the content of the snapshot file into memory
 	if err = store.LoadSnapshot(); err != nil {
@@ -68,77 +132,356 @@ func New(aofPath string, snapshotPath string) (*Store, error) {
 	return &store, nil
 }
 
+type SetCondition int
+
+const (
+	// Always write the value
+	SetAlways SetCondition = iota
+	// Only write if the key doesn't exist yet (NX)
+	SetIfAbsent
+	// Only write if the key already exists (XX)
+	SetIfPresent
+)
+
+type SetOptions struct {
+	// Zero means that the key never expires, see DefaultExpiry for the
+	// default TTL
+	ExpiresAt time.Time
+	// Keep the expiry of an existing key instead of using ExpiresAt
+	KeepTTL   bool
+	Condition SetCondition
+	// Only write if the key exists with this version, zero disables the check
+	IfVersion uint64
+	Flags     uint32
+}
+
 func (s *Store) Set(key string, value string, ttlSeconds uint64, override bool) {
 	var expiresAt time.Time
 	if ttlSeconds > 0 {
 		expiresAt = time.Now().Add(time.Duration(ttlSeconds) * time.Second)
 	}
 
+	condition := SetAlways
 	if !override {
-		_, exists := s.Get(key)
-		if exists {
-			// If the item already exists, don't override it
-			return
-		}
+		// If the item already exists, don't override it
+		condition = SetIfAbsent
 	}
 
+	s.SetWithOptions(key, value, SetOptions{
+		ExpiresAt: expiresAt,
+		Condition: condition,
+	})
+}
+
+// Writes the value if the condition holds. Returns the stored item and true
+// on success, or the current item (if any) and false otherwise.
+func (s *Store) SetWithOptions(key string, value string, opts SetOptions) (Item, bool) {
 	s.mu.Lock()
-	s.items[key] = Item{
+	defer s.mu.Unlock()
+
+	current, exists := s.liveItem(key)
+	if (opts.Condition == SetIfAbsent && exists) || (opts.Condition == SetIfPresent && !exists) {
+		return current, false
+	}
+	if opts.IfVersion != 0 && (!exists || current.Version != opts.IfVersion) {
+		return current, false
+	}
+
+	item := Item{
 		Value:     value,
-		ExpiresAt: expiresAt,
+		ExpiresAt: opts.ExpiresAt,
+		Flags:     opts.Flags,
 	}
-	s.mu.Unlock()
+	if opts.KeepTTL && exists {
+		item.ExpiresAt = current.ExpiresAt
+	}
+	return s.put(key, item), true
+}
 
-	if s.aofPersistance != nil {
+// Sets the TTL of writes that don't set an expiry themselves, see
+// DefaultExpiry. Zero, the default, means that such keys never expire.
+func (s *Store) SetDefaultTTL(ttl time.Duration) {
+	s.defaultTTL.Store(int64(ttl))
+}
 
-		// Retry if writing to the AOF file fails
-		for range 5 {
-			err := s.aofPersistance.AOFAppend(s.aofFile, persistance.AOFEntry{
-				Op:        "set",
-				Key:       key,
-				Value:     value,
-				ExpiresAt: expiresAt,
-			})
-			if err == nil {
-				break
-			}
-		}
+func (s *Store) DefaultTTL() time.Duration {
+	return time.Duration(s.defaultTTL.Load())
+}
+
+// Expiry for a write made at now that doesn't set one, or zero without a
+// default TTL. The store doesn't apply it by itself, as some protocols have
+// their own way of asking for no expiry: it is up to the API layer to use it
+// for clients that leave the TTL out.
+func (s *Store) DefaultExpiry(now time.Time) time.Time {
+	ttl := s.DefaultTTL()
+	if ttl <= 0 {
+		return time.Time{}
 	}
+	return now.Add(ttl)
 }
 
 func (s *Store) Get(key string) (string, bool) {
+	item, ok := s.GetItem(key)
+	return item.Value, ok
+}
+
+// Like Get, but also returns the expiry of the key.
+func (s *Store) GetItem(key string) (Item, bool) {
 	s.mu.RLock()
 	item, ok := s.items[key]
 	s.mu.RUnlock()
 
 	if !ok {
-		return "", false
+		return Item{}, false
 	}
-	if !item.ExpiresAt.IsZero() && item.ExpiresAt.Before(time.Now()) {
+	if isExpired(item) {
 		s.Delete(key)
-		return "", false
+		return Item{}, false
+	}
+	return item, true
+}
+
+// Deletes the key and reports whether it existed.
+func (s *Store) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return false
 	}
-	return item.Value, true
+	s.remove(key)
+	return !isExpired(item)
 }
 
-func (s *Store) Delete(key string) {
+// Deletes the key only if its current version matches. Returns the current
+// item when it doesn't.
+func (s *Store) DeleteIfVersion(key string, version uint64) (Item, bool) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.liveItem(key)
+	if !exists || item.Version != version {
+		return item, false
+	}
+	s.remove(key)
+	return item, true
+}
+
+// Changes the expiry of an existing key, a time in the past deletes it.
+// A zero expiresAt removes the expiry. Reports whether the key existed.
+func (s *Store) Expire(key string, expiresAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.liveItem(key)
+	if !exists {
+		return false
+	}
+
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		s.remove(key)
+		return true
+	}
+
+	item.ExpiresAt = expiresAt
+	s.put(key, item)
+	return true
+}
+
+// Removes the expiry of a key. Reports whether the key had one.
+func (s *Store) Persist(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.liveItem(key)
+	if !exists || item.ExpiresAt.IsZero() {
+		return false
+	}
+
+	item.ExpiresAt = time.Time{}
+	s.put(key, item)
+	return true
+}
+
+// Writes the item to memory and the AOF under a new version, evicting
+// other keys if it takes the store over the memory limit.
+// Must be called with the lock held.
+func (s *Store) put(key string, item Item) Item {
+	item, entry := s.setItem(key, item)
+	s.appendBatch(append([]persistance.AOFEntry{entry}, s.evict(key)...))
+	return item
+}
+
+// Like put, but leaves writing the returned AOF entry to the caller.
+// Must be called with the lock held.
+func (s *Store) setItem(key string, item Item) (Item, persistance.AOFEntry) {
+	s.version++
+	item.Version = s.version
+	if s.clock != nil {
+		item.Timestamp = s.clock.Now()
+		item.Origin = s.origin
+	}
+	s.storeItem(key, item)
+	return item, setEntry(key, item)
+}
+
+func setEntry(key string, item Item) persistance.AOFEntry {
+	return persistance.AOFEntry{
+		Op:        "set",
+		Key:       key,
+		Value:     item.Value,
+		ExpiresAt: item.ExpiresAt,
+		Version:   item.Version,
+		Flags:     item.Flags,
+		Timestamp: item.Timestamp,
+		Origin:    item.Origin,
+	}
+}
+
+// Used when loading persisted items, which may predate versions.
+// Must be called with the lock held.
+func (s *Store) loadVersion(version uint64) uint64 {
+	if version == 0 {
+		s.version++
+		return s.version
+	}
+	s.version = max(s.version, version)
+	return version
+}
+
+// Must be called with the lock held.
+func (s *Store) remove(key string) {
+	s.appendAOF(s.deleteItem(key))
+}
+
+// Like remove, but leaves writing the returned AOF entry to the caller.
+// Must be called with the lock held.
+func (s *Store) deleteItem(key string) persistance.AOFEntry {
+	item, ok := s.items[key]
+	s.dropItem(key)
+	entry := persistance.AOFEntry{
+		Op:  "delete",
+		Key: key,
+	}
+	// Expired keys are removed by every site on its own, only deletes
+	// leave a tombstone
+	if s.clock != nil && ok && !isExpired(item) {
+		entry.Timestamp = s.clock.Now()
+		entry.Origin = s.origin
+		s.tombstones[key] = tombstone{Timestamp: entry.Timestamp, Origin: entry.Origin}
+	}
+	return entry
+}
+
+// Writes to the map and keeps dataBytes up to date, without versioning or
+// persisting anything. Must be called with the lock held.
+func (s *Store) storeItem(key string, item Item) {
+	old, ok := s.items[key]
+	if ok {
+		s.dataBytes -= itemSize(key, old)
+	}
+	s.items[key] = item
+	s.dataBytes += itemSize(key, item)
+	delete(s.tombstones, key)
+
+	var oldItem *Item
+	if ok && !isExpired(old) {
+		oldItem = &old
+	}
+	s.notifyChange(ChangeSet, key, oldItem, &item)
+}
+
+// Must be called with the lock held.
+func (s *Store) dropItem(key string) {
+	s.removeItem(key, ChangeDelete)
+}
+
+// Like dropItem, but reports the change as op unless the key had expired.
+// Must be called with the lock held.
+func (s *Store) removeItem(key string, op string) {
+	old, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.dataBytes -= itemSize(key, old)
 	delete(s.items, key)
-	s.mu.Unlock()
+	if isExpired(old) {
+		op = ChangeExpire
+	}
+	s.notifyChange(op, key, &old, nil)
+}
 
-	if s.aofPersistance != nil {
+func itemSize(key string, item Item) int64 {
+	return int64(len(key) + len(item.Value))
+}
+
+type Entry struct {
+	Key string
+	Item
+}
 
-		// Retry if writing to the AOF file fails
-		for range 5 {
-			err := s.aofPersistance.AOFAppend(s.aofFile, persistance.AOFEntry{
-				Op:  "delete",
-				Key: key,
-			})
-			if err == nil {
-				break
-			}
+// Returns up to limit live keys that start with prefix and sort after the
+// given key, in key order, and whether more keys follow.
+func (s *Store) Scan(prefix string, after string, limit int) ([]Entry, bool) {
+	s.mu.RLock()
+	entries := make([]Entry, 0)
+	for k, v := range s.items {
+		if k <= after || !strings.HasPrefix(k, prefix) || isExpired(v) {
+			continue
 		}
+		entries = append(entries, Entry{Key: k, Item: v})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	if limit > 0 && len(entries) > limit {
+		return entries[:limit], true
+	}
+	return entries, false
+}
+
+// Must be called with the lock held.
+func (s *Store) liveItem(key string) (Item, bool) {
+	item, ok := s.items[key]
+	if !ok || isExpired(item) {
+		return Item{}, false
 	}
+	return item, true
+}
+
+func isExpired(item Item) bool {
+	return !item.ExpiresAt.IsZero() && item.ExpiresAt.Before(time.Now())
+}
+
+// Must be called with the lock held, so that the AOF sees writes in the same
+// order as the map.
+func (s *Store) appendAOF(entry persistance.AOFEntry) {
+	if s.writeObserver != nil {
+		s.writeObserver(entry)
+	}
+	if s.aofPersistance == nil {
+		return
+	}
+
+	// Retry if writing to the AOF file fails
+	const attempts = 5
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err := s.aofPersistance.AOFAppend(s.aofFile, entry)
+		if err == nil {
+			return
+		}
+		if attempt < attempts {
+			slog.Warn("AOF write failed, retrying", "op", entry.Op, "key", entry.Key, "attempt", attempt, "error", err)
+			continue
+		}
+		// The write is already in memory, so it only survives a restart
+		// if a snapshot is taken before then
+		slog.Error("AOF write failed, giving up", "op", entry.Op, "key", entry.Key, "attempts", attempts, "error", err)
+	}
+	s.aofWriteErrors.Add(1)
 }
 
 func (s *Store) loadAOF() error {
@@ -149,26 +492,79 @@ func (s *Store) loadAOF() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, entry := range entries {
-		switch entry.Op {
-		case "set":
-			s.items[entry.Key] = Item{
-				Value:     entry.Value,
-				ExpiresAt: entry.ExpiresAt,
-			}
-		case "delete":
-			delete(s.items, entry.Key)
-		}
+		s.applyEntry(entry)
 	}
 	return nil
 }
 
+// Applies a record from the AOF or a primary to memory, keeping its
+// version. Must be called with the lock held.
+func (s *Store) applyEntry(entry persistance.AOFEntry) {
+	switch entry.Op {
+	case "set":
+		s.storeItem(entry.Key, Item{
+			Value:     entry.Value,
+			ExpiresAt: entry.ExpiresAt,
+			Version:   s.loadVersion(entry.Version),
+			Flags:     entry.Flags,
+			Timestamp: entry.Timestamp,
+			Origin:    entry.Origin,
+		})
+	case "delete":
+		s.dropItem(entry.Key)
+		if entry.Timestamp != 0 {
+			s.tombstones[entry.Key] = tombstone{Timestamp: entry.Timestamp, Origin: entry.Origin}
+		}
+	case "batch":
+		for _, e := range entry.Entries {
+			s.applyEntry(e)
+		}
+	}
+}
+
+// Writes every item to a snapshot and clears the AOF. The lock is held
+// throughout, so no write can land in the AOF between the two and get lost.
 func (s *Store) SaveSnapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// Like SaveSnapshot, but must be called with the lock held.
+func (s *Store) snapshot() error {
+	start := time.Now()
+	err := s.saveSnapshot()
+	s.lastSnapshot = time.Now()
+	s.lastSnapshotError = err
+	s.lastSnapshotDuration = s.lastSnapshot.Sub(start)
+	if err != nil {
+		slog.Error("snapshot failed", "dir", s.snapshotDir, "error", err)
+	} else {
+		slog.Debug("snapshot saved", "dir", s.snapshotDir, "keys", len(s.items), "duration", s.lastSnapshotDuration)
+	}
+	return err
+}
+
+// Must be called with the lock held.
+func (s *Store) saveSnapshot() error {
 	entries := make([]persistance.SnapshotEntry, 0, len(s.items))
 	for k, v := range s.items {
 		entries = append(entries, persistance.SnapshotEntry{
 			Key:       k,
 			Value:     v.Value,
 			ExpiresAt: v.ExpiresAt,
+			Version:   v.Version,
+			Flags:     v.Flags,
+			Timestamp: v.Timestamp,
+			Origin:    v.Origin,
+		})
+	}
+	for k, t := range s.tombstones {
+		entries = append(entries, persistance.SnapshotEntry{
+			Key:       k,
+			Timestamp: t.Timestamp,
+			Origin:    t.Origin,
+			Deleted:   true,
 		})
 	}
 
@@ -195,52 +591,147 @@ func (s *Store) LoadSnapshot() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, entry := range entries {
+		if entry.Deleted {
+			s.tombstones[entry.Key] = tombstone{Timestamp: entry.Timestamp, Origin: entry.Origin}
+			continue
+		}
 		if !entry.ExpiresAt.IsZero() && entry.ExpiresAt.Before(time.Now()) {
 			continue
 		}
 
-		s.items[entry.Key] = Item{
+		s.storeItem(entry.Key, Item{
 			Value:     entry.Value,
 			ExpiresAt: entry.ExpiresAt,
-		}
+			Version:   s.loadVersion(entry.Version),
+			Flags:     entry.Flags,
+			Timestamp: entry.Timestamp,
+			Origin:    entry.Origin,
+		})
 	}
 	return nil
 }
 
-func (s *Store) SaveSnapshotRegularly() {
+const (
+	DefaultSnapshotInterval = 30 * time.Second
+	DefaultExpiryInterval   = time.Second
+)
+
+// Sets how often snapshots are taken, zero disables periodic snapshots.
+// Takes effect right away, also for a background task that is waiting.
+func (s *Store) SetSnapshotInterval(interval time.Duration) {
+	s.snapshotInterval.Store(int64(interval))
+	notify(s.snapshotIntervalChanged)
+}
+
+func (s *Store) SnapshotInterval() time.Duration {
+	return time.Duration(s.snapshotInterval.Load())
+}
+
+// Sets how often expired keys are cleaned up. Non-positive intervals are
+// ignored, expired keys have to be removed at some point.
+func (s *Store) SetExpiryInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.expiryInterval.Store(int64(interval))
+	notify(s.expiryIntervalChanged)
+}
+
+func (s *Store) ExpiryInterval() time.Duration {
+	return time.Duration(s.expiryInterval.Load())
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Returns a channel that fires after interval, or never for a zero interval.
+func after(interval time.Duration) <-chan time.Time {
+	if interval <= 0 {
+		return nil
+	}
+	return time.After(interval)
+}
+
+// Takes a snapshot every SnapshotInterval until ctx is done.
+func (s *Store) SaveSnapshotRegularly(ctx context.Context) {
 	for {
-		time.Sleep(30 * time.Second)
-		if err := s.SaveSnapshot(); err != nil {
-			fmt.Println("Error saving snapshot:", err)
+		select {
+		case <-after(s.SnapshotInterval()):
+			// SaveSnapshot logs failures itself
+			s.SaveSnapshot()
+		case <-s.snapshotIntervalChanged:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-func (s *Store) CleanExpiredItems() {
+// Removes expired keys every ExpiryInterval until ctx is done.
+func (s *Store) CleanExpiredItems(ctx context.Context) {
 	for {
-		time.Sleep(1 * time.Second)
-		s.mu.Lock()
-		for k, v := range s.items {
-			if !v.ExpiresAt.IsZero() && v.ExpiresAt.Before(time.Now()) {
-				delete(s.items, k)
-			}
+		select {
+		case <-after(s.ExpiryInterval()):
+			s.cleanExpiredItems()
+		case <-s.expiryIntervalChanged:
+		case <-ctx.Done():
+			return
 		}
-		s.mu.Unlock()
 	}
 }
 
-func (s *Store) InitBackgroundTasks() {
-	go s.SaveSnapshotRegularly()
-	go s.CleanExpiredItems()
+func (s *Store) cleanExpiredItems() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.items {
+		if isExpired(v) {
+			s.dropItem(k)
+			s.expiredKeys.Add(1)
+		}
+	}
+	s.cleanTombstones()
 }
 
+// Starts the snapshot and expiry tasks. They run until ctx is done or the
+// store is closed.
+func (s *Store) InitBackgroundTasks(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancelTasks = cancel
+	s.mu.Unlock()
+
+	s.tasks.Add(2)
+	go func() {
+		defer s.tasks.Done()
+		s.SaveSnapshotRegularly(ctx)
+	}()
+	go func() {
+		defer s.tasks.Done()
+		s.CleanExpiredItems(ctx)
+	}()
+}
+
+// Stops the background tasks and waits for them, then flushes the AOF to
+// disk and closes it. Writes after Close aren't persisted.
 func (s *Store) Close() error {
+	s.mu.Lock()
+	cancel := s.cancelTasks
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	// A task may be waiting for the lock, so this can't hold it
+	s.tasks.Wait()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.aofFile != nil {
-		err := s.aofFile.Close()
-		s.aofFile = nil
-		return err
+	if s.aofFile == nil {
+		return nil
 	}
-	return nil
+	err := errors.Join(s.aofFile.Sync(), s.aofFile.Close())
+	s.aofFile = nil
+	return err
 }
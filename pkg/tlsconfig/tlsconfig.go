@@ -0,0 +1,222 @@
+// Package tlsconfig builds the TLS configurations used by the gRPC server
+// and client. Server certificates and the client CA bundle are reloaded
+// from disk when the files change, so they can be rotated without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// When set, clients must present a certificate signed by one of these CAs
+	ClientCAFile string
+}
+
+type ClientOptions struct {
+	// Verifies the server against this bundle instead of the system roots
+	CAFile string
+	// Optional client certificate for servers that require mTLS
+	CertFile string
+	KeyFile  string
+	// Overrides the name checked against the server certificate
+	ServerName string
+}
+
+// Server returns a TLS configuration that picks up new certificate and CA
+// files on the next handshake after they are replaced. A file that fails
+// to load keeps the previous version in use.
+func Server(opts ServerOptions) (*tls.Config, error) {
+	r, err := NewReloader(opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.Config(), nil
+}
+
+// Reloader holds the server certificates behind a configuration returned by
+// Config. Besides picking up changed files, it can be pointed at different
+// files with Update.
+type Reloader struct {
+	// Held while loading files, so a reload can't overwrite an Update
+	loadMu sync.Mutex
+
+	mu       sync.RWMutex
+	opts     ServerOptions
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes []time.Time
+}
+
+func NewReloader(opts ServerOptions) (*Reloader, error) {
+	r := &Reloader{}
+	if err := r.Update(opts); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update loads the files in opts and uses them for new connections. On
+// error the previous files stay in use.
+func (r *Reloader) Update(opts ServerOptions) error {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return errors.New("both a certificate and a key file are required")
+	}
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	return r.load(opts)
+}
+
+// Config returns a TLS configuration serving the current certificates.
+func (r *Reloader) Config() *tls.Config {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+			cert, pool := r.current()
+
+			config := base.Clone()
+			config.Certificates = []tls.Certificate{*cert}
+			if pool != nil {
+				config.ClientCAs = pool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
+	}
+}
+
+// Client returns a TLS configuration for dialing the server.
+func Client(opts ClientOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+
+	if opts.CAFile != "" {
+		pool, err := loadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("a client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (opts ServerOptions) files() []string {
+	files := []string{opts.CertFile, opts.KeyFile}
+	if opts.ClientCAFile != "" {
+		files = append(files, opts.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+func (r *Reloader) load(opts ServerOptions) error {
+	modTimes, err := statFiles(opts.files())
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading server certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if opts.ClientCAFile != "" {
+		if pool, err = loadCertPool(opts.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.opts = opts
+	r.cert = &cert
+	r.pool = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+// Reloads the files if any of them changed since they were last loaded.
+// A stat per handshake is cheap next to the handshake itself.
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	opts, loaded := r.opts, r.modTimes
+	r.mu.RUnlock()
+
+	modTimes, err := statFiles(opts.files())
+	if err != nil {
+		return
+	}
+	for i := range modTimes {
+		if !modTimes[i].Equal(loaded[i]) {
+			r.reload()
+			return
+		}
+	}
+}
+
+func (r *Reloader) reload() {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	// Update may have switched files since maybeReload looked
+	r.mu.RLock()
+	opts := r.opts
+	r.mu.RUnlock()
+	if err := r.load(opts); err != nil {
+		slog.Error("failed to reload TLS certificates", "error", err)
+	} else {
+		slog.Info("reloaded TLS certificates", "cert", opts.CertFile)
+	}
+}
+
+func statFiles(files []string) ([]time.Time, error) {
+	modTimes := make([]time.Time, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,227 @@
+// Package tracking remembers which keys clients keep in a local cache, so
+// they can be told when those keys change. A client subscribes to a Table,
+// sends its ID along with its reads, and gets each key it read once on its
+// subscription the next time the key changes. After that the key has to be
+// read again to be tracked again.
+package tracking
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+)
+
+const (
+	DefaultMaxKeys = 1000000
+	// Invalidations a client can fall behind by before it is dropped
+	DefaultBacklog = 10000
+)
+
+var ErrTooSlow = errors.New("client fell too far behind on invalidations")
+
+// Message tells a client to drop a key from its cache, or every key when
+// All is set.
+type Message struct {
+	Key string
+	All bool
+}
+
+// Table tracks which subscriptions read which keys. The number of keys it
+// tracks is bounded: once it is full, tracking a new key invalidates an
+// arbitrary one to make room.
+type Table struct {
+	maxKeys int
+
+	mu   sync.Mutex
+	subs map[uint64]*Subscription
+	keys map[string]map[*Subscription]struct{}
+
+	invalidations atomic.Uint64
+	dropped       atomic.Uint64
+}
+
+// NewTable returns a table that tracks up to maxKeys keys.
+func NewTable(maxKeys int) *Table {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Table{
+		maxKeys: maxKeys,
+		subs:    make(map[uint64]*Subscription),
+		keys:    make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a subscription with a new, random ID.
+func (t *Table) Subscribe() *Subscription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sub := &Subscription{
+		messages: make(chan Message, DefaultBacklog),
+		keys:     make(map[string]struct{}),
+	}
+	// The ID is all a read needs to be tracked for a client, so it
+	// shouldn't be guessable
+	for sub.ID == 0 || t.subs[sub.ID] != nil {
+		var b [8]byte
+		rand.Read(b[:])
+		sub.ID = binary.LittleEndian.Uint64(b[:])
+	}
+	t.subs[sub.ID] = sub
+	return sub
+}
+
+func (t *Table) Unsubscribe(sub *Subscription) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(sub)
+}
+
+// Must be called with the lock held.
+func (t *Table) remove(sub *Subscription) {
+	if t.subs[sub.ID] != sub {
+		return
+	}
+	for key := range sub.keys {
+		t.untrack(key, sub)
+	}
+	delete(t.subs, sub.ID)
+	close(sub.messages)
+}
+
+// Must be called with the lock held.
+func (t *Table) untrack(key string, sub *Subscription) {
+	subs := t.keys[key]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(t.keys, key)
+	}
+}
+
+// Track tells the subscription with the given ID about the next change to
+// key. Call it before reading the key, so a change made right after the
+// read isn't missed. It returns false if there is no such subscription.
+func (t *Table) Track(id uint64, key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sub := t.subs[id]
+	if sub == nil {
+		return false
+	}
+	subs, ok := t.keys[key]
+	if !ok {
+		if len(t.keys) >= t.maxKeys {
+			for other := range t.keys {
+				t.invalidate(other)
+				break
+			}
+		}
+		subs = make(map[*Subscription]struct{})
+		t.keys[key] = subs
+	}
+	subs[sub] = struct{}{}
+	sub.keys[key] = struct{}{}
+	return true
+}
+
+// Invalidate tells the subscriptions tracking key that it changed.
+func (t *Table) Invalidate(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.invalidate(key)
+}
+
+// Must be called with the lock held.
+func (t *Table) invalidate(key string) {
+	subs, ok := t.keys[key]
+	if !ok {
+		return
+	}
+	delete(t.keys, key)
+	for sub := range subs {
+		delete(sub.keys, key)
+		t.send(sub, Message{Key: key})
+	}
+}
+
+// InvalidateAll tells every subscription that all keys may have changed,
+// for when the store's data is replaced as a whole.
+func (t *Table) InvalidateAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.keys = make(map[string]map[*Subscription]struct{})
+	for _, sub := range t.subs {
+		clear(sub.keys)
+		t.send(sub, Message{All: true})
+	}
+}
+
+// Observe invalidates the key of a change. It is meant to be the store's
+// change observer and never blocks.
+func (t *Table) Observe(change store.Change) {
+	t.Invalidate(change.Key)
+}
+
+// Must be called with the lock held. A subscription that can't keep up is
+// dropped, its client no longer knows which of its keys are current.
+func (t *Table) send(sub *Subscription, msg Message) {
+	select {
+	case sub.messages <- msg:
+		t.invalidations.Add(1)
+	default:
+		sub.tooSlow.Store(true)
+		t.dropped.Add(1)
+		t.remove(sub)
+	}
+}
+
+type Stats struct {
+	Subscriptions int
+	Keys          int
+	// Invalidations sent
+	Invalidations uint64
+	// Subscriptions dropped for falling behind
+	Dropped uint64
+}
+
+func (t *Table) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Stats{
+		Subscriptions: len(t.subs),
+		Keys:          len(t.keys),
+		Invalidations: t.invalidations.Load(),
+		Dropped:       t.dropped.Load(),
+	}
+}
+
+type Subscription struct {
+	// Sent by the client with the reads to track
+	ID uint64
+
+	messages chan Message
+	// Keys tracked for this subscription, guarded by the table's lock
+	keys    map[string]struct{}
+	tooSlow atomic.Bool
+}
+
+// Messages returns the invalidations. The channel is closed when the
+// subscription ends, see Err.
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Err returns ErrTooSlow if the table dropped the subscription.
+func (s *Subscription) Err() error {
+	if s.tooSlow.Load() {
+		return ErrTooSlow
+	}
+	return nil
+}
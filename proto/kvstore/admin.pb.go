@@ -0,0 +1,780 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.31.1
+// source: proto/admin.proto
+
+package kvstore
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SnapshotRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotRequest) Reset() {
+	*x = SnapshotRequest{}
+	mi := &file_proto_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotRequest) ProtoMessage() {}
+
+func (x *SnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotRequest.ProtoReflect.Descriptor instead.
+func (*SnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{0}
+}
+
+type SnapshotResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotResponse) Reset() {
+	*x = SnapshotResponse{}
+	mi := &file_proto_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotResponse) ProtoMessage() {}
+
+func (x *SnapshotResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotResponse.ProtoReflect.Descriptor instead.
+func (*SnapshotResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{1}
+}
+
+type RewriteAOFRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RewriteAOFRequest) Reset() {
+	*x = RewriteAOFRequest{}
+	mi := &file_proto_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RewriteAOFRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RewriteAOFRequest) ProtoMessage() {}
+
+func (x *RewriteAOFRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RewriteAOFRequest.ProtoReflect.Descriptor instead.
+func (*RewriteAOFRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{2}
+}
+
+type RewriteAOFResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       int64                  `protobuf:"varint,1,opt,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RewriteAOFResponse) Reset() {
+	*x = RewriteAOFResponse{}
+	mi := &file_proto_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RewriteAOFResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RewriteAOFResponse) ProtoMessage() {}
+
+func (x *RewriteAOFResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RewriteAOFResponse.ProtoReflect.Descriptor instead.
+func (*RewriteAOFResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RewriteAOFResponse) GetRecords() int64 {
+	if x != nil {
+		return x.Records
+	}
+	return 0
+}
+
+type FlushRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Deletes every key starting with prefix
+	Prefix string `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// Must be set to flush the whole store, an empty prefix alone is rejected
+	All           bool `protobuf:"varint,2,opt,name=all,proto3" json:"all,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlushRequest) Reset() {
+	*x = FlushRequest{}
+	mi := &file_proto_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlushRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlushRequest) ProtoMessage() {}
+
+func (x *FlushRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlushRequest.ProtoReflect.Descriptor instead.
+func (*FlushRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FlushRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *FlushRequest) GetAll() bool {
+	if x != nil {
+		return x.All
+	}
+	return false
+}
+
+type FlushResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deleted       int64                  `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlushResponse) Reset() {
+	*x = FlushResponse{}
+	mi := &file_proto_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlushResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlushResponse) ProtoMessage() {}
+
+func (x *FlushResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlushResponse.ProtoReflect.Descriptor instead.
+func (*FlushResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FlushResponse) GetDeleted() int64 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+type InfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InfoRequest) Reset() {
+	*x = InfoRequest{}
+	mi := &file_proto_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InfoRequest) ProtoMessage() {}
+
+func (x *InfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InfoRequest.ProtoReflect.Descriptor instead.
+func (*InfoRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{6}
+}
+
+type InfoResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	UptimeSeconds  int64                  `protobuf:"varint,1,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	Keys           int64                  `protobuf:"varint,2,opt,name=keys,proto3" json:"keys,omitempty"`
+	KeysWithExpiry int64                  `protobuf:"varint,3,opt,name=keys_with_expiry,json=keysWithExpiry,proto3" json:"keys_with_expiry,omitempty"`
+	// Bytes taken up by keys and values
+	DataBytes int64 `protobuf:"varint,4,opt,name=data_bytes,json=dataBytes,proto3" json:"data_bytes,omitempty"`
+	// Go runtime memory obtained from the OS and currently allocated on the heap
+	MemorySysBytes       uint64 `protobuf:"varint,5,opt,name=memory_sys_bytes,json=memorySysBytes,proto3" json:"memory_sys_bytes,omitempty"`
+	MemoryHeapAllocBytes uint64 `protobuf:"varint,6,opt,name=memory_heap_alloc_bytes,json=memoryHeapAllocBytes,proto3" json:"memory_heap_alloc_bytes,omitempty"`
+	ReadOnly             bool   `protobuf:"varint,7,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	AofPath              string `protobuf:"bytes,8,opt,name=aof_path,json=aofPath,proto3" json:"aof_path,omitempty"`
+	AofSizeBytes         int64  `protobuf:"varint,9,opt,name=aof_size_bytes,json=aofSizeBytes,proto3" json:"aof_size_bytes,omitempty"`
+	SnapshotDir          string `protobuf:"bytes,10,opt,name=snapshot_dir,json=snapshotDir,proto3" json:"snapshot_dir,omitempty"`
+	// Unix seconds, 0 if it never happened since startup
+	LastSnapshotUnix   int64  `protobuf:"varint,11,opt,name=last_snapshot_unix,json=lastSnapshotUnix,proto3" json:"last_snapshot_unix,omitempty"`
+	LastSnapshotError  string `protobuf:"bytes,12,opt,name=last_snapshot_error,json=lastSnapshotError,proto3" json:"last_snapshot_error,omitempty"`
+	LastAofRewriteUnix int64  `protobuf:"varint,13,opt,name=last_aof_rewrite_unix,json=lastAofRewriteUnix,proto3" json:"last_aof_rewrite_unix,omitempty"`
+	// Limit on data_bytes, 0 if there is none
+	MaxMemoryBytes int64 `protobuf:"varint,14,opt,name=max_memory_bytes,json=maxMemoryBytes,proto3" json:"max_memory_bytes,omitempty"`
+	// Totals since startup
+	ExpiredKeys   uint64 `protobuf:"varint,15,opt,name=expired_keys,json=expiredKeys,proto3" json:"expired_keys,omitempty"`
+	EvictedKeys   uint64 `protobuf:"varint,16,opt,name=evicted_keys,json=evictedKeys,proto3" json:"evicted_keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InfoResponse) Reset() {
+	*x = InfoResponse{}
+	mi := &file_proto_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InfoResponse) ProtoMessage() {}
+
+func (x *InfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InfoResponse.ProtoReflect.Descriptor instead.
+func (*InfoResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *InfoResponse) GetUptimeSeconds() int64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetKeys() int64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetKeysWithExpiry() int64 {
+	if x != nil {
+		return x.KeysWithExpiry
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetDataBytes() int64 {
+	if x != nil {
+		return x.DataBytes
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetMemorySysBytes() uint64 {
+	if x != nil {
+		return x.MemorySysBytes
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetMemoryHeapAllocBytes() uint64 {
+	if x != nil {
+		return x.MemoryHeapAllocBytes
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetReadOnly() bool {
+	if x != nil {
+		return x.ReadOnly
+	}
+	return false
+}
+
+func (x *InfoResponse) GetAofPath() string {
+	if x != nil {
+		return x.AofPath
+	}
+	return ""
+}
+
+func (x *InfoResponse) GetAofSizeBytes() int64 {
+	if x != nil {
+		return x.AofSizeBytes
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetSnapshotDir() string {
+	if x != nil {
+		return x.SnapshotDir
+	}
+	return ""
+}
+
+func (x *InfoResponse) GetLastSnapshotUnix() int64 {
+	if x != nil {
+		return x.LastSnapshotUnix
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetLastSnapshotError() string {
+	if x != nil {
+		return x.LastSnapshotError
+	}
+	return ""
+}
+
+func (x *InfoResponse) GetLastAofRewriteUnix() int64 {
+	if x != nil {
+		return x.LastAofRewriteUnix
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetMaxMemoryBytes() int64 {
+	if x != nil {
+		return x.MaxMemoryBytes
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetExpiredKeys() uint64 {
+	if x != nil {
+		return x.ExpiredKeys
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetEvictedKeys() uint64 {
+	if x != nil {
+		return x.EvictedKeys
+	}
+	return 0
+}
+
+type SetReadOnlyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ReadOnly      bool                   `protobuf:"varint,1,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetReadOnlyRequest) Reset() {
+	*x = SetReadOnlyRequest{}
+	mi := &file_proto_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetReadOnlyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetReadOnlyRequest) ProtoMessage() {}
+
+func (x *SetReadOnlyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetReadOnlyRequest.ProtoReflect.Descriptor instead.
+func (*SetReadOnlyRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetReadOnlyRequest) GetReadOnly() bool {
+	if x != nil {
+		return x.ReadOnly
+	}
+	return false
+}
+
+type SetReadOnlyResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The mode before the call
+	Previous      bool `protobuf:"varint,1,opt,name=previous,proto3" json:"previous,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetReadOnlyResponse) Reset() {
+	*x = SetReadOnlyResponse{}
+	mi := &file_proto_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetReadOnlyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetReadOnlyResponse) ProtoMessage() {}
+
+func (x *SetReadOnlyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetReadOnlyResponse.ProtoReflect.Descriptor instead.
+func (*SetReadOnlyResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SetReadOnlyResponse) GetPrevious() bool {
+	if x != nil {
+		return x.Previous
+	}
+	return false
+}
+
+type ReloadConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadConfigRequest) Reset() {
+	*x = ReloadConfigRequest{}
+	mi := &file_proto_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadConfigRequest) ProtoMessage() {}
+
+func (x *ReloadConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadConfigRequest.ProtoReflect.Descriptor instead.
+func (*ReloadConfigRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{10}
+}
+
+type ReloadConfigResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Config keys that changed and are now in effect. ACL_FILE is always
+	// listed when authentication is on, since the file is read again.
+	Applied []string `protobuf:"bytes,1,rep,name=applied,proto3" json:"applied,omitempty"`
+	// Config keys that changed but only take effect after a restart
+	RestartRequired []string `protobuf:"bytes,2,rep,name=restart_required,json=restartRequired,proto3" json:"restart_required,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ReloadConfigResponse) Reset() {
+	*x = ReloadConfigResponse{}
+	mi := &file_proto_admin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadConfigResponse) ProtoMessage() {}
+
+func (x *ReloadConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadConfigResponse.ProtoReflect.Descriptor instead.
+func (*ReloadConfigResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ReloadConfigResponse) GetApplied() []string {
+	if x != nil {
+		return x.Applied
+	}
+	return nil
+}
+
+func (x *ReloadConfigResponse) GetRestartRequired() []string {
+	if x != nil {
+		return x.RestartRequired
+	}
+	return nil
+}
+
+var File_proto_admin_proto protoreflect.FileDescriptor
+
+const file_proto_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x11proto/admin.proto\x12\akvstore\"\x11\n" +
+	"\x0fSnapshotRequest\"\x12\n" +
+	"\x10SnapshotResponse\"\x13\n" +
+	"\x11RewriteAOFRequest\".\n" +
+	"\x12RewriteAOFResponse\x12\x18\n" +
+	"\arecords\x18\x01 \x01(\x03R\arecords\"8\n" +
+	"\fFlushRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x10\n" +
+	"\x03all\x18\x02 \x01(\bR\x03all\")\n" +
+	"\rFlushResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\x03R\adeleted\"\r\n" +
+	"\vInfoRequest\"\xf5\x04\n" +
+	"\fInfoResponse\x12%\n" +
+	"\x0euptime_seconds\x18\x01 \x01(\x03R\ruptimeSeconds\x12\x12\n" +
+	"\x04keys\x18\x02 \x01(\x03R\x04keys\x12(\n" +
+	"\x10keys_with_expiry\x18\x03 \x01(\x03R\x0ekeysWithExpiry\x12\x1d\n" +
+	"\n" +
+	"data_bytes\x18\x04 \x01(\x03R\tdataBytes\x12(\n" +
+	"\x10memory_sys_bytes\x18\x05 \x01(\x04R\x0ememorySysBytes\x125\n" +
+	"\x17memory_heap_alloc_bytes\x18\x06 \x01(\x04R\x14memoryHeapAllocBytes\x12\x1b\n" +
+	"\tread_only\x18\a \x01(\bR\breadOnly\x12\x19\n" +
+	"\baof_path\x18\b \x01(\tR\aaofPath\x12$\n" +
+	"\x0eaof_size_bytes\x18\t \x01(\x03R\faofSizeBytes\x12!\n" +
+	"\fsnapshot_dir\x18\n" +
+	" \x01(\tR\vsnapshotDir\x12,\n" +
+	"\x12last_snapshot_unix\x18\v \x01(\x03R\x10lastSnapshotUnix\x12.\n" +
+	"\x13last_snapshot_error\x18\f \x01(\tR\x11lastSnapshotError\x121\n" +
+	"\x15last_aof_rewrite_unix\x18\r \x01(\x03R\x12lastAofRewriteUnix\x12(\n" +
+	"\x10max_memory_bytes\x18\x0e \x01(\x03R\x0emaxMemoryBytes\x12!\n" +
+	"\fexpired_keys\x18\x0f \x01(\x04R\vexpiredKeys\x12!\n" +
+	"\fevicted_keys\x18\x10 \x01(\x04R\vevictedKeys\"1\n" +
+	"\x12SetReadOnlyRequest\x12\x1b\n" +
+	"\tread_only\x18\x01 \x01(\bR\breadOnly\"1\n" +
+	"\x13SetReadOnlyResponse\x12\x1a\n" +
+	"\bprevious\x18\x01 \x01(\bR\bprevious\"\x15\n" +
+	"\x13ReloadConfigRequest\"[\n" +
+	"\x14ReloadConfigResponse\x12\x18\n" +
+	"\aapplied\x18\x01 \x03(\tR\aapplied\x12)\n" +
+	"\x10restart_required\x18\x02 \x03(\tR\x0frestartRequired2\x93\x03\n" +
+	"\x05Admin\x12?\n" +
+	"\bSnapshot\x12\x18.kvstore.SnapshotRequest\x1a\x19.kvstore.SnapshotResponse\x12E\n" +
+	"\n" +
+	"RewriteAOF\x12\x1a.kvstore.RewriteAOFRequest\x1a\x1b.kvstore.RewriteAOFResponse\x126\n" +
+	"\x05Flush\x12\x15.kvstore.FlushRequest\x1a\x16.kvstore.FlushResponse\x123\n" +
+	"\x04Info\x12\x14.kvstore.InfoRequest\x1a\x15.kvstore.InfoResponse\x12H\n" +
+	"\vSetReadOnly\x12\x1b.kvstore.SetReadOnlyRequest\x1a\x1c.kvstore.SetReadOnlyResponse\x12K\n" +
+	"\fReloadConfig\x12\x1c.kvstore.ReloadConfigRequest\x1a\x1d.kvstore.ReloadConfigResponseB=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
+
+var (
+	file_proto_admin_proto_rawDescOnce sync.Once
+	file_proto_admin_proto_rawDescData []byte
+)
+
+func file_proto_admin_proto_rawDescGZIP() []byte {
+	file_proto_admin_proto_rawDescOnce.Do(func() {
+		file_proto_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)))
+	})
+	return file_proto_admin_proto_rawDescData
+}
+
+var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_proto_admin_proto_goTypes = []any{
+	(*SnapshotRequest)(nil),      // 0: kvstore.SnapshotRequest
+	(*SnapshotResponse)(nil),     // 1: kvstore.SnapshotResponse
+	(*RewriteAOFRequest)(nil),    // 2: kvstore.RewriteAOFRequest
+	(*RewriteAOFResponse)(nil),   // 3: kvstore.RewriteAOFResponse
+	(*FlushRequest)(nil),         // 4: kvstore.FlushRequest
+	(*FlushResponse)(nil),        // 5: kvstore.FlushResponse
+	(*InfoRequest)(nil),          // 6: kvstore.InfoRequest
+	(*InfoResponse)(nil),         // 7: kvstore.InfoResponse
+	(*SetReadOnlyRequest)(nil),   // 8: kvstore.SetReadOnlyRequest
+	(*SetReadOnlyResponse)(nil),  // 9: kvstore.SetReadOnlyResponse
+	(*ReloadConfigRequest)(nil),  // 10: kvstore.ReloadConfigRequest
+	(*ReloadConfigResponse)(nil), // 11: kvstore.ReloadConfigResponse
+}
+var file_proto_admin_proto_depIdxs = []int32{
+	0,  // 0: kvstore.Admin.Snapshot:input_type -> kvstore.SnapshotRequest
+	2,  // 1: kvstore.Admin.RewriteAOF:input_type -> kvstore.RewriteAOFRequest
+	4,  // 2: kvstore.Admin.Flush:input_type -> kvstore.FlushRequest
+	6,  // 3: kvstore.Admin.Info:input_type -> kvstore.InfoRequest
+	8,  // 4: kvstore.Admin.SetReadOnly:input_type -> kvstore.SetReadOnlyRequest
+	10, // 5: kvstore.Admin.ReloadConfig:input_type -> kvstore.ReloadConfigRequest
+	1,  // 6: kvstore.Admin.Snapshot:output_type -> kvstore.SnapshotResponse
+	3,  // 7: kvstore.Admin.RewriteAOF:output_type -> kvstore.RewriteAOFResponse
+	5,  // 8: kvstore.Admin.Flush:output_type -> kvstore.FlushResponse
+	7,  // 9: kvstore.Admin.Info:output_type -> kvstore.InfoResponse
+	9,  // 10: kvstore.Admin.SetReadOnly:output_type -> kvstore.SetReadOnlyResponse
+	11, // 11: kvstore.Admin.ReloadConfig:output_type -> kvstore.ReloadConfigResponse
+	6,  // [6:12] is the sub-list for method output_type
+	0,  // [0:6] is the sub-list for method input_type
+	0,  // [0:0] is the sub-list for extension type_name
+	0,  // [0:0] is the sub-list for extension extendee
+	0,  // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_admin_proto_init() }
+func file_proto_admin_proto_init() {
+	if File_proto_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_admin_proto_goTypes,
+		DependencyIndexes: file_proto_admin_proto_depIdxs,
+		MessageInfos:      file_proto_admin_proto_msgTypes,
+	}.Build()
+	File_proto_admin_proto = out.File
+	file_proto_admin_proto_goTypes = nil
+	file_proto_admin_proto_depIdxs = nil
+}
@@ -0,0 +1,313 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.31.1
+// source: proto/changefeed.proto
+
+package kvstore
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ChangeFeedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// First change to send, resuming takes the last LSN processed plus one.
+	// 0 starts at the oldest retained change.
+	FromLsn uint64 `protobuf:"varint,1,opt,name=from_lsn,json=fromLsn,proto3" json:"from_lsn,omitempty"`
+	// Skips the retained changes and only sends new ones
+	FromNow       bool `protobuf:"varint,2,opt,name=from_now,json=fromNow,proto3" json:"from_now,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeFeedRequest) Reset() {
+	*x = ChangeFeedRequest{}
+	mi := &file_proto_changefeed_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeFeedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeFeedRequest) ProtoMessage() {}
+
+func (x *ChangeFeedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_changefeed_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeFeedRequest.ProtoReflect.Descriptor instead.
+func (*ChangeFeedRequest) Descriptor() ([]byte, []int) {
+	return file_proto_changefeed_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChangeFeedRequest) GetFromLsn() uint64 {
+	if x != nil {
+		return x.FromLsn
+	}
+	return 0
+}
+
+func (x *ChangeFeedRequest) GetFromNow() bool {
+	if x != nil {
+		return x.FromNow
+	}
+	return false
+}
+
+type ChangeValue struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Value string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	// Unix nanoseconds, 0 if the key doesn't expire
+	ExpiresAtUnixNano int64  `protobuf:"varint,2,opt,name=expires_at_unix_nano,json=expiresAtUnixNano,proto3" json:"expires_at_unix_nano,omitempty"`
+	Version           uint64 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	Flags             uint32 `protobuf:"varint,4,opt,name=flags,proto3" json:"flags,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ChangeValue) Reset() {
+	*x = ChangeValue{}
+	mi := &file_proto_changefeed_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeValue) ProtoMessage() {}
+
+func (x *ChangeValue) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_changefeed_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeValue.ProtoReflect.Descriptor instead.
+func (*ChangeValue) Descriptor() ([]byte, []int) {
+	return file_proto_changefeed_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChangeValue) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *ChangeValue) GetExpiresAtUnixNano() int64 {
+	if x != nil {
+		return x.ExpiresAtUnixNano
+	}
+	return 0
+}
+
+func (x *ChangeValue) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *ChangeValue) GetFlags() uint32 {
+	if x != nil {
+		return x.Flags
+	}
+	return 0
+}
+
+type ChangeEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Lsn   uint64                 `protobuf:"varint,1,opt,name=lsn,proto3" json:"lsn,omitempty"`
+	// When the change happened
+	TimestampUnixNano int64 `protobuf:"varint,2,opt,name=timestamp_unix_nano,json=timestampUnixNano,proto3" json:"timestamp_unix_nano,omitempty"`
+	// "set", "delete", "expire" when the TTL passed, or "evict" when the key
+	// was removed to stay under MAX_MEMORY
+	Op  string `protobuf:"bytes,3,opt,name=op,proto3" json:"op,omitempty"`
+	Key string `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	// Unset when the key didn't exist
+	Old *ChangeValue `protobuf:"bytes,5,opt,name=old,proto3" json:"old,omitempty"`
+	// Unset when the key was removed
+	New           *ChangeValue `protobuf:"bytes,6,opt,name=new,proto3" json:"new,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeEvent) Reset() {
+	*x = ChangeEvent{}
+	mi := &file_proto_changefeed_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeEvent) ProtoMessage() {}
+
+func (x *ChangeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_changefeed_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeEvent.ProtoReflect.Descriptor instead.
+func (*ChangeEvent) Descriptor() ([]byte, []int) {
+	return file_proto_changefeed_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ChangeEvent) GetLsn() uint64 {
+	if x != nil {
+		return x.Lsn
+	}
+	return 0
+}
+
+func (x *ChangeEvent) GetTimestampUnixNano() int64 {
+	if x != nil {
+		return x.TimestampUnixNano
+	}
+	return 0
+}
+
+func (x *ChangeEvent) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetOld() *ChangeValue {
+	if x != nil {
+		return x.Old
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetNew() *ChangeValue {
+	if x != nil {
+		return x.New
+	}
+	return nil
+}
+
+var File_proto_changefeed_proto protoreflect.FileDescriptor
+
+const file_proto_changefeed_proto_rawDesc = "" +
+	"\n" +
+	"\x16proto/changefeed.proto\x12\akvstore\"I\n" +
+	"\x11ChangeFeedRequest\x12\x19\n" +
+	"\bfrom_lsn\x18\x01 \x01(\x04R\afromLsn\x12\x19\n" +
+	"\bfrom_now\x18\x02 \x01(\bR\afromNow\"\x84\x01\n" +
+	"\vChangeValue\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12/\n" +
+	"\x14expires_at_unix_nano\x18\x02 \x01(\x03R\x11expiresAtUnixNano\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x04R\aversion\x12\x14\n" +
+	"\x05flags\x18\x04 \x01(\rR\x05flags\"\xc1\x01\n" +
+	"\vChangeEvent\x12\x10\n" +
+	"\x03lsn\x18\x01 \x01(\x04R\x03lsn\x12.\n" +
+	"\x13timestamp_unix_nano\x18\x02 \x01(\x03R\x11timestampUnixNano\x12\x0e\n" +
+	"\x02op\x18\x03 \x01(\tR\x02op\x12\x10\n" +
+	"\x03key\x18\x04 \x01(\tR\x03key\x12&\n" +
+	"\x03old\x18\x05 \x01(\v2\x14.kvstore.ChangeValueR\x03old\x12&\n" +
+	"\x03new\x18\x06 \x01(\v2\x14.kvstore.ChangeValueR\x03new2K\n" +
+	"\aChanges\x12@\n" +
+	"\n" +
+	"ChangeFeed\x12\x1a.kvstore.ChangeFeedRequest\x1a\x14.kvstore.ChangeEvent0\x01B=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
+
+var (
+	file_proto_changefeed_proto_rawDescOnce sync.Once
+	file_proto_changefeed_proto_rawDescData []byte
+)
+
+func file_proto_changefeed_proto_rawDescGZIP() []byte {
+	file_proto_changefeed_proto_rawDescOnce.Do(func() {
+		file_proto_changefeed_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_changefeed_proto_rawDesc), len(file_proto_changefeed_proto_rawDesc)))
+	})
+	return file_proto_changefeed_proto_rawDescData
+}
+
+var file_proto_changefeed_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_changefeed_proto_goTypes = []any{
+	(*ChangeFeedRequest)(nil), // 0: kvstore.ChangeFeedRequest
+	(*ChangeValue)(nil),       // 1: kvstore.ChangeValue
+	(*ChangeEvent)(nil),       // 2: kvstore.ChangeEvent
+}
+var file_proto_changefeed_proto_depIdxs = []int32{
+	1, // 0: kvstore.ChangeEvent.old:type_name -> kvstore.ChangeValue
+	1, // 1: kvstore.ChangeEvent.new:type_name -> kvstore.ChangeValue
+	0, // 2: kvstore.Changes.ChangeFeed:input_type -> kvstore.ChangeFeedRequest
+	2, // 3: kvstore.Changes.ChangeFeed:output_type -> kvstore.ChangeEvent
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_proto_changefeed_proto_init() }
+func file_proto_changefeed_proto_init() {
+	if File_proto_changefeed_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_changefeed_proto_rawDesc), len(file_proto_changefeed_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_changefeed_proto_goTypes,
+		DependencyIndexes: file_proto_changefeed_proto_depIdxs,
+		MessageInfos:      file_proto_changefeed_proto_msgTypes,
+	}.Build()
+	File_proto_changefeed_proto = out.File
+	file_proto_changefeed_proto_goTypes = nil
+	file_proto_changefeed_proto_depIdxs = nil
+}
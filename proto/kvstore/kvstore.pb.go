@@ -21,11 +21,63 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type SetCondition int32
+
+const (
+	SetCondition_SET_CONDITION_ALWAYS SetCondition = 0
+	// Only write if the key doesn't exist (NX)
+	SetCondition_SET_CONDITION_IF_ABSENT SetCondition = 1
+	// Only write if the key already exists (XX)
+	SetCondition_SET_CONDITION_IF_PRESENT SetCondition = 2
+)
+
+// Enum value maps for SetCondition.
+var (
+	SetCondition_name = map[int32]string{
+		0: "SET_CONDITION_ALWAYS",
+		1: "SET_CONDITION_IF_ABSENT",
+		2: "SET_CONDITION_IF_PRESENT",
+	}
+	SetCondition_value = map[string]int32{
+		"SET_CONDITION_ALWAYS":     0,
+		"SET_CONDITION_IF_ABSENT":  1,
+		"SET_CONDITION_IF_PRESENT": 2,
+	}
+)
+
+func (x SetCondition) Enum() *SetCondition {
+	p := new(SetCondition)
+	*p = x
+	return p
+}
+
+func (x SetCondition) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SetCondition) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_kvstore_proto_enumTypes[0].Descriptor()
+}
+
+func (SetCondition) Type() protoreflect.EnumType {
+	return &file_proto_kvstore_proto_enumTypes[0]
+}
+
+func (x SetCondition) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SetCondition.Descriptor instead.
+func (SetCondition) EnumDescriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{0}
+}
+
 type SetRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
 	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
 	TtlSeconds    int64                  `protobuf:"varint,3,opt,name=ttl_seconds,json=ttlSeconds,proto3" json:"ttl_seconds,omitempty"`
+	Condition     SetCondition           `protobuf:"varint,4,opt,name=condition,proto3,enum=kvstore.SetCondition" json:"condition,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -81,10 +133,18 @@ func (x *SetRequest) GetTtlSeconds() int64 {
 	return 0
 }
 
+func (x *SetRequest) GetCondition() SetCondition {
+	if x != nil {
+		return x.Condition
+	}
+	return SetCondition_SET_CONDITION_ALWAYS
+}
+
 type SetResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
-	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// False when the condition prevented the write
+	Success       bool   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -333,36 +393,911 @@ func (x *DeleteResponse) GetError() string {
 	return ""
 }
 
-var File_proto_kvstore_proto protoreflect.FileDescriptor
+// Batch requests return one result per key, in request order
+type MGetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []string               `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_proto_kvstore_proto_rawDesc = "" +
-	"\n" +
-	"\x13proto/kvstore.proto\x12\akvstore\"U\n" +
-	"\n" +
-	"SetRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value\x12\x1f\n" +
-	"\vttl_seconds\x18\x03 \x01(\x03R\n" +
-	"ttlSeconds\"=\n" +
-	"\vSetResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
-	"\x05error\x18\x02 \x01(\tR\x05error\"\x1e\n" +
-	"\n" +
-	"GetRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"O\n" +
-	"\vGetResponse\x12\x14\n" +
-	"\x05found\x18\x01 \x01(\bR\x05found\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error\"!\n" +
-	"\rDeleteRequest\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\"@\n" +
-	"\x0eDeleteResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
-	"\x05error\x18\x02 \x01(\tR\x05error2\xa8\x01\n" +
+func (x *MGetRequest) Reset() {
+	*x = MGetRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MGetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MGetRequest) ProtoMessage() {}
+
+func (x *MGetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MGetRequest.ProtoReflect.Descriptor instead.
+func (*MGetRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *MGetRequest) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type MGetResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Found         bool                   `protobuf:"varint,2,opt,name=found,proto3" json:"found,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MGetResult) Reset() {
+	*x = MGetResult{}
+	mi := &file_proto_kvstore_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MGetResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MGetResult) ProtoMessage() {}
+
+func (x *MGetResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MGetResult.ProtoReflect.Descriptor instead.
+func (*MGetResult) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *MGetResult) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MGetResult) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *MGetResult) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *MGetResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type MGetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*MGetResult          `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MGetResponse) Reset() {
+	*x = MGetResponse{}
+	mi := &file_proto_kvstore_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MGetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MGetResponse) ProtoMessage() {}
+
+func (x *MGetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MGetResponse.ProtoReflect.Descriptor instead.
+func (*MGetResponse) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *MGetResponse) GetResults() []*MGetResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type MSetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*SetRequest          `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSetRequest) Reset() {
+	*x = MSetRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSetRequest) ProtoMessage() {}
+
+func (x *MSetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSetRequest.ProtoReflect.Descriptor instead.
+func (*MSetRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *MSetRequest) GetEntries() []*SetRequest {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type MSetResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSetResult) Reset() {
+	*x = MSetResult{}
+	mi := &file_proto_kvstore_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSetResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSetResult) ProtoMessage() {}
+
+func (x *MSetResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSetResult.ProtoReflect.Descriptor instead.
+func (*MSetResult) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *MSetResult) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MSetResult) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *MSetResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type MSetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*MSetResult          `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSetResponse) Reset() {
+	*x = MSetResponse{}
+	mi := &file_proto_kvstore_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSetResponse) ProtoMessage() {}
+
+func (x *MSetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSetResponse.ProtoReflect.Descriptor instead.
+func (*MSetResponse) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *MSetResponse) GetResults() []*MSetResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type MDeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []string               `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MDeleteRequest) Reset() {
+	*x = MDeleteRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MDeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MDeleteRequest) ProtoMessage() {}
+
+func (x *MDeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MDeleteRequest.ProtoReflect.Descriptor instead.
+func (*MDeleteRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *MDeleteRequest) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type MDeleteResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Deleted       bool                   `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MDeleteResult) Reset() {
+	*x = MDeleteResult{}
+	mi := &file_proto_kvstore_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MDeleteResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MDeleteResult) ProtoMessage() {}
+
+func (x *MDeleteResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MDeleteResult.ProtoReflect.Descriptor instead.
+func (*MDeleteResult) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *MDeleteResult) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MDeleteResult) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *MDeleteResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type MDeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*MDeleteResult       `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MDeleteResponse) Reset() {
+	*x = MDeleteResponse{}
+	mi := &file_proto_kvstore_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MDeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MDeleteResponse) ProtoMessage() {}
+
+func (x *MDeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MDeleteResponse.ProtoReflect.Descriptor instead.
+func (*MDeleteResponse) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *MDeleteResponse) GetResults() []*MDeleteResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// Expire and ExpireAt delete the key when the new expiry is not in the future
+type ExpireRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	TtlSeconds    int64                  `protobuf:"varint,2,opt,name=ttl_seconds,json=ttlSeconds,proto3" json:"ttl_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpireRequest) Reset() {
+	*x = ExpireRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpireRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpireRequest) ProtoMessage() {}
+
+func (x *ExpireRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpireRequest.ProtoReflect.Descriptor instead.
+func (*ExpireRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ExpireRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ExpireRequest) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+type ExpireAtRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	UnixSeconds   int64                  `protobuf:"varint,2,opt,name=unix_seconds,json=unixSeconds,proto3" json:"unix_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpireAtRequest) Reset() {
+	*x = ExpireAtRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpireAtRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpireAtRequest) ProtoMessage() {}
+
+func (x *ExpireAtRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpireAtRequest.ProtoReflect.Descriptor instead.
+func (*ExpireAtRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ExpireAtRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ExpireAtRequest) GetUnixSeconds() int64 {
+	if x != nil {
+		return x.UnixSeconds
+	}
+	return 0
+}
+
+type ExpireResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// False when the key doesn't exist
+	Updated       bool   `protobuf:"varint,1,opt,name=updated,proto3" json:"updated,omitempty"`
+	Error         string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpireResponse) Reset() {
+	*x = ExpireResponse{}
+	mi := &file_proto_kvstore_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpireResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpireResponse) ProtoMessage() {}
+
+func (x *ExpireResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpireResponse.ProtoReflect.Descriptor instead.
+func (*ExpireResponse) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ExpireResponse) GetUpdated() bool {
+	if x != nil {
+		return x.Updated
+	}
+	return false
+}
+
+func (x *ExpireResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type PersistRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PersistRequest) Reset() {
+	*x = PersistRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PersistRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PersistRequest) ProtoMessage() {}
+
+func (x *PersistRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PersistRequest.ProtoReflect.Descriptor instead.
+func (*PersistRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PersistRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type PersistResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// False when the key doesn't exist or has no expiry
+	Updated       bool   `protobuf:"varint,1,opt,name=updated,proto3" json:"updated,omitempty"`
+	Error         string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PersistResponse) Reset() {
+	*x = PersistResponse{}
+	mi := &file_proto_kvstore_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PersistResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PersistResponse) ProtoMessage() {}
+
+func (x *PersistResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PersistResponse.ProtoReflect.Descriptor instead.
+func (*PersistResponse) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *PersistResponse) GetUpdated() bool {
+	if x != nil {
+		return x.Updated
+	}
+	return false
+}
+
+func (x *PersistResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type TTLRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TTLRequest) Reset() {
+	*x = TTLRequest{}
+	mi := &file_proto_kvstore_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TTLRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TTLRequest) ProtoMessage() {}
+
+func (x *TTLRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TTLRequest.ProtoReflect.Descriptor instead.
+func (*TTLRequest) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *TTLRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type TTLResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Found bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	// -1 when the key has no expiry
+	TtlSeconds    int64  `protobuf:"varint,2,opt,name=ttl_seconds,json=ttlSeconds,proto3" json:"ttl_seconds,omitempty"`
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TTLResponse) Reset() {
+	*x = TTLResponse{}
+	mi := &file_proto_kvstore_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TTLResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TTLResponse) ProtoMessage() {}
+
+func (x *TTLResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_kvstore_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TTLResponse.ProtoReflect.Descriptor instead.
+func (*TTLResponse) Descriptor() ([]byte, []int) {
+	return file_proto_kvstore_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *TTLResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *TTLResponse) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *TTLResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_proto_kvstore_proto protoreflect.FileDescriptor
+
+const file_proto_kvstore_proto_rawDesc = "" +
+	"\n" +
+	"\x13proto/kvstore.proto\x12\akvstore\"\x8a\x01\n" +
+	"\n" +
+	"SetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x1f\n" +
+	"\vttl_seconds\x18\x03 \x01(\x03R\n" +
+	"ttlSeconds\x123\n" +
+	"\tcondition\x18\x04 \x01(\x0e2\x15.kvstore.SetConditionR\tcondition\"=\n" +
+	"\vSetResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x1e\n" +
+	"\n" +
+	"GetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"O\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"!\n" +
+	"\rDeleteRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"@\n" +
+	"\x0eDeleteResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"!\n" +
+	"\vMGetRequest\x12\x12\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"`\n" +
+	"\n" +
+	"MGetResult\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05found\x18\x02 \x01(\bR\x05found\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"=\n" +
+	"\fMGetResponse\x12-\n" +
+	"\aresults\x18\x01 \x03(\v2\x13.kvstore.MGetResultR\aresults\"<\n" +
+	"\vMSetRequest\x12-\n" +
+	"\aentries\x18\x01 \x03(\v2\x13.kvstore.SetRequestR\aentries\"N\n" +
+	"\n" +
+	"MSetResult\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"=\n" +
+	"\fMSetResponse\x12-\n" +
+	"\aresults\x18\x01 \x03(\v2\x13.kvstore.MSetResultR\aresults\"$\n" +
+	"\x0eMDeleteRequest\x12\x12\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"Q\n" +
+	"\rMDeleteResult\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\bR\adeleted\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"C\n" +
+	"\x0fMDeleteResponse\x120\n" +
+	"\aresults\x18\x01 \x03(\v2\x16.kvstore.MDeleteResultR\aresults\"B\n" +
+	"\rExpireRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1f\n" +
+	"\vttl_seconds\x18\x02 \x01(\x03R\n" +
+	"ttlSeconds\"F\n" +
+	"\x0fExpireAtRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12!\n" +
+	"\funix_seconds\x18\x02 \x01(\x03R\vunixSeconds\"@\n" +
+	"\x0eExpireResponse\x12\x18\n" +
+	"\aupdated\x18\x01 \x01(\bR\aupdated\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\"\n" +
+	"\x0ePersistRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"A\n" +
+	"\x0fPersistResponse\x12\x18\n" +
+	"\aupdated\x18\x01 \x01(\bR\aupdated\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x1e\n" +
+	"\n" +
+	"TTLRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"Z\n" +
+	"\vTTLResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x1f\n" +
+	"\vttl_seconds\x18\x02 \x01(\x03R\n" +
+	"ttlSeconds\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error*c\n" +
+	"\fSetCondition\x12\x18\n" +
+	"\x14SET_CONDITION_ALWAYS\x10\x00\x12\x1b\n" +
+	"\x17SET_CONDITION_IF_ABSENT\x10\x01\x12\x1c\n" +
+	"\x18SET_CONDITION_IF_PRESENT\x10\x022\xba\x04\n" +
 	"\aKVStore\x120\n" +
 	"\x03Set\x12\x13.kvstore.SetRequest\x1a\x14.kvstore.SetResponse\x120\n" +
 	"\x03Get\x12\x13.kvstore.GetRequest\x1a\x14.kvstore.GetResponse\x129\n" +
-	"\x06Delete\x12\x16.kvstore.DeleteRequest\x1a\x17.kvstore.DeleteResponseB=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
+	"\x06Delete\x12\x16.kvstore.DeleteRequest\x1a\x17.kvstore.DeleteResponse\x123\n" +
+	"\x04MGet\x12\x14.kvstore.MGetRequest\x1a\x15.kvstore.MGetResponse\x123\n" +
+	"\x04MSet\x12\x14.kvstore.MSetRequest\x1a\x15.kvstore.MSetResponse\x12<\n" +
+	"\aMDelete\x12\x17.kvstore.MDeleteRequest\x1a\x18.kvstore.MDeleteResponse\x129\n" +
+	"\x06Expire\x12\x16.kvstore.ExpireRequest\x1a\x17.kvstore.ExpireResponse\x12=\n" +
+	"\bExpireAt\x12\x18.kvstore.ExpireAtRequest\x1a\x17.kvstore.ExpireResponse\x12<\n" +
+	"\aPersist\x12\x17.kvstore.PersistRequest\x1a\x18.kvstore.PersistResponse\x120\n" +
+	"\x03TTL\x12\x13.kvstore.TTLRequest\x1a\x14.kvstore.TTLResponseB=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
 
 var (
 	file_proto_kvstore_proto_rawDescOnce sync.Once
@@ -376,27 +1311,64 @@ func file_proto_kvstore_proto_rawDescGZIP() []byte {
 	return file_proto_kvstore_proto_rawDescData
 }
 
-var file_proto_kvstore_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_proto_kvstore_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_kvstore_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
 var file_proto_kvstore_proto_goTypes = []any{
-	(*SetRequest)(nil),     // 0: kvstore.SetRequest
-	(*SetResponse)(nil),    // 1: kvstore.SetResponse
-	(*GetRequest)(nil),     // 2: kvstore.GetRequest
-	(*GetResponse)(nil),    // 3: kvstore.GetResponse
-	(*DeleteRequest)(nil),  // 4: kvstore.DeleteRequest
-	(*DeleteResponse)(nil), // 5: kvstore.DeleteResponse
+	(SetCondition)(0),       // 0: kvstore.SetCondition
+	(*SetRequest)(nil),      // 1: kvstore.SetRequest
+	(*SetResponse)(nil),     // 2: kvstore.SetResponse
+	(*GetRequest)(nil),      // 3: kvstore.GetRequest
+	(*GetResponse)(nil),     // 4: kvstore.GetResponse
+	(*DeleteRequest)(nil),   // 5: kvstore.DeleteRequest
+	(*DeleteResponse)(nil),  // 6: kvstore.DeleteResponse
+	(*MGetRequest)(nil),     // 7: kvstore.MGetRequest
+	(*MGetResult)(nil),      // 8: kvstore.MGetResult
+	(*MGetResponse)(nil),    // 9: kvstore.MGetResponse
+	(*MSetRequest)(nil),     // 10: kvstore.MSetRequest
+	(*MSetResult)(nil),      // 11: kvstore.MSetResult
+	(*MSetResponse)(nil),    // 12: kvstore.MSetResponse
+	(*MDeleteRequest)(nil),  // 13: kvstore.MDeleteRequest
+	(*MDeleteResult)(nil),   // 14: kvstore.MDeleteResult
+	(*MDeleteResponse)(nil), // 15: kvstore.MDeleteResponse
+	(*ExpireRequest)(nil),   // 16: kvstore.ExpireRequest
+	(*ExpireAtRequest)(nil), // 17: kvstore.ExpireAtRequest
+	(*ExpireResponse)(nil),  // 18: kvstore.ExpireResponse
+	(*PersistRequest)(nil),  // 19: kvstore.PersistRequest
+	(*PersistResponse)(nil), // 20: kvstore.PersistResponse
+	(*TTLRequest)(nil),      // 21: kvstore.TTLRequest
+	(*TTLResponse)(nil),     // 22: kvstore.TTLResponse
 }
 var file_proto_kvstore_proto_depIdxs = []int32{
-	0, // 0: kvstore.KVStore.Set:input_type -> kvstore.SetRequest
-	2, // 1: kvstore.KVStore.Get:input_type -> kvstore.GetRequest
-	4, // 2: kvstore.KVStore.Delete:input_type -> kvstore.DeleteRequest
-	1, // 3: kvstore.KVStore.Set:output_type -> kvstore.SetResponse
-	3, // 4: kvstore.KVStore.Get:output_type -> kvstore.GetResponse
-	5, // 5: kvstore.KVStore.Delete:output_type -> kvstore.DeleteResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: kvstore.SetRequest.condition:type_name -> kvstore.SetCondition
+	8,  // 1: kvstore.MGetResponse.results:type_name -> kvstore.MGetResult
+	1,  // 2: kvstore.MSetRequest.entries:type_name -> kvstore.SetRequest
+	11, // 3: kvstore.MSetResponse.results:type_name -> kvstore.MSetResult
+	14, // 4: kvstore.MDeleteResponse.results:type_name -> kvstore.MDeleteResult
+	1,  // 5: kvstore.KVStore.Set:input_type -> kvstore.SetRequest
+	3,  // 6: kvstore.KVStore.Get:input_type -> kvstore.GetRequest
+	5,  // 7: kvstore.KVStore.Delete:input_type -> kvstore.DeleteRequest
+	7,  // 8: kvstore.KVStore.MGet:input_type -> kvstore.MGetRequest
+	10, // 9: kvstore.KVStore.MSet:input_type -> kvstore.MSetRequest
+	13, // 10: kvstore.KVStore.MDelete:input_type -> kvstore.MDeleteRequest
+	16, // 11: kvstore.KVStore.Expire:input_type -> kvstore.ExpireRequest
+	17, // 12: kvstore.KVStore.ExpireAt:input_type -> kvstore.ExpireAtRequest
+	19, // 13: kvstore.KVStore.Persist:input_type -> kvstore.PersistRequest
+	21, // 14: kvstore.KVStore.TTL:input_type -> kvstore.TTLRequest
+	2,  // 15: kvstore.KVStore.Set:output_type -> kvstore.SetResponse
+	4,  // 16: kvstore.KVStore.Get:output_type -> kvstore.GetResponse
+	6,  // 17: kvstore.KVStore.Delete:output_type -> kvstore.DeleteResponse
+	9,  // 18: kvstore.KVStore.MGet:output_type -> kvstore.MGetResponse
+	12, // 19: kvstore.KVStore.MSet:output_type -> kvstore.MSetResponse
+	15, // 20: kvstore.KVStore.MDelete:output_type -> kvstore.MDeleteResponse
+	18, // 21: kvstore.KVStore.Expire:output_type -> kvstore.ExpireResponse
+	18, // 22: kvstore.KVStore.ExpireAt:output_type -> kvstore.ExpireResponse
+	20, // 23: kvstore.KVStore.Persist:output_type -> kvstore.PersistResponse
+	22, // 24: kvstore.KVStore.TTL:output_type -> kvstore.TTLResponse
+	15, // [15:25] is the sub-list for method output_type
+	5,  // [5:15] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_kvstore_proto_init() }
@@ -409,13 +1381,14 @@ func file_proto_kvstore_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_kvstore_proto_rawDesc), len(file_proto_kvstore_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   6,
+			NumEnums:      1,
+			NumMessages:   22,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_kvstore_proto_goTypes,
 		DependencyIndexes: file_proto_kvstore_proto_depIdxs,
+		EnumInfos:         file_proto_kvstore_proto_enumTypes,
 		MessageInfos:      file_proto_kvstore_proto_msgTypes,
 	}.Build()
 	File_proto_kvstore_proto = out.File
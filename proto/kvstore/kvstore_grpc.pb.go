@@ -19,9 +19,16 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	KVStore_Set_FullMethodName    = "/kvstore.KVStore/Set"
-	KVStore_Get_FullMethodName    = "/kvstore.KVStore/Get"
-	KVStore_Delete_FullMethodName = "/kvstore.KVStore/Delete"
+	KVStore_Set_FullMethodName      = "/kvstore.KVStore/Set"
+	KVStore_Get_FullMethodName      = "/kvstore.KVStore/Get"
+	KVStore_Delete_FullMethodName   = "/kvstore.KVStore/Delete"
+	KVStore_MGet_FullMethodName     = "/kvstore.KVStore/MGet"
+	KVStore_MSet_FullMethodName     = "/kvstore.KVStore/MSet"
+	KVStore_MDelete_FullMethodName  = "/kvstore.KVStore/MDelete"
+	KVStore_Expire_FullMethodName   = "/kvstore.KVStore/Expire"
+	KVStore_ExpireAt_FullMethodName = "/kvstore.KVStore/ExpireAt"
+	KVStore_Persist_FullMethodName  = "/kvstore.KVStore/Persist"
+	KVStore_TTL_FullMethodName      = "/kvstore.KVStore/TTL"
 )
 
 // KVStoreClient is the client API for KVStore service.
@@ -31,6 +38,13 @@ type KVStoreClient interface {
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	MGet(ctx context.Context, in *MGetRequest, opts ...grpc.CallOption) (*MGetResponse, error)
+	MSet(ctx context.Context, in *MSetRequest, opts ...grpc.CallOption) (*MSetResponse, error)
+	MDelete(ctx context.Context, in *MDeleteRequest, opts ...grpc.CallOption) (*MDeleteResponse, error)
+	Expire(ctx context.Context, in *ExpireRequest, opts ...grpc.CallOption) (*ExpireResponse, error)
+	ExpireAt(ctx context.Context, in *ExpireAtRequest, opts ...grpc.CallOption) (*ExpireResponse, error)
+	Persist(ctx context.Context, in *PersistRequest, opts ...grpc.CallOption) (*PersistResponse, error)
+	TTL(ctx context.Context, in *TTLRequest, opts ...grpc.CallOption) (*TTLResponse, error)
 }
 
 type kVStoreClient struct {
@@ -71,6 +85,76 @@ func (c *kVStoreClient) Delete(ctx context.Context, in *DeleteRequest, opts ...g
 	return out, nil
 }
 
+func (c *kVStoreClient) MGet(ctx context.Context, in *MGetRequest, opts ...grpc.CallOption) (*MGetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MGetResponse)
+	err := c.cc.Invoke(ctx, KVStore_MGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreClient) MSet(ctx context.Context, in *MSetRequest, opts ...grpc.CallOption) (*MSetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MSetResponse)
+	err := c.cc.Invoke(ctx, KVStore_MSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreClient) MDelete(ctx context.Context, in *MDeleteRequest, opts ...grpc.CallOption) (*MDeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MDeleteResponse)
+	err := c.cc.Invoke(ctx, KVStore_MDelete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreClient) Expire(ctx context.Context, in *ExpireRequest, opts ...grpc.CallOption) (*ExpireResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExpireResponse)
+	err := c.cc.Invoke(ctx, KVStore_Expire_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreClient) ExpireAt(ctx context.Context, in *ExpireAtRequest, opts ...grpc.CallOption) (*ExpireResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExpireResponse)
+	err := c.cc.Invoke(ctx, KVStore_ExpireAt_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreClient) Persist(ctx context.Context, in *PersistRequest, opts ...grpc.CallOption) (*PersistResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PersistResponse)
+	err := c.cc.Invoke(ctx, KVStore_Persist_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreClient) TTL(ctx context.Context, in *TTLRequest, opts ...grpc.CallOption) (*TTLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TTLResponse)
+	err := c.cc.Invoke(ctx, KVStore_TTL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // KVStoreServer is the server API for KVStore service.
 // All implementations must embed UnimplementedKVStoreServer
 // for forward compatibility.
@@ -78,6 +162,13 @@ type KVStoreServer interface {
 	Set(context.Context, *SetRequest) (*SetResponse, error)
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	MGet(context.Context, *MGetRequest) (*MGetResponse, error)
+	MSet(context.Context, *MSetRequest) (*MSetResponse, error)
+	MDelete(context.Context, *MDeleteRequest) (*MDeleteResponse, error)
+	Expire(context.Context, *ExpireRequest) (*ExpireResponse, error)
+	ExpireAt(context.Context, *ExpireAtRequest) (*ExpireResponse, error)
+	Persist(context.Context, *PersistRequest) (*PersistResponse, error)
+	TTL(context.Context, *TTLRequest) (*TTLResponse, error)
 	mustEmbedUnimplementedKVStoreServer()
 }
 
@@ -97,6 +188,27 @@ func (UnimplementedKVStoreServer) Get(context.Context, *GetRequest) (*GetRespons
 func (UnimplementedKVStoreServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
+func (UnimplementedKVStoreServer) MGet(context.Context, *MGetRequest) (*MGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MGet not implemented")
+}
+func (UnimplementedKVStoreServer) MSet(context.Context, *MSetRequest) (*MSetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MSet not implemented")
+}
+func (UnimplementedKVStoreServer) MDelete(context.Context, *MDeleteRequest) (*MDeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MDelete not implemented")
+}
+func (UnimplementedKVStoreServer) Expire(context.Context, *ExpireRequest) (*ExpireResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Expire not implemented")
+}
+func (UnimplementedKVStoreServer) ExpireAt(context.Context, *ExpireAtRequest) (*ExpireResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExpireAt not implemented")
+}
+func (UnimplementedKVStoreServer) Persist(context.Context, *PersistRequest) (*PersistResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Persist not implemented")
+}
+func (UnimplementedKVStoreServer) TTL(context.Context, *TTLRequest) (*TTLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TTL not implemented")
+}
 func (UnimplementedKVStoreServer) mustEmbedUnimplementedKVStoreServer() {}
 func (UnimplementedKVStoreServer) testEmbeddedByValue()                 {}
 
@@ -172,6 +284,132 @@ func _KVStore_Delete_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _KVStore_MGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).MGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_MGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).MGet(ctx, req.(*MGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStore_MSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).MSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_MSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).MSet(ctx, req.(*MSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStore_MDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).MDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_MDelete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).MDelete(ctx, req.(*MDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStore_Expire_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpireRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).Expire(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_Expire_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).Expire(ctx, req.(*ExpireRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStore_ExpireAt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpireAtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).ExpireAt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_ExpireAt_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).ExpireAt(ctx, req.(*ExpireAtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStore_Persist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PersistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).Persist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_Persist_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).Persist(ctx, req.(*PersistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStore_TTL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TTLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServer).TTL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KVStore_TTL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServer).TTL(ctx, req.(*TTLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // KVStore_ServiceDesc is the grpc.ServiceDesc for KVStore service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -191,6 +429,34 @@ var KVStore_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Delete",
 			Handler:    _KVStore_Delete_Handler,
 		},
+		{
+			MethodName: "MGet",
+			Handler:    _KVStore_MGet_Handler,
+		},
+		{
+			MethodName: "MSet",
+			Handler:    _KVStore_MSet_Handler,
+		},
+		{
+			MethodName: "MDelete",
+			Handler:    _KVStore_MDelete_Handler,
+		},
+		{
+			MethodName: "Expire",
+			Handler:    _KVStore_Expire_Handler,
+		},
+		{
+			MethodName: "ExpireAt",
+			Handler:    _KVStore_ExpireAt_Handler,
+		},
+		{
+			MethodName: "Persist",
+			Handler:    _KVStore_Persist_Handler,
+		},
+		{
+			MethodName: "TTL",
+			Handler:    _KVStore_TTL_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/kvstore.proto",
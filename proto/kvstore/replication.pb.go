@@ -0,0 +1,1605 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.31.1
+// source: proto/replication.proto
+
+package kvstore
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SyncRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Identifies the replica in the primary's status
+	ReplicaId string `protobuf:"bytes,1,opt,name=replica_id,json=replicaId,proto3" json:"replica_id,omitempty"`
+	// Set when another site of a multi-master deployment syncs. The full sync
+	// then includes tombstones, and writes that came from that site are left
+	// out of the stream.
+	OriginId      string `protobuf:"bytes,2,opt,name=origin_id,json=originId,proto3" json:"origin_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncRequest) Reset() {
+	*x = SyncRequest{}
+	mi := &file_proto_replication_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncRequest) ProtoMessage() {}
+
+func (x *SyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncRequest.ProtoReflect.Descriptor instead.
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SyncRequest) GetReplicaId() string {
+	if x != nil {
+		return x.ReplicaId
+	}
+	return ""
+}
+
+func (x *SyncRequest) GetOriginId() string {
+	if x != nil {
+		return x.OriginId
+	}
+	return ""
+}
+
+// A write in the same shape as an AOF record
+type ReplicationEntry struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "set", "delete" or "batch"
+	Op    string `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	Key   string `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value string `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	// Unix nanoseconds, 0 if the key doesn't expire
+	ExpiresAtUnixNano int64  `protobuf:"varint,4,opt,name=expires_at_unix_nano,json=expiresAtUnixNano,proto3" json:"expires_at_unix_nano,omitempty"`
+	Version           uint64 `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	Flags             uint32 `protobuf:"varint,6,opt,name=flags,proto3" json:"flags,omitempty"`
+	// The writes of a batch record
+	Entries []*ReplicationEntry `protobuf:"bytes,7,rep,name=entries,proto3" json:"entries,omitempty"`
+	// Hybrid logical clock timestamp and site of the write, in multi-master
+	// mode
+	Timestamp     uint64 `protobuf:"varint,8,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Origin        string `protobuf:"bytes,9,opt,name=origin,proto3" json:"origin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicationEntry) Reset() {
+	*x = ReplicationEntry{}
+	mi := &file_proto_replication_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicationEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicationEntry) ProtoMessage() {}
+
+func (x *ReplicationEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicationEntry.ProtoReflect.Descriptor instead.
+func (*ReplicationEntry) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ReplicationEntry) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *ReplicationEntry) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ReplicationEntry) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *ReplicationEntry) GetExpiresAtUnixNano() int64 {
+	if x != nil {
+		return x.ExpiresAtUnixNano
+	}
+	return 0
+}
+
+func (x *ReplicationEntry) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *ReplicationEntry) GetFlags() uint32 {
+	if x != nil {
+		return x.Flags
+	}
+	return 0
+}
+
+func (x *ReplicationEntry) GetEntries() []*ReplicationEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *ReplicationEntry) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *ReplicationEntry) GetOrigin() string {
+	if x != nil {
+		return x.Origin
+	}
+	return ""
+}
+
+type SyncResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Position in the primary's write log. For a write it is the position of
+	// that write, for a full sync the last write the keys include and for a
+	// heartbeat the newest write on the primary.
+	Offset uint64 `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	// The primary's clock when the message was created
+	TimestampUnixNano int64 `protobuf:"varint,2,opt,name=timestamp_unix_nano,json=timestampUnixNano,proto3" json:"timestamp_unix_nano,omitempty"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*SyncResponse_FullSync
+	//	*SyncResponse_Write
+	//	*SyncResponse_Heartbeat
+	Message       isSyncResponse_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncResponse) Reset() {
+	*x = SyncResponse{}
+	mi := &file_proto_replication_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncResponse) ProtoMessage() {}
+
+func (x *SyncResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncResponse.ProtoReflect.Descriptor instead.
+func (*SyncResponse) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SyncResponse) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *SyncResponse) GetTimestampUnixNano() int64 {
+	if x != nil {
+		return x.TimestampUnixNano
+	}
+	return 0
+}
+
+func (x *SyncResponse) GetMessage() isSyncResponse_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *SyncResponse) GetFullSync() *FullSync {
+	if x != nil {
+		if x, ok := x.Message.(*SyncResponse_FullSync); ok {
+			return x.FullSync
+		}
+	}
+	return nil
+}
+
+func (x *SyncResponse) GetWrite() *ReplicationEntry {
+	if x != nil {
+		if x, ok := x.Message.(*SyncResponse_Write); ok {
+			return x.Write
+		}
+	}
+	return nil
+}
+
+func (x *SyncResponse) GetHeartbeat() *Heartbeat {
+	if x != nil {
+		if x, ok := x.Message.(*SyncResponse_Heartbeat); ok {
+			return x.Heartbeat
+		}
+	}
+	return nil
+}
+
+type isSyncResponse_Message interface {
+	isSyncResponse_Message()
+}
+
+type SyncResponse_FullSync struct {
+	FullSync *FullSync `protobuf:"bytes,3,opt,name=full_sync,json=fullSync,proto3,oneof"`
+}
+
+type SyncResponse_Write struct {
+	Write *ReplicationEntry `protobuf:"bytes,4,opt,name=write,proto3,oneof"`
+}
+
+type SyncResponse_Heartbeat struct {
+	// Sent every second, so the replica knows how far behind it is
+	Heartbeat *Heartbeat `protobuf:"bytes,5,opt,name=heartbeat,proto3,oneof"`
+}
+
+func (*SyncResponse_FullSync) isSyncResponse_Message() {}
+
+func (*SyncResponse_Write) isSyncResponse_Message() {}
+
+func (*SyncResponse_Heartbeat) isSyncResponse_Message() {}
+
+type FullSync struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Set entries for some of the keys
+	Items []*ReplicationEntry `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	// Marks the last chunk, after which the replica replaces its data
+	Done bool `protobuf:"varint,2,opt,name=done,proto3" json:"done,omitempty"`
+	// Delete entries for deleted keys, only sent to other sites
+	Tombstones    []*ReplicationEntry `protobuf:"bytes,3,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FullSync) Reset() {
+	*x = FullSync{}
+	mi := &file_proto_replication_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FullSync) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FullSync) ProtoMessage() {}
+
+func (x *FullSync) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FullSync.ProtoReflect.Descriptor instead.
+func (*FullSync) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FullSync) GetItems() []*ReplicationEntry {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *FullSync) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+func (x *FullSync) GetTombstones() []*ReplicationEntry {
+	if x != nil {
+		return x.Tombstones
+	}
+	return nil
+}
+
+type Heartbeat struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only sent to other sites in multi-master mode: the last write in the log
+	// the stream went past, including those it left out
+	Passed        uint64 `protobuf:"varint,1,opt,name=passed,proto3" json:"passed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Heartbeat) Reset() {
+	*x = Heartbeat{}
+	mi := &file_proto_replication_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heartbeat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heartbeat) ProtoMessage() {}
+
+func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
+func (*Heartbeat) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Heartbeat) GetPassed() uint64 {
+	if x != nil {
+		return x.Passed
+	}
+	return 0
+}
+
+type ReplicationStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicationStatusRequest) Reset() {
+	*x = ReplicationStatusRequest{}
+	mi := &file_proto_replication_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicationStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicationStatusRequest) ProtoMessage() {}
+
+func (x *ReplicationStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicationStatusRequest.ProtoReflect.Descriptor instead.
+func (*ReplicationStatusRequest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{5}
+}
+
+type ReplicationStatusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "primary", "replica" or "multi-master"
+	Role string `protobuf:"bytes,1,opt,name=role,proto3" json:"role,omitempty"`
+	// On a primary the newest write in its log, on a replica the last write
+	// it applied
+	Offset uint64 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	// Only set on replicas
+	PrimaryAddr string `protobuf:"bytes,3,opt,name=primary_addr,json=primaryAddr,proto3" json:"primary_addr,omitempty"`
+	Connected   bool   `protobuf:"varint,4,opt,name=connected,proto3" json:"connected,omitempty"`
+	LagEntries  uint64 `protobuf:"varint,5,opt,name=lag_entries,json=lagEntries,proto3" json:"lag_entries,omitempty"`
+	// Time since the replica last had every write of the primary
+	LagSeconds float64 `protobuf:"fixed64,6,opt,name=lag_seconds,json=lagSeconds,proto3" json:"lag_seconds,omitempty"`
+	// Keys fixed by anti-entropy repairs since the replica started
+	KeysRepaired uint64 `protobuf:"varint,10,opt,name=keys_repaired,json=keysRepaired,proto3" json:"keys_repaired,omitempty"`
+	// Set on primaries, and on sites for the other sites following them
+	Replicas []*ReplicaInfo `protobuf:"bytes,7,rep,name=replicas,proto3" json:"replicas,omitempty"`
+	// Only set in multi-master mode
+	OriginId      string        `protobuf:"bytes,8,opt,name=origin_id,json=originId,proto3" json:"origin_id,omitempty"`
+	Peers         []*PeerStatus `protobuf:"bytes,9,rep,name=peers,proto3" json:"peers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReplicationStatusResponse) Reset() {
+	*x = ReplicationStatusResponse{}
+	mi := &file_proto_replication_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicationStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicationStatusResponse) ProtoMessage() {}
+
+func (x *ReplicationStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicationStatusResponse.ProtoReflect.Descriptor instead.
+func (*ReplicationStatusResponse) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReplicationStatusResponse) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *ReplicationStatusResponse) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ReplicationStatusResponse) GetPrimaryAddr() string {
+	if x != nil {
+		return x.PrimaryAddr
+	}
+	return ""
+}
+
+func (x *ReplicationStatusResponse) GetConnected() bool {
+	if x != nil {
+		return x.Connected
+	}
+	return false
+}
+
+func (x *ReplicationStatusResponse) GetLagEntries() uint64 {
+	if x != nil {
+		return x.LagEntries
+	}
+	return 0
+}
+
+func (x *ReplicationStatusResponse) GetLagSeconds() float64 {
+	if x != nil {
+		return x.LagSeconds
+	}
+	return 0
+}
+
+func (x *ReplicationStatusResponse) GetKeysRepaired() uint64 {
+	if x != nil {
+		return x.KeysRepaired
+	}
+	return 0
+}
+
+func (x *ReplicationStatusResponse) GetReplicas() []*ReplicaInfo {
+	if x != nil {
+		return x.Replicas
+	}
+	return nil
+}
+
+func (x *ReplicationStatusResponse) GetOriginId() string {
+	if x != nil {
+		return x.OriginId
+	}
+	return ""
+}
+
+func (x *ReplicationStatusResponse) GetPeers() []*PeerStatus {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+// A site this one follows in multi-master mode
+type PeerStatus struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Addr      string                 `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	Connected bool                   `protobuf:"varint,3,opt,name=connected,proto3" json:"connected,omitempty"`
+	// The last write received from the site
+	Offset uint64 `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	// Writes received, and those of them that won over what this site had
+	WritesReceived uint64 `protobuf:"varint,5,opt,name=writes_received,json=writesReceived,proto3" json:"writes_received,omitempty"`
+	WritesApplied  uint64 `protobuf:"varint,6,opt,name=writes_applied,json=writesApplied,proto3" json:"writes_applied,omitempty"`
+	// Time since this site last had every write of the other one
+	LagSeconds float64 `protobuf:"fixed64,7,opt,name=lag_seconds,json=lagSeconds,proto3" json:"lag_seconds,omitempty"`
+	// Keys fixed by anti-entropy repairs from the site
+	KeysRepaired  uint64 `protobuf:"varint,8,opt,name=keys_repaired,json=keysRepaired,proto3" json:"keys_repaired,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PeerStatus) Reset() {
+	*x = PeerStatus{}
+	mi := &file_proto_replication_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PeerStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PeerStatus) ProtoMessage() {}
+
+func (x *PeerStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PeerStatus.ProtoReflect.Descriptor instead.
+func (*PeerStatus) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PeerStatus) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PeerStatus) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *PeerStatus) GetConnected() bool {
+	if x != nil {
+		return x.Connected
+	}
+	return false
+}
+
+func (x *PeerStatus) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *PeerStatus) GetWritesReceived() uint64 {
+	if x != nil {
+		return x.WritesReceived
+	}
+	return 0
+}
+
+func (x *PeerStatus) GetWritesApplied() uint64 {
+	if x != nil {
+		return x.WritesApplied
+	}
+	return 0
+}
+
+func (x *PeerStatus) GetLagSeconds() float64 {
+	if x != nil {
+		return x.LagSeconds
+	}
+	return 0
+}
+
+func (x *PeerStatus) GetKeysRepaired() uint64 {
+	if x != nil {
+		return x.KeysRepaired
+	}
+	return 0
+}
+
+type DigestRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of buckets, 256 when 0
+	Buckets uint32 `protobuf:"varint,1,opt,name=buckets,proto3" json:"buckets,omitempty"`
+	// Buckets whose keys to list
+	ListBuckets   []uint32 `protobuf:"varint,2,rep,packed,name=list_buckets,json=listBuckets,proto3" json:"list_buckets,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DigestRequest) Reset() {
+	*x = DigestRequest{}
+	mi := &file_proto_replication_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DigestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DigestRequest) ProtoMessage() {}
+
+func (x *DigestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DigestRequest.ProtoReflect.Descriptor instead.
+func (*DigestRequest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DigestRequest) GetBuckets() uint32 {
+	if x != nil {
+		return x.Buckets
+	}
+	return 0
+}
+
+func (x *DigestRequest) GetListBuckets() []uint32 {
+	if x != nil {
+		return x.ListBuckets
+	}
+	return nil
+}
+
+type DigestResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Empty outside of multi-master mode
+	OriginId   string          `protobuf:"bytes,1,opt,name=origin_id,json=originId,proto3" json:"origin_id,omitempty"`
+	Keys       uint64          `protobuf:"varint,2,opt,name=keys,proto3" json:"keys,omitempty"`
+	Tombstones uint64          `protobuf:"varint,3,opt,name=tombstones,proto3" json:"tombstones,omitempty"`
+	Buckets    []*BucketDigest `protobuf:"bytes,4,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	// The keys of the listed buckets, in key order
+	Listed        []*KeyDigest `protobuf:"bytes,5,rep,name=listed,proto3" json:"listed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DigestResponse) Reset() {
+	*x = DigestResponse{}
+	mi := &file_proto_replication_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DigestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DigestResponse) ProtoMessage() {}
+
+func (x *DigestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DigestResponse.ProtoReflect.Descriptor instead.
+func (*DigestResponse) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DigestResponse) GetOriginId() string {
+	if x != nil {
+		return x.OriginId
+	}
+	return ""
+}
+
+func (x *DigestResponse) GetKeys() uint64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *DigestResponse) GetTombstones() uint64 {
+	if x != nil {
+		return x.Tombstones
+	}
+	return 0
+}
+
+func (x *DigestResponse) GetBuckets() []*BucketDigest {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+func (x *DigestResponse) GetListed() []*KeyDigest {
+	if x != nil {
+		return x.Listed
+	}
+	return nil
+}
+
+type BucketDigest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          uint64                 `protobuf:"varint,1,opt,name=keys,proto3" json:"keys,omitempty"`
+	Hash          uint64                 `protobuf:"varint,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BucketDigest) Reset() {
+	*x = BucketDigest{}
+	mi := &file_proto_replication_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BucketDigest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BucketDigest) ProtoMessage() {}
+
+func (x *BucketDigest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BucketDigest.ProtoReflect.Descriptor instead.
+func (*BucketDigest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *BucketDigest) GetKeys() uint64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *BucketDigest) GetHash() uint64 {
+	if x != nil {
+		return x.Hash
+	}
+	return 0
+}
+
+type KeyDigest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Key    string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Bucket uint32                 `protobuf:"varint,2,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	// Hash of the key's value, expiry, flags, timestamp and origin
+	Hash          uint64 `protobuf:"varint,3,opt,name=hash,proto3" json:"hash,omitempty"`
+	Timestamp     uint64 `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Origin        string `protobuf:"bytes,5,opt,name=origin,proto3" json:"origin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyDigest) Reset() {
+	*x = KeyDigest{}
+	mi := &file_proto_replication_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyDigest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyDigest) ProtoMessage() {}
+
+func (x *KeyDigest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyDigest.ProtoReflect.Descriptor instead.
+func (*KeyDigest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *KeyDigest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KeyDigest) GetBucket() uint32 {
+	if x != nil {
+		return x.Bucket
+	}
+	return 0
+}
+
+func (x *KeyDigest) GetHash() uint64 {
+	if x != nil {
+		return x.Hash
+	}
+	return 0
+}
+
+func (x *KeyDigest) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *KeyDigest) GetOrigin() string {
+	if x != nil {
+		return x.Origin
+	}
+	return ""
+}
+
+type MerkleNodesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The tree has 1 << depth leaves, each a range of key hashes
+	Depth uint32 `protobuf:"varint,1,opt,name=depth,proto3" json:"depth,omitempty"`
+	// Nodes in heap order: node 0 is the root, node i has children 2i+1 and
+	// 2i+2
+	Nodes         []uint32 `protobuf:"varint,2,rep,packed,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MerkleNodesRequest) Reset() {
+	*x = MerkleNodesRequest{}
+	mi := &file_proto_replication_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MerkleNodesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MerkleNodesRequest) ProtoMessage() {}
+
+func (x *MerkleNodesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MerkleNodesRequest.ProtoReflect.Descriptor instead.
+func (*MerkleNodesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *MerkleNodesRequest) GetDepth() uint32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *MerkleNodesRequest) GetNodes() []uint32 {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type MerkleNodesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The hash of every requested node, in the same order
+	Hashes        []uint64 `protobuf:"varint,1,rep,packed,name=hashes,proto3" json:"hashes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MerkleNodesResponse) Reset() {
+	*x = MerkleNodesResponse{}
+	mi := &file_proto_replication_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MerkleNodesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MerkleNodesResponse) ProtoMessage() {}
+
+func (x *MerkleNodesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MerkleNodesResponse.ProtoReflect.Descriptor instead.
+func (*MerkleNodesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *MerkleNodesResponse) GetHashes() []uint64 {
+	if x != nil {
+		return x.Hashes
+	}
+	return nil
+}
+
+type RangeItemsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Depth uint32                 `protobuf:"varint,1,opt,name=depth,proto3" json:"depth,omitempty"`
+	// Leaves to send the keys of, numbered from 0
+	Ranges        []uint32 `protobuf:"varint,2,rep,packed,name=ranges,proto3" json:"ranges,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RangeItemsRequest) Reset() {
+	*x = RangeItemsRequest{}
+	mi := &file_proto_replication_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RangeItemsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RangeItemsRequest) ProtoMessage() {}
+
+func (x *RangeItemsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RangeItemsRequest.ProtoReflect.Descriptor instead.
+func (*RangeItemsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RangeItemsRequest) GetDepth() uint32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *RangeItemsRequest) GetRanges() []uint32 {
+	if x != nil {
+		return x.Ranges
+	}
+	return nil
+}
+
+type RangeItemsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Items []*ReplicationEntry    `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	// Deleted keys, only in multi-master mode
+	Tombstones []*ReplicationEntry `protobuf:"bytes,2,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+	// The last version the server handed out when the items were read
+	Version       uint64 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RangeItemsResponse) Reset() {
+	*x = RangeItemsResponse{}
+	mi := &file_proto_replication_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RangeItemsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RangeItemsResponse) ProtoMessage() {}
+
+func (x *RangeItemsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RangeItemsResponse.ProtoReflect.Descriptor instead.
+func (*RangeItemsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *RangeItemsResponse) GetItems() []*ReplicationEntry {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *RangeItemsResponse) GetTombstones() []*ReplicationEntry {
+	if x != nil {
+		return x.Tombstones
+	}
+	return nil
+}
+
+func (x *RangeItemsResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type RepairRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// In multi-master mode, repairs only from this site
+	SiteId        string `protobuf:"bytes,1,opt,name=site_id,json=siteId,proto3" json:"site_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepairRequest) Reset() {
+	*x = RepairRequest{}
+	mi := &file_proto_replication_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepairRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepairRequest) ProtoMessage() {}
+
+func (x *RepairRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepairRequest.ProtoReflect.Descriptor instead.
+func (*RepairRequest) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *RepairRequest) GetSiteId() string {
+	if x != nil {
+		return x.SiteId
+	}
+	return ""
+}
+
+type RepairResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*RepairResult        `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepairResponse) Reset() {
+	*x = RepairResponse{}
+	mi := &file_proto_replication_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepairResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepairResponse) ProtoMessage() {}
+
+func (x *RepairResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepairResponse.ProtoReflect.Descriptor instead.
+func (*RepairResponse) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *RepairResponse) GetResults() []*RepairResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type RepairResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The primary, or the ID of the other site
+	Source string `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	// Ranges whose leaves differed
+	Ranges    uint32 `protobuf:"varint,2,opt,name=ranges,proto3" json:"ranges,omitempty"`
+	KeysFixed uint64 `protobuf:"varint,3,opt,name=keys_fixed,json=keysFixed,proto3" json:"keys_fixed,omitempty"`
+	// Set if the repair failed
+	Error         string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepairResult) Reset() {
+	*x = RepairResult{}
+	mi := &file_proto_replication_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepairResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepairResult) ProtoMessage() {}
+
+func (x *RepairResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepairResult.ProtoReflect.Descriptor instead.
+func (*RepairResult) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RepairResult) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *RepairResult) GetRanges() uint32 {
+	if x != nil {
+		return x.Ranges
+	}
+	return 0
+}
+
+func (x *RepairResult) GetKeysFixed() uint64 {
+	if x != nil {
+		return x.KeysFixed
+	}
+	return 0
+}
+
+func (x *RepairResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ReplicaInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Addr  string                 `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	// The last write sent to the replica
+	Offset             uint64 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	ConnectedSinceUnix int64  `protobuf:"varint,4,opt,name=connected_since_unix,json=connectedSinceUnix,proto3" json:"connected_since_unix,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ReplicaInfo) Reset() {
+	*x = ReplicaInfo{}
+	mi := &file_proto_replication_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicaInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicaInfo) ProtoMessage() {}
+
+func (x *ReplicaInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_replication_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicaInfo.ProtoReflect.Descriptor instead.
+func (*ReplicaInfo) Descriptor() ([]byte, []int) {
+	return file_proto_replication_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ReplicaInfo) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ReplicaInfo) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *ReplicaInfo) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ReplicaInfo) GetConnectedSinceUnix() int64 {
+	if x != nil {
+		return x.ConnectedSinceUnix
+	}
+	return 0
+}
+
+var File_proto_replication_proto protoreflect.FileDescriptor
+
+const file_proto_replication_proto_rawDesc = "" +
+	"\n" +
+	"\x17proto/replication.proto\x12\akvstore\"I\n" +
+	"\vSyncRequest\x12\x1d\n" +
+	"\n" +
+	"replica_id\x18\x01 \x01(\tR\treplicaId\x12\x1b\n" +
+	"\torigin_id\x18\x02 \x01(\tR\boriginId\"\x96\x02\n" +
+	"\x10ReplicationEntry\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x12/\n" +
+	"\x14expires_at_unix_nano\x18\x04 \x01(\x03R\x11expiresAtUnixNano\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\x04R\aversion\x12\x14\n" +
+	"\x05flags\x18\x06 \x01(\rR\x05flags\x123\n" +
+	"\aentries\x18\a \x03(\v2\x19.kvstore.ReplicationEntryR\aentries\x12\x1c\n" +
+	"\ttimestamp\x18\b \x01(\x04R\ttimestamp\x12\x16\n" +
+	"\x06origin\x18\t \x01(\tR\x06origin\"\xfa\x01\n" +
+	"\fSyncResponse\x12\x16\n" +
+	"\x06offset\x18\x01 \x01(\x04R\x06offset\x12.\n" +
+	"\x13timestamp_unix_nano\x18\x02 \x01(\x03R\x11timestampUnixNano\x120\n" +
+	"\tfull_sync\x18\x03 \x01(\v2\x11.kvstore.FullSyncH\x00R\bfullSync\x121\n" +
+	"\x05write\x18\x04 \x01(\v2\x19.kvstore.ReplicationEntryH\x00R\x05write\x122\n" +
+	"\theartbeat\x18\x05 \x01(\v2\x12.kvstore.HeartbeatH\x00R\theartbeatB\t\n" +
+	"\amessage\"\x8a\x01\n" +
+	"\bFullSync\x12/\n" +
+	"\x05items\x18\x01 \x03(\v2\x19.kvstore.ReplicationEntryR\x05items\x12\x12\n" +
+	"\x04done\x18\x02 \x01(\bR\x04done\x129\n" +
+	"\n" +
+	"tombstones\x18\x03 \x03(\v2\x19.kvstore.ReplicationEntryR\n" +
+	"tombstones\"#\n" +
+	"\tHeartbeat\x12\x16\n" +
+	"\x06passed\x18\x01 \x01(\x04R\x06passed\"\x1a\n" +
+	"\x18ReplicationStatusRequest\"\xe9\x02\n" +
+	"\x19ReplicationStatusResponse\x12\x12\n" +
+	"\x04role\x18\x01 \x01(\tR\x04role\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x04R\x06offset\x12!\n" +
+	"\fprimary_addr\x18\x03 \x01(\tR\vprimaryAddr\x12\x1c\n" +
+	"\tconnected\x18\x04 \x01(\bR\tconnected\x12\x1f\n" +
+	"\vlag_entries\x18\x05 \x01(\x04R\n" +
+	"lagEntries\x12\x1f\n" +
+	"\vlag_seconds\x18\x06 \x01(\x01R\n" +
+	"lagSeconds\x12#\n" +
+	"\rkeys_repaired\x18\n" +
+	" \x01(\x04R\fkeysRepaired\x120\n" +
+	"\breplicas\x18\a \x03(\v2\x14.kvstore.ReplicaInfoR\breplicas\x12\x1b\n" +
+	"\torigin_id\x18\b \x01(\tR\boriginId\x12)\n" +
+	"\x05peers\x18\t \x03(\v2\x13.kvstore.PeerStatusR\x05peers\"\xfc\x01\n" +
+	"\n" +
+	"PeerStatus\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04addr\x18\x02 \x01(\tR\x04addr\x12\x1c\n" +
+	"\tconnected\x18\x03 \x01(\bR\tconnected\x12\x16\n" +
+	"\x06offset\x18\x04 \x01(\x04R\x06offset\x12'\n" +
+	"\x0fwrites_received\x18\x05 \x01(\x04R\x0ewritesReceived\x12%\n" +
+	"\x0ewrites_applied\x18\x06 \x01(\x04R\rwritesApplied\x12\x1f\n" +
+	"\vlag_seconds\x18\a \x01(\x01R\n" +
+	"lagSeconds\x12#\n" +
+	"\rkeys_repaired\x18\b \x01(\x04R\fkeysRepaired\"L\n" +
+	"\rDigestRequest\x12\x18\n" +
+	"\abuckets\x18\x01 \x01(\rR\abuckets\x12!\n" +
+	"\flist_buckets\x18\x02 \x03(\rR\vlistBuckets\"\xbe\x01\n" +
+	"\x0eDigestResponse\x12\x1b\n" +
+	"\torigin_id\x18\x01 \x01(\tR\boriginId\x12\x12\n" +
+	"\x04keys\x18\x02 \x01(\x04R\x04keys\x12\x1e\n" +
+	"\n" +
+	"tombstones\x18\x03 \x01(\x04R\n" +
+	"tombstones\x12/\n" +
+	"\abuckets\x18\x04 \x03(\v2\x15.kvstore.BucketDigestR\abuckets\x12*\n" +
+	"\x06listed\x18\x05 \x03(\v2\x12.kvstore.KeyDigestR\x06listed\"6\n" +
+	"\fBucketDigest\x12\x12\n" +
+	"\x04keys\x18\x01 \x01(\x04R\x04keys\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\x04R\x04hash\"\x7f\n" +
+	"\tKeyDigest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x16\n" +
+	"\x06bucket\x18\x02 \x01(\rR\x06bucket\x12\x12\n" +
+	"\x04hash\x18\x03 \x01(\x04R\x04hash\x12\x1c\n" +
+	"\ttimestamp\x18\x04 \x01(\x04R\ttimestamp\x12\x16\n" +
+	"\x06origin\x18\x05 \x01(\tR\x06origin\"@\n" +
+	"\x12MerkleNodesRequest\x12\x14\n" +
+	"\x05depth\x18\x01 \x01(\rR\x05depth\x12\x14\n" +
+	"\x05nodes\x18\x02 \x03(\rR\x05nodes\"-\n" +
+	"\x13MerkleNodesResponse\x12\x16\n" +
+	"\x06hashes\x18\x01 \x03(\x04R\x06hashes\"A\n" +
+	"\x11RangeItemsRequest\x12\x14\n" +
+	"\x05depth\x18\x01 \x01(\rR\x05depth\x12\x16\n" +
+	"\x06ranges\x18\x02 \x03(\rR\x06ranges\"\x9a\x01\n" +
+	"\x12RangeItemsResponse\x12/\n" +
+	"\x05items\x18\x01 \x03(\v2\x19.kvstore.ReplicationEntryR\x05items\x129\n" +
+	"\n" +
+	"tombstones\x18\x02 \x03(\v2\x19.kvstore.ReplicationEntryR\n" +
+	"tombstones\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x04R\aversion\"(\n" +
+	"\rRepairRequest\x12\x17\n" +
+	"\asite_id\x18\x01 \x01(\tR\x06siteId\"A\n" +
+	"\x0eRepairResponse\x12/\n" +
+	"\aresults\x18\x01 \x03(\v2\x15.kvstore.RepairResultR\aresults\"s\n" +
+	"\fRepairResult\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12\x16\n" +
+	"\x06ranges\x18\x02 \x01(\rR\x06ranges\x12\x1d\n" +
+	"\n" +
+	"keys_fixed\x18\x03 \x01(\x04R\tkeysFixed\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"{\n" +
+	"\vReplicaInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04addr\x18\x02 \x01(\tR\x04addr\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x04R\x06offset\x120\n" +
+	"\x14connected_since_unix\x18\x04 \x01(\x03R\x12connectedSinceUnix2\x9c\x03\n" +
+	"\vReplication\x125\n" +
+	"\x04Sync\x12\x14.kvstore.SyncRequest\x1a\x15.kvstore.SyncResponse0\x01\x12O\n" +
+	"\x06Status\x12!.kvstore.ReplicationStatusRequest\x1a\".kvstore.ReplicationStatusResponse\x129\n" +
+	"\x06Digest\x12\x16.kvstore.DigestRequest\x1a\x17.kvstore.DigestResponse\x12H\n" +
+	"\vMerkleNodes\x12\x1b.kvstore.MerkleNodesRequest\x1a\x1c.kvstore.MerkleNodesResponse\x12E\n" +
+	"\n" +
+	"RangeItems\x12\x1a.kvstore.RangeItemsRequest\x1a\x1b.kvstore.RangeItemsResponse\x129\n" +
+	"\x06Repair\x12\x16.kvstore.RepairRequest\x1a\x17.kvstore.RepairResponseB=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
+
+var (
+	file_proto_replication_proto_rawDescOnce sync.Once
+	file_proto_replication_proto_rawDescData []byte
+)
+
+func file_proto_replication_proto_rawDescGZIP() []byte {
+	file_proto_replication_proto_rawDescOnce.Do(func() {
+		file_proto_replication_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_replication_proto_rawDesc), len(file_proto_replication_proto_rawDesc)))
+	})
+	return file_proto_replication_proto_rawDescData
+}
+
+var file_proto_replication_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
+var file_proto_replication_proto_goTypes = []any{
+	(*SyncRequest)(nil),               // 0: kvstore.SyncRequest
+	(*ReplicationEntry)(nil),          // 1: kvstore.ReplicationEntry
+	(*SyncResponse)(nil),              // 2: kvstore.SyncResponse
+	(*FullSync)(nil),                  // 3: kvstore.FullSync
+	(*Heartbeat)(nil),                 // 4: kvstore.Heartbeat
+	(*ReplicationStatusRequest)(nil),  // 5: kvstore.ReplicationStatusRequest
+	(*ReplicationStatusResponse)(nil), // 6: kvstore.ReplicationStatusResponse
+	(*PeerStatus)(nil),                // 7: kvstore.PeerStatus
+	(*DigestRequest)(nil),             // 8: kvstore.DigestRequest
+	(*DigestResponse)(nil),            // 9: kvstore.DigestResponse
+	(*BucketDigest)(nil),              // 10: kvstore.BucketDigest
+	(*KeyDigest)(nil),                 // 11: kvstore.KeyDigest
+	(*MerkleNodesRequest)(nil),        // 12: kvstore.MerkleNodesRequest
+	(*MerkleNodesResponse)(nil),       // 13: kvstore.MerkleNodesResponse
+	(*RangeItemsRequest)(nil),         // 14: kvstore.RangeItemsRequest
+	(*RangeItemsResponse)(nil),        // 15: kvstore.RangeItemsResponse
+	(*RepairRequest)(nil),             // 16: kvstore.RepairRequest
+	(*RepairResponse)(nil),            // 17: kvstore.RepairResponse
+	(*RepairResult)(nil),              // 18: kvstore.RepairResult
+	(*ReplicaInfo)(nil),               // 19: kvstore.ReplicaInfo
+}
+var file_proto_replication_proto_depIdxs = []int32{
+	1,  // 0: kvstore.ReplicationEntry.entries:type_name -> kvstore.ReplicationEntry
+	3,  // 1: kvstore.SyncResponse.full_sync:type_name -> kvstore.FullSync
+	1,  // 2: kvstore.SyncResponse.write:type_name -> kvstore.ReplicationEntry
+	4,  // 3: kvstore.SyncResponse.heartbeat:type_name -> kvstore.Heartbeat
+	1,  // 4: kvstore.FullSync.items:type_name -> kvstore.ReplicationEntry
+	1,  // 5: kvstore.FullSync.tombstones:type_name -> kvstore.ReplicationEntry
+	19, // 6: kvstore.ReplicationStatusResponse.replicas:type_name -> kvstore.ReplicaInfo
+	7,  // 7: kvstore.ReplicationStatusResponse.peers:type_name -> kvstore.PeerStatus
+	10, // 8: kvstore.DigestResponse.buckets:type_name -> kvstore.BucketDigest
+	11, // 9: kvstore.DigestResponse.listed:type_name -> kvstore.KeyDigest
+	1,  // 10: kvstore.RangeItemsResponse.items:type_name -> kvstore.ReplicationEntry
+	1,  // 11: kvstore.RangeItemsResponse.tombstones:type_name -> kvstore.ReplicationEntry
+	18, // 12: kvstore.RepairResponse.results:type_name -> kvstore.RepairResult
+	0,  // 13: kvstore.Replication.Sync:input_type -> kvstore.SyncRequest
+	5,  // 14: kvstore.Replication.Status:input_type -> kvstore.ReplicationStatusRequest
+	8,  // 15: kvstore.Replication.Digest:input_type -> kvstore.DigestRequest
+	12, // 16: kvstore.Replication.MerkleNodes:input_type -> kvstore.MerkleNodesRequest
+	14, // 17: kvstore.Replication.RangeItems:input_type -> kvstore.RangeItemsRequest
+	16, // 18: kvstore.Replication.Repair:input_type -> kvstore.RepairRequest
+	2,  // 19: kvstore.Replication.Sync:output_type -> kvstore.SyncResponse
+	6,  // 20: kvstore.Replication.Status:output_type -> kvstore.ReplicationStatusResponse
+	9,  // 21: kvstore.Replication.Digest:output_type -> kvstore.DigestResponse
+	13, // 22: kvstore.Replication.MerkleNodes:output_type -> kvstore.MerkleNodesResponse
+	15, // 23: kvstore.Replication.RangeItems:output_type -> kvstore.RangeItemsResponse
+	17, // 24: kvstore.Replication.Repair:output_type -> kvstore.RepairResponse
+	19, // [19:25] is the sub-list for method output_type
+	13, // [13:19] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_proto_replication_proto_init() }
+func file_proto_replication_proto_init() {
+	if File_proto_replication_proto != nil {
+		return
+	}
+	file_proto_replication_proto_msgTypes[2].OneofWrappers = []any{
+		(*SyncResponse_FullSync)(nil),
+		(*SyncResponse_Write)(nil),
+		(*SyncResponse_Heartbeat)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_replication_proto_rawDesc), len(file_proto_replication_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   20,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_replication_proto_goTypes,
+		DependencyIndexes: file_proto_replication_proto_depIdxs,
+		MessageInfos:      file_proto_replication_proto_msgTypes,
+	}.Build()
+	File_proto_replication_proto = out.File
+	file_proto_replication_proto_goTypes = nil
+	file_proto_replication_proto_depIdxs = nil
+}
@@ -0,0 +1,875 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.31.1
+// source: proto/sharding.proto
+
+package kvstore
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ShardNode struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// gRPC address
+	Addr          string `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShardNode) Reset() {
+	*x = ShardNode{}
+	mi := &file_proto_sharding_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShardNode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShardNode) ProtoMessage() {}
+
+func (x *ShardNode) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShardNode.ProtoReflect.Descriptor instead.
+func (*ShardNode) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ShardNode) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ShardNode) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+// A point on the hash ring. The node owns the keys whose hash is greater
+// than the previous token's and at most this one's, wrapping around.
+type ShardToken struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hash          uint64                 `protobuf:"varint,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	NodeId        string                 `protobuf:"bytes,2,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShardToken) Reset() {
+	*x = ShardToken{}
+	mi := &file_proto_sharding_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShardToken) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShardToken) ProtoMessage() {}
+
+func (x *ShardToken) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShardToken.ProtoReflect.Descriptor instead.
+func (*ShardToken) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ShardToken) GetHash() uint64 {
+	if x != nil {
+		return x.Hash
+	}
+	return 0
+}
+
+func (x *ShardToken) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+type TopologyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologyRequest) Reset() {
+	*x = TopologyRequest{}
+	mi := &file_proto_sharding_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologyRequest) ProtoMessage() {}
+
+func (x *TopologyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologyRequest.ProtoReflect.Descriptor instead.
+func (*TopologyRequest) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{2}
+}
+
+type TopologyResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Increases with every change, so clients can tell which topology is newer
+	Epoch  uint64        `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	Nodes  []*ShardNode  `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Tokens []*ShardToken `protobuf:"bytes,3,rep,name=tokens,proto3" json:"tokens,omitempty"`
+	// The node that answered
+	SelfId        string `protobuf:"bytes,4,opt,name=self_id,json=selfId,proto3" json:"self_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologyResponse) Reset() {
+	*x = TopologyResponse{}
+	mi := &file_proto_sharding_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologyResponse) ProtoMessage() {}
+
+func (x *TopologyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologyResponse.ProtoReflect.Descriptor instead.
+func (*TopologyResponse) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TopologyResponse) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *TopologyResponse) GetNodes() []*ShardNode {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *TopologyResponse) GetTokens() []*ShardToken {
+	if x != nil {
+		return x.Tokens
+	}
+	return nil
+}
+
+func (x *TopologyResponse) GetSelfId() string {
+	if x != nil {
+		return x.SelfId
+	}
+	return ""
+}
+
+type AddShardNodeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Addr          string                 `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddShardNodeRequest) Reset() {
+	*x = AddShardNodeRequest{}
+	mi := &file_proto_sharding_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddShardNodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddShardNodeRequest) ProtoMessage() {}
+
+func (x *AddShardNodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddShardNodeRequest.ProtoReflect.Descriptor instead.
+func (*AddShardNodeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AddShardNodeRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AddShardNodeRequest) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+type TopologyChangeResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Topology *TopologyResponse      `protobuf:"bytes,1,opt,name=topology,proto3" json:"topology,omitempty"`
+	// Nodes that couldn't be told about the change
+	Unreachable   []string `protobuf:"bytes,2,rep,name=unreachable,proto3" json:"unreachable,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologyChangeResponse) Reset() {
+	*x = TopologyChangeResponse{}
+	mi := &file_proto_sharding_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologyChangeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologyChangeResponse) ProtoMessage() {}
+
+func (x *TopologyChangeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologyChangeResponse.ProtoReflect.Descriptor instead.
+func (*TopologyChangeResponse) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TopologyChangeResponse) GetTopology() *TopologyResponse {
+	if x != nil {
+		return x.Topology
+	}
+	return nil
+}
+
+func (x *TopologyChangeResponse) GetUnreachable() []string {
+	if x != nil {
+		return x.Unreachable
+	}
+	return nil
+}
+
+type StartMigrationRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	TargetId string                 `protobuf:"bytes,1,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"`
+	// Points on the ring to hand to the target, existing or new. When empty,
+	// the target's default virtual tokens that fall in this node's ranges.
+	Tokens        []uint64 `protobuf:"varint,2,rep,packed,name=tokens,proto3" json:"tokens,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartMigrationRequest) Reset() {
+	*x = StartMigrationRequest{}
+	mi := &file_proto_sharding_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartMigrationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartMigrationRequest) ProtoMessage() {}
+
+func (x *StartMigrationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartMigrationRequest.ProtoReflect.Descriptor instead.
+func (*StartMigrationRequest) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StartMigrationRequest) GetTargetId() string {
+	if x != nil {
+		return x.TargetId
+	}
+	return ""
+}
+
+func (x *StartMigrationRequest) GetTokens() []uint64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return nil
+}
+
+type GetMigrationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMigrationRequest) Reset() {
+	*x = GetMigrationRequest{}
+	mi := &file_proto_sharding_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMigrationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMigrationRequest) ProtoMessage() {}
+
+func (x *GetMigrationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMigrationRequest.ProtoReflect.Descriptor instead.
+func (*GetMigrationRequest) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{7}
+}
+
+type AbortMigrationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AbortMigrationRequest) Reset() {
+	*x = AbortMigrationRequest{}
+	mi := &file_proto_sharding_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AbortMigrationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AbortMigrationRequest) ProtoMessage() {}
+
+func (x *AbortMigrationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AbortMigrationRequest.ProtoReflect.Descriptor instead.
+func (*AbortMigrationRequest) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{8}
+}
+
+type MigrationStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "idle", "copying", "forwarding", "done", "failed" or "aborted"
+	State           string   `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	TargetId        string   `protobuf:"bytes,2,opt,name=target_id,json=targetId,proto3" json:"target_id,omitempty"`
+	Tokens          []uint64 `protobuf:"varint,3,rep,packed,name=tokens,proto3" json:"tokens,omitempty"`
+	KeysCopied      uint64   `protobuf:"varint,4,opt,name=keys_copied,json=keysCopied,proto3" json:"keys_copied,omitempty"`
+	WritesForwarded uint64   `protobuf:"varint,5,opt,name=writes_forwarded,json=writesForwarded,proto3" json:"writes_forwarded,omitempty"`
+	Error           string   `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	StartedUnix     int64    `protobuf:"varint,7,opt,name=started_unix,json=startedUnix,proto3" json:"started_unix,omitempty"`
+	FinishedUnix    int64    `protobuf:"varint,8,opt,name=finished_unix,json=finishedUnix,proto3" json:"finished_unix,omitempty"`
+	// Epoch of the topology in which the target owns the tokens
+	Epoch         uint64 `protobuf:"varint,9,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MigrationStatus) Reset() {
+	*x = MigrationStatus{}
+	mi := &file_proto_sharding_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MigrationStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MigrationStatus) ProtoMessage() {}
+
+func (x *MigrationStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MigrationStatus.ProtoReflect.Descriptor instead.
+func (*MigrationStatus) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *MigrationStatus) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *MigrationStatus) GetTargetId() string {
+	if x != nil {
+		return x.TargetId
+	}
+	return ""
+}
+
+func (x *MigrationStatus) GetTokens() []uint64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return nil
+}
+
+func (x *MigrationStatus) GetKeysCopied() uint64 {
+	if x != nil {
+		return x.KeysCopied
+	}
+	return 0
+}
+
+func (x *MigrationStatus) GetWritesForwarded() uint64 {
+	if x != nil {
+		return x.WritesForwarded
+	}
+	return 0
+}
+
+func (x *MigrationStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *MigrationStatus) GetStartedUnix() int64 {
+	if x != nil {
+		return x.StartedUnix
+	}
+	return 0
+}
+
+func (x *MigrationStatus) GetFinishedUnix() int64 {
+	if x != nil {
+		return x.FinishedUnix
+	}
+	return 0
+}
+
+func (x *MigrationStatus) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+// The part of the ring after start, up to and including end, wrapping
+// around when end is before start
+type ShardRange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         uint64                 `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           uint64                 `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShardRange) Reset() {
+	*x = ShardRange{}
+	mi := &file_proto_sharding_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShardRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShardRange) ProtoMessage() {}
+
+func (x *ShardRange) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShardRange.ProtoReflect.Descriptor instead.
+func (*ShardRange) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ShardRange) GetStart() uint64 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *ShardRange) GetEnd() uint64 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+type ImportKeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SourceId      string                 `protobuf:"bytes,1,opt,name=source_id,json=sourceId,proto3" json:"source_id,omitempty"`
+	Ranges        []*ShardRange          `protobuf:"bytes,2,rep,name=ranges,proto3" json:"ranges,omitempty"`
+	Entries       []*ReplicationEntry    `protobuf:"bytes,3,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportKeysRequest) Reset() {
+	*x = ImportKeysRequest{}
+	mi := &file_proto_sharding_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportKeysRequest) ProtoMessage() {}
+
+func (x *ImportKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportKeysRequest.ProtoReflect.Descriptor instead.
+func (*ImportKeysRequest) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ImportKeysRequest) GetSourceId() string {
+	if x != nil {
+		return x.SourceId
+	}
+	return ""
+}
+
+func (x *ImportKeysRequest) GetRanges() []*ShardRange {
+	if x != nil {
+		return x.Ranges
+	}
+	return nil
+}
+
+func (x *ImportKeysRequest) GetEntries() []*ReplicationEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type ImportKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       uint64                 `protobuf:"varint,1,opt,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportKeysResponse) Reset() {
+	*x = ImportKeysResponse{}
+	mi := &file_proto_sharding_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportKeysResponse) ProtoMessage() {}
+
+func (x *ImportKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_sharding_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportKeysResponse.ProtoReflect.Descriptor instead.
+func (*ImportKeysResponse) Descriptor() ([]byte, []int) {
+	return file_proto_sharding_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ImportKeysResponse) GetEntries() uint64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+var File_proto_sharding_proto protoreflect.FileDescriptor
+
+const file_proto_sharding_proto_rawDesc = "" +
+	"\n" +
+	"\x14proto/sharding.proto\x12\akvstore\x1a\x17proto/replication.proto\"/\n" +
+	"\tShardNode\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04addr\x18\x02 \x01(\tR\x04addr\"9\n" +
+	"\n" +
+	"ShardToken\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\x04R\x04hash\x12\x17\n" +
+	"\anode_id\x18\x02 \x01(\tR\x06nodeId\"\x11\n" +
+	"\x0fTopologyRequest\"\x98\x01\n" +
+	"\x10TopologyResponse\x12\x14\n" +
+	"\x05epoch\x18\x01 \x01(\x04R\x05epoch\x12(\n" +
+	"\x05nodes\x18\x02 \x03(\v2\x12.kvstore.ShardNodeR\x05nodes\x12+\n" +
+	"\x06tokens\x18\x03 \x03(\v2\x13.kvstore.ShardTokenR\x06tokens\x12\x17\n" +
+	"\aself_id\x18\x04 \x01(\tR\x06selfId\"9\n" +
+	"\x13AddShardNodeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04addr\x18\x02 \x01(\tR\x04addr\"q\n" +
+	"\x16TopologyChangeResponse\x125\n" +
+	"\btopology\x18\x01 \x01(\v2\x19.kvstore.TopologyResponseR\btopology\x12 \n" +
+	"\vunreachable\x18\x02 \x03(\tR\vunreachable\"L\n" +
+	"\x15StartMigrationRequest\x12\x1b\n" +
+	"\ttarget_id\x18\x01 \x01(\tR\btargetId\x12\x16\n" +
+	"\x06tokens\x18\x02 \x03(\x04R\x06tokens\"\x15\n" +
+	"\x13GetMigrationRequest\"\x17\n" +
+	"\x15AbortMigrationRequest\"\x9c\x02\n" +
+	"\x0fMigrationStatus\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\x12\x1b\n" +
+	"\ttarget_id\x18\x02 \x01(\tR\btargetId\x12\x16\n" +
+	"\x06tokens\x18\x03 \x03(\x04R\x06tokens\x12\x1f\n" +
+	"\vkeys_copied\x18\x04 \x01(\x04R\n" +
+	"keysCopied\x12)\n" +
+	"\x10writes_forwarded\x18\x05 \x01(\x04R\x0fwritesForwarded\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12!\n" +
+	"\fstarted_unix\x18\a \x01(\x03R\vstartedUnix\x12#\n" +
+	"\rfinished_unix\x18\b \x01(\x03R\ffinishedUnix\x12\x14\n" +
+	"\x05epoch\x18\t \x01(\x04R\x05epoch\"4\n" +
+	"\n" +
+	"ShardRange\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\x04R\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\x04R\x03end\"\x92\x01\n" +
+	"\x11ImportKeysRequest\x12\x1b\n" +
+	"\tsource_id\x18\x01 \x01(\tR\bsourceId\x12+\n" +
+	"\x06ranges\x18\x02 \x03(\v2\x13.kvstore.ShardRangeR\x06ranges\x123\n" +
+	"\aentries\x18\x03 \x03(\v2\x19.kvstore.ReplicationEntryR\aentries\".\n" +
+	"\x12ImportKeysResponse\x12\x18\n" +
+	"\aentries\x18\x01 \x01(\x04R\aentries2\x86\x04\n" +
+	"\bSharding\x12?\n" +
+	"\bTopology\x12\x18.kvstore.TopologyRequest\x1a\x19.kvstore.TopologyResponse\x12H\n" +
+	"\aAddNode\x12\x1c.kvstore.AddShardNodeRequest\x1a\x1f.kvstore.TopologyChangeResponse\x12F\n" +
+	"\x0eUpdateTopology\x12\x19.kvstore.TopologyResponse\x1a\x19.kvstore.TopologyResponse\x12J\n" +
+	"\x0eStartMigration\x12\x1e.kvstore.StartMigrationRequest\x1a\x18.kvstore.MigrationStatus\x12F\n" +
+	"\fGetMigration\x12\x1c.kvstore.GetMigrationRequest\x1a\x18.kvstore.MigrationStatus\x12J\n" +
+	"\x0eAbortMigration\x12\x1e.kvstore.AbortMigrationRequest\x1a\x18.kvstore.MigrationStatus\x12G\n" +
+	"\n" +
+	"ImportKeys\x12\x1a.kvstore.ImportKeysRequest\x1a\x1b.kvstore.ImportKeysResponse(\x01B=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
+
+var (
+	file_proto_sharding_proto_rawDescOnce sync.Once
+	file_proto_sharding_proto_rawDescData []byte
+)
+
+func file_proto_sharding_proto_rawDescGZIP() []byte {
+	file_proto_sharding_proto_rawDescOnce.Do(func() {
+		file_proto_sharding_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_sharding_proto_rawDesc), len(file_proto_sharding_proto_rawDesc)))
+	})
+	return file_proto_sharding_proto_rawDescData
+}
+
+var file_proto_sharding_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_proto_sharding_proto_goTypes = []any{
+	(*ShardNode)(nil),              // 0: kvstore.ShardNode
+	(*ShardToken)(nil),             // 1: kvstore.ShardToken
+	(*TopologyRequest)(nil),        // 2: kvstore.TopologyRequest
+	(*TopologyResponse)(nil),       // 3: kvstore.TopologyResponse
+	(*AddShardNodeRequest)(nil),    // 4: kvstore.AddShardNodeRequest
+	(*TopologyChangeResponse)(nil), // 5: kvstore.TopologyChangeResponse
+	(*StartMigrationRequest)(nil),  // 6: kvstore.StartMigrationRequest
+	(*GetMigrationRequest)(nil),    // 7: kvstore.GetMigrationRequest
+	(*AbortMigrationRequest)(nil),  // 8: kvstore.AbortMigrationRequest
+	(*MigrationStatus)(nil),        // 9: kvstore.MigrationStatus
+	(*ShardRange)(nil),             // 10: kvstore.ShardRange
+	(*ImportKeysRequest)(nil),      // 11: kvstore.ImportKeysRequest
+	(*ImportKeysResponse)(nil),     // 12: kvstore.ImportKeysResponse
+	(*ReplicationEntry)(nil),       // 13: kvstore.ReplicationEntry
+}
+var file_proto_sharding_proto_depIdxs = []int32{
+	0,  // 0: kvstore.TopologyResponse.nodes:type_name -> kvstore.ShardNode
+	1,  // 1: kvstore.TopologyResponse.tokens:type_name -> kvstore.ShardToken
+	3,  // 2: kvstore.TopologyChangeResponse.topology:type_name -> kvstore.TopologyResponse
+	10, // 3: kvstore.ImportKeysRequest.ranges:type_name -> kvstore.ShardRange
+	13, // 4: kvstore.ImportKeysRequest.entries:type_name -> kvstore.ReplicationEntry
+	2,  // 5: kvstore.Sharding.Topology:input_type -> kvstore.TopologyRequest
+	4,  // 6: kvstore.Sharding.AddNode:input_type -> kvstore.AddShardNodeRequest
+	3,  // 7: kvstore.Sharding.UpdateTopology:input_type -> kvstore.TopologyResponse
+	6,  // 8: kvstore.Sharding.StartMigration:input_type -> kvstore.StartMigrationRequest
+	7,  // 9: kvstore.Sharding.GetMigration:input_type -> kvstore.GetMigrationRequest
+	8,  // 10: kvstore.Sharding.AbortMigration:input_type -> kvstore.AbortMigrationRequest
+	11, // 11: kvstore.Sharding.ImportKeys:input_type -> kvstore.ImportKeysRequest
+	3,  // 12: kvstore.Sharding.Topology:output_type -> kvstore.TopologyResponse
+	5,  // 13: kvstore.Sharding.AddNode:output_type -> kvstore.TopologyChangeResponse
+	3,  // 14: kvstore.Sharding.UpdateTopology:output_type -> kvstore.TopologyResponse
+	9,  // 15: kvstore.Sharding.StartMigration:output_type -> kvstore.MigrationStatus
+	9,  // 16: kvstore.Sharding.GetMigration:output_type -> kvstore.MigrationStatus
+	9,  // 17: kvstore.Sharding.AbortMigration:output_type -> kvstore.MigrationStatus
+	12, // 18: kvstore.Sharding.ImportKeys:output_type -> kvstore.ImportKeysResponse
+	12, // [12:19] is the sub-list for method output_type
+	5,  // [5:12] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_proto_sharding_proto_init() }
+func file_proto_sharding_proto_init() {
+	if File_proto_sharding_proto != nil {
+		return
+	}
+	file_proto_replication_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_sharding_proto_rawDesc), len(file_proto_sharding_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_sharding_proto_goTypes,
+		DependencyIndexes: file_proto_sharding_proto_depIdxs,
+		MessageInfos:      file_proto_sharding_proto_msgTypes,
+	}.Build()
+	File_proto_sharding_proto = out.File
+	file_proto_sharding_proto_goTypes = nil
+	file_proto_sharding_proto_depIdxs = nil
+}
@@ -0,0 +1,361 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.31.1
+// source: proto/sharding.proto
+
+package kvstore
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Sharding_Topology_FullMethodName       = "/kvstore.Sharding/Topology"
+	Sharding_AddNode_FullMethodName        = "/kvstore.Sharding/AddNode"
+	Sharding_UpdateTopology_FullMethodName = "/kvstore.Sharding/UpdateTopology"
+	Sharding_StartMigration_FullMethodName = "/kvstore.Sharding/StartMigration"
+	Sharding_GetMigration_FullMethodName   = "/kvstore.Sharding/GetMigration"
+	Sharding_AbortMigration_FullMethodName = "/kvstore.Sharding/AbortMigration"
+	Sharding_ImportKeys_FullMethodName     = "/kvstore.Sharding/ImportKeys"
+)
+
+// ShardingClient is the client API for Sharding service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Describes how keys are spread over the shards of a sharded deployment.
+// Clients use it to send each key to the node that owns it.
+type ShardingClient interface {
+	Topology(ctx context.Context, in *TopologyRequest, opts ...grpc.CallOption) (*TopologyResponse, error)
+	// Adds a node without tokens and sends the new topology to every node
+	AddNode(ctx context.Context, in *AddShardNodeRequest, opts ...grpc.CallOption) (*TopologyChangeResponse, error)
+	// Replaces the topology if the given one has a higher epoch
+	UpdateTopology(ctx context.Context, in *TopologyResponse, opts ...grpc.CallOption) (*TopologyResponse, error)
+	// Called on the node that owns the tokens, moves them to the target
+	StartMigration(ctx context.Context, in *StartMigrationRequest, opts ...grpc.CallOption) (*MigrationStatus, error)
+	GetMigration(ctx context.Context, in *GetMigrationRequest, opts ...grpc.CallOption) (*MigrationStatus, error)
+	AbortMigration(ctx context.Context, in *AbortMigrationRequest, opts ...grpc.CallOption) (*MigrationStatus, error)
+	// Called by the source of a migration on its target. The first message
+	// names the ranges, whose keys the target drops before taking the ones
+	// sent. If the stream breaks they are dropped again.
+	ImportKeys(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImportKeysRequest, ImportKeysResponse], error)
+}
+
+type shardingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShardingClient(cc grpc.ClientConnInterface) ShardingClient {
+	return &shardingClient{cc}
+}
+
+func (c *shardingClient) Topology(ctx context.Context, in *TopologyRequest, opts ...grpc.CallOption) (*TopologyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TopologyResponse)
+	err := c.cc.Invoke(ctx, Sharding_Topology_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) AddNode(ctx context.Context, in *AddShardNodeRequest, opts ...grpc.CallOption) (*TopologyChangeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TopologyChangeResponse)
+	err := c.cc.Invoke(ctx, Sharding_AddNode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) UpdateTopology(ctx context.Context, in *TopologyResponse, opts ...grpc.CallOption) (*TopologyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TopologyResponse)
+	err := c.cc.Invoke(ctx, Sharding_UpdateTopology_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) StartMigration(ctx context.Context, in *StartMigrationRequest, opts ...grpc.CallOption) (*MigrationStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MigrationStatus)
+	err := c.cc.Invoke(ctx, Sharding_StartMigration_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) GetMigration(ctx context.Context, in *GetMigrationRequest, opts ...grpc.CallOption) (*MigrationStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MigrationStatus)
+	err := c.cc.Invoke(ctx, Sharding_GetMigration_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) AbortMigration(ctx context.Context, in *AbortMigrationRequest, opts ...grpc.CallOption) (*MigrationStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MigrationStatus)
+	err := c.cc.Invoke(ctx, Sharding_AbortMigration_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardingClient) ImportKeys(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImportKeysRequest, ImportKeysResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Sharding_ServiceDesc.Streams[0], Sharding_ImportKeys_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ImportKeysRequest, ImportKeysResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Sharding_ImportKeysClient = grpc.ClientStreamingClient[ImportKeysRequest, ImportKeysResponse]
+
+// ShardingServer is the server API for Sharding service.
+// All implementations must embed UnimplementedShardingServer
+// for forward compatibility.
+//
+// Describes how keys are spread over the shards of a sharded deployment.
+// Clients use it to send each key to the node that owns it.
+type ShardingServer interface {
+	Topology(context.Context, *TopologyRequest) (*TopologyResponse, error)
+	// Adds a node without tokens and sends the new topology to every node
+	AddNode(context.Context, *AddShardNodeRequest) (*TopologyChangeResponse, error)
+	// Replaces the topology if the given one has a higher epoch
+	UpdateTopology(context.Context, *TopologyResponse) (*TopologyResponse, error)
+	// Called on the node that owns the tokens, moves them to the target
+	StartMigration(context.Context, *StartMigrationRequest) (*MigrationStatus, error)
+	GetMigration(context.Context, *GetMigrationRequest) (*MigrationStatus, error)
+	AbortMigration(context.Context, *AbortMigrationRequest) (*MigrationStatus, error)
+	// Called by the source of a migration on its target. The first message
+	// names the ranges, whose keys the target drops before taking the ones
+	// sent. If the stream breaks they are dropped again.
+	ImportKeys(grpc.ClientStreamingServer[ImportKeysRequest, ImportKeysResponse]) error
+	mustEmbedUnimplementedShardingServer()
+}
+
+// UnimplementedShardingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedShardingServer struct{}
+
+func (UnimplementedShardingServer) Topology(context.Context, *TopologyRequest) (*TopologyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Topology not implemented")
+}
+func (UnimplementedShardingServer) AddNode(context.Context, *AddShardNodeRequest) (*TopologyChangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddNode not implemented")
+}
+func (UnimplementedShardingServer) UpdateTopology(context.Context, *TopologyResponse) (*TopologyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTopology not implemented")
+}
+func (UnimplementedShardingServer) StartMigration(context.Context, *StartMigrationRequest) (*MigrationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartMigration not implemented")
+}
+func (UnimplementedShardingServer) GetMigration(context.Context, *GetMigrationRequest) (*MigrationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMigration not implemented")
+}
+func (UnimplementedShardingServer) AbortMigration(context.Context, *AbortMigrationRequest) (*MigrationStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AbortMigration not implemented")
+}
+func (UnimplementedShardingServer) ImportKeys(grpc.ClientStreamingServer[ImportKeysRequest, ImportKeysResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ImportKeys not implemented")
+}
+func (UnimplementedShardingServer) mustEmbedUnimplementedShardingServer() {}
+func (UnimplementedShardingServer) testEmbeddedByValue()                  {}
+
+// UnsafeShardingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShardingServer will
+// result in compilation errors.
+type UnsafeShardingServer interface {
+	mustEmbedUnimplementedShardingServer()
+}
+
+func RegisterShardingServer(s grpc.ServiceRegistrar, srv ShardingServer) {
+	// If the following call pancis, it indicates UnimplementedShardingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Sharding_ServiceDesc, srv)
+}
+
+func _Sharding_Topology_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopologyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardingServer).Topology(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sharding_Topology_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardingServer).Topology(ctx, req.(*TopologyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sharding_AddNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddShardNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardingServer).AddNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sharding_AddNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardingServer).AddNode(ctx, req.(*AddShardNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sharding_UpdateTopology_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopologyResponse)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardingServer).UpdateTopology(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sharding_UpdateTopology_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardingServer).UpdateTopology(ctx, req.(*TopologyResponse))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sharding_StartMigration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartMigrationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardingServer).StartMigration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sharding_StartMigration_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardingServer).StartMigration(ctx, req.(*StartMigrationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sharding_GetMigration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMigrationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardingServer).GetMigration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sharding_GetMigration_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardingServer).GetMigration(ctx, req.(*GetMigrationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sharding_AbortMigration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbortMigrationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardingServer).AbortMigration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sharding_AbortMigration_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardingServer).AbortMigration(ctx, req.(*AbortMigrationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sharding_ImportKeys_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShardingServer).ImportKeys(&grpc.GenericServerStream[ImportKeysRequest, ImportKeysResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Sharding_ImportKeysServer = grpc.ClientStreamingServer[ImportKeysRequest, ImportKeysResponse]
+
+// Sharding_ServiceDesc is the grpc.ServiceDesc for Sharding service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Sharding_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvstore.Sharding",
+	HandlerType: (*ShardingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Topology",
+			Handler:    _Sharding_Topology_Handler,
+		},
+		{
+			MethodName: "AddNode",
+			Handler:    _Sharding_AddNode_Handler,
+		},
+		{
+			MethodName: "UpdateTopology",
+			Handler:    _Sharding_UpdateTopology_Handler,
+		},
+		{
+			MethodName: "StartMigration",
+			Handler:    _Sharding_StartMigration_Handler,
+		},
+		{
+			MethodName: "GetMigration",
+			Handler:    _Sharding_GetMigration_Handler,
+		},
+		{
+			MethodName: "AbortMigration",
+			Handler:    _Sharding_AbortMigration_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ImportKeys",
+			Handler:       _Sharding_ImportKeys_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/sharding.proto",
+}
@@ -0,0 +1,185 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.31.1
+// source: proto/tracking.proto
+
+package kvstore
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InvalidationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvalidationsRequest) Reset() {
+	*x = InvalidationsRequest{}
+	mi := &file_proto_tracking_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvalidationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvalidationsRequest) ProtoMessage() {}
+
+func (x *InvalidationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tracking_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvalidationsRequest.ProtoReflect.Descriptor instead.
+func (*InvalidationsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_tracking_proto_rawDescGZIP(), []int{0}
+}
+
+type Invalidation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only set on the first message
+	ClientId uint64 `protobuf:"varint,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	// Keys that changed, expired or were removed
+	Keys []string `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	// Every key may have changed, e.g. after a replica's full sync
+	All           bool `protobuf:"varint,3,opt,name=all,proto3" json:"all,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Invalidation) Reset() {
+	*x = Invalidation{}
+	mi := &file_proto_tracking_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Invalidation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Invalidation) ProtoMessage() {}
+
+func (x *Invalidation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_tracking_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Invalidation.ProtoReflect.Descriptor instead.
+func (*Invalidation) Descriptor() ([]byte, []int) {
+	return file_proto_tracking_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Invalidation) GetClientId() uint64 {
+	if x != nil {
+		return x.ClientId
+	}
+	return 0
+}
+
+func (x *Invalidation) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *Invalidation) GetAll() bool {
+	if x != nil {
+		return x.All
+	}
+	return false
+}
+
+var File_proto_tracking_proto protoreflect.FileDescriptor
+
+const file_proto_tracking_proto_rawDesc = "" +
+	"\n" +
+	"\x14proto/tracking.proto\x12\akvstore\"\x16\n" +
+	"\x14InvalidationsRequest\"Q\n" +
+	"\fInvalidation\x12\x1b\n" +
+	"\tclient_id\x18\x01 \x01(\x04R\bclientId\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\tR\x04keys\x12\x10\n" +
+	"\x03all\x18\x03 \x01(\bR\x03all2S\n" +
+	"\bTracking\x12G\n" +
+	"\rInvalidations\x12\x1d.kvstore.InvalidationsRequest\x1a\x15.kvstore.Invalidation0\x01B=Z;github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstoreb\x06proto3"
+
+var (
+	file_proto_tracking_proto_rawDescOnce sync.Once
+	file_proto_tracking_proto_rawDescData []byte
+)
+
+func file_proto_tracking_proto_rawDescGZIP() []byte {
+	file_proto_tracking_proto_rawDescOnce.Do(func() {
+		file_proto_tracking_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_tracking_proto_rawDesc), len(file_proto_tracking_proto_rawDesc)))
+	})
+	return file_proto_tracking_proto_rawDescData
+}
+
+var file_proto_tracking_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_tracking_proto_goTypes = []any{
+	(*InvalidationsRequest)(nil), // 0: kvstore.InvalidationsRequest
+	(*Invalidation)(nil),         // 1: kvstore.Invalidation
+}
+var file_proto_tracking_proto_depIdxs = []int32{
+	0, // 0: kvstore.Tracking.Invalidations:input_type -> kvstore.InvalidationsRequest
+	1, // 1: kvstore.Tracking.Invalidations:output_type -> kvstore.Invalidation
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_tracking_proto_init() }
+func file_proto_tracking_proto_init() {
+	if File_proto_tracking_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_tracking_proto_rawDesc), len(file_proto_tracking_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_tracking_proto_goTypes,
+		DependencyIndexes: file_proto_tracking_proto_depIdxs,
+		MessageInfos:      file_proto_tracking_proto_msgTypes,
+	}.Build()
+	File_proto_tracking_proto = out.File
+	file_proto_tracking_proto_goTypes = nil
+	file_proto_tracking_proto_depIdxs = nil
+}
@@ -0,0 +1,140 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.31.1
+// source: proto/tracking.proto
+
+package kvstore
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tracking_Invalidations_FullMethodName = "/kvstore.Tracking/Invalidations"
+)
+
+// TrackingClient is the client API for Tracking service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Invalidations for clients that cache keys locally. Any authenticated user
+// may subscribe.
+type TrackingClient interface {
+	// The first message carries the client ID. Get and MGet calls sent with
+	// that ID in the kvstore-tracking-id metadata are tracked: the response
+	// has the keys' expiry in the kvstore-expires-at header, and the next
+	// change to each key is sent on this stream. Tracking ends with the
+	// stream.
+	Invalidations(ctx context.Context, in *InvalidationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Invalidation], error)
+}
+
+type trackingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrackingClient(cc grpc.ClientConnInterface) TrackingClient {
+	return &trackingClient{cc}
+}
+
+func (c *trackingClient) Invalidations(ctx context.Context, in *InvalidationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Invalidation], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tracking_ServiceDesc.Streams[0], Tracking_Invalidations_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[InvalidationsRequest, Invalidation]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tracking_InvalidationsClient = grpc.ServerStreamingClient[Invalidation]
+
+// TrackingServer is the server API for Tracking service.
+// All implementations must embed UnimplementedTrackingServer
+// for forward compatibility.
+//
+// Invalidations for clients that cache keys locally. Any authenticated user
+// may subscribe.
+type TrackingServer interface {
+	// The first message carries the client ID. Get and MGet calls sent with
+	// that ID in the kvstore-tracking-id metadata are tracked: the response
+	// has the keys' expiry in the kvstore-expires-at header, and the next
+	// change to each key is sent on this stream. Tracking ends with the
+	// stream.
+	Invalidations(*InvalidationsRequest, grpc.ServerStreamingServer[Invalidation]) error
+	mustEmbedUnimplementedTrackingServer()
+}
+
+// UnimplementedTrackingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTrackingServer struct{}
+
+func (UnimplementedTrackingServer) Invalidations(*InvalidationsRequest, grpc.ServerStreamingServer[Invalidation]) error {
+	return status.Errorf(codes.Unimplemented, "method Invalidations not implemented")
+}
+func (UnimplementedTrackingServer) mustEmbedUnimplementedTrackingServer() {}
+func (UnimplementedTrackingServer) testEmbeddedByValue()                  {}
+
+// UnsafeTrackingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrackingServer will
+// result in compilation errors.
+type UnsafeTrackingServer interface {
+	mustEmbedUnimplementedTrackingServer()
+}
+
+func RegisterTrackingServer(s grpc.ServiceRegistrar, srv TrackingServer) {
+	// If the following call pancis, it indicates UnimplementedTrackingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tracking_ServiceDesc, srv)
+}
+
+func _Tracking_Invalidations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(InvalidationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrackingServer).Invalidations(m, &grpc.GenericServerStream[InvalidationsRequest, Invalidation]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tracking_InvalidationsServer = grpc.ServerStreamingServer[Invalidation]
+
+// Tracking_ServiceDesc is the grpc.ServiceDesc for Tracking service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tracking_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvstore.Tracking",
+	HandlerType: (*TrackingServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Invalidations",
+			Handler:       _Tracking_Invalidations_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/tracking.proto",
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func startAdminServer(t *testing.T, st *store.Store) (kvstore.KVStoreClient, kvstore.AdminClient) {
+	t.Helper()
+	srv := api.NewGRPCServer(st)
+	srv.EnableAdmin(nil)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return kvstore.NewKVStoreClient(conn), kvstore.NewAdminClient(conn)
+}
+
+func TestAdminFlushAndInfo(t *testing.T) {
+	client, admin := startAdminServer(t, newTestStore(t))
+	ctx := context.Background()
+
+	client.MSet(ctx, &kvstore.MSetRequest{Entries: []*kvstore.SetRequest{
+		{Key: "a/1", Value: "x"},
+		{Key: "a/2", Value: "y", TtlSeconds: 60},
+		{Key: "b/1", Value: "z"},
+	}})
+
+	info, err := admin.Info(ctx, &kvstore.InfoRequest{})
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Keys != 3 || info.KeysWithExpiry != 1 || info.DataBytes != 12 || info.AofSizeBytes == 0 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	if _, err := admin.Flush(ctx, &kvstore.FlushRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an empty flush to be rejected, got %v", err)
+	}
+	resp, err := admin.Flush(ctx, &kvstore.FlushRequest{Prefix: "a/"})
+	if err != nil || resp.Deleted != 2 {
+		t.Fatalf("Flush prefix: resp=%v err=%v", resp, err)
+	}
+	resp, err = admin.Flush(ctx, &kvstore.FlushRequest{All: true})
+	if err != nil || resp.Deleted != 1 {
+		t.Fatalf("Flush all: resp=%v err=%v", resp, err)
+	}
+
+	if _, err := admin.Snapshot(ctx, &kvstore.SnapshotRequest{}); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	info, _ = admin.Info(ctx, &kvstore.InfoRequest{})
+	if info.Keys != 0 || info.LastSnapshotUnix == 0 || info.LastSnapshotError != "" {
+		t.Fatalf("unexpected info after snapshot: %+v", info)
+	}
+}
+
+func TestAdminReadOnly(t *testing.T) {
+	client, admin := startAdminServer(t, newTestStore(t))
+	ctx := context.Background()
+
+	client.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v"})
+	if _, err := admin.SetReadOnly(ctx, &kvstore.SetReadOnlyRequest{ReadOnly: true}); err != nil {
+		t.Fatalf("SetReadOnly: %v", err)
+	}
+
+	if _, err := client.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v2"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a write, got %v", err)
+	}
+	if _, err := client.Delete(ctx, &kvstore.DeleteRequest{Key: "k"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a delete, got %v", err)
+	}
+	if resp, err := client.Get(ctx, &kvstore.GetRequest{Key: "k"}); err != nil || resp.Value != "v" {
+		t.Fatalf("reads should still work: resp=%v err=%v", resp, err)
+	}
+
+	resp, _ := admin.SetReadOnly(ctx, &kvstore.SetReadOnlyRequest{ReadOnly: false})
+	if !resp.Previous {
+		t.Fatalf("expected the previous mode to be read-only")
+	}
+	if _, err := client.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v2"}); err != nil {
+		t.Fatalf("Set after leaving read-only mode: %v", err)
+	}
+}
+
+func TestRewriteAOF(t *testing.T) {
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+
+	s, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	for range 10 {
+		s.Set("counter", "v", 0, true)
+	}
+	s.Set("gone", "v", 0, true)
+	s.Delete("gone")
+
+	records, err := s.RewriteAOF()
+	if err != nil || records != 1 {
+		t.Fatalf("RewriteAOF: records=%d err=%v", records, err)
+	}
+	// Writes after the rewrite go to the new file
+	s.Set("after", "v", 0, true)
+	s.Close()
+
+	file, err := os.Open(aofPath)
+	if err != nil {
+		t.Fatalf("open AOF: %v", err)
+	}
+	entries, _, err := persistance.ReadAOF(file)
+	file.Close()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 records after rewrite, got %d (err %v)", len(entries), err)
+	}
+
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+	if _, ok := s.Get("counter"); !ok {
+		t.Fatalf("expected counter after reload")
+	}
+	if _, ok := s.Get("after"); !ok {
+		t.Fatalf("expected key written after the rewrite")
+	}
+	if _, ok := s.Get("gone"); ok {
+		t.Fatalf("expected deleted key to stay deleted")
+	}
+}
+
+func TestRewriteAOFKeepsSnapshotDeletes(t *testing.T) {
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+
+	s, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	s.Set("a", "1", 0, true)
+	s.Set("b", "1", 0, true)
+	if err := s.SaveSnapshot(); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	s.Delete("a")
+	if _, err := s.RewriteAOF(); err != nil {
+		t.Fatalf("RewriteAOF: %v", err)
+	}
+	s.Close()
+
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+	if _, ok := s.Get("a"); ok {
+		t.Fatalf("expected a key deleted after the snapshot to stay deleted")
+	}
+	if _, ok := s.Get("b"); !ok {
+		t.Fatalf("expected b after reload")
+	}
+}
+
+func TestAdminReloadConfig(t *testing.T) {
+	ctx := context.Background()
+	_, admin := startAdminServer(t, newTestStore(t))
+	if _, err := admin.ReloadConfig(ctx, &kvstore.ReloadConfigRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented without a reload func, got %v", err)
+	}
+
+	var reloadErr error
+	srv := api.NewGRPCServer(newTestStore(t))
+	srv.EnableAdmin(func() ([]string, []string, error) {
+		if reloadErr != nil {
+			return nil, nil, reloadErr
+		}
+		return []string{"LOG_LEVEL"}, []string{"PORT"}, nil
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	admin = kvstore.NewAdminClient(conn)
+
+	resp, err := admin.ReloadConfig(ctx, &kvstore.ReloadConfigRequest{})
+	if err != nil || len(resp.Applied) != 1 || resp.Applied[0] != "LOG_LEVEL" || len(resp.RestartRequired) != 1 || resp.RestartRequired[0] != "PORT" {
+		t.Fatalf("ReloadConfig: resp=%v err=%v", resp, err)
+	}
+	reloadErr = errors.New("PORT must be between 1 and 65535")
+	if _, err := admin.ReloadConfig(ctx, &kvstore.ReloadConfigRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a rejected config, got %v", err)
+	}
+}
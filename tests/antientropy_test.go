@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMerkleTreeFindsTheDifferingRange(t *testing.T) {
+	a, b := newTestStore(t), newTestStore(t)
+	for _, s := range []*store.Store{a, b} {
+		for _, key := range []string{"k1", "k2", "k3", "k4"} {
+			s.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: key, Value: "v", Version: 1})
+		}
+	}
+	const depth = 4
+	treeA, treeB := a.MerkleTree(depth), b.MerkleTree(depth)
+	rootA, _ := treeA.Node(0)
+	if rootA == 0 {
+		t.Fatalf("expected a non-empty root")
+	}
+	if rootB, _ := treeB.Node(0); rootA != rootB {
+		t.Fatalf("expected equal roots for equal data")
+	}
+
+	// Versions differ between copies and are left out
+	b.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "k2", Value: "v", Version: 7})
+	if rootB, _ := b.MerkleTree(depth).Node(0); rootA != rootB {
+		t.Fatalf("expected the version to be left out of the hash")
+	}
+
+	b.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "k3", Value: "changed", Version: 8})
+	treeB = b.MerkleTree(depth)
+	var differing []int
+	for i := 0; ; i++ {
+		hashA, ok := treeA.Node(i)
+		if !ok {
+			break
+		}
+		hashB, _ := treeB.Node(i)
+		if leaf, isLeaf := treeA.Leaf(i); isLeaf && hashA != hashB {
+			differing = append(differing, leaf)
+		}
+	}
+	if len(differing) != 1 || differing[0] != store.KeyRange("k3", depth) {
+		t.Fatalf("expected only the range of k3 to differ, got %v", differing)
+	}
+}
+
+func TestStoreRepairKeepsNewerWrites(t *testing.T) {
+	s := newTestStore(t)
+	s.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "newer", Value: "local", Version: 9})
+	s.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "stale", Value: "local", Version: 3})
+	s.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "gone", Value: "local", Version: 2})
+	s.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "after", Value: "local", Version: 8})
+
+	const depth = 0
+	primary := []store.Entry{
+		{Key: "newer", Item: store.Item{Value: "primary", Version: 4}},
+		{Key: "stale", Item: store.Item{Value: "primary", Version: 5}},
+		{Key: "missing", Item: store.Item{Value: "primary", Version: 6}},
+	}
+	// The primary had handed out versions up to 7, so "after" is newer
+	// than its copy and "gone" was deleted there
+	if fixed := s.Repair(depth, []int{0}, primary, 7); fixed != 3 {
+		t.Fatalf("expected 3 keys fixed, got %d", fixed)
+	}
+	for key, want := range map[string]string{"newer": "local", "stale": "primary", "missing": "primary", "after": "local"} {
+		if v, _ := s.Get(key); v != want {
+			t.Fatalf("key %s: expected %q, got %q", key, want, v)
+		}
+	}
+	if _, ok := s.Get("gone"); ok {
+		t.Fatalf("expected the key the primary doesn't have to be deleted")
+	}
+	if item, _ := s.GetItem("missing"); item.Version != 6 {
+		t.Fatalf("expected the primary's version, got %d", item.Version)
+	}
+}
+
+func TestReplicaRepairsDivergence(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestStore(t)
+	_, primaryConn := startReplicationNode(t, primary, nil)
+	client := kvstore.NewKVStoreClient(primaryConn)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		client.Set(ctx, &kvstore.SetRequest{Key: key, Value: "v"})
+	}
+
+	replicaStore := newTestStore(t)
+	replica := startReplica(t, replicaStore, primaryConn.Target())
+	_, replicaConn := startReplicationNode(t, replicaStore, replica)
+	waitUntil(t, "the full sync", func() bool { return replica.Status().Connected })
+
+	// What a crash could leave behind: a lost write, a lost delete and a
+	// value that didn't make it
+	b, _ := replicaStore.GetItem("b")
+	replicaStore.ApplyReplicated(persistance.AOFEntry{Op: "delete", Key: "a"})
+	replicaStore.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "b", Value: "corrupt", Version: b.Version})
+	replicaStore.ApplyReplicated(persistance.AOFEntry{Op: "set", Key: "ghost", Value: "v", Version: 1})
+
+	replicationClient := kvstore.NewReplicationClient(replicaConn)
+	resp, err := replicationClient.Repair(ctx, &kvstore.RepairRequest{})
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Error != "" || resp.Results[0].KeysFixed != 3 || resp.Results[0].Ranges == 0 {
+		t.Fatalf("expected 3 keys fixed, got %+v", resp.Results)
+	}
+	rootPrimary, _ := primary.MerkleTree(store.DefaultMerkleDepth).Node(0)
+	if rootReplica, _ := replicaStore.MerkleTree(store.DefaultMerkleDepth).Node(0); rootPrimary != rootReplica {
+		t.Fatalf("expected the replica to match the primary after the repair")
+	}
+	if v, _ := replicaStore.Get("b"); v != "v" {
+		t.Fatalf("expected b repaired, got %q", v)
+	}
+
+	resp, err = replicationClient.Repair(ctx, &kvstore.RepairRequest{})
+	if err != nil || resp.Results[0].KeysFixed != 0 || resp.Results[0].Ranges != 0 {
+		t.Fatalf("expected nothing left to repair, got %+v, %v", resp, err)
+	}
+	st, err := replicationClient.Status(ctx, &kvstore.ReplicationStatusRequest{})
+	if err != nil || st.KeysRepaired != 3 {
+		t.Fatalf("expected 3 keys repaired in the status, got %+v, %v", st, err)
+	}
+
+	// A primary has nothing to repair from
+	_, err = kvstore.NewReplicationClient(primaryConn).Repair(ctx, &kvstore.RepairRequest{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition on a primary, got %v", err)
+	}
+}
+
+func TestSiteRepairMergesTheOtherSite(t *testing.T) {
+	ctx := context.Background()
+	siteA, siteB := newTestStore(t), newTestStore(t)
+	siteA.EnableMultiMaster("a", hlc.NewClock(nil))
+	siteB.EnableMultiMaster("b", hlc.NewClock(nil))
+	siteA.Set("k", "old", 0, true)
+	siteB.Set("only-b", "v", 0, true)
+	siteB.Set("deleted", "v", 0, true)
+	siteB.Delete("deleted")
+	siteA.Merge(persistance.AOFEntry{Op: "set", Key: "deleted", Value: "v", Timestamp: hlc.FromTime(time.Now().Add(-time.Hour)), Origin: "b"})
+	siteB.Set("k", "new", 0, true)
+	_, connB := startReplicationNode(t, siteB, nil)
+
+	// Not running, so only the repair brings the writes over
+	peer, err := replication.NewPeer(siteA, "b", connB.Target(), replication.PeerOptions{Origin: "a"})
+	if err != nil {
+		t.Fatalf("NewPeer: %v", err)
+	}
+	defer peer.Close()
+	result, err := peer.Repair(ctx)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if result.KeysFixed != 3 {
+		t.Fatalf("expected 3 keys fixed, got %+v", result)
+	}
+	if v, _ := siteA.Get("k"); v != "new" {
+		t.Fatalf("expected the newer write, got %q", v)
+	}
+	if v, _ := siteA.Get("only-b"); v != "v" {
+		t.Fatalf("expected the missing key, got %q", v)
+	}
+	if _, ok := siteA.Get("deleted"); ok {
+		t.Fatalf("expected the tombstone to delete the key")
+	}
+	if peer.Status().KeysRepaired != 3 {
+		t.Fatalf("expected 3 keys repaired in the status, got %+v", peer.Status())
+	}
+}
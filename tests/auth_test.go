@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testACL = `
+users:
+  - name: app
+    token: app-token
+    permissions:
+      - prefix: "app/"
+        access: [read, write]
+      - prefix: "shared/"
+        access: [read]
+  - name: ops
+    # sha256("ops-token")
+    token_sha256: d9310c002af91822beb0b3487d8b04f85bf6bf1f8a5496bff7d35fc7c5a29def
+    permissions:
+      - access: [admin]
+`
+
+func TestParseACL(t *testing.T) {
+	acl, err := auth.ParseACL([]byte(testACL))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	user, err := acl.Authenticate("app-token")
+	if err != nil || user.Name != "app" {
+		t.Fatalf("Authenticate: user=%v err=%v", user, err)
+	}
+	if !user.Allowed(auth.Write, "app/x") || user.Allowed(auth.Write, "shared/x") || !user.Allowed(auth.Read, "shared/x") {
+		t.Fatalf("unexpected permissions for app")
+	}
+	if user.Allowed(auth.Read, "other") || user.Allowed(auth.Admin, "app/x") {
+		t.Fatalf("app should only reach its own prefixes")
+	}
+	if _, err := acl.Authenticate("wrong"); err != auth.ErrUnauthenticated {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+
+	for _, bad := range []string{
+		"users:\n  - name: x\n",
+		"users:\n  - name: x\n    token: t\n    permissions:\n      - access: [fly]\n",
+		"users:\n  - name: x\n    token: t\n  - name: y\n    token: t\n",
+		"users:\n  - name: x\n    token_sha256: abc\n",
+	} {
+		if _, err := auth.ParseACL([]byte(bad)); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestGRPCServerAuthInterceptor(t *testing.T) {
+	acl, err := auth.ParseACL([]byte(testACL))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	srv := api.NewGRPCServer(newTestStore(t), grpc.UnaryInterceptor(api.AuthInterceptor(acl)))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := kvstore.NewKVStoreClient(conn)
+
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	expectCode := func(err error, want codes.Code) {
+		t.Helper()
+		if got := status.Code(err); got != want {
+			t.Fatalf("expected %v, got %v (%v)", want, got, err)
+		}
+	}
+
+	_, err = client.Get(context.Background(), &kvstore.GetRequest{Key: "app/k"})
+	expectCode(err, codes.Unauthenticated)
+	_, err = client.Get(withToken("nope"), &kvstore.GetRequest{Key: "app/k"})
+	expectCode(err, codes.Unauthenticated)
+
+	_, err = client.Set(withToken("app-token"), &kvstore.SetRequest{Key: "app/k", Value: "v"})
+	expectCode(err, codes.OK)
+	_, err = client.Set(withToken("app-token"), &kvstore.SetRequest{Key: "shared/k", Value: "v"})
+	expectCode(err, codes.PermissionDenied)
+	_, err = client.Get(withToken("app-token"), &kvstore.GetRequest{Key: "shared/k"})
+	expectCode(err, codes.OK)
+
+	// One key outside the user's prefixes rejects the whole batch
+	_, err = client.MGet(withToken("app-token"), &kvstore.MGetRequest{Keys: []string{"app/k", "secret"}})
+	expectCode(err, codes.PermissionDenied)
+	_, err = client.MSet(withToken("app-token"), &kvstore.MSetRequest{Entries: []*kvstore.SetRequest{{Key: "app/a"}, {Key: "secret"}}})
+	expectCode(err, codes.PermissionDenied)
+
+	// Admin implies read and write everywhere
+	_, err = client.MDelete(withToken("ops-token"), &kvstore.MDeleteRequest{Keys: []string{"app/k", "secret"}})
+	expectCode(err, codes.OK)
+}
+
+func TestReloadableACL(t *testing.T) {
+	acl, err := auth.ParseACL([]byte(testACL))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	reloadable := auth.NewReloadableACL(acl)
+	if _, err := reloadable.Authenticate("app-token"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	// Rotating a token takes the old one out of use
+	rotated, err := auth.ParseACL([]byte("users:\n  - name: app\n    token: new-token\n"))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	reloadable.Swap(rotated)
+	if _, err := reloadable.Authenticate("app-token"); err != auth.ErrUnauthenticated {
+		t.Fatalf("expected the old token to be rejected, got %v", err)
+	}
+	if user, err := reloadable.Authenticate("new-token"); err != nil || user.Name != "app" {
+		t.Fatalf("Authenticate: user=%v err=%v", user, err)
+	}
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/changefeed"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestStoreReportsChanges(t *testing.T) {
+	s := newTestStore(t)
+	var changes []store.Change
+	s.SetChangeObserver(func(c store.Change) { changes = append(changes, c) })
+
+	s.Set("k", "v1", 0, true)
+	s.Set("k", "v2", 0, true)
+	s.Delete("k")
+	s.SetWithOptions("short", "v", store.SetOptions{ExpiresAt: time.Now().Add(10 * time.Millisecond)})
+	time.Sleep(20 * time.Millisecond)
+	s.Get("short")
+	s.Set("big", "0123456789", 0, true)
+	s.SetMaxMemory(4)
+
+	want := []struct{ op, key, old, new string }{
+		{store.ChangeSet, "k", "", "v1"},
+		{store.ChangeSet, "k", "v1", "v2"},
+		{store.ChangeDelete, "k", "v2", ""},
+		{store.ChangeSet, "short", "", "v"},
+		{store.ChangeExpire, "short", "v", ""},
+		{store.ChangeSet, "big", "", "0123456789"},
+		{store.ChangeEvict, "big", "0123456789", ""},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Op != w.op || c.Key != w.key {
+			t.Fatalf("change %d: expected %s %s, got %s %s", i, w.op, w.key, c.Op, c.Key)
+		}
+		if (c.Old == nil) != (w.old == "") || c.Old != nil && c.Old.Value != w.old {
+			t.Fatalf("change %d: expected old value %q, got %+v", i, w.old, c.Old)
+		}
+		if (c.New == nil) != (w.new == "") || c.New != nil && c.New.Value != w.new {
+			t.Fatalf("change %d: expected new value %q, got %+v", i, w.new, c.New)
+		}
+	}
+}
+
+// Reads from the log until n changes came in.
+func readChanges(log *changefeed.Log, from uint64, n int) ([]changefeed.Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var records []changefeed.Record
+	errDone := errors.New("done")
+	err := log.Read(ctx, from, func(r changefeed.Record) error {
+		records = append(records, r)
+		if len(records) == n {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		return records, fmt.Errorf("%w after %d changes", err, len(records))
+	}
+	return records, nil
+}
+
+func TestChangeFeedResumesAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	opts := changefeed.Options{SegmentBytes: 300}
+	log, err := changefeed.Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := range 10 {
+		log.Append(store.Change{Op: store.ChangeSet, Key: fmt.Sprintf("k%d", i), New: &store.Item{Value: "v"}})
+	}
+	if st := log.Stats(); st.Segments < 3 || st.First != 1 || st.Last != 10 {
+		t.Fatalf("expected 10 changes over several segments, got %+v", st)
+	}
+	records, err := readChanges(log, 4, 7)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	for i, r := range records {
+		if r.LSN != uint64(4+i) || r.Key != fmt.Sprintf("k%d", 3+i) {
+			t.Fatalf("expected change %d, got %+v", 4+i, r)
+		}
+	}
+
+	// A reader waiting at the end gets the changes as they are appended
+	got := make(chan error, 1)
+	go func() {
+		records, err = readChanges(log, 11, 2)
+		got <- err
+	}()
+	log.Append(store.Change{Op: store.ChangeDelete, Key: "k0", Old: &store.Item{Value: "v"}})
+	log.Append(store.Change{Op: store.ChangeDelete, Key: "k1", Old: &store.Item{Value: "v"}})
+	if err := <-got; err != nil || records[1].LSN != 12 || records[1].Op != store.ChangeDelete || records[1].Old.Value != "v" {
+		t.Fatalf("expected the new changes, got %+v, %v", records, err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Numbering carries on after a restart, and retention only deletes
+	// closed segments
+	opts.MaxBytes = 300
+	log, err = changefeed.Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer log.Close()
+	if log.Next() != 13 {
+		t.Fatalf("expected to continue at 13, got %d", log.Next())
+	}
+	log.Append(store.Change{Op: store.ChangeSet, Key: "k13", New: &store.Item{Value: "v"}})
+	st := log.Stats()
+	if st.First == 1 || st.Last != 13 || st.Bytes > 600 {
+		t.Fatalf("expected old segments deleted, got %+v", st)
+	}
+	if records, err := readChanges(log, 0, 1); err != nil || records[0].LSN != st.First {
+		t.Fatalf("expected 0 to start at the oldest retained change, got %+v, %v", records, err)
+	}
+
+	var rangeErr *changefeed.RangeError
+	err = log.Read(context.Background(), 1, func(changefeed.Record) error { return nil })
+	if !errors.As(err, &rangeErr) || !rangeErr.Compacted() || rangeErr.First != st.First {
+		t.Fatalf("expected a compacted error, got %v", err)
+	}
+	err = log.Read(context.Background(), 20, func(changefeed.Record) error { return nil })
+	if !errors.As(err, &rangeErr) || rangeErr.Compacted() {
+		t.Fatalf("expected an error for a change past the end, got %v", err)
+	}
+}
+
+func TestChangeFeedRPC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	st := newTestStore(t)
+	log, err := changefeed.Open(filepath.Join(t.TempDir(), "changefeed"), changefeed.Options{SegmentBytes: 200, MaxBytes: 400})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	st.SetChangeObserver(log.Append)
+
+	srv := api.NewGRPCServer(st)
+	srv.EnableChangeFeed(log)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := kvstore.NewChangesClient(conn)
+
+	st.Set("a", "1", 0, true)
+	st.Set("a", "2", 0, true)
+	firstCtx, cancelFirst := context.WithCancel(ctx)
+	stream, err := client.ChangeFeed(firstCtx, &kvstore.ChangeFeedRequest{FromLsn: 2})
+	if err != nil {
+		t.Fatalf("ChangeFeed: %v", err)
+	}
+	event, err := stream.Recv()
+	if err != nil || event.Lsn != 2 || event.Op != "set" || event.Old.GetValue() != "1" || event.New.GetValue() != "2" || event.TimestampUnixNano == 0 {
+		t.Fatalf("expected change 2, got %+v, %v", event, err)
+	}
+	st.Delete("a")
+	event, err = stream.Recv()
+	if err != nil || event.Lsn != 3 || event.Op != "delete" || event.New != nil || event.Old.GetValue() != "2" {
+		t.Fatalf("expected the delete, got %+v, %v", event, err)
+	}
+
+	cancelFirst()
+	waitUntil(t, "the first consumer to leave", func() bool { return log.Stats().Readers == 0 })
+
+	// Enough changes to compact the first segments away
+	for i := range 20 {
+		st.Set(fmt.Sprintf("key-%d", i), "value", 0, true)
+	}
+	stream, err = client.ChangeFeed(ctx, &kvstore.ChangeFeedRequest{FromLsn: 1})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatalf("expected OutOfRange for a compacted change, got %v", err)
+	}
+	trailer := stream.Trailer()
+	if first := log.Stats().First; first <= 1 || len(trailer.Get("kvstore-oldest-lsn")) != 1 || trailer.Get("kvstore-oldest-lsn")[0] != fmt.Sprint(first) {
+		t.Fatalf("expected the oldest LSN %d in the trailer, got %v", first, trailer)
+	}
+
+	stream, err = client.ChangeFeed(ctx, &kvstore.ChangeFeedRequest{FromNow: true})
+	if err != nil {
+		t.Fatalf("ChangeFeed: %v", err)
+	}
+	// Changes made before the server handles the call aren't new to it
+	waitUntil(t, "the consumer", func() bool { return log.Stats().Readers == 1 })
+	st.Set("b", "1", 0, true)
+	if event, err = stream.Recv(); err != nil || event.Key != "b" || event.Lsn != log.Stats().Last {
+		t.Fatalf("expected only the new change, got %+v, %v", event, err)
+	}
+}
@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/client"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tracking"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Serves srv on a local port and returns its address.
+func serveGRPC(t *testing.T, srv *grpc.Server) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// Serves a store with tracking on, for clients that cache.
+func startClientTestServer(t *testing.T, opts ...grpc.ServerOption) string {
+	t.Helper()
+	st := newTestStore(t)
+	table := tracking.NewTable(0)
+	st.SetChangeObserver(table.Observe)
+	srv := api.NewGRPCServer(st, opts...)
+	srv.EnableTracking(table)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func newTestClient(t *testing.T, opts client.Options) *client.Client {
+	t.Helper()
+	c, err := client.New(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// A server that is always unavailable, counting the calls it gets
+type unavailableServer struct {
+	kvstore.UnimplementedKVStoreServer
+	calls atomic.Int32
+}
+
+func (s *unavailableServer) Get(context.Context, *kvstore.GetRequest) (*kvstore.GetResponse, error) {
+	s.calls.Add(1)
+	return nil, status.Error(codes.Unavailable, "down")
+}
+
+func (s *unavailableServer) Set(context.Context, *kvstore.SetRequest) (*kvstore.SetResponse, error) {
+	s.calls.Add(1)
+	return nil, status.Error(codes.Unavailable, "down")
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, client.Options{Endpoints: []string{startClientTestServer(t)}})
+
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := c.Set(ctx, "k", []byte("v"), client.WithTTL(1500*time.Millisecond)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if value, err := c.Get(ctx, "k"); err != nil || string(value) != "v" {
+		t.Fatalf("expected v, got %q, %v", value, err)
+	}
+	if ttl, err := c.TTL(ctx, "k"); err != nil || ttl != 2*time.Second {
+		t.Fatalf("expected the TTL rounded up to 2s, got %v, %v", ttl, err)
+	}
+	if err := c.Set(ctx, "k", []byte("other"), client.IfAbsent()); !errors.Is(err, client.ErrNotSet) {
+		t.Fatalf("expected ErrNotSet, got %v", err)
+	}
+	if updated, err := c.Persist(ctx, "k"); err != nil || !updated {
+		t.Fatalf("Persist: %v, %v", updated, err)
+	}
+	if ttl, err := c.TTL(ctx, "k"); err != nil || ttl != client.NoExpiry {
+		t.Fatalf("expected NoExpiry, got %v, %v", ttl, err)
+	}
+	if err := c.Expire(ctx, "missing", time.Minute); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := c.MSet(ctx, client.Entry{Key: "a", Value: []byte("1")}, client.Entry{Key: "b", Value: []byte("2")}); err != nil {
+		t.Fatalf("MSet: %v", err)
+	}
+	values, err := c.MGet(ctx, "a", "b", "missing", "")
+	var batchErr *client.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || batchErr.Errors[""] == nil {
+		t.Fatalf("expected the empty key to fail, got %v", err)
+	}
+	if len(values) != 2 || string(values["a"]) != "1" || string(values["b"]) != "2" {
+		t.Fatalf("expected a and b, got %v", values)
+	}
+	deleted, err := c.MDelete(ctx, "a", "missing")
+	if err != nil || !deleted["a"] || deleted["missing"] {
+		t.Fatalf("expected only a deleted, got %v, %v", deleted, err)
+	}
+
+	if err := c.Delete(ctx, "k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Delete, got %v", err)
+	}
+}
+
+func TestClientFailsOver(t *testing.T) {
+	ctx := context.Background()
+	down := &unavailableServer{}
+	srv := grpc.NewServer()
+	kvstore.RegisterKVStoreServer(srv, down)
+	downAddr := serveGRPC(t, srv)
+	upAddr := startClientTestServer(t)
+
+	c := newTestClient(t, client.Options{
+		Endpoints: []string{downAddr, upAddr},
+		Retry:     client.RetryPolicy{InitialBackoff: time.Millisecond},
+	})
+	if err := c.Set(ctx, "k", []byte("v")); err != nil {
+		t.Fatalf("expected the set to fail over, got %v", err)
+	}
+	if down.calls.Load() != 1 || c.Addr() != upAddr {
+		t.Fatalf("expected one call to the unavailable server and a switch, got %d calls, at %s", down.calls.Load(), c.Addr())
+	}
+	if value, err := c.Get(ctx, "k"); err != nil || string(value) != "v" {
+		t.Fatalf("expected v from the second server, got %q, %v", value, err)
+	}
+
+	// Conditional sets may have been applied, so they aren't retried
+	c = newTestClient(t, client.Options{Endpoints: []string{downAddr, upAddr}})
+	if err := c.Set(ctx, "k", []byte("v"), client.IfAbsent()); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+	if down.calls.Load() != 2 {
+		t.Fatalf("expected no retry, got %d calls", down.calls.Load())
+	}
+
+	// Retries stop after MaxAttempts, even with nowhere else to go
+	c = newTestClient(t, client.Options{
+		Endpoints: []string{downAddr},
+		Retry:     client.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond},
+	})
+	if _, err := c.Get(ctx, "k"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+	if down.calls.Load() != 6 {
+		t.Fatalf("expected 4 attempts, got %d calls", down.calls.Load()-2)
+	}
+}
+
+func TestClientFollowsReplicaToPrimary(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestStore(t)
+	_, primaryConn := startReplicationNode(t, primary, nil)
+	replicaStore := newTestStore(t)
+	replica := startReplica(t, replicaStore, primaryConn.Target())
+	_, replicaConn := startReplicationNode(t, replicaStore, replica)
+
+	c := newTestClient(t, client.Options{Endpoints: []string{replicaConn.Target()}})
+	if err := c.Set(ctx, "k", []byte("v"), client.IfAbsent()); err != nil {
+		t.Fatalf("expected the set to go to the primary, got %v", err)
+	}
+	if _, ok := primary.Get("k"); !ok || c.Addr() != primaryConn.Target() {
+		t.Fatalf("expected the key on the primary and calls going there, at %s", c.Addr())
+	}
+}
+
+func TestClientDoesNotRetryReadOnly(t *testing.T) {
+	ctx := context.Background()
+	readOnly := newTestStore(t)
+	readOnly.SetReadOnly(true)
+	srv := api.NewGRPCServer(readOnly)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	readOnlyAddr := lis.Addr().String()
+	upAddr := startClientTestServer(t)
+
+	c := newTestClient(t, client.Options{
+		Endpoints: []string{readOnlyAddr, upAddr},
+		Retry:     client.RetryPolicy{InitialBackoff: time.Millisecond},
+	})
+	if err := c.Set(ctx, "k", []byte("v")); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if c.Addr() != readOnlyAddr {
+		t.Fatalf("expected the client to stay at the read-only server, at %s", c.Addr())
+	}
+}
+
+func TestClientSendsToken(t *testing.T) {
+	ctx := context.Background()
+	acl, err := auth.ParseACL([]byte(testACL))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	addr := startClientTestServer(t,
+		grpc.UnaryInterceptor(api.AuthInterceptor(acl)),
+		grpc.StreamInterceptor(api.AuthStreamInterceptor(acl)),
+	)
+
+	c := newTestClient(t, client.Options{Endpoints: []string{addr}, Token: "app-token"})
+	if err := c.Set(ctx, "app/k", []byte("v")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.Set(ctx, "secret", []byte("v")); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+	// Calls on Conn carry the token too
+	if _, err := kvstore.NewKVStoreClient(c.Conn()).Get(ctx, &kvstore.GetRequest{Key: "app/k"}); err != nil {
+		t.Fatalf("Get on Conn: %v", err)
+	}
+	// Any user may subscribe to invalidations, unlike other streams
+	stream, err := kvstore.NewTrackingClient(c.Conn()).Invalidations(ctx, &kvstore.InvalidationsRequest{})
+	if err != nil {
+		t.Fatalf("Invalidations: %v", err)
+	}
+	if msg, err := stream.Recv(); err != nil || msg.ClientId == 0 {
+		t.Fatalf("expected a client ID, got %v, %v", msg, err)
+	}
+
+	c = newTestClient(t, client.Options{Endpoints: []string{addr}})
+	if _, err := c.Get(ctx, "app/k"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a token, got %v", err)
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	table := tracking.NewTable(0)
+	st.SetChangeObserver(table.Observe)
+	srv := api.NewGRPCServer(st)
+	srv.EnableTracking(table)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c := newTestClient(t, client.Options{Endpoints: []string{lis.Addr().String()}, CacheSize: 2})
+	waitUntil(t, "the invalidation stream", func() bool { return table.Stats().Subscriptions == 1 })
+
+	st.Set("k", "v1", 0, true)
+	for range 3 {
+		if value, err := c.Get(ctx, "k"); err != nil || string(value) != "v1" {
+			t.Fatalf("expected v1, got %q, %v", value, err)
+		}
+	}
+	if stats := c.CacheStats(); stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("expected the key cached after the first read, got %+v", stats)
+	}
+
+	// A change made on the server reaches the cache
+	st.Set("k", "v2", 0, true)
+	waitUntil(t, "the invalidation", func() bool { return c.CacheStats().Invalidations == 1 })
+	if value, err := c.Get(ctx, "k"); err != nil || string(value) != "v2" {
+		t.Fatalf("expected v2, got %q, %v", value, err)
+	}
+
+	// Missing keys are cached too, and the cache stays within its size
+	for range 2 {
+		values, err := c.MGet(ctx, "k", "missing", "other")
+		if err != nil || len(values) != 1 || string(values["k"]) != "v2" {
+			t.Fatalf("expected only k, got %v, %v", values, err)
+		}
+	}
+	if stats := c.CacheStats(); stats.Entries != 2 || stats.Evictions == 0 {
+		t.Fatalf("expected evictions down to 2 keys, got %+v", stats)
+	}
+
+	// The client's own writes drop the key straight away
+	if err := c.Set(ctx, "k", []byte("v3")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if value, err := c.Get(ctx, "k"); err != nil || string(value) != "v3" {
+		t.Fatalf("expected v3, got %q, %v", value, err)
+	}
+
+	// Cached keys don't outlive their expiry
+	st.SetWithOptions("short", "v", store.SetOptions{ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+	if _, err := c.Get(ctx, "short"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Get(ctx, "short"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected the key expired, got %v", err)
+	}
+
+	reg := metrics.NewRegistry()
+	c.RegisterCacheMetrics(reg)
+	var out strings.Builder
+	reg.Write(&out)
+	if !strings.Contains(out.String(), "kvstore_client_cache_hit_ratio") {
+		t.Fatalf("expected the hit ratio in the metrics, got %s", out.String())
+	}
+
+	// Without the stream nothing would say when keys change
+	srv.Stop()
+	waitUntil(t, "the cache to be emptied", func() bool { return c.CacheStats().Entries == 0 })
+}
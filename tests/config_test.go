@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/config"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+)
+
+func envFrom(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestConfigLayering(t *testing.T) {
+	path := writeConfig(t, "DEFAULT_TTL: 600\nSNAPSHOT_DIR: \"data/snapshots\"\nAOF_DIR: \"data/aof\"\nPORT: 6000\nRESP_PORT: 6001\n")
+
+	// File over defaults
+	cfg, err := config.Load([]string{"-config", path}, envFrom(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DefaultTTL != 600 || cfg.Port != 6000 || cfg.RESPPort != 6001 || cfg.HTTPPort != 0 || cfg.Path != path {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if cfg.AOFPath() != filepath.Join("data/aof", "aof.log") {
+		t.Fatalf("unexpected AOF path %q", cfg.AOFPath())
+	}
+
+	// Environment over the file, flags over the environment
+	env := envFrom(map[string]string{
+		"KVSTORE_CONFIG":    path,
+		"KVSTORE_PORT":      "7000",
+		"KVSTORE_RESP_PORT": "7001",
+	})
+	cfg, err = config.Load([]string{"-resp-port", "0"}, env)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != 7000 || cfg.RESPPort != 0 || cfg.SnapshotDir != "data/snapshots" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	noFile := []string{"-config", ""}
+	for _, tc := range []struct {
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{[]string{"-port", "0"}, nil, "PORT must be between"},
+		{[]string{"-http-port", "50051"}, nil, "PORT and HTTP_PORT both use port 50051"},
+		{[]string{"-default-ttl", "-5"}, nil, "DEFAULT_TTL cannot be negative"},
+		{[]string{"-tls-cert", "a.crt"}, nil, "TLS_CERT and TLS_KEY"},
+		{nil, map[string]string{"KVSTORE_LOG_LEVEL": "loud"}, "unknown log level"},
+		{nil, map[string]string{"KVSTORE_PORT": "high"}, "KVSTORE_PORT"},
+		{[]string{"-raft-id", "n1", "-replica-of", "localhost:50051"}, nil, "RAFT_ID and REPLICA_OF are mutually exclusive"},
+		{[]string{"-raft-id", "n1", "-max-memory", "1024"}, nil, "MAX_MEMORY must be 0 in cluster mode"},
+		{[]string{"-raft-id", "n1", "-raft-peers", "n2=localhost:50052"}, nil, "RAFT_PEERS must include RAFT_ID"},
+		{[]string{"-raft-id", "n1", "-raft-peers", "n1"}, nil, "is not id=host:port"},
+		{[]string{"-shard-id", "a", "-shard-nodes", "b=localhost:50052"}, nil, "SHARD_NODES must include SHARD_ID"},
+		{[]string{"-shard-id", "a", "-shard-nodes", "a=localhost:50051", "-raft-id", "n1"}, nil, "SHARD_ID can't be combined"},
+		{[]string{"-shard-id", "a", "-shard-topology-file", ""}, nil, "SHARD_TOPOLOGY_FILE cannot be empty"},
+		{[]string{"-multi-master-id", "a", "-replica-of", "localhost:50051"}, nil, "MULTI_MASTER_ID can't be combined"},
+		{[]string{"-multi-master-id", "a", "-max-memory", "1024"}, nil, "MAX_MEMORY must be 0 in multi-master mode"},
+		{[]string{"-multi-master-id", "a", "-multi-master-peers", "b=localhost:50052"}, nil, "MULTI_MASTER_PEERS must include MULTI_MASTER_ID"},
+		{[]string{"-multi-master-peers", "a=localhost:50051"}, nil, "MULTI_MASTER_PEERS needs MULTI_MASTER_ID"},
+		{[]string{"-tombstone-ttl", "0s"}, nil, "TOMBSTONE_TTL must be positive"},
+		{[]string{"-anti-entropy-interval", "-1m"}, nil, "ANTI_ENTROPY_INTERVAL cannot be negative"},
+		{[]string{"-changefeed-retention", "-1h"}, nil, "CHANGEFEED_RETENTION cannot be negative"},
+		{[]string{"-tracking-max-keys", "-1"}, nil, "TRACKING_MAX_KEYS cannot be negative"},
+		{[]string{"-acl-file", "acl.yml", "-memcached-port", "11211"}, nil, "MEMCACHED_PORT must be 0 when ACL_FILE is set"},
+	} {
+		args := append(append([]string{}, noFile...), tc.args...)
+		_, err := config.Load(args, envFrom(tc.env))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("args %v env %v: expected error containing %q, got %v", tc.args, tc.env, tc.want, err)
+		}
+	}
+
+	// A shard without nodes waits to be added to a deployment
+	if _, err := config.Load(append(noFile, "-shard-id", "a"), envFrom(nil)); err != nil {
+		t.Fatalf("expected a shard without nodes to be valid, got %v", err)
+	}
+	cfg, err := config.Load(append(noFile, "-multi-master-id", "a", "-multi-master-peers", "a=localhost:50051,b=localhost:50052"), envFrom(nil))
+	if err != nil {
+		t.Fatalf("expected a multi-master config to be valid, got %v", err)
+	}
+	if sites, _ := cfg.MultiMasterSites(); len(sites) != 1 || sites[0] != (config.Site{ID: "b", Addr: "localhost:50052"}) {
+		t.Fatalf("expected site b as the only other site, got %+v", sites)
+	}
+	if _, err := config.Load([]string{"-config", writeConfig(t, "PROT: 1\n")}, envFrom(nil)); err == nil {
+		t.Fatalf("expected an error for an unknown key")
+	}
+	if _, err := config.Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yml")}, envFrom(nil)); err == nil {
+		t.Fatalf("expected an error for a missing explicit config file")
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	st := newTestStore(t)
+	st.SetDefaultTTL(time.Minute)
+	ctx := context.Background()
+
+	// gRPC and HTTP writes without a TTL get the default one
+	grpcServer := api.NewGRPCServer(st)
+	grpcServer.Set(ctx, &kvstore.SetRequest{Key: "grpc", Value: "v"})
+	grpcServer.Set(ctx, &kvstore.SetRequest{Key: "explicit", Value: "v", TtlSeconds: 3600})
+	grpcServer.MSet(ctx, &kvstore.MSetRequest{Entries: []*kvstore.SetRequest{{Key: "batch", Value: "v"}}})
+	httpServer := httptest.NewServer(api.NewHTTPServer(st).Handler())
+	defer httpServer.Close()
+	doHTTP(t, http.MethodPut, httpServer.URL+"/v1/keys/http", "v", nil)
+
+	// RESP and memcached have their own way to ask for no expiry
+	respServer := api.NewRESPServer(st)
+	respConn := serveAndDial(t, respServer.Serve, respServer.Stop)
+	fmt.Fprint(respConn, "SET resp v\r\n")
+	if reply := readReply(t, bufio.NewReader(respConn)); reply != "+OK" {
+		t.Fatalf("unexpected SET reply %q", reply)
+	}
+	memcachedServer := api.NewMemcachedServer(st)
+	memcachedConn := serveAndDial(t, memcachedServer.Serve, memcachedServer.Stop)
+	memcachedExpect(t, memcachedConn, bufio.NewReader(memcachedConn), "set memcached 0 0 1\r\nv\r\n", "STORED")
+	st.Set("import", "v", 0, true)
+
+	for key, want := range map[string]time.Duration{"grpc": time.Minute, "explicit": time.Hour, "batch": time.Minute, "http": time.Minute} {
+		item, _ := st.GetItem(key)
+		if ttl := time.Until(item.ExpiresAt); ttl > want || ttl < want-5*time.Second {
+			t.Errorf("%s: expected a TTL of about %v, got %v", key, want, ttl)
+		}
+	}
+	for _, key := range []string{"resp", "memcached", "import"} {
+		if item, ok := st.GetItem(key); !ok || !item.ExpiresAt.IsZero() {
+			t.Errorf("%s: expected a key that never expires, got %+v", key, item)
+		}
+	}
+
+	// Keeping the TTL doesn't replace it with the default
+	st.Persist("grpc")
+	st.SetWithOptions("grpc", "v2", store.SetOptions{KeepTTL: true})
+	if item, _ := st.GetItem("grpc"); !item.ExpiresAt.IsZero() {
+		t.Fatalf("expected KEEPTTL to keep the key persistent")
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	noFile := []string{"-config", ""}
+	old, err := config.Load(noFile, envFrom(map[string]string{"KVSTORE_TLS_CERT": "a.crt", "KVSTORE_TLS_KEY": "a.key"}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	next, err := config.Load(noFile, envFrom(map[string]string{
+		"KVSTORE_TLS_CERT":          "b.crt",
+		"KVSTORE_TLS_KEY":           "a.key",
+		"KVSTORE_LOG_LEVEL":         "debug",
+		"KVSTORE_SNAPSHOT_INTERVAL": "5m",
+		"KVSTORE_PORT":              "6000",
+		"KVSTORE_ACL_FILE":          "acl.yml",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if next.SnapshotInterval != 5*time.Minute {
+		t.Fatalf("unexpected snapshot interval %v", next.SnapshotInterval)
+	}
+
+	live, restart := config.Diff(old, next)
+	if !slices.Equal(live, []string{"SNAPSHOT_INTERVAL", "TLS_CERT", "LOG_LEVEL"}) {
+		t.Fatalf("unexpected live changes %v", live)
+	}
+	// Turning ACLs on changes the interceptors, which needs a restart
+	if !slices.Equal(restart, []string{"PORT", "ACL_FILE"}) {
+		t.Fatalf("unexpected restart changes %v", restart)
+	}
+
+	old.Update(next, live)
+	if old.LogLevel != "debug" || old.TLSCert != "b.crt" || old.Port != 50051 || old.ACLFile != "" {
+		t.Fatalf("unexpected config after update: %+v", old)
+	}
+	if live, _ := config.Diff(old, next); len(live) != 0 {
+		t.Fatalf("expected no live changes left, got %v", live)
+	}
+}
@@ -104,3 +104,119 @@ func TestGRPCServer_TTLExpiry(t *testing.T) {
 		t.Fatalf("expected key to be expired and not found")
 	}
 }
+
+func TestGRPCServer_Batch(t *testing.T) {
+	st := newTestStore(t)
+	srv := api.NewGRPCServer(st)
+	ctx := context.Background()
+
+	setResp, err := srv.MSet(ctx, &kvstore.MSetRequest{Entries: []*kvstore.SetRequest{
+		{Key: "a", Value: "1"},
+		{Key: "", Value: "x"},
+		{Key: "b", Value: "2", TtlSeconds: 60},
+	}})
+	if err != nil {
+		t.Fatalf("MSet error: %v", err)
+	}
+	if r := setResp.Results; len(r) != 3 || !r[0].Success || r[1].Success || r[1].Error == "" || !r[2].Success {
+		t.Fatalf("unexpected MSet results: %v", r)
+	}
+
+	getResp, err := srv.MGet(ctx, &kvstore.MGetRequest{Keys: []string{"b", "missing", "a"}})
+	if err != nil {
+		t.Fatalf("MGet error: %v", err)
+	}
+	r := getResp.Results
+	if len(r) != 3 || r[0].Value != "2" || r[1].Found || r[2].Key != "a" || r[2].Value != "1" {
+		t.Fatalf("unexpected MGet results: %v", r)
+	}
+
+	delResp, err := srv.MDelete(ctx, &kvstore.MDeleteRequest{Keys: []string{"a", "missing"}})
+	if err != nil {
+		t.Fatalf("MDelete error: %v", err)
+	}
+	if d := delResp.Results; len(d) != 2 || !d[0].Deleted || d[1].Deleted {
+		t.Fatalf("unexpected MDelete results: %v", d)
+	}
+	if _, found := st.Get("a"); found {
+		t.Fatalf("expected a to be deleted")
+	}
+}
+
+func TestGRPCServer_SetConditions(t *testing.T) {
+	srv := api.NewGRPCServer(newTestStore(t))
+	ctx := context.Background()
+
+	set := func(value string, condition kvstore.SetCondition) bool {
+		t.Helper()
+		resp, err := srv.Set(ctx, &kvstore.SetRequest{Key: "k", Value: value, Condition: condition})
+		if err != nil {
+			t.Fatalf("Set error: %v", err)
+		}
+		return resp.Success
+	}
+
+	if set("v1", kvstore.SetCondition_SET_CONDITION_IF_PRESENT) {
+		t.Fatalf("expected XX on a missing key to fail")
+	}
+	if !set("v1", kvstore.SetCondition_SET_CONDITION_IF_ABSENT) {
+		t.Fatalf("expected NX on a missing key to succeed")
+	}
+	if set("v2", kvstore.SetCondition_SET_CONDITION_IF_ABSENT) {
+		t.Fatalf("expected NX on an existing key to fail")
+	}
+	if !set("v3", kvstore.SetCondition_SET_CONDITION_IF_PRESENT) {
+		t.Fatalf("expected XX on an existing key to succeed")
+	}
+	if resp, _ := srv.Get(ctx, &kvstore.GetRequest{Key: "k"}); resp.Value != "v3" {
+		t.Fatalf("unexpected value %q", resp.Value)
+	}
+
+	_, err := srv.Set(ctx, &kvstore.SetRequest{Key: "k", Condition: kvstore.SetCondition(42)})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an unknown condition, got %v", err)
+	}
+}
+
+func TestGRPCServer_TTLManagement(t *testing.T) {
+	srv := api.NewGRPCServer(newTestStore(t))
+	ctx := context.Background()
+
+	if resp, _ := srv.TTL(ctx, &kvstore.TTLRequest{Key: "k"}); resp.Found {
+		t.Fatalf("expected missing key")
+	}
+	if resp, _ := srv.Expire(ctx, &kvstore.ExpireRequest{Key: "k", TtlSeconds: 10}); resp.Updated {
+		t.Fatalf("expected Expire on a missing key to report false")
+	}
+
+	srv.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v"})
+	if resp, _ := srv.TTL(ctx, &kvstore.TTLRequest{Key: "k"}); !resp.Found || resp.TtlSeconds != -1 {
+		t.Fatalf("expected no TTL, got %+v", resp)
+	}
+
+	if resp, _ := srv.Expire(ctx, &kvstore.ExpireRequest{Key: "k", TtlSeconds: 100}); !resp.Updated {
+		t.Fatalf("expected Expire to update the key")
+	}
+	if resp, _ := srv.TTL(ctx, &kvstore.TTLRequest{Key: "k"}); resp.TtlSeconds != 100 {
+		t.Fatalf("expected TTL of 100, got %d", resp.TtlSeconds)
+	}
+
+	if resp, _ := srv.Persist(ctx, &kvstore.PersistRequest{Key: "k"}); !resp.Updated {
+		t.Fatalf("expected Persist to remove the TTL")
+	}
+	if resp, _ := srv.Persist(ctx, &kvstore.PersistRequest{Key: "k"}); resp.Updated {
+		t.Fatalf("expected a second Persist to report false")
+	}
+
+	at := time.Now().Add(time.Hour).Unix()
+	srv.ExpireAt(ctx, &kvstore.ExpireAtRequest{Key: "k", UnixSeconds: at})
+	if resp, _ := srv.TTL(ctx, &kvstore.TTLRequest{Key: "k"}); resp.TtlSeconds < 3590 || resp.TtlSeconds > 3600 {
+		t.Fatalf("unexpected TTL after ExpireAt: %d", resp.TtlSeconds)
+	}
+
+	// A timestamp in the past deletes the key
+	srv.ExpireAt(ctx, &kvstore.ExpireAtRequest{Key: "k", UnixSeconds: time.Now().Add(-time.Hour).Unix()})
+	if resp, _ := srv.Get(ctx, &kvstore.GetRequest{Key: "k"}); resp.Found {
+		t.Fatalf("expected key to be gone after ExpireAt in the past")
+	}
+}
@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+)
+
+type httpKey struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	Version    uint64 `json:"version"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+type httpErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func startHTTPServer(t *testing.T, opts ...func(*api.HTTPServer)) *httptest.Server {
+	t.Helper()
+	httpServer := api.NewHTTPServer(newTestStore(t))
+	for _, opt := range opts {
+		opt(httpServer)
+	}
+	srv := httptest.NewServer(httpServer.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doHTTP(t *testing.T, method, url, body string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestHTTPServerPutGetDelete(t *testing.T) {
+	srv := startHTTPServer(t)
+	url := srv.URL + "/v1/keys/dir/name"
+
+	resp, body := doHTTP(t, http.MethodPut, url+"?ttl=60", "hello world", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT: %d %s", resp.StatusCode, body)
+	}
+	var put httpKey
+	json.Unmarshal(body, &put)
+	if put.Key != "dir/name" || put.Value != "hello world" || put.TTLSeconds != 60 {
+		t.Fatalf("unexpected PUT response: %s", body)
+	}
+
+	resp, body = doHTTP(t, http.MethodGet, url, "", nil)
+	var got httpKey
+	json.Unmarshal(body, &got)
+	if resp.StatusCode != http.StatusOK || got.Value != "hello world" || got.Version != put.Version {
+		t.Fatalf("GET: %d %s", resp.StatusCode, body)
+	}
+	if etag := resp.Header.Get("ETag"); etag != fmt.Sprintf("%q", fmt.Sprint(put.Version)) {
+		t.Fatalf("unexpected ETag %q", etag)
+	}
+
+	resp, _ = doHTTP(t, http.MethodDelete, url, "", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: %d", resp.StatusCode)
+	}
+
+	resp, body = doHTTP(t, http.MethodGet, url, "", nil)
+	var errResp httpErrorResponse
+	json.Unmarshal(body, &errResp)
+	if resp.StatusCode != http.StatusNotFound || errResp.Error.Status != "NOT_FOUND" || errResp.Error.Code != 404 {
+		t.Fatalf("GET after delete: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = doHTTP(t, http.MethodPut, url+"?ttl=abc", "v", nil)
+	json.Unmarshal(body, &errResp)
+	if resp.StatusCode != http.StatusBadRequest || errResp.Error.Status != "INVALID_ARGUMENT" {
+		t.Fatalf("PUT with bad ttl: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestHTTPServerConditionalWrites(t *testing.T) {
+	srv := startHTTPServer(t)
+	url := srv.URL + "/v1/keys/k"
+
+	resp, body := doHTTP(t, http.MethodPut, url, "v1", map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+	etag := resp.Header.Get("ETag")
+
+	resp, _ = doHTTP(t, http.MethodPut, url, "v1", map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected create of existing key to fail, got %d", resp.StatusCode)
+	}
+
+	resp, _ = doHTTP(t, http.MethodPut, url, "v2", map[string]string{"If-Match": etag, "X-TTL": "30"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected matching If-Match to succeed, got %d", resp.StatusCode)
+	}
+
+	// The old ETag is stale now
+	resp, body = doHTTP(t, http.MethodPut, url, "v3", map[string]string{"If-Match": etag})
+	var errResp httpErrorResponse
+	json.Unmarshal(body, &errResp)
+	if resp.StatusCode != http.StatusPreconditionFailed || errResp.Error.Status != "FAILED_PRECONDITION" {
+		t.Fatalf("expected stale If-Match to fail, got %d %s", resp.StatusCode, body)
+	}
+	resp, _ = doHTTP(t, http.MethodDelete, url, "", map[string]string{"If-Match": etag})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected stale If-Match delete to fail, got %d", resp.StatusCode)
+	}
+
+	resp, body = doHTTP(t, http.MethodGet, url, "", nil)
+	var got httpKey
+	json.Unmarshal(body, &got)
+	if got.Value != "v2" || got.TTLSeconds != 30 {
+		t.Fatalf("unexpected item: %s", body)
+	}
+}
+
+func TestHTTPServerReadOnly(t *testing.T) {
+	st := newTestStore(t)
+	srv := httptest.NewServer(api.NewHTTPServer(st).Handler())
+	t.Cleanup(srv.Close)
+	url := srv.URL + "/v1/keys/k"
+	doHTTP(t, http.MethodPut, url, "v", nil)
+	st.SetReadOnly(true)
+
+	// Not a 503, which load balancers and clients would retry elsewhere
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		resp, body := doHTTP(t, method, url, "v2", nil)
+		var errResp httpErrorResponse
+		json.Unmarshal(body, &errResp)
+		if resp.StatusCode != http.StatusConflict || errResp.Error.Status != "FAILED_PRECONDITION" {
+			t.Fatalf("%s in read-only mode: %d %s", method, resp.StatusCode, body)
+		}
+	}
+	if resp, body := doHTTP(t, http.MethodGet, url, "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("reads should still work: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestHTTPServerListPagination(t *testing.T) {
+	srv := startHTTPServer(t)
+	for _, k := range []string{"a/1", "a/2", "a/3", "b/1"} {
+		doHTTP(t, http.MethodPut, srv.URL+"/v1/keys/"+k, "v", nil)
+	}
+
+	var keys []string
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatalf("too many pages")
+		}
+		resp, body := doHTTP(t, http.MethodGet, srv.URL+"/v1/keys?prefix=a/&limit=2&cursor="+cursor, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list: %d %s", resp.StatusCode, body)
+		}
+		var list struct {
+			Keys       []httpKey `json:"keys"`
+			NextCursor string    `json:"next_cursor"`
+		}
+		json.Unmarshal(body, &list)
+		for _, k := range list.Keys {
+			keys = append(keys, k.Key)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		cursor = list.NextCursor
+	}
+
+	if strings.Join(keys, ",") != "a/1,a/2,a/3" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestHTTPServerAuth(t *testing.T) {
+	acl, err := auth.ParseACL([]byte(testACL))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	srv := startHTTPServer(t, func(s *api.HTTPServer) { s.EnableAuth(acl) })
+	app := map[string]string{"Authorization": "Bearer app-token"}
+
+	for _, tc := range []struct {
+		method, path string
+		headers      map[string]string
+		want         int
+	}{
+		{http.MethodPut, "/v1/keys/app/k", nil, http.StatusUnauthorized},
+		{http.MethodPut, "/v1/keys/app/k", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{http.MethodPut, "/v1/keys/app/k", app, http.StatusOK},
+		{http.MethodGet, "/v1/keys/app/k", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/v1/keys/app/k", app, http.StatusOK},
+		{http.MethodPut, "/v1/keys/shared/k", app, http.StatusForbidden},
+		{http.MethodGet, "/v1/keys?prefix=app/", app, http.StatusOK},
+		{http.MethodGet, "/v1/keys", app, http.StatusForbidden},
+		{http.MethodDelete, "/v1/keys/app/k", nil, http.StatusUnauthorized},
+		{http.MethodDelete, "/v1/keys/app/k", app, http.StatusNoContent},
+	} {
+		resp, body := doHTTP(t, tc.method, srv.URL+tc.path, "v", tc.headers)
+		if resp.StatusCode != tc.want {
+			t.Fatalf("%s %s: got %d (%s), want %d", tc.method, tc.path, resp.StatusCode, body, tc.want)
+		}
+	}
+}
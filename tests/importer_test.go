@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/importer"
+)
+
+// Builds a minimal RDB file by hand
+type rdbBuilder struct {
+	bytes.Buffer
+}
+
+func (b *rdbBuilder) str(s string) {
+	b.WriteByte(byte(len(s)))
+	b.WriteString(s)
+}
+
+func (b *rdbBuilder) expireMS(t time.Time) {
+	b.WriteByte(0xFC)
+	binary.Write(b, binary.LittleEndian, uint64(t.UnixMilli()))
+}
+
+func TestImportRedisRDB(t *testing.T) {
+	st := newTestStore(t)
+	now := time.Now()
+
+	var b rdbBuilder
+	b.WriteString("REDIS0011")
+	b.WriteByte(0xFA)
+	b.str("redis-ver")
+	b.str("7.2.0")
+	b.WriteByte(0xFE)
+	b.WriteByte(0)
+	b.WriteByte(0xFB)
+	b.WriteByte(5)
+	b.WriteByte(2)
+
+	// Plain string
+	b.WriteByte(0)
+	b.str("plain")
+	b.str("value")
+
+	// String that expires in an hour
+	b.expireMS(now.Add(time.Hour))
+	b.WriteByte(0)
+	b.str("ttl")
+	b.str("soon")
+
+	// String that already expired
+	b.expireMS(now.Add(-time.Hour))
+	b.WriteByte(0)
+	b.str("gone")
+	b.str("x")
+
+	// Integer encoded as int16
+	b.WriteByte(0)
+	b.str("int")
+	b.WriteByte(0xC1)
+	binary.Write(&b, binary.LittleEndian, int16(-1234))
+
+	// LZF compressed run of 20 'a's
+	b.WriteByte(0)
+	b.str("lzf")
+	b.Write([]byte{0xC3, 5, 20, 0x00, 'a', 0xE0, 0x0A, 0x00})
+
+	// A list, which can't be imported
+	b.WriteByte(1)
+	b.str("list")
+	b.WriteByte(2)
+	b.str("a")
+	b.str("b")
+
+	// Keys in other databases are ignored by default
+	b.WriteByte(0xFE)
+	b.WriteByte(1)
+	b.WriteByte(0)
+	b.str("other-db")
+	b.str("x")
+
+	b.WriteByte(0xFF)
+	b.Write(make([]byte, 8))
+
+	stats, err := importer.ImportRedisRDB(&b, st, importer.RedisOptions{})
+	if err != nil {
+		t.Fatalf("ImportRedisRDB: %v", err)
+	}
+	if stats.Imported != 4 || stats.Expired != 1 || stats.Skipped["list"] != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	want := map[string]string{
+		"plain": "value",
+		"ttl":   "soon",
+		"int":   "-1234",
+		"lzf":   strings.Repeat("a", 20),
+	}
+	for k, v := range want {
+		if got, ok := st.Get(k); !ok || got != v {
+			t.Fatalf("key %q: got %q, %v; want %q", k, got, ok, v)
+		}
+	}
+	for _, k := range []string{"gone", "list", "other-db"} {
+		if _, ok := st.Get(k); ok {
+			t.Fatalf("key %q should not have been imported", k)
+		}
+	}
+}
+
+func TestImportRedisRDBCorruptLength(t *testing.T) {
+	prefixes := map[string][]byte{
+		// A 64-bit length that doesn't fit in an int
+		"huge length": {0x81, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		// 100 MB, with the file ending long before
+		"truncated": {0x80, 0x06, 0x40, 0x00, 0x00},
+		// LZF string claiming to expand to 4 GB
+		"lzf": {0xC3, 0x02, 0x80, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 'a'},
+	}
+	for name, prefix := range prefixes {
+		st := newTestStore(t)
+		var b rdbBuilder
+		b.WriteString("REDIS0011")
+		b.WriteByte(0)
+		b.str("key")
+		b.Write(prefix)
+		b.WriteString("short")
+
+		if _, err := importer.ImportRedisRDB(&b, st, importer.RedisOptions{}); err == nil {
+			t.Fatalf("%s: expected an error for a corrupt length", name)
+		}
+	}
+}
+
+func respCommand(args ...string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return sb.String()
+}
+
+func TestImportRedisAOF(t *testing.T) {
+	st := newTestStore(t)
+	now := time.Now()
+	past := fmt.Sprint(now.Add(-time.Minute).UnixMilli())
+	future := fmt.Sprint(now.Add(time.Hour).UnixMilli())
+
+	aof := respCommand("SELECT", "0") +
+		respCommand("SET", "a", "1") +
+		respCommand("SET", "b", "2", "PXAT", future) +
+		respCommand("SET", "c", "3", "PXAT", past) +
+		respCommand("INCR", "a") +
+		respCommand("MULTI") +
+		respCommand("RPUSH", "list", "x") +
+		respCommand("EXEC") +
+		"#TS:1700000000\r\n" +
+		"   \r\n" +
+		respCommand("SET", "d", "4") +
+		respCommand("DEL", "d") +
+		respCommand("SET", "e", "5") +
+		respCommand("RENAME", "e", "f") +
+		respCommand("SET", "g", "7") +
+		respCommand("PEXPIREAT", "g", past) +
+		respCommand("SET", "b", "ignored", "NX") +
+		respCommand("SELECT", "1") +
+		respCommand("SET", "a", "other-db") +
+		respCommand("FLUSHDB")
+
+	stats, err := importer.ImportRedisAOF(strings.NewReader(aof), st, importer.RedisOptions{})
+	if err != nil {
+		t.Fatalf("ImportRedisAOF: %v", err)
+	}
+	if stats.Skipped["RPUSH"] != 1 {
+		t.Fatalf("expected RPUSH to be skipped: %+v", stats)
+	}
+
+	want := map[string]string{"a": "2", "b": "2", "f": "5"}
+	for k, v := range want {
+		if got, ok := st.Get(k); !ok || got != v {
+			t.Fatalf("key %q: got %q, %v; want %q", k, got, ok, v)
+		}
+	}
+	for _, k := range []string{"c", "d", "e", "g", "list"} {
+		if _, ok := st.Get(k); ok {
+			t.Fatalf("key %q should not exist", k)
+		}
+	}
+}
+
+func TestImportRedisAOFCorruptLength(t *testing.T) {
+	for name, aof := range map[string]string{
+		"bulk length":  "*1\r\n$536870000\r\nshort",
+		"array length": "*1000000\r\n$3\r\nSET\r\n",
+		"long line":    strings.Repeat("x", 1<<20),
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := importer.ImportRedisAOF(strings.NewReader(aof), newTestStore(t), importer.RedisOptions{})
+		runtime.ReadMemStats(&after)
+		if err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+		// The claimed lengths aren't allocated before the data arrives
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+			t.Fatalf("%s: allocated %d bytes", name, allocated)
+		}
+	}
+}
+
+func TestImportRedisAOFTruncated(t *testing.T) {
+	st := newTestStore(t)
+	aof := respCommand("SET", "a", "1") + "*3\r\n$3\r\nSET\r\n$1\r\nb"
+
+	stats, err := importer.ImportRedisAOF(strings.NewReader(aof), st, importer.RedisOptions{})
+	if err == nil {
+		t.Fatalf("expected an error for a truncated AOF")
+	}
+	if stats.Imported != 1 {
+		t.Fatalf("expected the complete command to be imported, got %+v", stats)
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/logging"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// A buffer that is safe to write from the server goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLoggingNew(t *testing.T) {
+	if _, err := logging.New(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Fatalf("expected an error for an unknown level")
+	}
+	if _, err := logging.New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "key", "v")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), `"msg":"shown"`) {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestRPCLoggingInterceptor(t *testing.T) {
+	var logs syncBuffer
+	logger, _ := logging.New(&logs, "debug", "json")
+	srv := api.NewGRPCServer(newTestStore(t), grpc.ChainUnaryInterceptor(api.RPCLoggingInterceptor(logger)))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := kvstore.NewKVStoreClient(conn)
+
+	// A caller supplied ID is kept and echoed back
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-123")
+	var header metadata.MD
+	if _, err := client.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "req-123" {
+		t.Fatalf("unexpected x-request-id header %v", got)
+	}
+
+	// Otherwise one is generated
+	header = nil
+	client.Get(context.Background(), &kvstore.GetRequest{Key: ""}, grpc.Header(&header))
+	if got := header.Get("x-request-id"); len(got) != 1 || len(got[0]) != 16 {
+		t.Fatalf("expected a generated request ID, got %v", got)
+	}
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 log records, got %d:\n%s", len(records), logs.String())
+	}
+	if records[0]["request_id"] != "req-123" || records[0]["level"] != "DEBUG" || records[0]["method"] != "/kvstore.KVStore/Set" {
+		t.Fatalf("unexpected record for Set: %v", records[0])
+	}
+	if records[1]["code"] != "InvalidArgument" || records[1]["level"] != "INFO" || records[1]["request_id"] != header.Get("x-request-id")[0] {
+		t.Fatalf("unexpected record for Get: %v", records[1])
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+)
+
+func startMemcachedServer(t *testing.T) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	srv := api.NewMemcachedServer(newTestStore(t))
+	conn := serveAndDial(t, srv.Serve, srv.Stop)
+	return conn, bufio.NewReader(conn)
+}
+
+// Sends a request and checks the reply lines that follow it.
+func memcachedExpect(t *testing.T, conn net.Conn, r *bufio.Reader, request string, want ...string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, w := range want {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%q: reading reply: %v", request, err)
+		}
+		if got := strings.TrimSuffix(line, "\r\n"); got != w {
+			t.Fatalf("%q: got %q, want %q", request, got, w)
+		}
+	}
+}
+
+func TestMemcachedStorageCommands(t *testing.T) {
+	conn, r := startMemcachedServer(t)
+
+	memcachedExpect(t, conn, r, "set k 42 0 5\r\nhello\r\n", "STORED")
+	memcachedExpect(t, conn, r, "get k missing\r\n", "VALUE k 42 5", "hello", "END")
+	memcachedExpect(t, conn, r, "add k 0 0 1\r\nx\r\n", "NOT_STORED")
+	memcachedExpect(t, conn, r, "replace missing 0 0 1\r\nx\r\n", "NOT_STORED")
+	memcachedExpect(t, conn, r, "replace k 7 0 5\r\nworld\r\n", "STORED")
+	memcachedExpect(t, conn, r, "get k\r\n", "VALUE k 7 5", "world", "END")
+	memcachedExpect(t, conn, r, "delete k\r\n", "DELETED")
+	memcachedExpect(t, conn, r, "delete k\r\n", "NOT_FOUND")
+
+	// noreply suppresses the answer, so the next reply belongs to get
+	memcachedExpect(t, conn, r, "set quiet 0 0 1 noreply\r\nq\r\nget quiet\r\n", "VALUE quiet 0 1", "q", "END")
+
+	// Negative exptime stores an item that is already expired
+	memcachedExpect(t, conn, r, "set gone 0 -1 1\r\nx\r\n", "STORED")
+	memcachedExpect(t, conn, r, "get gone\r\n", "END")
+
+	memcachedExpect(t, conn, r, "bogus\r\n", "ERROR")
+	memcachedExpect(t, conn, r, "get\r\n", "CLIENT_ERROR bad command line format")
+}
+
+func TestMemcachedCAS(t *testing.T) {
+	conn, r := startMemcachedServer(t)
+
+	memcachedExpect(t, conn, r, "cas k 0 0 1 1\r\nx\r\n", "NOT_FOUND")
+	memcachedExpect(t, conn, r, "set k 0 0 2\r\nv1\r\n", "STORED")
+
+	conn.Write([]byte("gets k\r\n"))
+	var key string
+	var flags, size int
+	var cas uint64
+	line, _ := r.ReadString('\n')
+	if _, err := fmt.Sscanf(line, "VALUE %s %d %d %d", &key, &flags, &size, &cas); err != nil {
+		t.Fatalf("unexpected gets reply %q: %v", line, err)
+	}
+	memcachedExpect(t, conn, r, "", "v1", "END")
+
+	memcachedExpect(t, conn, r, fmt.Sprintf("cas k 0 0 2 %d\r\nv2\r\n", cas), "STORED")
+	// The CAS value changed with the write
+	memcachedExpect(t, conn, r, fmt.Sprintf("cas k 0 0 2 %d\r\nv3\r\n", cas), "EXISTS")
+	memcachedExpect(t, conn, r, "get k\r\n", "VALUE k 0 2", "v2", "END")
+}
+
+func TestMemcachedIncrDecrTouch(t *testing.T) {
+	conn, r := startMemcachedServer(t)
+
+	memcachedExpect(t, conn, r, "incr n 1\r\n", "NOT_FOUND")
+	memcachedExpect(t, conn, r, "set n 5 100 2\r\n10\r\n", "STORED")
+	memcachedExpect(t, conn, r, "incr n 5\r\n", "15")
+	memcachedExpect(t, conn, r, "decr n 100\r\n", "0")
+	memcachedExpect(t, conn, r, "set max 0 0 20\r\n18446744073709551615\r\n", "STORED")
+	memcachedExpect(t, conn, r, "incr max 2\r\n", "1")
+	memcachedExpect(t, conn, r, "set s 0 0 3\r\nabc\r\n", "STORED")
+	memcachedExpect(t, conn, r, "incr s 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+
+	// Flags survive incr
+	memcachedExpect(t, conn, r, "get n\r\n", "VALUE n 5 1", "0", "END")
+
+	memcachedExpect(t, conn, r, "touch missing 10\r\n", "NOT_FOUND")
+	memcachedExpect(t, conn, r, "touch n -1\r\n", "TOUCHED")
+	memcachedExpect(t, conn, r, "get n\r\n", "END")
+
+	// Large exptimes are absolute unix timestamps
+	future := time.Now().Add(time.Hour).Unix()
+	memcachedExpect(t, conn, r, fmt.Sprintf("set abs 0 %d 1\r\nx\r\n", future), "STORED")
+	memcachedExpect(t, conn, r, "get abs\r\n", "VALUE abs 0 1", "x", "END")
+	past := time.Now().Add(-time.Hour).Unix()
+	memcachedExpect(t, conn, r, fmt.Sprintf("touch abs %d\r\n", past), "TOUCHED")
+	memcachedExpect(t, conn, r, "get abs\r\n", "END")
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/metrics"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestMetricsTextFormat(t *testing.T) {
+	reg := metrics.NewRegistry()
+	requests := reg.NewCounter("requests_total", "Requests.", "method")
+	requests.With("get").Inc()
+	requests.With("get").Add(2)
+	requests.With(`a"b`).Inc()
+	latency := reg.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+	reg.NewGaugeFunc("conns", "Connections.", func() float64 { return 2 }, metrics.Label{Name: "protocol", Value: "grpc"})
+	reg.NewGaugeFunc("conns", "Connections.", func() float64 { return 3 }, metrics.Label{Name: "protocol", Value: "resp"})
+
+	var sb strings.Builder
+	reg.Write(&sb)
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="a\"b"} 1
+requests_total{method="get"} 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP conns Connections.
+# TYPE conns gauge
+conns{protocol="grpc"} 2
+conns{protocol="resp"} 3
+`
+	if sb.String() != want {
+		t.Fatalf("unexpected output:\n%s", sb.String())
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	st := newTestStore(t)
+	reg := metrics.NewRegistry()
+	api.RegisterStoreMetrics(reg, st)
+	srv := api.NewGRPCServer(st, grpc.ChainUnaryInterceptor(api.RPCMetricsInterceptor(reg)))
+	api.RegisterConnectionMetrics(reg, "grpc", srv)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	client := kvstore.NewKVStoreClient(conn)
+	client.Set(context.Background(), &kvstore.SetRequest{Key: "k", Value: "v"})
+	client.Get(context.Background(), &kvstore.GetRequest{Key: ""})
+
+	metricsSrv := httptest.NewServer(reg.Handler())
+	defer metricsSrv.Close()
+	resp, err := metricsSrv.Client().Get(metricsSrv.URL)
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	for _, want := range []string{
+		`kvstore_grpc_requests_total{method="/kvstore.KVStore/Set",code="OK"} 1`,
+		`kvstore_grpc_requests_total{method="/kvstore.KVStore/Get",code="InvalidArgument"} 1`,
+		`kvstore_grpc_request_duration_seconds_count{method="/kvstore.KVStore/Set"} 1`,
+		"kvstore_keys 1\n",
+		`kvstore_active_connections{protocol="grpc"} 1`,
+		"kvstore_snapshot_age_seconds NaN\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/hlc"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// A clock stuck at at, so sites writing at the same time tie.
+func fixedClock(at time.Time) *hlc.Clock {
+	return hlc.NewClock(func() time.Time { return at })
+}
+
+// Starts following the site at addr, stopped when the test ends.
+func startPeer(t *testing.T, st *store.Store, id, addr string) *replication.Peer {
+	t.Helper()
+	peer, err := replication.NewPeer(st, id, addr, replication.PeerOptions{
+		Origin:     st.Origin(),
+		RetryDelay: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewPeer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		peer.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		peer.Close()
+	})
+	return peer
+}
+
+// Serves st as a site following peers, which must be running.
+func startSite(t *testing.T, st *store.Store, lis net.Listener, peers ...*replication.Peer) *grpc.ClientConn {
+	t.Helper()
+	log := replication.NewLog(100)
+	st.SetWriteObserver(log.Append)
+	srv := api.NewGRPCServer(st)
+	srv.EnableReplication(log, nil).SetPeers(peers)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return lis
+}
+
+func TestHLCClock(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	clock := hlc.NewClock(func() time.Time { return now })
+
+	first := clock.Now()
+	if first != hlc.FromTime(now) {
+		t.Fatalf("expected the wall time, got %s", first)
+	}
+	if second := clock.Now(); second <= first || second.Time() != first.Time() || second.Logical() != 1 {
+		t.Fatalf("expected the logical part to tick on the same millisecond, got %s after %s", second, first)
+	}
+
+	remote := hlc.FromTime(now.Add(time.Second))
+	clock.Update(remote)
+	if next := clock.Now(); next <= remote {
+		t.Fatalf("expected a timestamp past %s, got %s", remote, next)
+	}
+
+	now = now.Add(time.Hour)
+	if next := clock.Now(); next != hlc.FromTime(now) {
+		t.Fatalf("expected the clock to follow the wall time again, got %s", next)
+	}
+}
+
+func TestMergeKeepsTheLastWriter(t *testing.T) {
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+	if err := os.MkdirAll(snapshotDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	s, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	base := time.Now()
+	s.EnableMultiMaster("b", fixedClock(base))
+
+	// A local write, then writes from site a around it
+	s.Set("k", "local", 0, true)
+	local, _ := s.GetItem("k")
+	if local.Origin != "b" || local.Timestamp != hlc.FromTime(base) {
+		t.Fatalf("expected the write stamped by site b, got %+v", local)
+	}
+	older := persistance.AOFEntry{Op: "set", Key: "k", Value: "older", Timestamp: local.Timestamp - 1, Origin: "a"}
+	if applied := s.Merge(older); applied != 0 {
+		t.Fatalf("expected an older write to lose, %d applied", applied)
+	}
+	// On a tie the higher origin wins, b over a
+	tie := persistance.AOFEntry{Op: "set", Key: "k", Value: "tie", Timestamp: local.Timestamp, Origin: "a"}
+	if applied := s.Merge(tie); applied != 0 {
+		t.Fatalf("expected a tie with a lower origin to lose, %d applied", applied)
+	}
+	newer := persistance.AOFEntry{Op: "set", Key: "k", Value: "newer", Timestamp: local.Timestamp + 5, Origin: "a"}
+	if applied := s.Merge(newer); applied != 1 {
+		t.Fatalf("expected a newer write to win, %d applied", applied)
+	}
+	if v, _ := s.Get("k"); v != "newer" {
+		t.Fatalf("expected newer, got %q", v)
+	}
+
+	// The clock moved past the merged write, so the next local one wins
+	s.Set("k", "after", 0, true)
+	if item, _ := s.GetItem("k"); item.Timestamp <= newer.Timestamp {
+		t.Fatalf("expected a timestamp past %s, got %s", newer.Timestamp, item.Timestamp)
+	}
+
+	// A delete leaves a tombstone that older writes can't get past
+	deleted := persistance.AOFEntry{Op: "delete", Key: "k", Timestamp: hlc.FromTime(base.Add(time.Minute)), Origin: "a"}
+	if applied := s.Merge(deleted); applied != 1 {
+		t.Fatalf("expected the delete to win, %d applied", applied)
+	}
+	late := persistance.AOFEntry{Op: "set", Key: "k", Value: "late", Timestamp: deleted.Timestamp - 1, Origin: "c"}
+	batch := persistance.AOFEntry{Op: "batch", Entries: []persistance.AOFEntry{
+		late,
+		{Op: "set", Key: "other", Value: "v", Timestamp: deleted.Timestamp, Origin: "c"},
+	}}
+	if applied := s.Merge(batch); applied != 1 {
+		t.Fatalf("expected only the write to the other key, %d applied", applied)
+	}
+	if _, ok := s.Get("k"); ok {
+		t.Fatalf("expected the tombstone to keep the key deleted")
+	}
+	// Writes without a timestamp come from outside multi-master mode
+	if applied := s.Merge(persistance.AOFEntry{Op: "set", Key: "plain", Value: "v"}); applied != 0 {
+		t.Fatalf("expected a write without a timestamp to be ignored, %d applied", applied)
+	}
+
+	// Tombstones survive a restart, from the AOF and from a snapshot
+	check := func(s *store.Store) {
+		t.Helper()
+		tombstones := s.Tombstones()
+		if len(tombstones) != 1 || tombstones[0].Key != "k" || tombstones[0].Timestamp != deleted.Timestamp || tombstones[0].Origin != "a" {
+			t.Fatalf("unexpected tombstones: %+v", tombstones)
+		}
+		if item, _ := s.GetItem("other"); item.Origin != "c" || item.Timestamp != deleted.Timestamp {
+			t.Fatalf("expected the merged write with its stamp, got %+v", item)
+		}
+	}
+	s.Close()
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	check(s)
+	if err := s.SaveSnapshot(); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	s.Close()
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+	check(s)
+}
+
+func TestTombstonesAreCollected(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableMultiMaster("a", hlc.NewClock(nil))
+	s.SetTombstoneTTL(time.Hour)
+	s.SetExpiryInterval(10 * time.Millisecond)
+
+	old := hlc.FromTime(time.Now().Add(-2 * time.Hour))
+	s.Merge(persistance.AOFEntry{Op: "delete", Key: "old", Timestamp: old, Origin: "b"})
+	s.Set("recent", "v", 0, true)
+	s.Delete("recent")
+	if n := len(s.Tombstones()); n != 2 {
+		t.Fatalf("expected 2 tombstones, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.InitBackgroundTasks(ctx)
+	waitUntil(t, "the old tombstone to go", func() bool { return len(s.Tombstones()) == 1 })
+	if tombstones := s.Tombstones(); tombstones[0].Key != "recent" {
+		t.Fatalf("expected the recent tombstone to stay, got %+v", tombstones)
+	}
+}
+
+func TestMultiMasterSitesConverge(t *testing.T) {
+	ctx := context.Background()
+	base := time.Now()
+	siteA, siteB := newTestStore(t), newTestStore(t)
+	siteA.EnableMultiMaster("a", fixedClock(base))
+	siteB.EnableMultiMaster("b", fixedClock(base))
+
+	// Written before the sites reach each other: both write x at the same
+	// time, and a deletes y after b wrote it
+	siteA.Set("x", "from-a", 0, true)
+	siteB.Set("x", "from-b", 0, true)
+	siteB.Set("y", "from-b", 0, true)
+	siteA.Set("y", "from-a", 0, true)
+	siteA.Set("y", "again", 0, true)
+	siteA.Delete("y")
+
+	lisA, lisB := listen(t), listen(t)
+	peerOfA := startPeer(t, siteA, "b", lisB.Addr().String())
+	peerOfB := startPeer(t, siteB, "a", lisA.Addr().String())
+	connA := startSite(t, siteA, lisA, peerOfA)
+	connB := startSite(t, siteB, lisB, peerOfB)
+	clientA, clientB := kvstore.NewKVStoreClient(connA), kvstore.NewKVStoreClient(connB)
+
+	value := func(st *store.Store, key string) string {
+		v, _ := st.Get(key)
+		return v
+	}
+	waitUntil(t, "the sites to sync", func() bool {
+		return peerOfA.Status().Connected && peerOfB.Status().Connected
+	})
+	for _, st := range []*store.Store{siteA, siteB} {
+		if v := value(st, "x"); v != "from-b" {
+			t.Fatalf("expected the tie to go to b, got %q", v)
+		}
+		if _, ok := st.Get("y"); ok {
+			t.Fatalf("expected the later delete to win")
+		}
+	}
+
+	// Writes on either site reach the other, and aren't sent back
+	clientA.Set(ctx, &kvstore.SetRequest{Key: "z", Value: "1"})
+	waitUntil(t, "z on b", func() bool { return value(siteB, "z") == "1" })
+	clientB.Delete(ctx, &kvstore.DeleteRequest{Key: "z"})
+	clientB.MSet(ctx, &kvstore.MSetRequest{Entries: []*kvstore.SetRequest{
+		{Key: "m1", Value: "v"},
+		{Key: "m2", Value: "v", TtlSeconds: 60},
+	}})
+	waitUntil(t, "the writes on a", func() bool {
+		_, found := siteA.Get("z")
+		return !found && value(siteA, "m2") == "v"
+	})
+	if st := peerOfA.Status(); st.WritesApplied != st.WritesReceived {
+		t.Fatalf("expected every write from b to apply, got %+v", st)
+	}
+
+	digestA, err := kvstore.NewReplicationClient(connA).Digest(ctx, &kvstore.DigestRequest{Buckets: 16})
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	digestB, err := kvstore.NewReplicationClient(connB).Digest(ctx, &kvstore.DigestRequest{Buckets: 16})
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	if digestA.Keys != 3 || digestB.Keys != 3 || digestA.Tombstones != 2 || digestB.Tombstones != 2 {
+		t.Fatalf("expected 3 keys and 2 tombstones on both, got %+v and %+v", digestA, digestB)
+	}
+	for i := range digestA.Buckets {
+		if digestA.Buckets[i].Hash != digestB.Buckets[i].Hash {
+			t.Fatalf("bucket %d differs after the sites converged", i)
+		}
+	}
+
+	status, err := kvstore.NewReplicationClient(connA).Status(ctx, &kvstore.ReplicationStatusRequest{})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Role != "multi-master" || status.OriginId != "a" || len(status.Peers) != 1 || status.Peers[0].Id != "b" || !status.Peers[0].Connected {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestDigestFindsDivergedKeys(t *testing.T) {
+	ctx := context.Background()
+	siteA, siteB := newTestStore(t), newTestStore(t)
+	siteA.EnableMultiMaster("a", hlc.NewClock(nil))
+	siteB.EnableMultiMaster("b", hlc.NewClock(nil))
+	ts := hlc.FromTime(time.Now())
+	for _, st := range []*store.Store{siteA, siteB} {
+		st.Merge(persistance.AOFEntry{Op: "set", Key: "same", Value: "v", Timestamp: ts, Origin: "a"})
+	}
+	siteA.Set("changed", "on a", 0, true)
+	siteB.Set("changed", "on b", 0, true)
+	siteA.Set("only-a", "v", 0, true)
+
+	digest := func(conn *grpc.ClientConn, req *kvstore.DigestRequest) *kvstore.DigestResponse {
+		t.Helper()
+		resp, err := kvstore.NewReplicationClient(conn).Digest(ctx, req)
+		if err != nil {
+			t.Fatalf("Digest: %v", err)
+		}
+		return resp
+	}
+	_, connA := startReplicationNode(t, siteA, nil)
+	_, connB := startReplicationNode(t, siteB, nil)
+	a, b := digest(connA, &kvstore.DigestRequest{}), digest(connB, &kvstore.DigestRequest{})
+	if len(a.Buckets) != 256 || a.OriginId != "a" {
+		t.Fatalf("expected 256 buckets from site a, got %d from %q", len(a.Buckets), a.OriginId)
+	}
+
+	var differing []uint32
+	for i := range a.Buckets {
+		if a.Buckets[i].Keys != b.Buckets[i].Keys || a.Buckets[i].Hash != b.Buckets[i].Hash {
+			differing = append(differing, uint32(i))
+		}
+	}
+	want := map[uint32]bool{
+		uint32(store.KeyBucket("changed", 256)): true,
+		uint32(store.KeyBucket("only-a", 256)):  true,
+	}
+	if len(differing) != len(want) {
+		t.Fatalf("expected buckets %v to differ, got %v", want, differing)
+	}
+	listed := digest(connA, &kvstore.DigestRequest{ListBuckets: differing}).Listed
+	keys := map[string]bool{}
+	for _, k := range listed {
+		keys[k.Key] = true
+	}
+	if len(keys) != 2 || !keys["changed"] || !keys["only-a"] {
+		t.Fatalf("expected changed and only-a listed, got %+v", listed)
+	}
+}
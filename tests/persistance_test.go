@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+)
+
+func TestReadAOFStopsAtCorruptTail(t *testing.T) {
+	good := `{"Op":"set","Key":"a","Value":"1","ExpiresAt":"0001-01-01T00:00:00Z"}` + "\n" +
+		`{"Op":"delete","Key":"a","Value":"","ExpiresAt":"0001-01-01T00:00:00Z"}` + "\n"
+	data := good + `{"Op":"set","Ke`
+
+	entries, valid, err := persistance.ReadAOF(strings.NewReader(data))
+	var corrupt *persistance.CorruptionError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("expected CorruptionError, got %v", err)
+	}
+	if corrupt.Line != 3 || corrupt.Offset != int64(len(good)) {
+		t.Fatalf("unexpected corruption position: %+v", corrupt)
+	}
+	if valid != int64(len(good)) {
+		t.Fatalf("expected %d valid bytes, got %d", len(good), valid)
+	}
+	if len(entries) != 2 || entries[1].Op != "delete" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestReadAOFIntact(t *testing.T) {
+	data := `{"Op":"set","Key":"a","Value":"1","ExpiresAt":"2001-01-01T00:00:00Z"}` + "\n"
+
+	entries, valid, err := persistance.ReadAOF(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadAOF: %v", err)
+	}
+	// Expired records are kept, only LoadAOF filters them
+	if len(entries) != 1 || valid != int64(len(data)) {
+		t.Fatalf("unexpected result: entries=%+v valid=%d", entries, valid)
+	}
+}
+
+func TestLoadSnapshotFile(t *testing.T) {
+	dir := t.TempDir()
+	sp := persistance.NewSnapshotPersistance()
+	want := []persistance.SnapshotEntry{{Key: "k", Value: "v"}}
+	if err := sp.SaveSnapshot(dir, want); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+
+	got, err := persistance.LoadSnapshotFile(filepath.Join(dir, persistance.SnapshotFilename))
+	if err != nil {
+		t.Fatalf("LoadSnapshotFile: %v", err)
+	}
+	if len(got) != 1 || got[0].Key != "k" || got[0].Value != "v" {
+		t.Fatalf("unexpected entries: %+v", got)
+	}
+
+	if _, err := persistance.LoadSnapshotFile(filepath.Join(dir, "missing.gob")); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/raft"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type clusterNode struct {
+	id        string
+	addr      string
+	store     *store.Store
+	node      *raft.Node
+	server    *api.GRPCServer
+	transport *raft.GRPCTransport
+	client    kvstore.KVStoreClient
+	raft      kvstore.RaftClient
+	stopped   bool
+}
+
+func (c *clusterNode) stop() {
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	c.server.Stop()
+	c.node.Stop()
+	c.transport.Close()
+	c.store.Close()
+}
+
+// Starts a node listening on lis. An empty bootstrap list makes a node that
+// waits to be added to an existing cluster.
+func startClusterNode(t *testing.T, id string, lis net.Listener, bootstrap []raft.Member, snapshotThreshold int) *clusterNode {
+	t.Helper()
+	dir := t.TempDir()
+	st, err := store.New(filepath.Join(dir, "aof.log"), filepath.Join(dir, "snapshots"))
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	transport := raft.NewGRPCTransport(raft.GRPCTransportOptions{})
+	node, err := raft.NewNode(raft.Config{
+		ID:                id,
+		Dir:               filepath.Join(dir, "raft"),
+		Bootstrap:         bootstrap,
+		ElectionTimeout:   300 * time.Millisecond,
+		HeartbeatInterval: 50 * time.Millisecond,
+		SnapshotThreshold: snapshotThreshold,
+	}, raft.NewStoreFSM(st), transport)
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+
+	srv := api.NewGRPCServer(st)
+	srv.EnableCluster(node)
+	go srv.Serve(lis)
+	node.Start()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c := &clusterNode{
+		id:        id,
+		addr:      lis.Addr().String(),
+		store:     st,
+		node:      node,
+		server:    srv,
+		transport: transport,
+		client:    kvstore.NewKVStoreClient(conn),
+		raft:      kvstore.NewRaftClient(conn),
+	}
+	t.Cleanup(func() {
+		c.stop()
+		conn.Close()
+	})
+	return c
+}
+
+func listenLocal(t *testing.T) net.Listener {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return lis
+}
+
+func startCluster(t *testing.T, size, snapshotThreshold int) []*clusterNode {
+	t.Helper()
+	listeners := make([]net.Listener, size)
+	members := make([]raft.Member, size)
+	for i := range listeners {
+		listeners[i] = listenLocal(t)
+		members[i] = raft.Member{ID: fmt.Sprintf("n%d", i+1), Addr: listeners[i].Addr().String()}
+	}
+	nodes := make([]*clusterNode, size)
+	for i, lis := range listeners {
+		nodes[i] = startClusterNode(t, members[i].ID, lis, members, snapshotThreshold)
+	}
+	return nodes
+}
+
+// Waits for a single leader among the running nodes.
+func waitForLeader(t *testing.T, nodes []*clusterNode) *clusterNode {
+	t.Helper()
+	var leader *clusterNode
+	waitUntil(t, "a leader", func() bool {
+		leader = nil
+		for _, n := range nodes {
+			if n.stopped || n.node.Status().State != raft.Leader {
+				continue
+			}
+			if leader != nil {
+				return false
+			}
+			leader = n
+		}
+		return leader != nil
+	})
+	return leader
+}
+
+func TestRaftElectsLeaderAndReplicatesWrites(t *testing.T) {
+	nodes := startCluster(t, 3, 1000)
+	leader := waitForLeader(t, nodes)
+	ctx := context.Background()
+
+	for i := range 10 {
+		key := fmt.Sprintf("key-%d", i)
+		resp, err := leader.client.Set(ctx, &kvstore.SetRequest{Key: key, Value: "value"})
+		if err != nil || !resp.Success {
+			t.Fatalf("set %s: %v %v", key, resp, err)
+		}
+	}
+	if _, err := leader.client.Delete(ctx, &kvstore.DeleteRequest{Key: "key-0"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	want, _ := leader.store.GetItem("key-9")
+	for _, n := range nodes {
+		waitUntil(t, "the writes on "+n.id, func() bool {
+			item, ok := n.store.GetItem("key-9")
+			_, deleted := n.store.Get("key-0")
+			return ok && !deleted && item.Version == want.Version
+		})
+	}
+}
+
+func TestRaftApplyIsDeterministic(t *testing.T) {
+	// Nodes apply a command at different times, the default TTL mustn't
+	// give them different expiries
+	command, err := proto.Marshal(&kvstore.RaftCommand{Op: "mset", Entries: []*kvstore.RaftCommand{
+		{Key: "persistent", Value: "v"},
+		{Key: "expiring", Value: "v", ExpiresAtUnixNano: time.Now().Add(time.Hour).UnixNano()},
+	}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var stores []*store.Store
+	for range 2 {
+		st := newTestStore(t)
+		st.SetDefaultTTL(time.Minute)
+		raft.NewStoreFSM(st).Apply(command)
+		stores = append(stores, st)
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, key := range []string{"persistent", "expiring"} {
+		a, _ := stores[0].GetItem(key)
+		b, _ := stores[1].GetItem(key)
+		if a != b {
+			t.Errorf("%s: got %+v and %+v", key, a, b)
+		}
+	}
+
+	// Writes without a TTL get the default one from the leader
+	nodes := startCluster(t, 3, 1000)
+	for _, n := range nodes {
+		n.store.SetDefaultTTL(time.Minute)
+	}
+	leader := waitForLeader(t, nodes)
+	if _, err := leader.client.Set(context.Background(), &kvstore.SetRequest{Key: "k", Value: "v"}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	want, _ := leader.store.GetItem("k")
+	if want.ExpiresAt.IsZero() {
+		t.Fatalf("expected the default TTL on the leader")
+	}
+	for _, n := range nodes {
+		waitUntil(t, "the write on "+n.id, func() bool {
+			item, _ := n.store.GetItem("k")
+			return item == want
+		})
+	}
+}
+
+func TestRaftFollowerRedirectsToLeader(t *testing.T) {
+	nodes := startCluster(t, 3, 1000)
+	leader := waitForLeader(t, nodes)
+	var follower *clusterNode
+	for _, n := range nodes {
+		if n != leader {
+			follower = n
+		}
+	}
+	waitUntil(t, "the follower to know the leader", func() bool {
+		return follower.node.Status().LeaderID == leader.id
+	})
+
+	var trailer metadata.MD
+	_, err := follower.client.Set(context.Background(), &kvstore.SetRequest{Key: "k", Value: "v"}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if got := trailer.Get("kvstore-leader"); len(got) != 1 || got[0] != leader.addr {
+		t.Fatalf("expected the leader's address %s in the trailer, got %v", leader.addr, got)
+	}
+
+	// Reads need the leader too, followers may be behind
+	if _, err := follower.client.Get(context.Background(), &kvstore.GetRequest{Key: "k"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a read, got %v", err)
+	}
+}
+
+func TestRaftFailoverKeepsCommittedWrites(t *testing.T) {
+	nodes := startCluster(t, 3, 1000)
+	leader := waitForLeader(t, nodes)
+	ctx := context.Background()
+	if _, err := leader.client.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "before"}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	leader.stop()
+	newLeader := waitForLeader(t, nodes)
+	if newLeader == leader {
+		t.Fatal("stopped node is still the leader")
+	}
+
+	// A read right after the election must see the write of the old term
+	resp, err := newLeader.client.Get(ctx, &kvstore.GetRequest{Key: "k"})
+	if err != nil || !resp.Found || resp.Value != "before" {
+		t.Fatalf("expected the committed write, got %v %v", resp, err)
+	}
+	if _, err := newLeader.client.Set(ctx, &kvstore.SetRequest{Key: "k", Value: "after"}); err != nil {
+		t.Fatalf("set on the new leader: %v", err)
+	}
+	resp, err = newLeader.client.Get(ctx, &kvstore.GetRequest{Key: "k"})
+	if err != nil || resp.Value != "after" {
+		t.Fatalf("expected the new write, got %v %v", resp, err)
+	}
+}
+
+func TestRaftRefusesExistingData(t *testing.T) {
+	dir := t.TempDir()
+	aofPath, snapshotDir := filepath.Join(dir, "aof.log"), filepath.Join(dir, "snapshots")
+	st, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer st.Close()
+	st.Set("k", "v", 0, true)
+
+	transport := raft.NewGRPCTransport(raft.GRPCTransportOptions{})
+	defer transport.Close()
+	config := raft.Config{
+		ID:        "n1",
+		Dir:       filepath.Join(dir, "raft"),
+		Bootstrap: []raft.Member{{ID: "n1", Addr: "127.0.0.1:1"}},
+	}
+	if _, err := raft.NewNode(config, raft.NewStoreFSM(st), transport); !errors.Is(err, raft.ErrNotEmpty) {
+		t.Fatalf("expected ErrNotEmpty, got %v", err)
+	}
+	if value, ok := st.Get("k"); !ok || value != "v" {
+		t.Fatalf("expected the data to survive, got %q, %v", value, ok)
+	}
+
+	// A node that already has Raft state restarts over its own data
+	st.Delete("k")
+	node, err := raft.NewNode(config, raft.NewStoreFSM(st), transport)
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+	node.Start()
+	waitUntil(t, "a leader", func() bool { return node.Status().State == raft.Leader })
+	command, _ := proto.Marshal(&kvstore.RaftCommand{Op: "set", Key: "k", Value: "v"})
+	if _, err := node.Apply(context.Background(), command); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	node.Stop()
+	node, err = raft.NewNode(config, raft.NewStoreFSM(st), transport)
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	node.Stop()
+}
+
+func TestRaftNewMemberCatchesUpFromSnapshot(t *testing.T) {
+	nodes := startCluster(t, 3, 20)
+	leader := waitForLeader(t, nodes)
+	ctx := context.Background()
+	for i := range 50 {
+		if _, err := leader.client.Set(ctx, &kvstore.SetRequest{Key: fmt.Sprintf("key-%d", i), Value: "v"}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	waitUntil(t, "log compaction", func() bool {
+		return leader.node.Status().SnapshotIndex > 0
+	})
+
+	lis := listenLocal(t)
+	joiner := startClusterNode(t, "n4", lis, nil, 20)
+	resp, err := leader.raft.AddMember(ctx, &kvstore.AddMemberRequest{Id: "n4", Addr: joiner.addr})
+	if err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if len(resp.Members) != 4 {
+		t.Fatalf("expected 4 members, got %v", resp.Members)
+	}
+
+	want, _ := leader.store.GetItem("key-49")
+	waitUntil(t, "the new member to catch up", func() bool {
+		item, ok := joiner.store.GetItem("key-49")
+		return ok && item.Version == want.Version && joiner.store.Info().Keys == 50
+	})
+
+	// The cluster keeps working after the joiner is removed again
+	if _, err := leader.raft.RemoveMember(ctx, &kvstore.RemoveMemberRequest{Id: "n4"}); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if _, err := leader.client.Set(ctx, &kvstore.SetRequest{Key: "after", Value: "v"}); err != nil {
+		t.Fatalf("set after removal: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/persistance"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/replication"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Serves st on a local port, as a primary when replica is nil.
+func startReplicationNode(t *testing.T, st *store.Store, replica *replication.Replica) (*api.GRPCServer, *grpc.ClientConn) {
+	t.Helper()
+	var log *replication.Log
+	if replica == nil {
+		log = replication.NewLog(100)
+		st.SetWriteObserver(log.Append)
+	}
+	srv := api.NewGRPCServer(st)
+	srv.EnableReplication(log, replica)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, conn
+}
+
+// Starts a replica of the primary at addr, stopped when the test ends.
+func startReplica(t *testing.T, st *store.Store, addr string) *replication.Replica {
+	t.Helper()
+	replica, err := replication.NewReplica(st, addr, replication.ReplicaOptions{
+		ID:         "test-replica",
+		RetryDelay: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewReplica: %v", err)
+	}
+	st.SetPrimary(addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		replica.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		replica.Close()
+	})
+	return replica
+}
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicationLogDropsSlowSubscribers(t *testing.T) {
+	log := replication.NewLog(2)
+	sub := log.Subscribe()
+	for range 3 {
+		log.Append(persistance.AOFEntry{Op: "set", Key: "k"})
+	}
+
+	var got []uint64
+	for record := range sub.Records() {
+		got = append(got, record.Offset)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected offsets 1 and 2 before the drop, got %v", got)
+	}
+	if sub.Err() != replication.ErrTooSlow {
+		t.Fatalf("expected ErrTooSlow, got %v", sub.Err())
+	}
+	if next := log.Subscribe(); next.Offset != 3 {
+		t.Fatalf("expected a new subscription to start at 3, got %d", next.Offset)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestStore(t)
+	primary.Set("before", "v", 0, true)
+	_, primaryConn := startReplicationNode(t, primary, nil)
+	client := kvstore.NewKVStoreClient(primaryConn)
+
+	replicaStore := newTestStore(t)
+	replicaStore.Set("stale", "v", 0, true)
+	replica := startReplica(t, replicaStore, primaryConn.Target())
+	_, replicaConn := startReplicationNode(t, replicaStore, replica)
+
+	waitUntil(t, "the full sync", func() bool { return replica.Status().Connected })
+	if _, ok := replicaStore.Get("before"); !ok {
+		t.Fatalf("expected keys written before the sync")
+	}
+	if _, ok := replicaStore.Get("stale"); ok {
+		t.Fatalf("expected the full sync to replace the replica's data")
+	}
+
+	client.Set(ctx, &kvstore.SetRequest{Key: "a", Value: "1"})
+	client.Set(ctx, &kvstore.SetRequest{Key: "a", Value: "2"})
+	client.MSet(ctx, &kvstore.MSetRequest{Entries: []*kvstore.SetRequest{
+		{Key: "b", Value: "x"},
+		{Key: "c", Value: "y", TtlSeconds: 60},
+	}})
+	client.Delete(ctx, &kvstore.DeleteRequest{Key: "before"})
+	client.Expire(ctx, &kvstore.ExpireRequest{Key: "b", TtlSeconds: 120})
+
+	waitUntil(t, "the writes", func() bool {
+		_, found := replicaStore.Get("before")
+		item, _ := replicaStore.GetItem("b")
+		return !found && !item.ExpiresAt.IsZero()
+	})
+	for _, key := range []string{"a", "b", "c"} {
+		want, _ := primary.GetItem(key)
+		got, found := replicaStore.GetItem(key)
+		if !found || got.Value != want.Value || got.Version != want.Version || !got.ExpiresAt.Equal(want.ExpiresAt) {
+			t.Fatalf("key %s: replica has %+v, primary %+v", key, got, want)
+		}
+	}
+
+	replicaStatus, err := kvstore.NewReplicationClient(replicaConn).Status(ctx, &kvstore.ReplicationStatusRequest{})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if replicaStatus.Role != "replica" || !replicaStatus.Connected || replicaStatus.LagEntries != 0 || replicaStatus.LagSeconds != 0 {
+		t.Fatalf("unexpected replica status: %+v", replicaStatus)
+	}
+	primaryStatus, err := kvstore.NewReplicationClient(primaryConn).Status(ctx, &kvstore.ReplicationStatusRequest{})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if primaryStatus.Role != "primary" || len(primaryStatus.Replicas) != 1 || primaryStatus.Replicas[0].Id != "test-replica" || primaryStatus.Offset != replicaStatus.Offset {
+		t.Fatalf("unexpected primary status: %+v (replica at %d)", primaryStatus, replicaStatus.Offset)
+	}
+}
+
+func TestReplicaRejectsWrites(t *testing.T) {
+	ctx := context.Background()
+	_, primaryConn := startReplicationNode(t, newTestStore(t), nil)
+	replicaStore := newTestStore(t)
+	replica := startReplica(t, replicaStore, primaryConn.Target())
+	_, replicaConn := startReplicationNode(t, replicaStore, replica)
+
+	var trailer metadata.MD
+	_, err := kvstore.NewKVStoreClient(replicaConn).Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v"}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if got := trailer.Get("kvstore-primary"); len(got) != 1 || got[0] != primaryConn.Target() {
+		t.Fatalf("expected the primary's address in the trailer, got %v", got)
+	}
+
+	httpServer := httptest.NewServer(api.NewHTTPServer(replicaStore).Handler())
+	defer httpServer.Close()
+	resp, _ := doHTTP(t, http.MethodPut, httpServer.URL+"/v1/keys/k", "v", nil)
+	if resp.StatusCode != http.StatusMisdirectedRequest || resp.Header.Get("X-KVStore-Primary") != primaryConn.Target() {
+		t.Fatalf("expected 421 with the primary's address, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Replicas can't be synced from
+	stream, err := kvstore.NewReplicationClient(replicaConn).Sync(ctx, &kvstore.SyncRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a sync from a replica, got %v", err)
+	}
+}
+
+func TestReplicaResyncsAfterReconnect(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestStore(t)
+	primaryServer, primaryConn := startReplicationNode(t, primary, nil)
+	replicaStore := newTestStore(t)
+	replica := startReplica(t, replicaStore, primaryConn.Target())
+	waitUntil(t, "the full sync", func() bool { return replica.Status().Connected })
+
+	// Restart the primary on the same port, with writes made while the
+	// replica was away
+	addr := primaryConn.Target()
+	primaryServer.Stop()
+	waitUntil(t, "the disconnect", func() bool { return !replica.Status().Connected })
+	if replica.Status().Lag == 0 {
+		t.Fatalf("expected lag while disconnected")
+	}
+	primary.Set("offline", "v", 0, true)
+
+	log := replication.NewLog(100)
+	primary.SetWriteObserver(log.Append)
+	srv := api.NewGRPCServer(primary)
+	srv.EnableReplication(log, nil)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	waitUntil(t, "the resync", func() bool {
+		_, ok := replicaStore.Get("offline")
+		return ok && replica.Status().Connected
+	})
+	kvstore.NewKVStoreClient(primaryConn).Set(ctx, &kvstore.SetRequest{Key: "after", Value: "v"})
+	waitUntil(t, "a write after the resync", func() bool {
+		_, ok := replicaStore.Get("after")
+		return ok
+	})
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/auth"
+)
+
+func startRESPServer(t *testing.T, opts ...func(*api.RESPServer)) net.Conn {
+	t.Helper()
+	srv := api.NewRESPServer(newTestStore(t))
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return serveAndDial(t, srv.Serve, srv.Stop)
+}
+
+// Serves on a local port until the test ends, and returns a connection to it.
+func serveAndDial(t *testing.T, serve func(net.Listener) error, stop func()) net.Conn {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go serve(lis)
+	t.Cleanup(stop)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Reads one reply and renders it as a string: bulk strings as their
+// content, nulls as "(nil)", arrays and maps as space-separated items.
+func readReply(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+', '-', ':':
+		return line
+	case '_':
+		return "(nil)"
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatalf("reading bulk string: %v", err)
+		}
+		return string(data[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = readReply(t, r)
+		}
+		return strings.Join(items, " ")
+	}
+	t.Fatalf("unexpected reply %q", line)
+	return ""
+}
+
+func TestRESPServerCommands(t *testing.T) {
+	conn := startRESPServer(t)
+	r := bufio.NewReader(conn)
+
+	// Everything is sent at once to exercise pipelining
+	commands := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"SET", "k", "v"}, "+OK"},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"SET", "k", "other", "NX"}, "(nil)"},
+		{[]string{"SET", "missing", "v", "XX"}, "(nil)"},
+		{[]string{"SET", "k", "v2", "XX", "EX", "100"}, "+OK"},
+		{[]string{"TTL", "k"}, ":100"},
+		{[]string{"SET", "k", "v3", "KEEPTTL"}, "+OK"},
+		{[]string{"TTL", "k"}, ":100"},
+		{[]string{"PERSIST", "k"}, ":1"},
+		{[]string{"TTL", "k"}, ":-1"},
+		{[]string{"TTL", "missing"}, ":-2"},
+		{[]string{"EXPIRE", "k", "50"}, ":1"},
+		{[]string{"TTL", "k"}, ":50"},
+		{[]string{"EXISTS", "k", "k", "missing"}, ":2"},
+		{[]string{"SET", "p", "v", "PX", "1"}, "+OK"},
+		{[]string{"DEL", "k", "missing"}, ":1"},
+		{[]string{"GET", "k"}, "(nil)"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "k", "v", "NX", "XX"}, "-ERR syntax error"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"NOPE"}, "-ERR unknown command 'NOPE'"},
+	}
+
+	var sb strings.Builder
+	for _, c := range commands {
+		sb.WriteString(respCommand(c.cmd...))
+	}
+	if _, err := conn.Write([]byte(sb.String())); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	for _, c := range commands {
+		if got := readReply(t, r); got != c.want {
+			t.Fatalf("%v: got %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestRESPServerInlineAndRESP3(t *testing.T) {
+	conn := startRESPServer(t)
+	r := bufio.NewReader(conn)
+
+	// Whitespace-only lines are skipped like blank ones
+	if _, err := conn.Write([]byte("   \r\n\t\r\nPING\r\nHELLO 3\r\nGET missing\r\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := readReply(t, r); got != "+PONG" {
+		t.Fatalf("PING: got %q", got)
+	}
+	if got := readReply(t, r); !strings.Contains(got, "proto :3") {
+		t.Fatalf("HELLO: got %q", got)
+	}
+
+	// RESP3 has a dedicated null type
+	line, _ := r.ReadString('\n')
+	if line != "_\r\n" {
+		t.Fatalf("expected RESP3 null, got %q", line)
+	}
+}
+
+func TestRESPServerAuth(t *testing.T) {
+	acl, err := auth.ParseACL([]byte(testACL))
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	conn := startRESPServer(t, func(srv *api.RESPServer) { srv.EnableAuth(acl) })
+	r := bufio.NewReader(conn)
+
+	commands := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"SET", "app/k", "v"}, "-NOAUTH Authentication required."},
+		{[]string{"PING"}, "-NOAUTH Authentication required."},
+		{[]string{"AUTH", "wrong"}, "-WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH", "ops", "app-token"}, "-WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH", "app", "app-token"}, "+OK"},
+		{[]string{"SET", "app/k", "v"}, "+OK"},
+		{[]string{"GET", "app/k"}, "v"},
+		{[]string{"SET", "shared/k", "v"}, "-NOPERM User app has no permissions to access the 'shared/k' key"},
+		{[]string{"DEL", "app/k", "other"}, "-NOPERM User app has no permissions to access the 'other' key"},
+		{[]string{"GET", "app/k"}, "v"},
+		{[]string{"AUTH", "ops-token"}, "+OK"},
+		{[]string{"DEL", "app/k", "other"}, ":1"},
+	}
+	for _, c := range commands {
+		if _, err := conn.Write([]byte(respCommand(c.cmd...))); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if got := readReply(t, r); got != c.want {
+			t.Fatalf("%v: got %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
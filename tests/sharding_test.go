@@ -0,0 +1,402 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/sharding"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRingSpreadsKeysAndMovesFewOnGrowth(t *testing.T) {
+	nodes := []sharding.Node{{ID: "a", Addr: "a:1"}, {ID: "b", Addr: "b:1"}, {ID: "c", Addr: "c:1"}}
+	ring, err := sharding.NewRing(nodes, sharding.DefaultVirtualNodes)
+	if err != nil {
+		t.Fatalf("NewRing: %v", err)
+	}
+
+	const keys = 10000
+	counts := make(map[string]int)
+	for i := range keys {
+		counts[ring.Owner(fmt.Sprintf("key-%d", i)).ID]++
+	}
+	for _, n := range nodes {
+		if share := float64(counts[n.ID]) / keys; share < 0.25 || share > 0.42 {
+			t.Errorf("node %s owns %.0f%% of the keys", n.ID, share*100)
+		}
+	}
+
+	grown, err := sharding.NewRing(append(nodes, sharding.Node{ID: "d", Addr: "d:1"}), sharding.DefaultVirtualNodes)
+	if err != nil {
+		t.Fatalf("NewRing: %v", err)
+	}
+	moved := 0
+	for i := range keys {
+		key := fmt.Sprintf("key-%d", i)
+		before, after := ring.Owner(key).ID, grown.Owner(key).ID
+		if before == after {
+			continue
+		}
+		if after != "d" {
+			t.Fatalf("key %s moved from %s to %s instead of to the new node", key, before, after)
+		}
+		moved++
+	}
+	if share := float64(moved) / keys; share < 0.15 || share > 0.35 {
+		t.Errorf("expected about a quarter of the keys to move, %.0f%% did", share*100)
+	}
+
+	// Clients rebuild the same ring from the topology
+	copied, err := sharding.RingFromProto(grown.ToProto("a"))
+	if err != nil {
+		t.Fatalf("RingFromProto: %v", err)
+	}
+	for i := range 100 {
+		key := fmt.Sprintf("key-%d", i)
+		if copied.Owner(key) != grown.Owner(key) {
+			t.Fatalf("copied ring disagrees on %s", key)
+		}
+	}
+}
+
+type shardNode struct {
+	id       string
+	addr     string
+	store    *store.Store
+	conn     *grpc.ClientConn
+	sharding *api.ShardingServer
+}
+
+func startShards(t *testing.T, ids ...string) []*shardNode {
+	t.Helper()
+	listeners := make([]net.Listener, len(ids))
+	nodes := make([]sharding.Node, len(ids))
+	for i, id := range ids {
+		listeners[i] = listenLocal(t)
+		nodes[i] = sharding.Node{ID: id, Addr: listeners[i].Addr().String()}
+	}
+	ring, err := sharding.NewRing(nodes, 16)
+	if err != nil {
+		t.Fatalf("NewRing: %v", err)
+	}
+
+	shards := make([]*shardNode, len(ids))
+	for i, lis := range listeners {
+		shards[i] = startShard(t, ids[i], lis, ring)
+	}
+	return shards
+}
+
+// Starts a shard listening on lis, whose writes feed its migrations. A nil
+// ring makes a shard that waits to be added.
+func startShard(t *testing.T, id string, lis net.Listener, ring *sharding.Ring) *shardNode {
+	t.Helper()
+	st := newTestStore(t)
+	srv := api.NewGRPCServer(st)
+	shardingServer, err := srv.EnableSharding(id, ring, api.ShardingOptions{
+		Path:         filepath.Join(t.TempDir(), "topology.json"),
+		VirtualNodes: 16,
+	})
+	if err != nil {
+		t.Fatalf("EnableSharding: %v", err)
+	}
+	st.SetWriteObserver(shardingServer.Observe)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &shardNode{id: id, addr: lis.Addr().String(), store: st, conn: conn, sharding: shardingServer}
+}
+
+func dialInsecure(addr string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+func TestShardRedirectsForeignKeys(t *testing.T) {
+	shards := startShards(t, "a", "b", "c")
+	ctx := context.Background()
+
+	resp, err := kvstore.NewShardingClient(shards[0].conn).Topology(ctx, &kvstore.TopologyRequest{})
+	if err != nil {
+		t.Fatalf("Topology: %v", err)
+	}
+	ring, err := sharding.RingFromProto(resp)
+	if err != nil {
+		t.Fatalf("RingFromProto: %v", err)
+	}
+
+	// Find a key that the first node doesn't own
+	var key string
+	var owner sharding.Node
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key-%d", i)
+		if owner = ring.Owner(key); owner.ID != "a" {
+			break
+		}
+	}
+
+	var trailer metadata.MD
+	client := kvstore.NewKVStoreClient(shards[0].conn)
+	_, err = client.Set(ctx, &kvstore.SetRequest{Key: key, Value: "v"}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if got := trailer.Get(sharding.MovedTrailer); len(got) != 1 || got[0] != owner.Addr {
+		t.Fatalf("expected the owner's address %s in the trailer, got %v", owner.Addr, got)
+	}
+
+	// Batches with one foreign key are rejected as a whole
+	_, err = client.MDelete(ctx, &kvstore.MDeleteRequest{Keys: []string{key}})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a batch, got %v", err)
+	}
+}
+
+func TestRouterSendsKeysToTheirOwners(t *testing.T) {
+	shards := startShards(t, "a", "b", "c")
+	ctx := context.Background()
+
+	router, err := sharding.NewRouter(ctx, shards[1].conn, dialInsecure)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	defer router.Close()
+	client := kvstore.NewKVStoreClient(router)
+
+	var keys []string
+	var entries []*kvstore.SetRequest
+	for i := range 50 {
+		key := fmt.Sprintf("key-%d", i)
+		keys = append(keys, key)
+		entries = append(entries, &kvstore.SetRequest{Key: key, Value: "v" + key})
+	}
+	if _, err := client.Set(ctx, &kvstore.SetRequest{Key: "single", Value: "v"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := client.MSet(ctx, &kvstore.MSetRequest{Entries: entries}); err != nil {
+		t.Fatalf("MSet: %v", err)
+	}
+
+	resp, err := client.MGet(ctx, &kvstore.MGetRequest{Keys: keys})
+	if err != nil {
+		t.Fatalf("MGet: %v", err)
+	}
+	for i, result := range resp.Results {
+		if result.Key != keys[i] || !result.Found || result.Value != "v"+keys[i] {
+			t.Fatalf("result %d out of order or wrong: %+v", i, result)
+		}
+	}
+
+	ring := router.Ring()
+	for _, shard := range shards {
+		for _, key := range append(keys, "single") {
+			_, found := shard.store.Get(key)
+			if owns := ring.Owner(key).ID == shard.id; found != owns {
+				t.Fatalf("shard %s: key %s found %t, owned %t", shard.id, key, found, owns)
+			}
+		}
+	}
+
+	// A server that isn't sharded can't be routed
+	plain := newTestStore(t)
+	_, conn := startReplicationNode(t, plain, nil)
+	if _, err := sharding.NewRouter(ctx, conn, dialInsecure); err != sharding.ErrNotSharded {
+		t.Fatalf("expected ErrNotSharded, got %v", err)
+	}
+}
+
+func TestMigrationMovesKeysWhileServingWrites(t *testing.T) {
+	shards := startShards(t, "a", "b")
+	ctx := context.Background()
+
+	// The new node starts without a topology and is added through a
+	joiner := startShard(t, "c", listenLocal(t), nil)
+	admin := kvstore.NewShardingClient(shards[0].conn)
+	added, err := admin.AddNode(ctx, &kvstore.AddShardNodeRequest{Id: "c", Addr: joiner.addr})
+	if err != nil || len(added.Unreachable) != 0 {
+		t.Fatalf("AddNode: %v %v", added, err)
+	}
+	if epoch := joiner.sharding.Ring().Epoch(); epoch != added.Topology.Epoch {
+		t.Fatalf("the new node has epoch %d, expected %d", epoch, added.Topology.Epoch)
+	}
+
+	router, err := sharding.NewRouter(ctx, shards[1].conn, dialInsecure)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	defer router.Close()
+	client := kvstore.NewKVStoreClient(router)
+	for i := range 300 {
+		req := &kvstore.SetRequest{Key: fmt.Sprintf("key-%d", i), Value: "v"}
+		if i%2 == 0 {
+			req.TtlSeconds = 3600
+		}
+		if _, err := client.Set(ctx, req); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	// Writes keep coming while the keys move
+	stop := make(chan struct{})
+	writerDone := make(chan error, 1)
+	written := 0
+	go func() {
+		for {
+			select {
+			case <-stop:
+				writerDone <- nil
+				return
+			default:
+			}
+			key := fmt.Sprintf("live-%d", written%100)
+			if _, err := client.Set(ctx, &kvstore.SetRequest{Key: key, Value: fmt.Sprint(written)}); err != nil {
+				writerDone <- err
+				return
+			}
+			written++
+		}
+	}()
+
+	status, err := admin.StartMigration(ctx, &kvstore.StartMigrationRequest{TargetId: "c"})
+	if err != nil {
+		t.Fatalf("StartMigration: %v", err)
+	}
+	if len(status.Tokens) == 0 {
+		t.Fatal("expected the migration to pick tokens")
+	}
+	waitUntil(t, "the migration to finish", func() bool {
+		status, err = admin.GetMigration(ctx, &kvstore.GetMigrationRequest{})
+		return err == nil && status.State != "copying" && status.State != "forwarding"
+	})
+	if status.State != "done" {
+		t.Fatalf("migration ended %s: %s", status.State, status.Error)
+	}
+	close(stop)
+	if err := <-writerDone; err != nil {
+		t.Fatalf("write during the migration: %v", err)
+	}
+
+	// Every node ends up with the new topology, and only the owner keeps
+	// each key
+	for _, n := range append(shards, joiner) {
+		waitUntil(t, "the new topology on "+n.id, func() bool {
+			return n.sharding.Ring().Epoch() == status.Epoch
+		})
+	}
+	ring := joiner.sharding.Ring()
+	moved := 0
+	for i := range 300 {
+		key := fmt.Sprintf("key-%d", i)
+		owner := ring.Owner(key).ID
+		if owner == "c" {
+			moved++
+			item, ok := joiner.store.GetItem(key)
+			if !ok || (i%2 == 0) == item.ExpiresAt.IsZero() {
+				t.Fatalf("key %s on the new node: %+v %t", key, item, ok)
+			}
+		}
+		if _, found := shards[0].store.Get(key); found != (owner == "a") {
+			t.Fatalf("key %s on a: found %t, owner %s", key, found, owner)
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no key moved to the new node")
+	}
+
+	// The latest value of every key written during the migration is there
+	for i := range min(written, 100) {
+		key := fmt.Sprintf("live-%d", i)
+		last := written - 1 - (written-1-i)%100
+		resp, err := client.Get(ctx, &kvstore.GetRequest{Key: key})
+		if err != nil || !resp.Found || resp.Value != fmt.Sprint(last) {
+			t.Fatalf("get %s: expected %d, got %v %v", key, last, resp, err)
+		}
+	}
+}
+
+// Takes imports without finishing them, so a migration to it never ends.
+type stuckImporter struct {
+	kvstore.UnimplementedShardingServer
+	cancelled chan struct{}
+}
+
+func (s *stuckImporter) UpdateTopology(ctx context.Context, req *kvstore.TopologyResponse) (*kvstore.TopologyResponse, error) {
+	return req, nil
+}
+
+func (s *stuckImporter) GetMigration(ctx context.Context, req *kvstore.GetMigrationRequest) (*kvstore.MigrationStatus, error) {
+	return &kvstore.MigrationStatus{State: "idle"}, nil
+}
+
+func (s *stuckImporter) ImportKeys(stream kvstore.Sharding_ImportKeysServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	<-stream.Context().Done()
+	close(s.cancelled)
+	return stream.Context().Err()
+}
+
+func TestMigrationAbortKeepsOwnership(t *testing.T) {
+	shards := startShards(t, "a")
+	ctx := context.Background()
+	for i := range 50 {
+		shards[0].store.Set(fmt.Sprintf("key-%d", i), "v", 0, true)
+	}
+
+	lis := listenLocal(t)
+	importer := &stuckImporter{cancelled: make(chan struct{})}
+	srv := grpc.NewServer()
+	kvstore.RegisterShardingServer(srv, importer)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	admin := kvstore.NewShardingClient(shards[0].conn)
+	if _, err := admin.AddNode(ctx, &kvstore.AddShardNodeRequest{Id: "b", Addr: lis.Addr().String()}); err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	epoch := shards[0].sharding.Ring().Epoch()
+	if _, err := admin.StartMigration(ctx, &kvstore.StartMigrationRequest{TargetId: "b"}); err != nil {
+		t.Fatalf("StartMigration: %v", err)
+	}
+	_, err := admin.StartMigration(ctx, &kvstore.StartMigrationRequest{TargetId: "b"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected a second migration to be refused, got %v", err)
+	}
+
+	resp, err := admin.AbortMigration(ctx, &kvstore.AbortMigrationRequest{})
+	if err != nil {
+		t.Fatalf("AbortMigration: %v", err)
+	}
+	if resp.State != "aborted" {
+		t.Fatalf("expected the migration to be aborted, got %s", resp.State)
+	}
+	select {
+	case <-importer.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the import stream was not cancelled")
+	}
+	if got := shards[0].sharding.Ring().Epoch(); got != epoch {
+		t.Fatalf("topology changed from epoch %d to %d", epoch, got)
+	}
+	if keys := shards[0].store.Info().Keys; keys != 50 {
+		t.Fatalf("expected the source to keep its 50 keys, has %d", keys)
+	}
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Waits for the number of goroutines to drop back to baseline. Goroutines
+// take a moment to exit after whatever stopped them returns.
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("%d goroutines left, expected at most %d:\n%s", runtime.NumGoroutine(), baseline, buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackgroundTasksStop(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	// Cancelling the context stops the tasks
+	st := newTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	st.InitBackgroundTasks(ctx)
+	cancel()
+	waitForGoroutines(t, baseline)
+
+	// So does closing the store
+	st = newTestStore(t)
+	st.InitBackgroundTasks(context.Background())
+	if err := st.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	waitForGoroutines(t, baseline)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+
+	st, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	st.InitBackgroundTasks(context.Background())
+
+	listen := func() net.Listener {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		return lis
+	}
+	grpcServer := api.NewGRPCServer(st)
+	respServer := api.NewRESPServer(st)
+	httpServer := api.NewHTTPServer(st)
+	memcachedServer := api.NewMemcachedServer(st)
+	grpcLis, respLis, httpLis, memcachedLis := listen(), listen(), listen(), listen()
+	go grpcServer.Serve(grpcLis)
+	go respServer.Serve(respLis)
+	go httpServer.Serve(httpLis)
+	go memcachedServer.Serve(memcachedLis)
+
+	// A write over every protocol, leaving the connections open and idle
+	conn, err := grpc.NewClient(grpcLis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if _, err := kvstore.NewKVStoreClient(conn).Set(context.Background(), &kvstore.SetRequest{Key: "grpc", Value: "1"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	respConn, err := net.Dial("tcp", respLis.Addr().String())
+	if err != nil {
+		t.Fatalf("dial RESP: %v", err)
+	}
+	defer respConn.Close()
+	fmt.Fprint(respConn, "*3\r\n$3\r\nSET\r\n$4\r\nresp\r\n$1\r\n1\r\n")
+	respReader := bufio.NewReader(respConn)
+	if line, _ := respReader.ReadString('\n'); line != "+OK\r\n" {
+		t.Fatalf("unexpected RESP reply %q", line)
+	}
+
+	memcachedConn, err := net.Dial("tcp", memcachedLis.Addr().String())
+	if err != nil {
+		t.Fatalf("dial memcached: %v", err)
+	}
+	defer memcachedConn.Close()
+	fmt.Fprint(memcachedConn, "set memcached 0 0 1\r\n1\r\n")
+	memcachedReader := bufio.NewReader(memcachedConn)
+	if line, _ := memcachedReader.ReadString('\n'); line != "STORED\r\n" {
+		t.Fatalf("unexpected memcached reply %q", line)
+	}
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Get("http://" + httpLis.Addr().String() + "/v1/keys/grpc")
+	if err != nil {
+		t.Fatalf("HTTP GET: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// Idle connections don't hold up the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	for name, srv := range map[string]interface {
+		Shutdown(context.Context) error
+	}{"grpc": grpcServer, "resp": respServer, "http": httpServer, "memcached": memcachedServer} {
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Fatalf("%s Shutdown: %v", name, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("shutdown took %v", elapsed)
+	}
+	if _, err := respReader.ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected the RESP connection to be closed, got %v", err)
+	}
+	if _, err := memcachedReader.ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected the memcached connection to be closed, got %v", err)
+	}
+
+	if err := st.SaveSnapshot(); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	conn.Close()
+	httpClient.CloseIdleConnections()
+	respConn.Close()
+	memcachedConn.Close()
+	waitForGoroutines(t, baseline)
+
+	// Every write made it to disk
+	st, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer st.Close()
+	_, found := st.MGet([]string{"grpc", "resp", "memcached"})
+	for i, ok := range found {
+		if !ok {
+			t.Fatalf("key %d missing after restart", i)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package tests
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -117,3 +119,193 @@ func TestTTLExpiryViaGet(t *testing.T) {
 		t.Fatalf("expected key to have expired")
 	}
 }
+
+func TestSetWithOptionsConditions(t *testing.T) {
+	s := newTestStore(t)
+
+	if _, ok := s.SetWithOptions("k", "v1", store.SetOptions{Condition: store.SetIfPresent}); ok {
+		t.Fatalf("expected XX set on missing key to fail")
+	}
+	if _, ok := s.SetWithOptions("k", "v1", store.SetOptions{Condition: store.SetIfAbsent}); !ok {
+		t.Fatalf("expected NX set on missing key to succeed")
+	}
+	current, ok := s.SetWithOptions("k", "v2", store.SetOptions{Condition: store.SetIfAbsent})
+	if ok || current.Value != "v1" {
+		t.Fatalf("expected NX set to fail and return the current item, got %+v %v", current, ok)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	s.SetWithOptions("k", "v3", store.SetOptions{ExpiresAt: expiresAt, Condition: store.SetIfPresent})
+	item, _ := s.SetWithOptions("k", "v4", store.SetOptions{KeepTTL: true})
+	if item.Value != "v4" || !item.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected KEEPTTL to keep the expiry, got %+v", item)
+	}
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	s := newTestStore(t)
+
+	if s.Expire("missing", time.Now().Add(time.Minute)) {
+		t.Fatalf("expected Expire on missing key to report false")
+	}
+
+	s.Set("k", "v", 0, true)
+	expiresAt := time.Now().Add(time.Minute)
+	if !s.Expire("k", expiresAt) {
+		t.Fatalf("expected Expire to report true")
+	}
+	if item, _ := s.GetItem("k"); !item.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("unexpected expiry: %v", item.ExpiresAt)
+	}
+
+	if !s.Persist("k") {
+		t.Fatalf("expected Persist to remove the expiry")
+	}
+	if s.Persist("k") {
+		t.Fatalf("expected Persist on a key without expiry to report false")
+	}
+
+	// A time in the past deletes the key
+	s.Expire("k", time.Now().Add(-time.Second))
+	if _, ok := s.Get("k"); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+	if s.Delete("k") {
+		t.Fatalf("expected Delete of a missing key to report false")
+	}
+}
+
+func TestExpiredSetInAOFDoesNotResurrectOldValue(t *testing.T) {
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+
+	s, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	s.Set("k", "old", 0, true)
+	s.SetWithOptions("k", "new", store.SetOptions{ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+	s.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+	if v, ok := s.Get("k"); ok {
+		t.Fatalf("expected key to stay expired after reload, got %q", v)
+	}
+}
+
+func TestBatchWritesSurviveReload(t *testing.T) {
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+
+	s, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	s.MSet([]store.Entry{
+		{Key: "a", Item: store.Item{Value: "1"}},
+		{Key: "b", Item: store.Item{Value: "2"}},
+		{Key: "c", Item: store.Item{Value: "3"}},
+	})
+	if deleted := s.MDelete([]string{"b", "missing"}); !deleted[0] || deleted[1] {
+		t.Fatalf("unexpected MDelete result: %v", deleted)
+	}
+	s.Close()
+
+	file, err := os.Open(aofPath)
+	if err != nil {
+		t.Fatalf("open AOF: %v", err)
+	}
+	records, _, err := persistance.ReadAOF(file)
+	file.Close()
+	if err != nil || len(records) != 2 || records[0].Op != "batch" || len(records[0].Entries) != 3 {
+		t.Fatalf("expected one batch record per MSet, got %+v (err %v)", records, err)
+	}
+
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+	items, found := s.MGet([]string{"a", "b", "c"})
+	if !found[0] || items[0].Value != "1" || found[1] || !found[2] || items[2].Value != "3" {
+		t.Fatalf("unexpected items after reload: %v %v", items, found)
+	}
+}
+
+func TestMaxMemoryEvictsKeys(t *testing.T) {
+	dir := t.TempDir()
+	aofPath := filepath.Join(dir, "aof.log")
+	snapshotDir := filepath.Join(dir, "snapshots")
+
+	s, err := store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	// Every key and value below takes 9 bytes
+	s.SetMaxMemory(20)
+	for i := 0; i < 5; i++ {
+		s.Set(fmt.Sprintf("key%d", i), "value", 0, true)
+	}
+	info := s.Info()
+	if info.Keys != 2 || info.DataBytes > 20 || info.EvictedKeys != 3 || info.MaxMemory != 20 {
+		t.Fatalf("unexpected info after eviction: %+v", info)
+	}
+	if _, ok := s.Get("key4"); !ok {
+		t.Fatalf("expected the last write to survive eviction")
+	}
+
+	// A value bigger than the limit is still stored, on its own
+	s.Set("big", strings.Repeat("x", 100), 0, true)
+	if info := s.Info(); info.Keys != 1 {
+		t.Fatalf("expected only the big key to be left, got %+v", info)
+	}
+
+	s.SetMaxMemory(0)
+	s.MSet([]store.Entry{
+		{Key: "a", Item: store.Item{Value: "1"}},
+		{Key: "b", Item: store.Item{Value: "2"}},
+	})
+	if info := s.Info(); info.Keys != 3 {
+		t.Fatalf("expected no eviction without a limit, got %+v", info)
+	}
+
+	// Lowering the limit evicts right away
+	s.SetMaxMemory(2)
+	before := s.Info()
+	if before.Keys > 1 || before.DataBytes > 2 {
+		t.Fatalf("expected at most one small key to be left, got %+v", before)
+	}
+	s.Close()
+
+	// Evictions are in the AOF, so they stick after a restart
+	s, err = store.New(aofPath, snapshotDir)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer s.Close()
+	if info := s.Info(); info.Keys != before.Keys || info.DataBytes != before.DataBytes {
+		t.Fatalf("unexpected keys after reload: %+v", info)
+	}
+}
+
+func TestSnapshotIntervalChange(t *testing.T) {
+	s := newTestStore(t)
+	go s.SaveSnapshotRegularly(t.Context())
+
+	// The task is waiting on the default interval, the new one applies anyway
+	s.SetSnapshotInterval(20 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Info().LastSnapshot.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot after lowering the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/api"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tlsconfig"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/proto/kvstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// Issues a certificate signed by parent, or a self-signed CA when parent is nil.
+func issueCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// Writes the certificate and key as PEM files and returns their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestGRPCServerMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "test-ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := issueCert(t, "server-1", ca).write(t, dir, "server")
+	clientCert, clientKey := issueCert(t, "client", ca).write(t, dir, "client")
+
+	serverTLS, err := tlsconfig.Server(tlsconfig.ServerOptions{
+		CertFile:     serverCert,
+		KeyFile:      serverKey,
+		ClientCAFile: caFile,
+	})
+	if err != nil {
+		t.Fatalf("server TLS config: %v", err)
+	}
+	srv := api.NewGRPCServer(newTestStore(t), grpc.Creds(credentials.NewTLS(serverTLS)))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	clientTLS, err := tlsconfig.Client(tlsconfig.ClientOptions{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey})
+	if err != nil {
+		t.Fatalf("client TLS config: %v", err)
+	}
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := kvstore.NewKVStoreClient(conn).Set(ctx, &kvstore.SetRequest{Key: "k", Value: "v"}); err != nil {
+		t.Fatalf("Set over mTLS: %v", err)
+	}
+
+	// Without a client certificate the handshake is rejected
+	noCertTLS, _ := tlsconfig.Client(tlsconfig.ClientOptions{CAFile: caFile})
+	noCertConn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(noCertTLS)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_, err = kvstore.NewKVStoreClient(noCertConn).Get(ctx, &kvstore.GetRequest{Key: "k"})
+	noCertConn.Close()
+	if err == nil {
+		t.Fatalf("expected a client without a certificate to be rejected")
+	}
+
+	// Replacing the files rotates the certificate for new connections.
+	// The sleep makes sure the modification time changes.
+	time.Sleep(50 * time.Millisecond)
+	issueCert(t, "server-2", ca).write(t, dir, "server")
+	raw, err := tls.Dial("tcp", lis.Addr().String(), clientTLS)
+	if err != nil {
+		t.Fatalf("tls dial after rotation: %v", err)
+	}
+	defer raw.Close()
+	if name := raw.ConnectionState().PeerCertificates[0].Subject.CommonName; name != "server-2" {
+		t.Fatalf("expected the rotated certificate, got %q", name)
+	}
+}
+
+func TestTLSReloaderUpdate(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "test-ca", nil)
+	cert1, key1 := issueCert(t, "server-1", ca).write(t, dir, "server-1")
+	cert2, key2 := issueCert(t, "server-2", ca).write(t, dir, "server-2")
+
+	r, err := tlsconfig.NewReloader(tlsconfig.ServerOptions{CertFile: cert1, KeyFile: key1})
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	config := r.Config()
+	servedName := func() string {
+		t.Helper()
+		served, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("GetConfigForClient: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(served.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if err := r.Update(tlsconfig.ServerOptions{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: key2}); err == nil {
+		t.Fatalf("expected an error for a missing certificate")
+	}
+	if name := servedName(); name != "server-1" {
+		t.Fatalf("expected a failed update to keep the old certificate, got %q", name)
+	}
+	if err := r.Update(tlsconfig.ServerOptions{CertFile: cert2, KeyFile: key2}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if name := servedName(); name != "server-2" {
+		t.Fatalf("expected the updated certificate, got %q", name)
+	}
+}
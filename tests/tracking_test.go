@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/store"
+	"github.com/oskarsmoczynski/Go-Key-Value-Store/pkg/tracking"
+)
+
+// Returns the messages waiting on the subscription.
+func pendingMessages(sub *tracking.Subscription) []tracking.Message {
+	var messages []tracking.Message
+	for {
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				return messages
+			}
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestTrackingTable(t *testing.T) {
+	table := tracking.NewTable(2)
+	a, b := table.Subscribe(), table.Subscribe()
+	if a.ID == 0 || a.ID == b.ID {
+		t.Fatalf("expected distinct IDs, got %d and %d", a.ID, b.ID)
+	}
+	if table.Track(a.ID+b.ID, "k") {
+		t.Fatalf("expected an unknown ID to be refused")
+	}
+
+	table.Track(a.ID, "k")
+	table.Track(b.ID, "k")
+	table.Observe(store.Change{Op: store.ChangeSet, Key: "k"})
+	table.Observe(store.Change{Op: store.ChangeSet, Key: "k"})
+	// Each read is told about one change only
+	for _, sub := range []*tracking.Subscription{a, b} {
+		if got := pendingMessages(sub); len(got) != 1 || got[0].Key != "k" {
+			t.Fatalf("expected one invalidation of k, got %+v", got)
+		}
+	}
+
+	// A full table makes room by invalidating a key
+	table.Track(a.ID, "x")
+	table.Track(a.ID, "y")
+	table.Track(a.ID, "z")
+	if got := pendingMessages(a); len(got) != 1 || got[0].Key == "z" || table.Stats().Keys != 2 {
+		t.Fatalf("expected one key invalidated to make room, got %+v, %+v", got, table.Stats())
+	}
+
+	table.InvalidateAll()
+	if got := pendingMessages(b); len(got) != 1 || !got[0].All {
+		t.Fatalf("expected an invalidation of all keys, got %+v", got)
+	}
+	table.Unsubscribe(b)
+	if st := table.Stats(); st.Subscriptions != 1 || st.Keys != 0 {
+		t.Fatalf("expected one subscription left and no keys, got %+v", st)
+	}
+}
+
+func TestTrackingDropsSlowSubscribers(t *testing.T) {
+	table := tracking.NewTable(0)
+	sub := table.Subscribe()
+	for range tracking.DefaultBacklog + 1 {
+		table.Track(sub.ID, "k")
+		table.Invalidate("k")
+	}
+	if got := pendingMessages(sub); len(got) != tracking.DefaultBacklog {
+		t.Fatalf("expected %d invalidations before the drop, got %d", tracking.DefaultBacklog, len(got))
+	}
+	if sub.Err() != tracking.ErrTooSlow || table.Track(sub.ID, "k") {
+		t.Fatalf("expected the subscription dropped, got %v", sub.Err())
+	}
+	if st := table.Stats(); st.Subscriptions != 0 || st.Dropped != 1 {
+		t.Fatalf("expected one dropped subscription, got %+v", st)
+	}
+}